@@ -0,0 +1,155 @@
+package antivirus
+
+import (
+	"backend/internal/config"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// chunkSize : taille des blocs envoyés à clamd (INSTREAM)
+const chunkSize = 64 * 1024
+
+// Clamd parle le protocole de clamd (commande INSTREAM) en TCP ou par socket unix
+type Clamd struct {
+	network string // tcp ou unix
+	address string
+	timeout time.Duration
+}
+
+// NewClamd instancie le client à partir de CLAMD_ADDRESS (tcp://hôte:port ou unix:///chemin)
+func NewClamd(cfg config.AntivirusConfig) (*Clamd, error) {
+	u, err := url.Parse(cfg.ClamdAddress)
+	if err != nil {
+		return nil, fmt.Errorf("CLAMD_ADDRESS invalide : %w", err)
+	}
+	c := &Clamd{network: u.Scheme, timeout: cfg.Timeout}
+	switch u.Scheme {
+	case "tcp":
+		c.address = u.Host
+	case "unix":
+		c.address = u.Path
+	default:
+		return nil, fmt.Errorf("CLAMD_ADDRESS invalide : %q (tcp://hôte:port ou unix:///chemin)", cfg.ClamdAddress)
+	}
+	if c.address == "" {
+		return nil, fmt.Errorf("CLAMD_ADDRESS invalide : %q", cfg.ClamdAddress)
+	}
+	return c, nil
+}
+
+// dial ouvre une connexion dont l'échéance est la plus proche entre ctx et le timeout configuré
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrScanFailed, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// Ping vérifie que clamd répond
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("%w : %v", ErrScanFailed, err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w : réponse inattendue %q", ErrScanFailed, reply)
+	}
+	return nil
+}
+
+// Scan envoie le flux par blocs préfixés de leur taille (uint32 big-endian), terminés par un bloc vide
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Verdict, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer conn.Close()
+
+	writeErr := c.stream(conn, r)
+	// clamd coupe l'envoi dès que StreamMaxLength est atteint : sa réponse explique pourquoi
+	reply, err := readReply(conn)
+	if err != nil {
+		if writeErr != nil {
+			return Verdict{}, writeErr
+		}
+		return Verdict{}, err
+	}
+	return parseReply(reply)
+}
+
+func (c *Clamd) stream(conn net.Conn, r io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("%w : %v", ErrScanFailed, err)
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("%w : %v", ErrScanFailed, werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			// Erreur de lecture de la source (stockage) : pas imputable à clamd
+			return err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("%w : %v", ErrScanFailed, err)
+	}
+	return nil
+}
+
+// readReply lit une réponse terminée par un octet nul (commandes préfixées par "z")
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("%w : %v", ErrScanFailed, err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+// parseReply interprète "stream: OK", "stream: <menace> FOUND" ou "<message> ERROR"
+func parseReply(reply string) (Verdict, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Verdict{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Verdict{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return Verdict{}, fmt.Errorf("%w : %s", ErrTooLarge, reply)
+	default:
+		return Verdict{}, fmt.Errorf("%w : %s", ErrScanFailed, reply)
+	}
+}
@@ -0,0 +1,65 @@
+package antivirus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrScanFailed : l'antivirus n'a pas pu rendre de verdict (réessayable)
+	ErrScanFailed = errors.New("analyse antivirus impossible")
+	// ErrTooLarge : fichier au-delà de la taille acceptée par l'antivirus (StreamMaxLength pour clamd)
+	ErrTooLarge = errors.New("fichier trop volumineux pour l'antivirus")
+)
+
+// Verdict : résultat de l'analyse d'un fichier
+type Verdict struct {
+	Infected  bool
+	Signature string // Nom de la menace détectée (ex: "Eicar-Test-Signature")
+}
+
+// Scanner analyse un flux avant qu'un upload ne devienne visible
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Verdict, error)
+}
+
+// Noop déclare tous les fichiers sains (développement, tests)
+type Noop struct{}
+
+// Scan lit le flux sans l'analyser
+func (Noop) Scan(ctx context.Context, r io.Reader) (Verdict, error) {
+	_, err := io.Copy(io.Discard, r)
+	return Verdict{}, err
+}
+
+// Fake signale les fichiers contenant une des signatures (motif -> nom de la menace) et garde la trace des analyses
+type Fake struct {
+	Signatures map[string]string
+	Err        error // Erreur retournée à chaque analyse (antivirus injoignable)
+
+	mu      sync.Mutex
+	Scanned int
+}
+
+// Scan cherche les motifs dans le contenu
+func (f *Fake) Scan(ctx context.Context, r io.Reader) (Verdict, error) {
+	f.mu.Lock()
+	f.Scanned++
+	f.mu.Unlock()
+	if f.Err != nil {
+		return Verdict{}, f.Err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Verdict{}, err
+	}
+	for pattern, name := range f.Signatures {
+		if strings.Contains(string(data), pattern) {
+			return Verdict{Infected: true, Signature: name}, nil
+		}
+	}
+	return Verdict{}, nil
+}
@@ -0,0 +1,325 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"gorm.io/gorm"
+
+	"backend/internal/antivirus"
+	"backend/internal/auth"
+	"backend/internal/comment"
+	"backend/internal/config"
+	"backend/internal/jobs"
+	"backend/internal/like"
+	"backend/internal/mailer"
+	"backend/internal/media"
+	"backend/internal/mediaproc"
+	"backend/internal/message"
+	"backend/internal/payment"
+	"backend/internal/post"
+	"backend/internal/ratelimit"
+	"backend/internal/realtime"
+	"backend/internal/storage"
+	"backend/internal/subscription"
+	"backend/internal/upload"
+	"backend/internal/user"
+)
+
+// App regroupe le routeur HTTP et les tâches de fond démarrées par New (workers de jobs, purge des uploads, hub temps réel),
+// qui s'arrêtent avec Close.
+type App struct {
+	Router *gin.Engine
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// goRun lance une tâche de fond arrêtée par Close
+func (a *App) goRun(run func(ctx context.Context)) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		run(a.ctx)
+	}()
+}
+
+// Close arrête les tâches de fond et attend leur fin (jobs en cours compris)
+func (a *App) Close() {
+	a.cancel()
+	a.wg.Wait()
+}
+
+// New construit tous les repositories, services et handlers à partir de la connexion
+// et de la configuration fournies, et retourne l'application prête à servir.
+// Les tests peuvent ainsi monter l'API complète sur une base (ou un schéma) isolée, puis l'arrêter avec Close.
+func New(cfg *config.Config, gdb *gorm.DB) (*App, error) {
+	// 🚦 Rate limiting (mémoire par défaut, Redis pour partager l'état entre instances)
+	store, err := ratelimit.NewStore(cfg.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("rate limiting : %w", err)
+	}
+	limiter := ratelimit.New(store)
+
+	// 📡 Diffusion des événements temps réel (mémoire par défaut, LISTEN/NOTIFY pour plusieurs instances)
+	pubsub, err := newPubSub(cfg.Realtime, gdb)
+	if err != nil {
+		return nil, fmt.Errorf("temps réel : %w", err)
+	}
+
+	// 🔐 Auth (JWT, sessions, OAuth, emails)
+	authService := auth.NewService(cfg, gdb, mailer.New(cfg.Mail))
+
+	// 🗄️ Stockage des fichiers (disque local ou bucket S3-compatible)
+	blobs, err := storage.New(cfg.Storage, cfg.Server.PublicBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("stockage : %w", err)
+	}
+	// Fichiers dédupliqués : clé réservée du dépôt à la création du média (pas d'effacement concurrent)
+	claims := media.NewClaimer(gdb, blobs)
+
+	// ⚙️ Workers de la file de jobs (JOB_WORKERS=0 : jobs traités par `worker` uniquement)
+	queue := jobs.NewQueue(gdb)
+	worker, err := NewWorker(cfg, gdb)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &App{ctx: ctx, cancel: cancel}
+	a.goRun(worker.Run)
+
+	// Initialiser Stripe
+	payment.InitStripe(cfg.Stripe)
+
+	r := gin.Default()
+	// X-Forwarded-For n'est cru que des proxies déclarés : sinon chaque client choisirait sa clé de rate limiting
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		a.Close()
+		return nil, fmt.Errorf("TRUSTED_PROXIES : %w", err)
+	}
+
+	// Middleware CORS (doit être avant les routes)
+	r.Use(func(c *gin.Context) {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+		c.Next()
+	})
+
+	// Page d'accueil simple
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "Bienvenue sur ThinkShare API",
+			"version": "1.0.0",
+			"endpoints": gin.H{
+				"auth": []string{"/register", "/login", "/auth/refresh", "/auth/verify-email", "/auth/password/forgot", "/auth/providers"},
+				"api":  []string{"/api/posts", "/api/comments", "/api/profile"},
+				"docs": "/swagger/index.html",
+			},
+		})
+	})
+
+	// Swagger
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// 🔐 Auth routes (registration, login, OAuth)
+	authService.RegisterRoutes(r, limiter)
+
+	// 🔧 Routes de debug (seulement en mode développement)
+	if !cfg.IsRelease() {
+		r.GET("/debug/mode", func(c *gin.Context) {
+			c.JSON(200, gin.H{
+				"mode":         gin.Mode(),
+				"env_gin_mode": cfg.Server.GinMode,
+				"is_debug":     gin.Mode() != gin.ReleaseMode,
+				"server_time":  time.Now().Format(time.RFC3339),
+			})
+		})
+		// Route pour tester l'authentification
+		r.GET("/api/test-auth", authService.AuthMiddleware(), func(c *gin.Context) {
+			userID := c.GetInt("user_id")
+			c.JSON(200, gin.H{
+				"message": "Authentification réussie",
+				"user_id": userID,
+				"role":    c.GetString("role"),
+				"time":    time.Now().Format(time.RFC3339),
+			})
+		})
+		log.Printf("🔧 Routes de debug activées (mode développement)")
+	}
+
+	// Route publique pour le webhook Stripe (avant les routes protégées)
+	r.POST("/api/payment/webhook", payment.StripeWebhookHandler(gdb, cfg.Stripe))
+
+	// Repositories partagés
+	userRepo := user.NewRepository(gdb)
+	postRepo := post.NewRepository(gdb)
+	messageRepo := message.NewRepository(gdb)
+
+	// 🖼️ Médias des posts : URLs signées liées au lecteur, accès revérifié à chaque téléchargement
+	mediaSigner := post.NewMediaURLSigner(cfg.Server.PublicBaseURL, []byte(cfg.Storage.SigningSecret), cfg.Storage.URLTTL)
+	postService := post.NewService(postRepo, mediaSigner, messageRepo)
+	postHandler := post.NewHandler(postService, blobs, mediaSigner, claims)
+	postHandler.RegisterMediaRoutes(r)
+
+	// 🔐 Routes API protégées
+	api := r.Group("/api", authService.AuthMiddleware())
+	{
+		// 👤 Routes utilisateur
+		userService := user.NewService(userRepo)
+		userHandler := user.NewHandler(userService)
+		api.GET("/profile", userHandler.GetProfile)
+		api.PUT("/profile", authService.RequireMFAEnrollment(), userHandler.UpdateProfile)
+		api.GET("/users/:id", userHandler.GetUserProfile)
+
+		// 🚫 Confidentialité : qui peut écrire en privé, liste de blocage (messages, commentaires, profil)
+		api.GET("/profile/privacy", userHandler.GetPrivacy)
+		api.PUT("/profile/privacy", userHandler.UpdatePrivacy)
+		api.GET("/profile/blocks", userHandler.ListBlocked)
+		api.POST("/users/:id/block", userHandler.BlockUser)
+		api.DELETE("/users/:id/block", userHandler.UnblockUser)
+
+		// 💳 Routes abonnement (gratuit, payant via Stripe)
+		subscriptionHandler := subscription.NewHandler(gdb, userRepo, cfg.Stripe)
+		api.POST("/subscribe", subscriptionHandler.Subscribe)
+		api.POST("/subscribe/paid", authService.RequireVerifiedEmail(), subscriptionHandler.SubscribePaidStripe) // Crée une session Stripe pour abonnement
+
+		api.POST("/unsubscribe", subscriptionHandler.Unsubscribe)
+		api.GET("/followers/:id", subscriptionHandler.GetFollowersByUser)
+		api.GET("/subscriptions", subscriptionHandler.GetMySubscriptions)
+
+		// 🛡️ Routes d'administration
+		admin := api.Group("/admin", auth.RequireRole(user.RoleAdmin))
+		admin.PUT("/users/:id/role", userHandler.UpdateUserRole)
+
+		// 🛡️ Routes de modération (modérateurs et admins) : suppression de contenus quel que soit l'auteur
+		moderation := api.Group("/moderation", auth.RequireRole(user.RoleModerator))
+
+		// ⚙️ État des jobs (dead-letter et relance réservées aux admins)
+		jobs.NewHandler(queue).RegisterRoutes(api, admin)
+
+		// 📝 Routes posts (publication réservée aux créateurs)
+		postHandler.RegisterRoutes(api, authService.RequireVerifiedEmail(), authService.RequireMFAEnrollment())
+		moderation.DELETE("/posts/:id", postHandler.ModeratePost)
+
+		// 🖼️ API des médias : modification réservée à leur auteur, lecture soumise à l'accès au post,
+		// nettoyage du stockage (admin) exécuté par les workers
+		mediaService := media.NewService(media.NewRepository(gdb), blobs)
+		media.NewHandler(mediaService, postService, queue).RegisterRoutes(api)
+
+		// 📤 Uploads reprenables (gros fichiers envoyés par fragments, puis rattachés à un post via media_ids)
+		uploadService := upload.NewService(upload.NewRepository(gdb), blobs, claims, cfg.Storage.UploadExpiry)
+		upload.NewHandler(uploadService).RegisterRoutes(api, authService.RequireVerifiedEmail(), authService.RequireMFAEnrollment())
+		a.goRun(func(ctx context.Context) { upload.RunJanitor(ctx, uploadService, 15*time.Minute) })
+
+		// 💬 Routes commentaires
+		commentRepo := comment.NewRepository(gdb)
+		commentService := comment.NewService(commentRepo, postRepo, userRepo)
+		commentHandler := comment.NewHandler(commentService)
+		commentHandler.RegisterRoutes(api, limiter.Throttle(ratelimit.Policy{Name: "comments", Limit: 20, Window: time.Minute}, ratelimit.ByUser))
+		moderation.DELETE("/comments/:id", commentHandler.ModerateComment)
+
+		// 💖 Routes likes
+		likeRepo := like.NewRepository(gdb)
+		likeService := like.NewService(likeRepo, postRepo)
+		likeHandler := like.NewHandler(likeService)
+		likeHandler.RegisterRoutes(api)
+
+		// 📩 Routes messagerie (privée et groupes), poussée en temps réel (WebSocket) ; la présence est partagée avec les correspondants.
+		// Les pièces jointes sont des médias : mêmes contrôles, antivirus et URLs signées que ceux des posts.
+		// Réglage des messages privés, demandes de messages et blocage : userService
+		hub := realtime.NewHub(pubsub, messageRepo.GetContactIDs)
+		a.goRun(hub.Run)
+		attachments := message.NewAttachments(blobs, claims, post.NewMessageAttachments(media.NewRepository(gdb), mediaSigner))
+		messageService := message.NewService(messageRepo, gdb, hub, postService, attachments, userService)
+		messageHandler := message.NewHandler(messageService)
+		messageHandler.RegisterRoutes(api, limiter.Throttle(ratelimit.Policy{Name: "messages", Limit: 30, Window: time.Minute}, ratelimit.ByUser))
+		realtime.NewHandler(hub, authService.IsSessionActive, cfg.Server.FrontendURL).RegisterRoutes(api)
+
+		log.Printf("✅ Routes API protégées configurées")
+	}
+
+	// Endpoint pour les métriques Prometheus (toujours accessible)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Le driver local sert lui-même ses URLs signées (cible des redirections de /media/:id) ;
+	// avec S3 elles pointent directement vers le bucket
+	if h, ok := blobs.(http.Handler); ok {
+		r.GET(storage.LocalURLPrefix+"*key", gin.WrapH(h))
+		r.HEAD(storage.LocalURLPrefix+"*key", gin.WrapH(h))
+	}
+
+	a.Router = r
+	return a, nil
+}
+
+// newPubSub choisit le transport des événements temps réel
+func newPubSub(cfg config.RealtimeConfig, gdb *gorm.DB) (realtime.PubSub, error) {
+	if cfg.PubSub != "postgres" {
+		log.Printf("📡 Événements temps réel diffusés en mémoire (une seule instance)")
+		return realtime.NewLocal(), nil
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("📡 Événements temps réel diffusés par PostgreSQL LISTEN/NOTIFY")
+	return realtime.NewPostgres(sqlDB), nil
+}
+
+// NewWorker construit le pool de workers et y enregistre les handlers de jobs ;
+// utilisé par le serveur HTTP et par la sous-commande `worker`.
+func NewWorker(cfg *config.Config, gdb *gorm.DB) (*jobs.Worker, error) {
+	blobs, err := storage.New(cfg.Storage, cfg.Server.PublicBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("stockage : %w", err)
+	}
+	// ffmpeg, pdftoppm et clamd ne sont requis que là où des jobs sont exécutés
+	var opts []mediaproc.Option
+	if cfg.Jobs.Workers > 0 && cfg.Video.Transcode {
+		transcoder, err := mediaproc.NewTranscoder(mediaproc.ExecRunner{}, cfg.Video)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mediaproc.WithTranscoder(transcoder))
+	}
+	if cfg.Jobs.Workers > 0 && cfg.Documents.Preview {
+		renderer, err := mediaproc.NewPDFRenderer(mediaproc.ExecRunner{}, cfg.Documents.PdftoppmPath)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mediaproc.WithPDFRenderer(renderer))
+	}
+	if cfg.Jobs.Workers > 0 && cfg.Antivirus.ClamdAddress != "" {
+		clamd, err := antivirus.NewClamd(cfg.Antivirus)
+		if err != nil {
+			return nil, err
+		}
+		// clamd peut démarrer après l'API (chargement des signatures) : les jobs seront réessayés
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := clamd.Ping(ctx); err != nil {
+			log.Printf("⚠️ clamd injoignable (%s) : %v", cfg.Antivirus.ClamdAddress, err)
+		} else {
+			log.Printf("🛡️ Analyse antivirus des uploads via clamd (%s)", cfg.Antivirus.ClamdAddress)
+		}
+		cancel()
+		opts = append(opts, mediaproc.WithScanner(clamd))
+	}
+	worker := jobs.NewWorker(jobs.NewQueue(gdb), cfg.Jobs)
+	mediaproc.NewProcessor(media.NewRepository(gdb), blobs, media.NewClaimer(gdb, blobs), opts...).Register(worker)
+	return worker, nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Durées de validité des tokens à usage unique
+const (
+	EmailVerifyTokenTTL   = 48 * time.Hour
+	PasswordResetTokenTTL = 1 * time.Hour
+)
+
+var ErrInvalidActionToken = errors.New("lien invalide, expiré ou déjà utilisé")
+
+// CreateActionToken émet un token signé, expirant et à usage unique pour un usage donné.
+// Le token est un JWT (signature + expiration) dont l'identifiant (jti) est enregistré
+// en base pour garantir l'usage unique. Les tokens précédents du même usage sont invalidés.
+func (s *Service) CreateActionToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	jti := uuid.New().String()
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&AuthToken{}).
+			Where("user_id = ? AND purpose = ? AND revoked_at IS NULL", userID, purpose).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&AuthToken{
+			UserID:    userID,
+			Token:     hashToken(jti),
+			Purpose:   purpose,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": purpose, // Empêche d'utiliser un token pour un autre usage (ou comme token d'accès)
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	}
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// parseActionToken vérifie la signature, l'expiration et l'usage d'un token ; retourne son jti
+func (s *Service) parseActionToken(tokenStr, purpose string) (string, error) {
+	token, err := jwt.Parse(tokenStr, s.keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return "", ErrInvalidActionToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidActionToken
+	}
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return "", ErrInvalidActionToken
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", ErrInvalidActionToken
+	}
+	return jti, nil
+}
+
+// ValidateActionToken vérifie un token à usage unique sans le consommer.
+// Retourne l'ID de l'utilisateur concerné.
+func (s *Service) ValidateActionToken(tokenStr, purpose string) (uint, error) {
+	jti, err := s.parseActionToken(tokenStr, purpose)
+	if err != nil {
+		return 0, err
+	}
+
+	var row AuthToken
+	err = s.db.
+		Where("token = ? AND purpose = ? AND revoked_at IS NULL AND expires_at > ?", hashToken(jti), purpose, time.Now()).
+		First(&row).Error
+	if err != nil {
+		return 0, ErrInvalidActionToken
+	}
+	return row.UserID, nil
+}
+
+// ConsumeActionToken vérifie un token à usage unique et le marque comme utilisé.
+// Retourne l'ID de l'utilisateur concerné.
+func (s *Service) ConsumeActionToken(tokenStr, purpose string) (uint, error) {
+	jti, err := s.parseActionToken(tokenStr, purpose)
+	if err != nil {
+		return 0, err
+	}
+
+	var userID uint
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var row AuthToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token = ? AND purpose = ?", hashToken(jti), purpose).
+			First(&row).Error
+		if err != nil {
+			return ErrInvalidActionToken
+		}
+
+		now := time.Now()
+		if row.RevokedAt != nil || now.After(row.ExpiresAt) {
+			return ErrInvalidActionToken
+		}
+		if err := tx.Model(&row).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		userID = row.UserID
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
@@ -1,48 +1,78 @@
 package auth
 
 import (
-	"backend/internal/db"
+	"backend/internal/ratelimit"
 	"backend/internal/user"
+	"errors"
+	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/google"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func InitGoth() {
-	goth.UseProviders(
-		google.New(
-			os.Getenv("GOOGLE_KEY"),
-			os.Getenv("GOOGLE_SECRET"),
-			"http://localhost:8080/auth/google/callback",
-		),
-	)
-}
-
-func ProviderMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		provider := c.Param("provider")
-		if provider != "" {
-			// Ajoute le provider à la query string pour gothic
-			q := c.Request.URL.Query()
-			q.Set("provider", provider)
-			c.Request.URL.RawQuery = q.Encode()
-		}
-		c.Next()
+// Limites appliquées aux routes d'authentification
+var (
+	registerPolicy       = ratelimit.Policy{Name: "register", Limit: 5, Window: time.Hour}
+	passwordForgotPolicy = ratelimit.Policy{Name: "password_forgot", Limit: 3, Window: time.Hour}
+	verifyRequestPolicy  = ratelimit.Policy{Name: "verify_email", Limit: 3, Window: time.Hour}
+	// Codes 2FA : échecs comptés par compte (login en deux étapes et gestion de la 2FA), en plus de l'IP au login
+	mfaLoginPolicy = ratelimit.BackoffPolicy{
+		Name:             "mfa",
+		FreeAttempts:     3,
+		BaseDelay:        2 * time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  30 * time.Minute,
+		FailureWindow:    time.Hour,
 	}
-}
+	// Gestion de la 2FA (session ouverte) : un mauvais code répond 400, même compteur par compte que le login
+	mfaManagePolicy = func() ratelimit.BackoffPolicy {
+		p := mfaLoginPolicy
+		p.FailureStatus = http.StatusBadRequest
+		return p
+	}()
+)
 
-func RegisterRoutes(r *gin.Engine) {
-	r.POST("/register", Register)
-	r.POST("/login", Login)
-	r.GET("/auth/:provider", ProviderMiddleware(), BeginAuthHandler)
-	r.GET("/auth/:provider/callback", ProviderMiddleware(), CallbackHandler)
-	r.GET("/logout", LogoutHandler)
+func (s *Service) RegisterRoutes(r *gin.Engine, limiter *ratelimit.Limiter) {
+	r.POST("/register", limiter.Throttle(registerPolicy, ratelimit.ByIP), s.Register)
+	r.POST("/login", limiter.Backoff(ratelimit.DefaultLoginPolicy, ratelimit.ByIP, ratelimit.ByEmail), s.Login)
+
+	// OAuth / OpenID Connect (Apple renvoie le callback en POST)
+	r.GET("/auth/providers", s.ListProvidersHandler)
+	r.GET("/auth/:provider", s.BeginAuthHandler)
+	r.GET("/auth/:provider/callback", s.CallbackHandler)
+	r.POST("/auth/:provider/callback", s.CallbackHandler)
+	r.POST("/auth/token", s.TokenExchangeHandler)
+	r.GET("/logout", s.LogoutHandler)
+
+	// Sessions : rotation du refresh token et révocation côté serveur
+	r.POST("/auth/refresh", s.RefreshHandler)
+	r.POST("/auth/logout", s.AuthMiddleware(), s.LogoutSessionHandler)
+	r.POST("/auth/logout-all", s.AuthMiddleware(), s.LogoutAllHandler)
+
+	// Vérification d'email et mot de passe oublié (tokens à usage unique envoyés par email)
+	r.POST("/auth/verify-email", s.VerifyEmailHandler)
+	r.POST("/auth/verify-email/request", s.AuthMiddleware(), limiter.Throttle(verifyRequestPolicy, ratelimit.ByUser), s.RequestVerificationHandler)
+	r.POST("/auth/password/forgot", limiter.Throttle(passwordForgotPolicy, ratelimit.ByIP, ratelimit.ByEmail), s.ForgotPasswordHandler)
+	r.POST("/auth/password/reset", s.ResetPasswordHandler)
+
+	// Double authentification (TOTP)
+	r.POST("/auth/2fa/login", limiter.Backoff(mfaLoginPolicy, ratelimit.ByIP, s.byMFAChallenge), s.MFALoginHandler)
+	mfa := r.Group("/auth/2fa", s.AuthMiddleware())
+	mfa.POST("/enroll", s.TOTPEnrollHandler)
+	mfaCode := limiter.Backoff(mfaManagePolicy, ratelimit.ByUser)
+	mfa.POST("/verify", mfaCode, s.TOTPVerifyHandler)
+	mfa.POST("/disable", mfaCode, s.TOTPDisableHandler)
+	mfa.POST("/recovery-codes", mfaCode, s.RecoveryCodesHandler)
+
+	// Identités externes liées au compte
+	identities := r.Group("/api/profile/identities", s.AuthMiddleware())
+	identities.GET("", s.ListIdentitiesHandler)
+	identities.POST("/:provider/link", s.LinkIdentityHandler)
+	identities.POST("/:provider/confirm", s.ConfirmLinkHandler)
+	identities.DELETE("/:provider", s.UnlinkIdentityHandler)
 }
 
 type RegisterInput struct {
@@ -62,7 +92,7 @@ type RegisterInput struct {
 // @Success 201 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Router /register [post]
-func Register(c *gin.Context) {
+func (s *Service) Register(c *gin.Context) {
 	var input RegisterInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -76,16 +106,21 @@ func Register(c *gin.Context) {
 		Username:     input.Username,
 		Email:        input.Email,
 		PasswordHash: string(hashed),
-		Role:         "user",
+		Role:         user.RoleUser,
 		CreatedAt:    time.Now(),
 	}
 
-	if err := db.GormDB.Create(&u).Error; err != nil {
+	if err := s.db.Create(&u).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email, username, name ou firstname déjà utilisé"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Utilisateur inscrit avec succès"})
+	// L'inscription reste valide même si l'email ne part pas : il pourra être renvoyé
+	if err := s.SendVerificationEmail(&u); err != nil {
+		log.Printf("❌ Erreur envoi email de vérification (user=%d) : %v", u.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Utilisateur inscrit avec succès, vérifiez votre adresse email"})
 }
 
 type LoginInput struct {
@@ -99,11 +134,11 @@ type LoginInput struct {
 // @Accept json
 // @Produce json
 // @Param input body LoginInput true "Identifiants de connexion"
-// @Success 200 {object} TokenResponse
+// @Success 200 {object} TokenResponse "ou MFAChallengeResponse si la 2FA est active"
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Router /login [post]
-func Login(c *gin.Context) {
+func (s *Service) Login(c *gin.Context) {
 	var input LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -111,7 +146,7 @@ func Login(c *gin.Context) {
 	}
 
 	var u user.User
-	if err := db.GormDB.Where("email = ?", input.Email).First(&u).Error; err != nil {
+	if err := s.db.Where("email = ?", input.Email).First(&u).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "email ou mot de passe invalide"})
 		return
 	}
@@ -121,69 +156,77 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token, err := GenerateJWT(int(u.ID))
+	// Si la 2FA est active, un challenge est renvoyé à la place des tokens
+	resp, err := s.startLogin(&u)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la génération du token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, TokenResponse{
-		Token:  token,
-		UserID: u.ID,
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
-// BeginAuthHandler godoc
-// @Summary Début de l'authentification Google OAuth
+// RefreshHandler godoc
+// @Summary Renouvelle le token d'accès à partir d'un refresh token (rotation)
 // @Tags Auth
+// @Accept json
 // @Produce json
-// @Param provider path string true "google"
-// @Success 302 {string} string "Redirection vers Google"
-// @Router /auth/{provider} [get]
-func BeginAuthHandler(c *gin.Context) {
-	provider := c.Param("provider")
-	if provider != "google" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider not supported"})
+// @Param input body RefreshInput true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/refresh [post]
+func (s *Service) RefreshHandler(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := s.RefreshSession(input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors du renouvellement du token"})
 		return
 	}
-	gothic.BeginAuthHandler(c.Writer, c.Request)
+
+	c.JSON(http.StatusOK, tokens)
 }
 
-// CallbackHandler godoc
-// @Summary Callback OAuth Google
+// LogoutSessionHandler godoc
+// @Summary Révoque la session courante
 // @Tags Auth
+// @Security BearerAuth
 // @Produce json
-// @Param provider path string true "google"
-// @Success 200 {object} user.User
-// @Router /auth/{provider}/callback [get]
-func CallbackHandler(c *gin.Context) {
-	provider := c.Param("provider")
-	if provider != "google" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider not supported"})
-		return
-	}
-	gUser, err := gothic.CompleteUserAuth(c.Writer, c.Request)
-	if err != nil {
-		c.Redirect(http.StatusTemporaryRedirect, "/")
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/logout [post]
+func (s *Service) LogoutSessionHandler(c *gin.Context) {
+	if err := s.RevokeSession(c.GetString("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la déconnexion"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session révoquée"})
+}
 
-	var u user.User
-	result := db.GormDB.Where("email = ?", gUser.Email).First(&u)
-	if result.Error != nil {
-		// Inscription via Google
-		u = user.User{
-			Username:     gUser.NickName,
-			Email:        gUser.Email,
-			PasswordHash: "",
-			Role:         "google",
-			CreatedAt:    time.Now(),
-		}
-		db.GormDB.Create(&u)
+// LogoutAllHandler godoc
+// @Summary Révoque toutes les sessions de l'utilisateur (tous les appareils)
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/logout-all [post]
+func (s *Service) LogoutAllHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if err := s.RevokeAllSessions(uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la déconnexion"})
+		return
 	}
-
-	// Redirige vers la documentation Swagger après authentification
-	c.Redirect(http.StatusTemporaryRedirect, "http://localhost:8080/swagger/index.html")
+	c.JSON(http.StatusOK, gin.H{"message": "Toutes les sessions ont été révoquées"})
 }
 
 // LogoutHandler godoc
@@ -192,7 +235,7 @@ func CallbackHandler(c *gin.Context) {
 // @Produce json
 // @Success 302 {string} string "Redirect vers /"
 // @Router /logout [get]
-func LogoutHandler(c *gin.Context) {
-	gothic.Logout(c.Writer, c.Request)
+func (s *Service) LogoutHandler(c *gin.Context) {
+	s.clearOAuthSession(c)
 	c.Redirect(http.StatusTemporaryRedirect, "/")
 }
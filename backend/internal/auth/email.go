@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"backend/internal/mailer"
+	"backend/internal/user"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// FrontendBaseURL retourne l'URL de l'application cliente
+func (s *Service) FrontendBaseURL() string {
+	return s.cfg.Server.FrontendURL
+}
+
+// frontendURL construit un lien vers le front avec le token en paramètre
+func (s *Service) frontendURL(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", s.FrontendBaseURL(), path, url.QueryEscape(token))
+}
+
+// SendVerificationEmail envoie un lien de vérification d'adresse email
+func (s *Service) SendVerificationEmail(u *user.User) error {
+	token, err := s.CreateActionToken(u.ID, PurposeEmailVerify, EmailVerifyTokenTTL)
+	if err != nil {
+		return err
+	}
+	return s.mail.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "ThinkShare - Confirmez votre adresse email",
+		Body: fmt.Sprintf("Bonjour %s,\n\nConfirmez votre adresse email en ouvrant ce lien (valable %d heures) :\n%s\n\nSi vous n'êtes pas à l'origine de cette inscription, ignorez cet email.\n",
+			u.Username, int(EmailVerifyTokenTTL.Hours()), s.frontendURL("/verify-email", token)),
+	})
+}
+
+// SendPasswordResetEmail envoie un lien de réinitialisation du mot de passe
+func (s *Service) SendPasswordResetEmail(u *user.User) error {
+	token, err := s.CreateActionToken(u.ID, PurposePasswordReset, PasswordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	return s.mail.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "ThinkShare - Réinitialisation de votre mot de passe",
+		Body: fmt.Sprintf("Bonjour %s,\n\nPour choisir un nouveau mot de passe, ouvrez ce lien (valable %d minutes) :\n%s\n\nSi vous n'avez rien demandé, ignorez cet email : votre mot de passe reste inchangé.\n",
+			u.Username, int(PasswordResetTokenTTL.Minutes()), s.frontendURL("/reset-password", token)),
+	})
+}
+
+// RequireVerifiedEmail bloque les utilisateurs dont l'email n'est pas vérifié.
+// À placer après AuthMiddleware.
+func (s *Service) RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u user.User
+		if err := s.db.Select("id", "email_verified").First(&u, c.GetInt("user_id")).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "utilisateur introuvable"})
+			return
+		}
+		if !u.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequestVerificationHandler godoc
+// @Summary Renvoie l'email de vérification de l'adresse
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/verify-email/request [post]
+func (s *Service) RequestVerificationHandler(c *gin.Context) {
+	var u user.User
+	if err := s.db.First(&u, c.GetInt("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "utilisateur introuvable"})
+		return
+	}
+	if u.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "Adresse email déjà vérifiée"})
+		return
+	}
+	if err := s.SendVerificationEmail(&u); err != nil {
+		log.Printf("❌ Erreur envoi email de vérification (user=%d) : %v", u.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de l'envoi de l'email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email de vérification envoyé"})
+}
+
+// VerifyEmailHandler godoc
+// @Summary Confirme l'adresse email à partir du token reçu par email
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body VerifyEmailInput true "Token de vérification"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/verify-email [post]
+func (s *Service) VerifyEmailHandler(c *gin.Context) {
+	var input VerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := s.ConsumeActionToken(input.Token, PurposeEmailVerify)
+	if err != nil {
+		if errors.Is(err, ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la vérification"})
+		return
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&user.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"email_verified": true, "email_verified_at": now}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la vérification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Adresse email vérifiée"})
+}
+
+// ForgotPasswordHandler godoc
+// @Summary Demande un lien de réinitialisation du mot de passe
+// @Description Répond toujours 200 pour ne pas révéler si l'email existe
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body EmailInput true "Adresse email du compte"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/password/forgot [post]
+func (s *Service) ForgotPasswordHandler(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u user.User
+	if err := s.db.Where("email = ?", input.Email).First(&u).Error; err == nil {
+		if err := s.SendPasswordResetEmail(&u); err != nil {
+			log.Printf("❌ Erreur envoi email de réinitialisation (user=%d) : %v", u.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Si un compte existe pour cette adresse, un email a été envoyé"})
+}
+
+// ResetPasswordHandler godoc
+// @Summary Définit un nouveau mot de passe à partir du token reçu par email
+// @Description Toutes les sessions ouvertes sont révoquées
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body ResetPasswordInput true "Token et nouveau mot de passe"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/password/reset [post]
+func (s *Service) ResetPasswordHandler(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := s.ConsumeActionToken(input.Token, PurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la réinitialisation"})
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la réinitialisation"})
+		return
+	}
+
+	var u user.User
+	if err := s.db.First(&u, userID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidActionToken.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{"password_hash": string(hashed)}
+	if !u.EmailVerified {
+		// Recevoir le lien prouve aussi la possession de l'adresse email
+		updates["email_verified"] = true
+		updates["email_verified_at"] = time.Now()
+	}
+	if err := s.db.Model(&u).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la réinitialisation"})
+		return
+	}
+
+	if err := s.RevokeAllSessions(userID); err != nil {
+		log.Printf("❌ Erreur révocation des sessions après reset (user=%d) : %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mot de passe réinitialisé, veuillez vous reconnecter"})
+}
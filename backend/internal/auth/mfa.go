@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"backend/internal/ratelimit"
+	"backend/internal/user"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	TOTPIssuer         = "ThinkShare"
+	MFAChallengeTTL    = 5 * time.Minute
+	RecoveryCodesCount = 10
+	recoveryCodeTTL    = 10 * 365 * 24 * time.Hour // Les codes de secours n'expirent pas en pratique
+	totpPeriod         = 30
+)
+
+var (
+	ErrInvalidMFACode   = errors.New("code de vérification invalide")
+	ErrMFANotEnrolled   = errors.New("aucune inscription 2FA en cours")
+	ErrMFAAlreadyActive = errors.New("la double authentification est déjà active")
+)
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Skew: 1, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// TOTPRequiredForPaidCreators indique si la politique impose la 2FA aux créateurs payants
+func (s *Service) TOTPRequiredForPaidCreators() bool {
+	return s.cfg.Auth.Require2FAForPaidCreators
+}
+
+// mfaEnrollmentRequired indique si la politique impose à cet utilisateur d'activer la 2FA
+func (s *Service) mfaEnrollmentRequired(u *user.User) bool {
+	return s.TOTPRequiredForPaidCreators() && u.MonthlyPrice > 0 && !u.TOTPEnabled
+}
+
+// RequireMFAEnrollment bloque les créateurs payants qui n'ont pas encore activé la 2FA
+// quand la politique l'exige. À placer après AuthMiddleware.
+func (s *Service) RequireMFAEnrollment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.TOTPRequiredForPaidCreators() {
+			c.Next()
+			return
+		}
+		var u user.User
+		if err := s.db.Select("id", "monthly_price", "totp_enabled").First(&u, c.GetInt("user_id")).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "utilisateur introuvable"})
+			return
+		}
+		if s.mfaEnrollmentRequired(&u) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "two-factor authentication required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateTOTP vérifie un code TOTP et refuse la réutilisation d'un pas de temps déjà accepté
+func (s *Service) validateTOTP(u *user.User, code string) error {
+	if u.TOTPSecret == "" {
+		return ErrMFANotEnrolled
+	}
+
+	now := time.Now()
+	for skew := -int64(totpOpts.Skew); skew <= int64(totpOpts.Skew); skew++ {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(u.TOTPSecret, t, totpOpts)
+		if err != nil {
+			return err
+		}
+		if expected != code {
+			continue
+		}
+
+		counter := t.Unix() / totpPeriod
+		result := s.db.Model(&user.User{}).
+			Where("id = ? AND totp_last_counter < ?", u.ID, counter).
+			Update("totp_last_counter", counter)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode // Code déjà utilisé
+		}
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// generateRecoveryCodes remplace les codes de secours de l'utilisateur (stockés hachés)
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	now := time.Now()
+	if err := tx.Model(&AuthToken{}).
+		Where("user_id = ? AND purpose = ? AND revoked_at IS NULL", userID, PurposeRecoveryCode).
+		Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodesCount)
+	for i := 0; i < RecoveryCodesCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))[:10]
+		code := raw[:5] + "-" + raw[5:]
+
+		if err := tx.Create(&AuthToken{
+			UserID:    userID,
+			Token:     hashToken(normalizeRecoveryCode(code)),
+			Purpose:   PurposeRecoveryCode,
+			ExpiresAt: now.Add(recoveryCodeTTL),
+		}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignore la casse, les espaces et les tirets saisis par l'utilisateur
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// useRecoveryCode consomme un code de secours de l'utilisateur
+func (s *Service) useRecoveryCode(userID uint, code string) error {
+	result := s.db.Model(&AuthToken{}).
+		Where("user_id = ? AND purpose = ? AND token = ? AND revoked_at IS NULL",
+			userID, PurposeRecoveryCode, hashToken(normalizeRecoveryCode(code))).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// verifySecondFactor accepte un code TOTP ou, à défaut, un code de secours
+func (s *Service) verifySecondFactor(u *user.User, code, recoveryCode string) error {
+	if code != "" {
+		return s.validateTOTP(u, code)
+	}
+	if recoveryCode != "" {
+		if err := s.useRecoveryCode(u.ID, recoveryCode); err != nil {
+			return err
+		}
+		log.Printf("🔐 Code de secours 2FA utilisé (user=%d)", u.ID)
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// byMFAChallenge limite /auth/2fa/login par compte challengé (mfa_token validé, clé "user:{id}" comme ByUser) :
+// un nouveau challenge, obtenu par un nouveau login, ne remet pas les échecs à zéro
+func (s *Service) byMFAChallenge(c *gin.Context) string {
+	userID, err := s.ValidateActionToken(ratelimit.JSONField(c, "mfa_token"), PurposeMFAChallenge)
+	if err != nil {
+		return ""
+	}
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// startLogin termine l'authentification primaire : tokens de session, ou challenge si la 2FA est active
+func (s *Service) startLogin(u *user.User) (interface{}, error) {
+	if u.TOTPEnabled {
+		token, err := s.CreateActionToken(u.ID, PurposeMFAChallenge, MFAChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    token,
+			ExpiresIn:   int64(MFAChallengeTTL.Seconds()),
+		}, nil
+	}
+	return s.IssueSession(u.ID)
+}
+
+// TOTPEnrollHandler godoc
+// @Summary Démarre l'activation de la 2FA (TOTP)
+// @Description Retourne le secret et l'URI otpauth:// à scanner ; la 2FA n'est active qu'après /auth/2fa/verify
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} TOTPEnrollResponse
+// @Failure 409 {object} map[string]string
+// @Router /auth/2fa/enroll [post]
+func (s *Service) TOTPEnrollHandler(c *gin.Context) {
+	u, err := s.users.GetByID(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrMFAAlreadyActive.Error()})
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTPIssuer, AccountName: u.Email, Period: totpPeriod})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la génération du secret"})
+		return
+	}
+	if err := s.db.Model(u).Updates(map[string]interface{}{"totp_secret": key.Secret(), "totp_last_counter": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de l'enregistrement du secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollResponse{Secret: key.Secret(), OTPAuthURL: key.URL()})
+}
+
+// TOTPVerifyHandler godoc
+// @Summary Confirme l'activation de la 2FA avec un premier code
+// @Description Retourne les codes de secours, affichés une seule fois
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body TOTPCodeInput true "Code TOTP"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /auth/2fa/verify [post]
+func (s *Service) TOTPVerifyHandler(c *gin.Context) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := s.users.GetByID(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrMFAAlreadyActive.Error()})
+		return
+	}
+	if err := s.validateTOTP(u, input.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(u).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = generateRecoveryCodes(tx, u.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de l'activation de la 2FA"})
+		return
+	}
+
+	log.Printf("🔐 2FA activée (user=%d)", u.ID)
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// TOTPDisableHandler godoc
+// @Summary Désactive la 2FA (code TOTP ou code de secours requis)
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body MFADisableInput true "Code TOTP ou code de secours"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /auth/2fa/disable [post]
+func (s *Service) TOTPDisableHandler(c *gin.Context) {
+	var input MFADisableInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := s.users.GetByID(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !u.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "la double authentification n'est pas active"})
+		return
+	}
+	if s.TOTPRequiredForPaidCreators() && u.MonthlyPrice > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "la double authentification est obligatoire pour les créateurs payants"})
+		return
+	}
+	if err := s.verifySecondFactor(u, input.Code, input.RecoveryCode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(u).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_counter": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&AuthToken{}).
+			Where("user_id = ? AND purpose = ? AND revoked_at IS NULL", u.ID, PurposeRecoveryCode).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la désactivation de la 2FA"})
+		return
+	}
+
+	log.Printf("🔓 2FA désactivée (user=%d)", u.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Double authentification désactivée"})
+}
+
+// RecoveryCodesHandler godoc
+// @Summary Régénère les codes de secours (les anciens deviennent invalides)
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body TOTPCodeInput true "Code TOTP"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Router /auth/2fa/recovery-codes [post]
+func (s *Service) RecoveryCodesHandler(c *gin.Context) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := s.users.GetByID(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !u.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "la double authentification n'est pas active"})
+		return
+	}
+	if err := s.validateTOTP(u, input.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = generateRecoveryCodes(tx, u.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la génération des codes"})
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// MFALoginHandler godoc
+// @Summary Seconde étape du login : échange le challenge et un code 2FA contre les tokens
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body MFALoginInput true "Challenge et code TOTP (ou code de secours)"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/2fa/login [post]
+func (s *Service) MFALoginHandler(c *gin.Context) {
+	var input MFALoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Le challenge n'est consommé qu'après un code valide, pour permettre une faute de frappe
+	userID, err := s.ValidateActionToken(input.MFAToken, PurposeMFAChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "challenge 2FA invalide ou expiré"})
+		return
+	}
+	u, err := s.users.GetByID(userID)
+	if err != nil || !u.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "challenge 2FA invalide ou expiré"})
+		return
+	}
+	if err := s.verifySecondFactor(u, input.Code, input.RecoveryCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.ConsumeActionToken(input.MFAToken, PurposeMFAChallenge); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "challenge 2FA invalide ou expiré"})
+		return
+	}
+
+	tokens, err := s.IssueSession(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la génération du token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"backend/internal/user"
 	"net/http"
 	"strings"
 
@@ -8,10 +9,13 @@ import (
 )
 
 // ✅ Middleware à appliquer sur les routes protégées
-func AuthMiddleware() gin.HandlerFunc {
+func (s *Service) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Récupère le header "Authorization: Bearer <token>"
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			authHeader = websocketBearer(c.Request)
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
 			c.Abort()
@@ -27,15 +31,67 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Vérifie et décode le token
-		userID, err := ParseJWT(parts[1])
+		claims, err := s.ParseJWT(parts[1])
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
 		}
 
-		// ✅ Injecte user_id dans le contexte pour le handler
-		c.Set("user_id", userID)
+		// Vérifie que la session n'a pas été révoquée (logout, vol de token...)
+		if !s.IsSessionActive(claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			c.Abort()
+			return
+		}
+
+		// ✅ Injecte user_id, session_id et role dans le contexte pour le handler
+		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("role", claims.Role)
 		c.Next()
 	}
 }
+
+// websocketBearer lit le token d'une connexion WebSocket ouverte par un navigateur, qui ne peut pas fixer
+// l'en-tête Authorization : new WebSocket(url, ["bearer", token]). Le token n'apparaît ainsi ni dans l'URL ni dans les logs.
+func websocketBearer(r *http.Request) string {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return ""
+	}
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(header, ",") {
+			protocols = append(protocols, strings.TrimSpace(p))
+		}
+	}
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == WebSocketProtocol {
+			return "Bearer " + protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// WebSocketProtocol : sous-protocole WebSocket suivi du token d'accès (voir websocketBearer)
+const WebSocketProtocol = "bearer"
+
+// RequireRole restreint une route aux rôles donnés (l'admin a toujours accès).
+// Doit être placé après AuthMiddleware, qui injecte le rôle issu du token.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if role == user.RoleAdmin {
+			c.Next()
+			return
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		c.Abort()
+	}
+}
@@ -4,11 +4,30 @@ import (
 	"time"
 )
 
+// Usages possibles d'un AuthToken
+const (
+	PurposeRefresh       = "refresh"         // Refresh token de session
+	PurposeEmailVerify   = "email_verify"    // Vérification de l'adresse email
+	PurposePasswordReset = "password_reset"  // Réinitialisation du mot de passe
+	PurposeOAuthLink     = "oauth_link"      // Liaison d'une identité externe à un compte existant
+	PurposeOAuthCode     = "oauth_code"      // Code d'autorisation échangé par l'app contre des tokens
+	PurposeOAuthLinkCode = "oauth_link_code" // Identité externe en attente de confirmation de liaison par l'app
+	PurposeMFAChallenge  = "mfa_challenge"   // Étape intermédiaire du login quand la 2FA est active
+	PurposeRecoveryCode  = "recovery_code"   // Code de secours 2FA (usage unique)
+)
+
+// AuthToken représente un refresh token rattaché à une session,
+// ou un token à usage unique (vérification d'email, reset de mot de passe).
+// Seul le hash SHA-256 du token est stocké, jamais sa valeur brute.
 type AuthToken struct {
 	ID        uint   `gorm:"primaryKey"`
-	UserID    uint   // Clé étrangère vers User
-	Token     string `gorm:"uniqueIndex"`
+	UserID    uint   `gorm:"index"`       // Clé étrangère vers User
+	Token     string `gorm:"uniqueIndex"` // Hash SHA-256 du token
+	Purpose   string `gorm:"size:32;index;default:refresh"`
+	SessionID string `gorm:"size:64;index"`
+	Payload   string `gorm:"type:text"` // Données associées (ex: PKCE et redirect_uri d'un code OAuth)
 	ExpiresAt time.Time
+	RevokedAt *time.Time
 	CreatedAt time.Time
 }
 
@@ -18,6 +37,71 @@ type LoginRequest struct {
 }
 
 type TokenResponse struct {
-	Token  string `json:"token"`
-	UserID uint   `json:"user_id"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Durée de validité du token d'accès (secondes)
+	UserID       uint   `json:"user_id"`
+
+	// La politique impose la 2FA à ce compte : les routes sensibles restent bloquées jusqu'à son activation
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+// MFAChallengeResponse est renvoyée à la place des tokens quand la 2FA est active
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" example:"true"`
+	MFAToken    string `json:"mfa_token"`  // À renvoyer avec le code sur /auth/2fa/login
+	ExpiresIn   int64  `json:"expires_in"` // Durée de validité du challenge (secondes)
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type EmailInput struct {
+	Email string `json:"email" binding:"required,email" example:"haithem@example.com"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// TokenExchangeInput représente l'échange d'un code d'autorisation OAuth (PKCE)
+type TokenExchangeInput struct {
+	Code         string `json:"code" binding:"required"`
+	CodeVerifier string `json:"code_verifier" binding:"required,min=43,max=128"`
+	RedirectURI  string `json:"redirect_uri" binding:"required" example:"thinkshare://auth/callback"`
+}
+
+// TOTPCodeInput représente un code TOTP à 6 chiffres
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
+
+// TOTPEnrollResponse contient le secret à enregistrer dans l'application d'authentification
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url" example:"otpauth://totp/ThinkShare:haithem@example.com?secret=...&issuer=ThinkShare"`
+}
+
+// RecoveryCodesResponse contient les codes de secours (affichés une seule fois)
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFALoginInput représente la seconde étape du login : code TOTP ou code de secours
+type MFALoginInput struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recovery_code" example:"k3f9q-7xw2m"`
+}
+
+// MFADisableInput permet de désactiver la 2FA avec un code TOTP ou un code de secours
+type MFADisableInput struct {
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recovery_code"`
 }
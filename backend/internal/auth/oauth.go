@@ -0,0 +1,449 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"backend/internal/user"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbates/goth"
+	"gorm.io/gorm"
+)
+
+// Durée de validité du lien de liaison d'une identité externe
+const OAuthLinkTokenTTL = 10 * time.Minute
+
+var (
+	ErrOAuthAccountExists = errors.New("un compte existe déjà avec cet email : connectez-vous puis liez ce fournisseur depuis votre profil")
+	ErrIdentityLinked     = errors.New("cette identité est déjà liée à un autre compte")
+)
+
+// ListProvidersHandler godoc
+// @Summary Liste des providers OAuth activés
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string][]string
+// @Router /auth/providers [get]
+func (s *Service) ListProvidersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": s.EnabledProviderNames()})
+}
+
+// BeginAuthHandler godoc
+// @Summary Début de l'authentification OAuth (Google, GitHub, Microsoft, Apple, OIDC)
+// @Description L'app fournit un code_challenge PKCE (S256) et une redirect_uri autorisée ;
+// @Description au retour, elle reçoit un code à échanger sur /auth/token.
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Nom du provider (cf. /auth/providers)"
+// @Param redirect_uri query string false "URI de retour de l'app (liste blanche OAUTH_REDIRECT_URIS)"
+// @Param code_challenge query string true "Challenge PKCE (connexion et liaison)"
+// @Param code_challenge_method query string true "S256"
+// @Param state query string false "State de l'app, renvoyé tel quel"
+// @Param link query string false "Token de liaison (obtenu via /api/profile/identities/{provider}/link)"
+// @Success 302 {string} string "Redirection vers le provider"
+// @Failure 400 {object} map[string]string
+// @Router /auth/{provider} [get]
+func (s *Service) BeginAuthHandler(c *gin.Context) {
+	p, ok := s.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider not supported"})
+		return
+	}
+
+	redirectURI, err := s.resolveRedirectURI(c.Query("redirect_uri"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// PKCE obligatoire, y compris pour la liaison : seule l'app qui a démarré le flux peut en utiliser le résultat
+	if !validCodeChallenge(c.Query("code_challenge"), c.Query("code_challenge_method")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidPKCE.Error()})
+		return
+	}
+	flow := oauthFlow{
+		RedirectURI:   redirectURI,
+		CodeChallenge: c.Query("code_challenge"),
+		ClientState:   c.Query("state"),
+		LinkToken:     c.Query("link"),
+	}
+
+	// Les paramètres de l'app voyagent signés dans le state, lui-même comparé à celui du cookie au retour
+	state, err := s.encodeOAuthFlow(flow)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur interne"})
+		return
+	}
+	authURL, err := s.beginOAuth(c, p, state)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+// CallbackHandler godoc
+// @Summary Callback OAuth : connexion, inscription ou liaison d'identité
+// @Description Redirige vers la redirect_uri de l'app avec ?code=...&state=... (ou ?error=...) ;
+// @Description pour une liaison, ?code=...&link={provider} : le code se confirme sur /api/profile/identities/{provider}/confirm
+// @Tags Auth
+// @Param provider path string true "Nom du provider"
+// @Success 302 {string} string "Redirection vers l'app"
+// @Failure 400 {object} map[string]string
+// @Router /auth/{provider}/callback [get]
+func (s *Service) CallbackHandler(c *gin.Context) {
+	name := c.Param("provider")
+	p, ok := s.providers[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider not supported"})
+		return
+	}
+
+	flow, err := s.decodeOAuthFlow(oauthState(c.Request))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fail := func(code string) {
+		redirectWithParams(c, flow.RedirectURI, map[string]string{"error": code, "state": flow.ClientState})
+	}
+
+	gUser, err := s.completeOAuth(c, p)
+	if err != nil || gUser.UserID == "" {
+		log.Printf("❌ Callback OAuth %s échoué : %v", name, err)
+		fail("access_denied")
+		return
+	}
+
+	// Flux de liaison : l'identité n'est liée qu'une fois le code confirmé par l'app connectée au compte
+	// qui a demandé le lien (session et code_verifier PKCE), jamais par la seule ouverture de l'URL
+	if flow.LinkToken != "" {
+		userID, err := s.ConsumeActionToken(flow.LinkToken, PurposeOAuthLink)
+		if err != nil {
+			fail("invalid_link")
+			return
+		}
+		if identity, err := s.users.FindIdentity(name, gUser.UserID); err == nil && identity.UserID != userID {
+			fail("identity_already_linked")
+			return
+		}
+		code, err := s.createOAuthCode(PurposeOAuthLinkCode, userID, oauthCodePayload{
+			RedirectURI:   flow.RedirectURI,
+			CodeChallenge: flow.CodeChallenge,
+			Provider:      name,
+			Subject:       gUser.UserID,
+			Email:         gUser.Email,
+		})
+		if err != nil {
+			log.Printf("❌ Liaison OAuth %s impossible (user=%d) : %v", name, userID, err)
+			fail("server_error")
+			return
+		}
+		redirectWithParams(c, flow.RedirectURI, map[string]string{"code": code, "link": name, "state": flow.ClientState})
+		return
+	}
+
+	u, err := s.resolveOAuthUser(p.cfg, gUser)
+	if err != nil {
+		if errors.Is(err, ErrOAuthAccountExists) {
+			fail("account_exists")
+			return
+		}
+		log.Printf("❌ Connexion OAuth %s impossible : %v", name, err)
+		fail("server_error")
+		return
+	}
+
+	code, err := s.CreateOAuthCode(u.ID, flow.RedirectURI, flow.CodeChallenge)
+	if err != nil {
+		log.Printf("❌ Création du code OAuth impossible (user=%d) : %v", u.ID, err)
+		fail("server_error")
+		return
+	}
+	redirectWithParams(c, flow.RedirectURI, map[string]string{"code": code, "state": flow.ClientState})
+}
+
+// resolveOAuthUser retrouve (ou crée) l'utilisateur correspondant à une identité externe.
+// L'identité (provider, subject) prime ; l'email n'est utilisé que s'il est vérifié des deux côtés.
+func (s *Service) resolveOAuthUser(cfg config.OAuthProvider, gUser goth.User) (*user.User, error) {
+	if identity, err := s.users.FindIdentity(cfg.Name, gUser.UserID); err == nil {
+		return s.users.GetByID(identity.UserID)
+	}
+
+	verified := providerEmailVerified(cfg, gUser)
+
+	var existing user.User
+	if gUser.Email != "" && s.db.Where("email = ?", gUser.Email).First(&existing).Error == nil {
+		// Les comptes sans mot de passe ont été créés par OAuth avant l'introduction des identités
+		if !verified || !(existing.EmailVerified || existing.PasswordHash == "") {
+			return nil, ErrOAuthAccountExists
+		}
+		if err := s.linkIdentity(existing.ID, cfg.Name, gUser); err != nil {
+			return nil, err
+		}
+		log.Printf("🔗 Identité %s rattachée au compte existant %d (email vérifié)", cfg.Name, existing.ID)
+		return &existing, nil
+	}
+
+	// Inscription via le provider
+	now := time.Now()
+	username := s.oauthUsername(gUser)
+	u := user.User{
+		Username:      username,
+		FullName:      strings.TrimSpace(gUser.FirstName + " " + gUser.LastName),
+		Name:          fallback(gUser.LastName, username),
+		FirstName:     fallback(gUser.FirstName, username),
+		AvatarURL:     gUser.AvatarURL,
+		Email:         gUser.Email,
+		PasswordHash:  "",
+		Role:          user.RoleUser,
+		EmailVerified: verified,
+		CreatedAt:     now,
+	}
+	if verified {
+		u.EmailVerifiedAt = &now
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		return tx.Create(&user.UserIdentity{
+			UserID:   u.ID,
+			Provider: cfg.Name,
+			Subject:  gUser.UserID,
+			Email:    gUser.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// linkIdentity rattache une identité externe à un utilisateur
+func (s *Service) linkIdentity(userID uint, provider string, gUser goth.User) error {
+	if identity, err := s.users.FindIdentity(provider, gUser.UserID); err == nil {
+		if identity.UserID == userID {
+			return nil // Déjà liée à ce compte
+		}
+		return ErrIdentityLinked
+	}
+	return s.users.CreateIdentity(&user.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  gUser.UserID,
+		Email:    gUser.Email,
+	})
+}
+
+// oauthUsername choisit un nom d'utilisateur libre à partir du profil externe
+func (s *Service) oauthUsername(gUser goth.User) string {
+	base := gUser.NickName
+	if base == "" {
+		base, _, _ = strings.Cut(gUser.Email, "@")
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		s.db.Model(&user.User{}).Where("username = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+		suffix := make([]byte, 3)
+		rand.Read(suffix)
+		candidate = fmt.Sprintf("%s_%x", base, suffix)
+	}
+	return candidate
+}
+
+func fallback(value, def string) string {
+	if strings.TrimSpace(value) == "" {
+		return def
+	}
+	return value
+}
+
+// ListIdentitiesHandler godoc
+// @Summary Liste les identités externes liées au compte
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} user.UserIdentity
+// @Failure 401 {object} map[string]string
+// @Router /api/profile/identities [get]
+func (s *Service) ListIdentitiesHandler(c *gin.Context) {
+	identities, err := s.users.ListIdentities(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des identités"})
+		return
+	}
+	c.JSON(http.StatusOK, identities)
+}
+
+// LinkIdentityHandler godoc
+// @Summary Prépare la liaison d'un provider externe au compte connecté
+// @Description Retourne l'URL à ouvrir dans le navigateur pour lier le compte (valable 10 minutes).
+// @Description Au retour, l'app confirme la liaison sur /api/profile/identities/{provider}/confirm avec son code_verifier.
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Nom du provider"
+// @Param redirect_uri query string false "URI de retour de l'app après liaison (liste blanche)"
+// @Param code_challenge query string true "Challenge PKCE de l'app"
+// @Param code_challenge_method query string true "S256"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/profile/identities/{provider}/link [post]
+func (s *Service) LinkIdentityHandler(c *gin.Context) {
+	provider := c.Param("provider")
+	if _, ok := s.providerConfig(provider); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider not supported"})
+		return
+	}
+
+	redirectURI, err := s.resolveRedirectURI(c.Query("redirect_uri"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	challenge, method := c.Query("code_challenge"), c.Query("code_challenge_method")
+	if !validCodeChallenge(challenge, method) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidPKCE.Error()})
+		return
+	}
+
+	userID := uint(c.GetInt("user_id"))
+	identities, err := s.users.ListIdentities(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des identités"})
+		return
+	}
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			c.JSON(http.StatusConflict, gin.H{"error": "ce provider est déjà lié au compte"})
+			return
+		}
+	}
+
+	token, err := s.CreateActionToken(userID, PurposeOAuthLink, OAuthLinkTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la génération du lien"})
+		return
+	}
+
+	query := url.Values{
+		"link":                  {token},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {method},
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url": fmt.Sprintf("%s/auth/%s?%s", s.PublicBaseURL(), url.PathEscape(provider), query.Encode()),
+	})
+}
+
+// ConfirmIdentityLink lie l'identité d'un code de liaison (usage unique, PKCE) au compte connecté ;
+// un code émis pour un autre compte ou un autre provider est refusé
+func (s *Service) ConfirmIdentityLink(userID uint, provider, code, verifier, redirectURI string) error {
+	codeUserID, payload, err := s.consumeOAuthCode(PurposeOAuthLinkCode, code, verifier, redirectURI)
+	if err != nil {
+		return err
+	}
+	if codeUserID != userID || payload.Provider != provider {
+		return ErrInvalidOAuthCode
+	}
+	return s.linkIdentity(userID, provider, goth.User{UserID: payload.Subject, Email: payload.Email})
+}
+
+// ConfirmLinkHandler godoc
+// @Summary Confirme la liaison d'un provider externe au compte connecté
+// @Description Le code reçu au retour du provider (?code=...&link={provider}) est échangé avec le code_verifier PKCE
+// @Description de l'app ; il est à usage unique, valable 1 minute et lié au compte qui a demandé la liaison.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Nom du provider"
+// @Param input body TokenExchangeInput true "Code, code_verifier PKCE et redirect_uri"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/profile/identities/{provider}/confirm [post]
+func (s *Service) ConfirmLinkHandler(c *gin.Context) {
+	var input TokenExchangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := uint(c.GetInt("user_id"))
+	provider := c.Param("provider")
+	err := s.ConfirmIdentityLink(userID, provider, input.Code, input.CodeVerifier, input.RedirectURI)
+	switch {
+	case errors.Is(err, ErrInvalidOAuthCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrIdentityLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("❌ Liaison OAuth %s impossible (user=%d) : %v", provider, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la liaison"})
+		return
+	}
+	log.Printf("🔗 Identité %s liée au compte %d", provider, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Identité liée", "provider": provider})
+}
+
+// UnlinkIdentityHandler godoc
+// @Summary Supprime la liaison avec un provider externe
+// @Description Refusé s'il s'agit du dernier moyen de connexion (pas de mot de passe)
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Nom du provider"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/profile/identities/{provider} [delete]
+func (s *Service) UnlinkIdentityHandler(c *gin.Context) {
+	userID := uint(c.GetInt("user_id"))
+
+	u, err := s.users.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	identities, err := s.users.ListIdentities(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des identités"})
+		return
+	}
+	if u.PasswordHash == "" && len(identities) <= 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "impossible de supprimer le dernier moyen de connexion : définissez d'abord un mot de passe"})
+		return
+	}
+
+	if err := s.users.DeleteIdentity(userID, c.Param("provider")); err != nil {
+		if errors.Is(err, user.ErrIdentityNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la suppression"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Identité supprimée"})
+}
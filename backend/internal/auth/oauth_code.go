@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Durées de vie du flux OAuth côté app
+const (
+	OAuthFlowTTL = 10 * time.Minute // Entre /auth/{provider} et le callback
+	OAuthCodeTTL = 1 * time.Minute  // Entre le callback et l'échange du code
+)
+
+var (
+	ErrRedirectNotAllowed = errors.New("redirect_uri non autorisée")
+	ErrInvalidPKCE        = errors.New("code_challenge PKCE (S256) requis")
+	ErrInvalidOAuthCode   = errors.New("code d'autorisation invalide, expiré ou déjà utilisé")
+	ErrInvalidOAuthFlow   = errors.New("state OAuth invalide ou expiré")
+)
+
+// oauthFlow contient les paramètres de l'app conservés pendant l'aller-retour chez le provider
+type oauthFlow struct {
+	RedirectURI   string
+	CodeChallenge string
+	ClientState   string
+	LinkToken     string
+}
+
+// oauthCodePayload est stocké avec le code d'autorisation (et, pour une liaison, l'identité à lier)
+type oauthCodePayload struct {
+	RedirectURI   string `json:"redirect_uri"`
+	CodeChallenge string `json:"code_challenge"`
+	Provider      string `json:"provider,omitempty"`
+	Subject       string `json:"subject,omitempty"`
+	Email         string `json:"email,omitempty"`
+}
+
+// AllowedRedirectURIs retourne la liste blanche des URIs de redirection
+func (s *Service) AllowedRedirectURIs() []string {
+	return s.cfg.Auth.OAuthRedirectURIs
+}
+
+// resolveRedirectURI vérifie la redirect_uri demandée (correspondance exacte) ou retourne celle par défaut
+func (s *Service) resolveRedirectURI(requested string) (string, error) {
+	allowed := s.AllowedRedirectURIs()
+	if requested == "" {
+		return allowed[0], nil
+	}
+	for _, uri := range allowed {
+		if requested == uri {
+			return uri, nil
+		}
+	}
+	return "", ErrRedirectNotAllowed
+}
+
+// validCodeChallenge vérifie le format d'un code_challenge S256 (SHA-256 encodé en base64url sans padding)
+func validCodeChallenge(challenge, method string) bool {
+	if method != "S256" {
+		return false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// verifyPKCE compare le code_verifier au code_challenge enregistré
+func verifyPKCE(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// encodeOAuthFlow signe les paramètres du flux ; le résultat sert de state auprès du provider
+func (s *Service) encodeOAuthFlow(flow oauthFlow) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"purpose":        "oauth_flow",
+		"jti":            uuid.New().String(), // Rend le state imprévisible
+		"redirect_uri":   flow.RedirectURI,
+		"code_challenge": flow.CodeChallenge,
+		"client_state":   flow.ClientState,
+		"link":           flow.LinkToken,
+		"iat":            now.Unix(),
+		"exp":            now.Add(OAuthFlowTTL).Unix(),
+	}
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// decodeOAuthFlow vérifie et décode le state reçu au callback
+func (s *Service) decodeOAuthFlow(state string) (*oauthFlow, error) {
+	token, err := jwt.Parse(state, s.keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidOAuthFlow
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidOAuthFlow
+	}
+	if p, _ := claims["purpose"].(string); p != "oauth_flow" {
+		return nil, ErrInvalidOAuthFlow
+	}
+
+	flow := &oauthFlow{}
+	flow.RedirectURI, _ = claims["redirect_uri"].(string)
+	flow.CodeChallenge, _ = claims["code_challenge"].(string)
+	flow.ClientState, _ = claims["client_state"].(string)
+	flow.LinkToken, _ = claims["link"].(string)
+	return flow, nil
+}
+
+// redirectWithParams redirige vers l'app en ajoutant des paramètres à la redirect_uri
+func redirectWithParams(c *gin.Context, redirectURI string, params map[string]string) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrRedirectNotAllowed.Error()})
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	c.Redirect(http.StatusFound, u.String())
+}
+
+// CreateOAuthCode émet un code d'autorisation à usage unique lié au challenge PKCE et à la redirect_uri
+func (s *Service) CreateOAuthCode(userID uint, redirectURI, codeChallenge string) (string, error) {
+	return s.createOAuthCode(PurposeOAuthCode, userID, oauthCodePayload{RedirectURI: redirectURI, CodeChallenge: codeChallenge})
+}
+
+// createOAuthCode enregistre un code à usage unique (haché) et ses données, valable OAuthCodeTTL
+func (s *Service) createOAuthCode(purpose string, userID uint, payload oauthCodePayload) (string, error) {
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	err = s.db.Create(&AuthToken{
+		UserID:    userID,
+		Token:     hashToken(code),
+		Purpose:   purpose,
+		Payload:   string(data),
+		ExpiresAt: time.Now().Add(OAuthCodeTTL),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// consumeOAuthCode brûle le code (usage unique, même si la vérification échoue) puis vérifie la redirect_uri
+// et le code_verifier PKCE. Retourne l'utilisateur et les données du code.
+func (s *Service) consumeOAuthCode(purpose, code, verifier, redirectURI string) (uint, *oauthCodePayload, error) {
+	var userID uint
+	var payload *oauthCodePayload
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var row AuthToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token = ? AND purpose = ?", hashToken(code), purpose).
+			First(&row).Error
+		if err != nil {
+			return ErrInvalidOAuthCode
+		}
+		if row.RevokedAt != nil || time.Now().After(row.ExpiresAt) {
+			return ErrInvalidOAuthCode
+		}
+		// Le code est brûlé dès la première tentative, même si la vérification échoue
+		if err := tx.Model(&row).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var p oauthCodePayload
+		if err := json.Unmarshal([]byte(row.Payload), &p); err != nil {
+			return nil
+		}
+		if p.RedirectURI == redirectURI && verifyPKCE(verifier, p.CodeChallenge) {
+			userID, payload = row.UserID, &p
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if payload == nil {
+		return 0, nil, ErrInvalidOAuthCode
+	}
+	return userID, payload, nil
+}
+
+// ExchangeOAuthCode consomme le code (usage unique) après vérification PKCE et ouvre une session
+// (ou retourne un challenge si la 2FA est active)
+func (s *Service) ExchangeOAuthCode(code, verifier, redirectURI string) (interface{}, error) {
+	userID, _, err := s.consumeOAuthCode(PurposeOAuthCode, code, verifier, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.users.GetByID(userID)
+	if err != nil {
+		return nil, ErrInvalidOAuthCode
+	}
+	return s.startLogin(u)
+}
+
+// TokenExchangeHandler godoc
+// @Summary Échange un code d'autorisation OAuth contre des tokens (PKCE)
+// @Description Même réponse que /login. Le code est à usage unique et valable 1 minute.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body TokenExchangeInput true "Code, code_verifier PKCE et redirect_uri"
+// @Success 200 {object} TokenResponse "ou MFAChallengeResponse si la 2FA est active"
+// @Failure 400 {object} map[string]string
+// @Router /auth/token [post]
+func (s *Service) TokenExchangeHandler(c *gin.Context) {
+	var input TokenExchangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := s.ExchangeOAuthCode(input.Code, input.CodeVerifier, input.RedirectURI)
+	if err != nil {
+		if errors.Is(err, ErrInvalidOAuthCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la génération du token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/apple"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/microsoftonline"
+	"github.com/markbates/goth/providers/openidConnect"
+)
+
+// Types de providers OAuth supportés
+const (
+	ProviderGoogle    = "google"
+	ProviderGitHub    = "github"
+	ProviderMicrosoft = "microsoft"
+	ProviderApple     = "apple"
+	ProviderOIDC      = "oidc"
+)
+
+// oauthProvider : provider OAuth activé, avec sa configuration
+type oauthProvider struct {
+	cfg  config.OAuthProvider
+	goth goth.Provider
+}
+
+// PublicBaseURL retourne l'URL publique de l'API, utilisée pour les callbacks
+func (s *Service) PublicBaseURL() string {
+	return s.cfg.Server.PublicBaseURL
+}
+
+// callbackURL construit l'URL de callback d'un provider
+func (s *Service) callbackURL(name string) string {
+	return fmt.Sprintf("%s/auth/%s/callback", s.PublicBaseURL(), name)
+}
+
+// newProvider instancie le provider goth correspondant à la configuration
+func (s *Service) newProvider(cfg config.OAuthProvider) (goth.Provider, error) {
+	cb := s.callbackURL(cfg.Name)
+	switch cfg.Type {
+	case ProviderGoogle:
+		p := google.New(cfg.ClientID, cfg.ClientSecret, cb, cfg.Scopes...)
+		p.SetName(cfg.Name)
+		return p, nil
+	case ProviderGitHub:
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"read:user", "user:email"}
+		}
+		p := github.New(cfg.ClientID, cfg.ClientSecret, cb, scopes...)
+		p.SetName(cfg.Name)
+		return p, nil
+	case ProviderMicrosoft:
+		p := microsoftonline.New(cfg.ClientID, cfg.ClientSecret, cb, cfg.Scopes...)
+		p.SetName(cfg.Name)
+		return p, nil
+	case ProviderApple:
+		secret := cfg.ClientSecret
+		if secret == "" && cfg.PrivateKey != "" {
+			// Secret JWT signé avec la clé privée Apple (durée max 6 mois)
+			now := time.Now()
+			s, err := apple.MakeSecret(apple.SecretParams{
+				PKCS8PrivateKey: cfg.PrivateKey,
+				TeamId:          cfg.TeamID,
+				KeyId:           cfg.KeyID,
+				ClientId:        cfg.ClientID,
+				Iat:             int(now.Unix()),
+				Exp:             int(now.Add(180 * 24 * time.Hour).Unix()),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("génération du secret Apple : %v", err)
+			}
+			secret = *s
+		}
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{apple.ScopeName, apple.ScopeEmail}
+		}
+		p := apple.New(cfg.ClientID, secret, cb, nil, scopes...)
+		p.SetName(cfg.Name)
+		return p, nil
+	case ProviderOIDC:
+		if cfg.DiscoveryURL == "" {
+			return nil, fmt.Errorf("discovery_url manquant")
+		}
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "profile", "email"}
+		}
+		return openidConnect.NewNamed(cfg.Name, cfg.ClientID, cfg.ClientSecret, cb, cfg.DiscoveryURL, scopes...)
+	default:
+		return nil, fmt.Errorf("type de provider inconnu : %q", cfg.Type)
+	}
+}
+
+// initProviders instancie les providers OAuth configurés et le store de session du flux OAuth
+func (s *Service) initProviders() {
+	s.oauthStore = s.newOAuthStore()
+
+	s.providers = map[string]oauthProvider{}
+	for _, cfg := range s.cfg.Auth.OAuthProviders {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+		}
+		if _, exists := s.providers[cfg.Name]; exists {
+			log.Printf("⚠️ Provider OAuth %s déclaré plusieurs fois, ignoré", cfg.Name)
+			continue
+		}
+		p, err := s.newProvider(cfg)
+		if err != nil {
+			log.Printf("❌ Provider OAuth %s ignoré : %v", cfg.Name, err)
+			continue
+		}
+		s.providers[cfg.Name] = oauthProvider{cfg: cfg, goth: p}
+		log.Printf("🔑 Provider OAuth %s activé (callback: %s)", cfg.Name, s.callbackURL(cfg.Name))
+	}
+}
+
+// newOAuthStore configure le cookie de session utilisé pendant le flux OAuth.
+// Apple renvoie le callback en POST cross-site : le cookie doit alors être SameSite=None (HTTPS requis).
+func (s *Service) newOAuthStore() sessions.Store {
+	store := sessions.NewCookieStore([]byte(s.cfg.Auth.SessionSecret))
+	store.Options.HttpOnly = true
+	store.Options.MaxAge = 600
+	store.Options.Path = "/"
+	if strings.HasPrefix(s.PublicBaseURL(), "https://") {
+		store.Options.Secure = true
+		store.Options.SameSite = http.SameSiteNoneMode
+	} else {
+		store.Options.SameSite = http.SameSiteLaxMode
+	}
+	return store
+}
+
+// oauthSessionName : cookie conservant la session goth entre /auth/{provider} et le callback
+const oauthSessionName = "_thinkshare_oauth"
+
+// beginOAuth démarre l'authentification chez le provider et retourne l'URL où rediriger l'utilisateur ;
+// la session goth (dont le state) est conservée dans un cookie signé jusqu'au callback
+func (s *Service) beginOAuth(c *gin.Context, p oauthProvider, state string) (string, error) {
+	sess, err := p.goth.BeginAuth(state)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := sess.GetAuthURL()
+	if err != nil {
+		return "", err
+	}
+	cookie, _ := s.oauthStore.New(c.Request, oauthSessionName)
+	cookie.Values[p.cfg.Name] = sess.Marshal()
+	if err := cookie.Save(c.Request, c.Writer); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// oauthState lit le state renvoyé par le provider (query string, ou formulaire pour le POST d'Apple)
+func oauthState(r *http.Request) string {
+	params := r.URL.Query()
+	if params.Encode() == "" && r.Method == http.MethodPost {
+		return r.FormValue("state")
+	}
+	return params.Get("state")
+}
+
+// completeOAuth termine l'authentification au callback : vérifie que le state est celui émis par beginOAuth,
+// échange le code et récupère le profil. Le cookie de session est supprimé dans tous les cas.
+func (s *Service) completeOAuth(c *gin.Context, p oauthProvider) (goth.User, error) {
+	cookie, _ := s.oauthStore.Get(c.Request, oauthSessionName)
+	value, _ := cookie.Values[p.cfg.Name].(string)
+	defer s.clearOAuthSession(c)
+	if value == "" {
+		return goth.User{}, errors.New("session OAuth introuvable")
+	}
+	sess, err := p.goth.UnmarshalSession(value)
+	if err != nil {
+		return goth.User{}, err
+	}
+
+	rawAuthURL, err := sess.GetAuthURL()
+	if err != nil {
+		return goth.User{}, err
+	}
+	authURL, err := url.Parse(rawAuthURL)
+	if err != nil {
+		return goth.User{}, err
+	}
+	if state := authURL.Query().Get("state"); state != "" && state != oauthState(c.Request) {
+		return goth.User{}, errors.New("state OAuth différent de celui émis")
+	}
+
+	params := c.Request.URL.Query()
+	if params.Encode() == "" && c.Request.Method == http.MethodPost {
+		if err := c.Request.ParseForm(); err != nil {
+			return goth.User{}, err
+		}
+		params = c.Request.Form
+	}
+	if _, err := sess.Authorize(p.goth, params); err != nil {
+		return goth.User{}, err
+	}
+	return p.goth.FetchUser(sess)
+}
+
+// clearOAuthSession supprime le cookie de session du flux OAuth
+func (s *Service) clearOAuthSession(c *gin.Context) {
+	cookie, _ := s.oauthStore.Get(c.Request, oauthSessionName)
+	cookie.Options.MaxAge = -1
+	cookie.Values = map[interface{}]interface{}{}
+	if err := cookie.Save(c.Request, c.Writer); err != nil {
+		log.Printf("⚠️ Suppression du cookie OAuth impossible : %v", err)
+	}
+}
+
+// providerConfig retourne la configuration d'un provider activé
+func (s *Service) providerConfig(name string) (config.OAuthProvider, bool) {
+	p, ok := s.providers[name]
+	return p.cfg, ok
+}
+
+// EnabledProviderNames retourne la liste triée des providers activés
+func (s *Service) EnabledProviderNames() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerEmailVerified indique si le provider garantit que l'email appartient à l'utilisateur
+func providerEmailVerified(cfg config.OAuthProvider, gUser goth.User) bool {
+	if gUser.Email == "" {
+		return false
+	}
+	if cfg.Type == ProviderApple {
+		return true // Apple ne communique que des adresses vérifiées (y compris les relais privés)
+	}
+	for _, key := range []string{"email_verified", "verified_email"} {
+		switch v := gUser.RawData[key].(type) {
+		case bool:
+			if v {
+				return true
+			}
+		case string:
+			if v == "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,47 +1,115 @@
 package auth
 
 import (
+	"backend/internal/config"
+	"backend/internal/mailer"
+	"backend/internal/user"
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/sessions"
+	"gorm.io/gorm"
 )
 
-var jwtKey = []byte(getSecret())
+var ErrJWTKeyNotConfigured = errors.New("clé de signature JWT non configurée")
 
-func getSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	return secret
+// Durées de vie des tokens : accès court, refresh long (rotatif)
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Service porte l'état de l'authentification : configuration (secret JWT, URLs, providers OAuth,
+// politique 2FA), connexion utilisée par les sessions, tokens et comptes, mailer et providers OAuth.
+// Construit par app.New et injecté dans les routes : deux instances ne partagent rien.
+type Service struct {
+	cfg        *config.Config
+	db         *gorm.DB
+	users      user.UserRepository
+	mail       mailer.Mailer
+	jwtKey     []byte
+	providers  map[string]oauthProvider // Providers OAuth activés, par nom
+	oauthStore sessions.Store           // Cookie de session pendant l'aller-retour chez le provider
+}
+
+// NewService construit le service d'authentification ; sans mailer, les emails sont journalisés
+func NewService(cfg *config.Config, gdb *gorm.DB, mail mailer.Mailer) *Service {
+	if mail == nil {
+		mail = &mailer.LogMailer{}
+	}
+	s := &Service{
+		cfg:    cfg,
+		db:     gdb,
+		users:  user.NewRepository(gdb),
+		mail:   mail,
+		jwtKey: []byte(cfg.Auth.JWTSecret),
+	}
+	s.initProviders()
+	return s
+}
+
+// signingKey retourne la clé JWT, ou une erreur si elle n'a pas été configurée :
+// on ne signe jamais avec une clé vide.
+func (s *Service) signingKey() ([]byte, error) {
+	if len(s.jwtKey) == 0 {
+		return nil, ErrJWTKeyNotConfigured
+	}
+	return s.jwtKey, nil
 }
 
-func GenerateJWT(userID int) (string, error) {
+// keyFunc fournit la clé de vérification à jwt.Parse
+func (s *Service) keyFunc(*jwt.Token) (interface{}, error) {
+	return s.signingKey()
+}
+
+// Claims contient les informations extraites d'un token d'accès
+type Claims struct {
+	UserID    int
+	SessionID string
+	Role      string
+}
+
+func (s *Service) GenerateJWT(userID int, sessionID, role string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id": userID,                                // Payload : ID de l'utilisateur
-		"exp":     time.Now().Add(24 * time.Hour).Unix(), // Expiration du token : 24h
+		"user_id": userID,                         // Payload : ID de l'utilisateur
+		"sid":     sessionID,                      // Session (révocable côté serveur)
+		"role":    role,                           // Rôle pour l'autorisation (RequireRole)
+		"iat":     now.Unix(),                     // Date d'émission
+		"exp":     now.Add(AccessTokenTTL).Unix(), // Expiration du token d'accès
 	}
 
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return token.SignedString(key)
 }
 
-func ParseJWT(tokenStr string) (int, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+func (s *Service) ParseJWT(tokenStr string) (*Claims, error) {
+	token, err := jwt.Parse(tokenStr, s.keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil || !token.Valid {
-		return 0, errors.New("invalid token") // token expiré ou signature invalide
+		return nil, errors.New("invalid token") // token expiré ou signature invalide
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, errors.New("cannot parse claims")
+		return nil, errors.New("cannot parse claims")
 	}
 
 	userID, ok := claims["user_id"].(float64) // json number = float64
 	if !ok {
-		return 0, errors.New("user_id not found in token")
+		return nil, errors.New("user_id not found in token")
+	}
+
+	sessionID, ok := claims["sid"].(string)
+	if !ok || sessionID == "" {
+		return nil, errors.New("session not found in token")
 	}
 
-	return int(userID), nil
+	role, _ := claims["role"].(string)
+
+	return &Claims{UserID: int(userID), SessionID: sessionID, Role: user.NormalizeRole(role)}, nil
 }
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"backend/internal/user"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token invalide ou expiré")
+	ErrRefreshTokenReused  = errors.New("refresh token déjà utilisé, session révoquée")
+)
+
+// hashToken retourne l'empreinte SHA-256 (hex) d'un token brut
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateOpaqueToken génère un token aléatoire (256 bits) encodé en base64 URL
+func generateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// issueTokens crée un refresh token pour la session et signe le token d'accès associé.
+// Le rôle est relu en base à chaque émission : un changement de rôle s'applique au prochain refresh.
+func (s *Service) issueTokens(tx *gorm.DB, userID uint, sessionID string) (*TokenResponse, error) {
+	var u user.User
+	if err := tx.Select("id", "role", "monthly_price", "totp_enabled").First(&u, userID).Error; err != nil {
+		return nil, err
+	}
+
+	refresh, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	row := AuthToken{
+		UserID:    userID,
+		Token:     hashToken(refresh),
+		Purpose:   PurposeRefresh,
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
+	}
+
+	access, err := s.GenerateJWT(int(userID), sessionID, user.NormalizeRole(u.Role))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(AccessTokenTTL.Seconds()),
+		UserID:       userID,
+
+		MFAEnrollmentRequired: s.mfaEnrollmentRequired(&u),
+	}, nil
+}
+
+// IssueSession ouvre une nouvelle session pour l'utilisateur (login)
+func (s *Service) IssueSession(userID uint) (*TokenResponse, error) {
+	return s.issueTokens(s.db, userID, uuid.New().String())
+}
+
+// RefreshSession échange un refresh token contre une nouvelle paire de tokens.
+// L'ancien refresh token est révoqué (rotation) ; sa réutilisation révoque toute la session.
+func (s *Service) RefreshSession(rawRefresh string) (*TokenResponse, error) {
+	var resp *TokenResponse
+	reused := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current AuthToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token = ? AND purpose = ?", hashToken(rawRefresh), PurposeRefresh).
+			First(&current).Error
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil {
+			// Token déjà consommé : probablement volé, on coupe toute la session
+			reused = true
+			log.Printf("⚠️ Réutilisation d'un refresh token détectée (user=%d, session=%s)", current.UserID, current.SessionID)
+			return tx.Model(&AuthToken{}).
+				Where("session_id = ? AND revoked_at IS NULL", current.SessionID).
+				Update("revoked_at", now).Error
+		}
+		if now.After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&current).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		resp, err = s.issueTokens(tx, current.UserID, current.SessionID)
+		return err
+	})
+
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RevokeSession révoque tous les refresh tokens d'une session
+func (s *Service) RevokeSession(sessionID string) error {
+	return s.db.Model(&AuthToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllSessions révoque toutes les sessions d'un utilisateur
+func (s *Service) RevokeAllSessions(userID uint) error {
+	return s.db.Model(&AuthToken{}).
+		Where("user_id = ? AND purpose = ? AND revoked_at IS NULL", userID, PurposeRefresh).
+		Update("revoked_at", time.Now()).Error
+}
+
+// IsSessionActive indique si la session possède encore un refresh token valide
+func (s *Service) IsSessionActive(sessionID string) bool {
+	var count int64
+	err := s.db.Model(&AuthToken{}).
+		Where("session_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		log.Printf("❌ Erreur vérification session %s : %v", sessionID, err)
+		return false
+	}
+	return count > 0
+}
@@ -16,11 +16,12 @@ func NewHandler(service Service) *Handler {
 	return &Handler{service: service}
 }
 
-func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, writeLimits ...gin.HandlerFunc) {
 	comments := rg.Group("/comments")
 
 	// Routes pour les commentaires
-	comments.POST("", h.CreateComment)              // POST /api/comments
+	// POST /api/comments (limites anti-spam passées par l'appelant)
+	comments.POST("", append(writeLimits, h.CreateComment)...)
 	comments.GET("/:postID", h.GetCommentsByPostID) // GET /api/comments/:postID
 	comments.PUT("/:id", h.UpdateComment)           // PUT /api/comments/:id
 	comments.DELETE("/:id", h.DeleteComment)        // DELETE /api/comments/:id
@@ -76,7 +77,7 @@ func (h *Handler) CreateComment(c *gin.Context) {
 // GetCommentsByPostID retrieves comments for a post
 // GetCommentsByPostID godoc
 // @Summary      Get comments for a post
-// @Description  Retrieve all comments for a specific post (paginated)
+// @Description  Retrieve the comments of a post visible to the authenticated user (paginated). Comments from users they blocked are hidden
 // @Tags         comments
 // @Security     BearerAuth
 // @Produce      json
@@ -96,7 +97,7 @@ func (h *Handler) GetCommentsByPostID(c *gin.Context) {
 	}
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	comments, total, err := h.service.GetCommentsByPostID(uint(postID), page, limit)
+	comments, total, err := h.service.GetCommentsByPostID(uint(postID), uint(c.GetInt("user_id")), page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
 		return
@@ -225,3 +226,35 @@ func (h *Handler) DeleteComment(c *gin.Context) {
 		"id":      commentID,
 	})
 }
+
+// ModerateComment godoc
+// @Summary      Remove a comment (moderation)
+// @Description  Delete any comment, whoever its author (moderators and admins)
+// @Tags         moderation
+// @Security     BearerAuth
+// @Param        id    path  int  true  "Comment ID"
+// @Success      200   {object}  map[string]interface{} "Comment deleted successfully"
+// @Failure      400   {object}  map[string]string "Invalid comment ID"
+// @Failure      403   {object}  map[string]string "Forbidden"
+// @Failure      404   {object}  map[string]string "Comment not found"
+// @Failure      500   {object}  map[string]string "Failed to delete comment"
+// @Router       /api/moderation/comments/{id} [delete]
+func (h *Handler) ModerateComment(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+	if err := h.service.RemoveComment(uint(commentID)); err != nil {
+		if err.Error() == "commentaire non trouvé" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment deleted successfully",
+		"id":      commentID,
+	})
+}
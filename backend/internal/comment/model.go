@@ -12,6 +12,7 @@ type Comment struct {
 	PostID    uint      `json:"post_id" gorm:"not null;index"`
 	UserID    uint      `json:"user_id" gorm:"not null;index"`
 	Text      string    `json:"text" gorm:"type:text;not null"`
+	Withheld  bool      `json:"-" gorm:"not null;default:false"` // Auteur bloqué par le créateur du post : visible de lui seul
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
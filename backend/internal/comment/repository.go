@@ -10,10 +10,10 @@ import (
 type Repository interface {
 	Create(comment *Comment) error
 	GetByID(id uint) (*Comment, error)
-	GetByPostID(postID uint, limit, offset int) ([]Comment, error)
+	GetByPostID(postID, viewerID uint, limit, offset int) ([]Comment, error)
 	Update(comment *Comment) error
 	Delete(id uint) error
-	CountByPostID(postID uint) (int64, error)
+	CountByPostID(postID, viewerID uint) (int64, error)
 }
 
 // repository implémentation de Repository
@@ -43,10 +43,19 @@ func (r *repository) GetByID(id uint) (*Comment, error) {
 	return &comment, nil
 }
 
-// GetByPostID récupère tous les commentaires d'un post avec pagination
-func (r *repository) GetByPostID(postID uint, limit, offset int) ([]Comment, error) {
+// visibleTo : un commentaire retenu n'est visible que de son auteur ; ceux des utilisateurs
+// que le lecteur a bloqués lui sont masqués
+func visibleTo(viewerID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("withheld = ? OR user_id = ?", false, viewerID).
+			Where("user_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)", viewerID)
+	}
+}
+
+// GetByPostID récupère les commentaires d'un post visibles du lecteur, avec pagination
+func (r *repository) GetByPostID(postID, viewerID uint, limit, offset int) ([]Comment, error) {
 	var comments []Comment
-	query := r.db.Where("post_id = ?", postID).Order("created_at DESC")
+	query := r.db.Scopes(visibleTo(viewerID)).Where("post_id = ?", postID).Order("created_at DESC")
 
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -71,10 +80,10 @@ func (r *repository) Delete(id uint) error {
 	return r.db.Delete(&Comment{}, id).Error
 }
 
-// CountByPostID compte le nombre de commentaires d'un post
-func (r *repository) CountByPostID(postID uint) (int64, error) {
+// CountByPostID compte les commentaires d'un post visibles du lecteur
+func (r *repository) CountByPostID(postID, viewerID uint) (int64, error) {
 	var count int64
-	if err := r.db.Model(&Comment{}).Where("post_id = ?", postID).Count(&count).Error; err != nil {
+	if err := r.db.Model(&Comment{}).Scopes(visibleTo(viewerID)).Where("post_id = ?", postID).Count(&count).Error; err != nil {
 		return 0, err
 	}
 	return count, nil
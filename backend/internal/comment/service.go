@@ -15,9 +15,10 @@ type PostRepository interface {
 // Service interface pour la logique métier des commentaires
 type Service interface {
 	CreateComment(userID uint, req CreateCommentRequest) (*CommentResponse, error)
-	GetCommentsByPostID(postID uint, page, limit int) ([]CommentResponse, int64, error)
+	GetCommentsByPostID(postID, viewerID uint, page, limit int) ([]CommentResponse, int64, error)
 	UpdateComment(userID, commentID uint, req UpdateCommentRequest) (*CommentResponse, error)
 	DeleteComment(userID, commentID uint) error
+	RemoveComment(commentID uint) error
 }
 
 type service struct {
@@ -43,16 +44,24 @@ func (s *service) CreateComment(userID uint, req CreateCommentRequest) (*Comment
 	}
 
 	// Vérifier que le post existe
-	_, err := s.postRepo.GetByID(req.PostID)
+	p, err := s.postRepo.GetByID(req.PostID)
 	if err != nil {
 		return nil, errors.New("post non trouvé")
 	}
 
+	// Auteur bloqué par le créateur du post : le commentaire est enregistré mais visible de lui seul,
+	// sans qu'il sache être bloqué
+	blocked, err := s.userRepo.IsBlocked(p.CreatorID, userID)
+	if err != nil {
+		return nil, errors.New("erreur lors de la création du commentaire")
+	}
+
 	// Créer le commentaire
 	comment := &Comment{
 		PostID:    req.PostID,
 		UserID:    userID,
 		Text:      req.Text,
+		Withheld:  blocked,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -80,8 +89,8 @@ func (s *service) CreateComment(userID uint, req CreateCommentRequest) (*Comment
 	return &response, nil
 }
 
-// GetCommentsByPostID récupère les commentaires d'un post avec pagination
-func (s *service) GetCommentsByPostID(postID uint, page, limit int) ([]CommentResponse, int64, error) {
+// GetCommentsByPostID récupère les commentaires d'un post visibles du lecteur, avec pagination
+func (s *service) GetCommentsByPostID(postID, viewerID uint, page, limit int) ([]CommentResponse, int64, error) {
 	if page <= 0 {
 		page = 1
 	}
@@ -90,11 +99,11 @@ func (s *service) GetCommentsByPostID(postID uint, page, limit int) ([]CommentRe
 	}
 	offset := (page - 1) * limit
 
-	comments, err := s.repo.GetByPostID(postID, limit, offset)
+	comments, err := s.repo.GetByPostID(postID, viewerID, limit, offset)
 	if err != nil {
 		return nil, 0, errors.New("erreur lors de la récupération des commentaires")
 	}
-	total, err := s.repo.CountByPostID(postID)
+	total, err := s.repo.CountByPostID(postID, viewerID)
 	if err != nil {
 		return nil, 0, errors.New("erreur lors du comptage des commentaires")
 	}
@@ -192,3 +201,14 @@ func (s *service) DeleteComment(userID, commentID uint) error {
 
 	return nil
 }
+
+// RemoveComment supprime un commentaire quel que soit son auteur (modération)
+func (s *service) RemoveComment(commentID uint) error {
+	if _, err := s.repo.GetByID(commentID); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(commentID); err != nil {
+		return errors.New("erreur lors de la suppression du commentaire")
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config regroupe toute la configuration de l'application.
+// Ordre de priorité : valeurs par défaut < fichier YAML < variables d'environnement.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Mail      MailConfig      `yaml:"mail"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Stripe    StripeConfig    `yaml:"stripe"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Video     VideoConfig     `yaml:"video"`
+	Documents DocumentsConfig `yaml:"documents"`
+	Antivirus AntivirusConfig `yaml:"antivirus"`
+	Realtime  RealtimeConfig  `yaml:"realtime"`
+}
+
+// ServerConfig : serveur HTTP et URLs publiques
+type ServerConfig struct {
+	Port          string `yaml:"port"`            // PORT
+	GinMode       string `yaml:"gin_mode"`        // GIN_MODE (debug | release)
+	PublicBaseURL string `yaml:"public_base_url"` // PUBLIC_BASE_URL : URL publique de l'API (callbacks OAuth)
+	FrontendURL   string `yaml:"frontend_url"`    // FRONTEND_URL : URL de l'app (liens envoyés par email)
+
+	// TRUSTED_PROXIES (IP ou CIDR séparés par des virgules) : reverse proxies dont X-Forwarded-For est cru pour
+	// l'IP du client (rate limiting) ; aucun par défaut, l'IP est alors celle de la connexion
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig : connexion PostgreSQL
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`     // PGHOST
+	Port     string `yaml:"port"`     // PGPORT
+	User     string `yaml:"user"`     // PGUSER
+	Password string `yaml:"password"` // PGPASSWORD
+	Name     string `yaml:"name"`     // PGDATABASE
+	SSLMode  string `yaml:"sslmode"`  // PGSSLMODE
+
+	AutoMigrate bool `yaml:"auto_migrate"` // DB_AUTO_MIGRATE : applique les migrations au démarrage (développement)
+}
+
+// DSN retourne la chaîne de connexion PostgreSQL
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Password, d.Name, d.SSLMode)
+}
+
+// OAuthProvider décrit un provider OAuth / OpenID Connect
+type OAuthProvider struct {
+	Name         string   `yaml:"name" json:"name"` // Nom utilisé dans les URLs (/auth/{name})
+	Type         string   `yaml:"type" json:"type"` // google, github, microsoft, apple ou oidc
+	ClientID     string   `yaml:"client_id" json:"client_id"`
+	ClientSecret string   `yaml:"client_secret" json:"client_secret"`
+	DiscoveryURL string   `yaml:"discovery_url" json:"discovery_url,omitempty"` // OIDC : .../.well-known/openid-configuration
+	Scopes       []string `yaml:"scopes" json:"scopes,omitempty"`
+
+	// Apple : le client secret peut être généré à partir de la clé privée (.p8)
+	TeamID     string `yaml:"team_id" json:"team_id,omitempty"`
+	KeyID      string `yaml:"key_id" json:"key_id,omitempty"`
+	PrivateKey string `yaml:"private_key" json:"private_key,omitempty"`
+}
+
+// AuthConfig : tokens, sessions OAuth et politique 2FA
+type AuthConfig struct {
+	JWTSecret                 string          `yaml:"jwt_secret"`                    // JWT_SECRET (obligatoire)
+	SessionSecret             string          `yaml:"session_secret"`                // SESSION_SECRET (cookie OAuth, JWT_SECRET par défaut)
+	OAuthProvidersFile        string          `yaml:"oauth_providers_file"`          // OAUTH_PROVIDERS_FILE (JSON)
+	OAuthProviders            []OAuthProvider `yaml:"oauth_providers"`               // Providers déclarés dans le YAML ou l'environnement
+	OAuthRedirectURIs         []string        `yaml:"oauth_redirect_uris"`           // OAUTH_REDIRECT_URIS (séparées par des virgules)
+	Require2FAForPaidCreators bool            `yaml:"require_2fa_for_paid_creators"` // REQUIRE_2FA_FOR_PAID_CREATORS
+}
+
+// MailConfig : envoi des emails transactionnels
+type MailConfig struct {
+	Driver       string `yaml:"driver"` // MAIL_DRIVER : smtp | log
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`    // MAIL_FROM
+	LogDir       string `yaml:"log_dir"` // MAIL_LOG_DIR (driver log)
+}
+
+// RateLimitConfig : store du rate limiting
+type RateLimitConfig struct {
+	Store    string `yaml:"store"`     // RATE_LIMIT_STORE : memory | redis
+	RedisURL string `yaml:"redis_url"` // REDIS_URL
+}
+
+// StripeConfig : paiements Stripe
+type StripeConfig struct {
+	SecretKey             string `yaml:"secret_key"`              // STRIPE_SECRET_KEY
+	WebhookSecret         string `yaml:"webhook_secret"`          // STRIPE_WEBHOOK_SECRET
+	SuccessURL            string `yaml:"success_url"`             // STRIPE_SUCCESS_URL
+	CancelURL             string `yaml:"cancel_url"`              // STRIPE_CANCEL_URL
+	DisableSignatureCheck bool   `yaml:"disable_signature_check"` // DISABLE_STRIPE_SIGNATURE_CHECK (tests uniquement)
+}
+
+// StorageConfig : stockage des fichiers uploadés
+type StorageConfig struct {
+	Driver        string        `yaml:"driver"`         // STORAGE_DRIVER : local | s3
+	LocalDir      string        `yaml:"local_dir"`      // STORAGE_LOCAL_DIR (driver local)
+	SigningSecret string        `yaml:"signing_secret"` // STORAGE_SIGNING_SECRET (URLs signées du driver local, JWT_SECRET par défaut)
+	URLTTL        time.Duration `yaml:"url_ttl"`        // STORAGE_URL_TTL : durée de validité des URLs signées (ex: 15m)
+	UploadExpiry  time.Duration `yaml:"upload_expiry"`  // UPLOAD_EXPIRY : durée de vie d'un upload fragmenté inachevé
+	S3            S3Config      `yaml:"s3"`
+}
+
+// S3Config : bucket S3-compatible (AWS S3, MinIO)
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`   // S3_ENDPOINT (ex: localhost:9000 pour MinIO)
+	Region    string `yaml:"region"`     // S3_REGION
+	Bucket    string `yaml:"bucket"`     // S3_BUCKET
+	AccessKey string `yaml:"access_key"` // S3_ACCESS_KEY
+	SecretKey string `yaml:"secret_key"` // S3_SECRET_KEY
+	UseSSL    bool   `yaml:"use_ssl"`    // S3_USE_SSL
+}
+
+// JobsConfig : workers de la file de jobs (traitement des médias…)
+type JobsConfig struct {
+	Workers      int           `yaml:"workers"`       // JOB_WORKERS : goroutines par instance (0 : pas de worker dans le serveur HTTP)
+	PollInterval time.Duration `yaml:"poll_interval"` // JOB_POLL_INTERVAL
+	JobTimeout   time.Duration `yaml:"job_timeout"`   // JOB_TIMEOUT : durée maximale d'un job
+}
+
+// VideoConfig : transcodage des vidéos en HLS (optionnel, nécessite ffmpeg et ffprobe)
+type VideoConfig struct {
+	Transcode   bool   `yaml:"transcode"`    // VIDEO_TRANSCODE
+	FFmpegPath  string `yaml:"ffmpeg_path"`  // FFMPEG_PATH
+	FFprobePath string `yaml:"ffprobe_path"` // FFPROBE_PATH
+}
+
+// DocumentsConfig : aperçu des documents (optionnel, nécessite pdftoppm de poppler-utils pour les PDF)
+type DocumentsConfig struct {
+	Preview      bool   `yaml:"preview"`       // DOCUMENT_PREVIEW
+	PdftoppmPath string `yaml:"pdftoppm_path"` // PDFTOPPM_PATH
+}
+
+// AntivirusConfig : analyse des uploads par clamd (optionnelle)
+type AntivirusConfig struct {
+	ClamdAddress string        `yaml:"clamd_address"` // CLAMD_ADDRESS : tcp://hôte:3310 ou unix:///chemin/clamd.ctl (vide : pas d'analyse)
+	Timeout      time.Duration `yaml:"timeout"`       // CLAMD_TIMEOUT : durée maximale d'une analyse
+}
+
+// RealtimeConfig : diffusion des événements temps réel (WebSocket) entre les instances
+type RealtimeConfig struct {
+	PubSub string `yaml:"pubsub"` // REALTIME_PUBSUB : memory (une seule instance) | postgres (LISTEN/NOTIFY)
+}
+
+// IsRelease indique si l'application tourne en mode production
+func (c *Config) IsRelease() bool {
+	return c.Server.GinMode == "release"
+}
+
+// Defaults retourne la configuration par défaut (développement local)
+func Defaults() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:          "8080",
+			GinMode:       "debug",
+			PublicBaseURL: "http://localhost:8080",
+			FrontendURL:   "http://localhost:3000",
+		},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    "5432",
+			SSLMode: "disable",
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			SMTPPort: 587,
+		},
+		RateLimit: RateLimitConfig{
+			Store: "memory",
+		},
+		Storage: StorageConfig{
+			Driver:       "local",
+			LocalDir:     "uploads",
+			URLTTL:       time.Hour,
+			UploadExpiry: 24 * time.Hour,
+			S3:           S3Config{UseSSL: true},
+		},
+		Jobs: JobsConfig{
+			Workers:      2,
+			PollInterval: 2 * time.Second,
+			JobTimeout:   10 * time.Minute,
+		},
+		Video: VideoConfig{
+			FFmpegPath:  "ffmpeg",
+			FFprobePath: "ffprobe",
+		},
+		Documents: DocumentsConfig{
+			PdftoppmPath: "pdftoppm",
+		},
+		Antivirus: AntivirusConfig{
+			Timeout: 5 * time.Minute,
+		},
+		Realtime: RealtimeConfig{
+			PubSub: "memory",
+		},
+	}
+}
+
+// FromEnv retourne la configuration par défaut surchargée par l'environnement, sans validation
+// (utile pour les tests et les outils) : les valeurs illisibles sont signalées et ignorées.
+func FromEnv() *Config {
+	cfg := Defaults()
+	for _, err := range applyEnv(cfg) {
+		log.Printf("⚠️ %v (valeur par défaut conservée)", err)
+	}
+	cfg.normalize()
+	return cfg
+}
+
+// Load charge la configuration (défauts, fichier YAML optionnel, environnement) puis la valide.
+// Une configuration invalide doit empêcher le démarrage.
+func Load(path string) (*Config, error) {
+	cfg := Defaults()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("lecture du fichier de configuration %s : %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("fichier de configuration %s invalide : %w", path, err)
+		}
+	}
+
+	if path := os.Getenv("OAUTH_PROVIDERS_FILE"); path != "" {
+		cfg.Auth.OAuthProvidersFile = path
+	}
+	if cfg.Auth.OAuthProvidersFile != "" {
+		providers, err := loadProvidersFile(cfg.Auth.OAuthProvidersFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Auth.OAuthProviders = mergeProviders(cfg.Auth.OAuthProviders, providers)
+	}
+
+	envErrs := applyEnv(cfg)
+	cfg.normalize()
+
+	if err := cfg.validate(envErrs); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// normalize nettoie les valeurs (slashs finaux, valeurs dérivées)
+func (c *Config) normalize() {
+	c.Server.PublicBaseURL = strings.TrimRight(c.Server.PublicBaseURL, "/")
+	c.Server.FrontendURL = strings.TrimRight(c.Server.FrontendURL, "/")
+	if c.Auth.SessionSecret == "" {
+		c.Auth.SessionSecret = c.Auth.JWTSecret
+	}
+	if c.Storage.SigningSecret == "" {
+		c.Storage.SigningSecret = c.Auth.JWTSecret
+	}
+	if len(c.Auth.OAuthRedirectURIs) == 0 {
+		c.Auth.OAuthRedirectURIs = []string{c.Server.FrontendURL + "/auth/callback"}
+	}
+}
+
+// Validate vérifie les valeurs obligatoires et leur cohérence ; toutes les erreurs sont remontées d'un coup
+func (c *Config) Validate() error {
+	return c.validate(nil)
+}
+
+// validate complète errs (ex: variables d'environnement illisibles) avec les erreurs de cohérence
+func (c *Config) validate(errs []error) error {
+
+	if c.Server.GinMode != "debug" && c.Server.GinMode != "release" && c.Server.GinMode != "test" {
+		errs = append(errs, fmt.Errorf("GIN_MODE invalide : %q (debug, release ou test)", c.Server.GinMode))
+	}
+	if _, err := strconv.Atoi(c.Server.Port); err != nil {
+		errs = append(errs, fmt.Errorf("PORT invalide : %q", c.Server.Port))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("TRUSTED_PROXIES : %q n'est ni une IP ni un CIDR", proxy))
+			}
+		}
+	}
+	for name, value := range map[string]string{"PUBLIC_BASE_URL": c.Server.PublicBaseURL, "FRONTEND_URL": c.Server.FrontendURL} {
+		if !isAbsoluteURL(value) {
+			errs = append(errs, fmt.Errorf("%s doit être une URL absolue : %q", name, value))
+		}
+	}
+
+	if c.Database.Host == "" || c.Database.User == "" || c.Database.Name == "" {
+		errs = append(errs, errors.New("PGHOST, PGUSER et PGDATABASE sont obligatoires"))
+	}
+
+	if c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET est obligatoire"))
+	} else if len(c.Auth.JWTSecret) < 32 {
+		log.Printf("⚠️ JWT_SECRET fait moins de 32 caractères : utilisez un secret plus long")
+	}
+	for _, uri := range c.Auth.OAuthRedirectURIs {
+		if u, err := url.Parse(uri); err != nil || u.Scheme == "" || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("OAUTH_REDIRECT_URIS : URI invalide %q", uri))
+		}
+	}
+	for _, p := range c.Auth.OAuthProviders {
+		if p.Type == "" || p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("provider OAuth %q : type et client_id obligatoires", p.Name))
+		}
+	}
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" || c.Mail.From == "" {
+			errs = append(errs, errors.New("MAIL_DRIVER=smtp nécessite SMTP_HOST et MAIL_FROM"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_DRIVER invalide : %q (smtp ou log)", c.Mail.Driver))
+	}
+
+	switch c.RateLimit.Store {
+	case "memory":
+	case "redis":
+		if c.RateLimit.RedisURL == "" {
+			errs = append(errs, errors.New("RATE_LIMIT_STORE=redis nécessite REDIS_URL"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE invalide : %q (memory ou redis)", c.RateLimit.Store))
+	}
+
+	switch c.Storage.Driver {
+	case "local":
+		if c.Storage.LocalDir == "" {
+			errs = append(errs, errors.New("STORAGE_DRIVER=local nécessite STORAGE_LOCAL_DIR"))
+		}
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" || c.Storage.S3.AccessKey == "" || c.Storage.S3.SecretKey == "" {
+			errs = append(errs, errors.New("STORAGE_DRIVER=s3 nécessite S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY et S3_SECRET_KEY"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_DRIVER invalide : %q (local ou s3)", c.Storage.Driver))
+	}
+	if c.Storage.URLTTL <= 0 {
+		errs = append(errs, fmt.Errorf("STORAGE_URL_TTL invalide : %s", c.Storage.URLTTL))
+	}
+	if c.Storage.UploadExpiry <= 0 {
+		errs = append(errs, fmt.Errorf("UPLOAD_EXPIRY invalide : %s", c.Storage.UploadExpiry))
+	}
+
+	if c.Jobs.Workers < 0 {
+		errs = append(errs, fmt.Errorf("JOB_WORKERS invalide : %d", c.Jobs.Workers))
+	}
+	if c.Jobs.PollInterval <= 0 || c.Jobs.JobTimeout <= 0 {
+		errs = append(errs, errors.New("JOB_POLL_INTERVAL et JOB_TIMEOUT doivent être positifs"))
+	}
+	if c.Video.Transcode && (c.Video.FFmpegPath == "" || c.Video.FFprobePath == "") {
+		errs = append(errs, errors.New("VIDEO_TRANSCODE nécessite FFMPEG_PATH et FFPROBE_PATH"))
+	}
+	if c.Documents.Preview && c.Documents.PdftoppmPath == "" {
+		errs = append(errs, errors.New("DOCUMENT_PREVIEW nécessite PDFTOPPM_PATH"))
+	}
+	if c.Antivirus.ClamdAddress != "" {
+		if u, err := url.Parse(c.Antivirus.ClamdAddress); err != nil || (u.Scheme != "tcp" && u.Scheme != "unix") {
+			errs = append(errs, fmt.Errorf("CLAMD_ADDRESS invalide : %q (tcp://hôte:port ou unix:///chemin)", c.Antivirus.ClamdAddress))
+		}
+		if c.Antivirus.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("CLAMD_TIMEOUT invalide : %s", c.Antivirus.Timeout))
+		}
+	}
+
+	switch c.Realtime.PubSub {
+	case "memory", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("REALTIME_PUBSUB invalide : %q (memory ou postgres)", c.Realtime.PubSub))
+	}
+
+	if c.IsRelease() {
+		if c.Stripe.DisableSignatureCheck {
+			errs = append(errs, errors.New("DISABLE_STRIPE_SIGNATURE_CHECK est interdit en mode release"))
+		}
+		if c.Stripe.SecretKey == "" || c.Stripe.WebhookSecret == "" {
+			errs = append(errs, errors.New("STRIPE_SECRET_KEY et STRIPE_WEBHOOK_SECRET sont obligatoires en mode release"))
+		}
+		if c.Mail.Driver != "smtp" {
+			log.Printf("⚠️ MAIL_DRIVER=%s en mode release : les emails ne seront pas envoyés", c.Mail.Driver)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("configuration invalide :\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// loadProvidersFile lit la liste des providers OAuth au format JSON
+func loadProvidersFile(path string) ([]OAuthProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture de %s : %w", path, err)
+	}
+	var providers []OAuthProvider
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("format invalide dans %s : %w", path, err)
+	}
+	return providers, nil
+}
+
+func isAbsoluteURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
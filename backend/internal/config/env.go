@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv surcharge la configuration avec les variables d'environnement définies ; les valeurs
+// illisibles (ex: JOB_WORKERS=abc) sont retournées pour que Load refuse de démarrer
+func applyEnv(cfg *Config) []error {
+	var errs []error
+	envString(&cfg.Server.Port, "PORT")
+	envString(&cfg.Server.GinMode, "GIN_MODE")
+	envString(&cfg.Server.PublicBaseURL, "PUBLIC_BASE_URL")
+	envString(&cfg.Server.FrontendURL, "FRONTEND_URL")
+	envList(&cfg.Server.TrustedProxies, "TRUSTED_PROXIES")
+
+	envString(&cfg.Database.Host, "PGHOST")
+	envString(&cfg.Database.Port, "PGPORT")
+	envString(&cfg.Database.User, "PGUSER")
+	envString(&cfg.Database.Password, "PGPASSWORD")
+	envString(&cfg.Database.Name, "PGDATABASE")
+	envString(&cfg.Database.SSLMode, "PGSSLMODE")
+	envBool(&errs, &cfg.Database.AutoMigrate, "DB_AUTO_MIGRATE")
+
+	envString(&cfg.Auth.JWTSecret, "JWT_SECRET")
+	envString(&cfg.Auth.SessionSecret, "SESSION_SECRET")
+	envList(&cfg.Auth.OAuthRedirectURIs, "OAUTH_REDIRECT_URIS")
+	envBool(&errs, &cfg.Auth.Require2FAForPaidCreators, "REQUIRE_2FA_FOR_PAID_CREATORS")
+	cfg.Auth.OAuthProviders = mergeProviders(cfg.Auth.OAuthProviders, providersFromEnv())
+
+	envString(&cfg.Mail.Driver, "MAIL_DRIVER")
+	envString(&cfg.Mail.SMTPHost, "SMTP_HOST")
+	envInt(&errs, &cfg.Mail.SMTPPort, "SMTP_PORT")
+	envString(&cfg.Mail.SMTPUsername, "SMTP_USERNAME")
+	envString(&cfg.Mail.SMTPPassword, "SMTP_PASSWORD")
+	envString(&cfg.Mail.From, "MAIL_FROM")
+	envString(&cfg.Mail.LogDir, "MAIL_LOG_DIR")
+
+	envString(&cfg.RateLimit.Store, "RATE_LIMIT_STORE")
+	envString(&cfg.RateLimit.RedisURL, "REDIS_URL")
+
+	envString(&cfg.Stripe.SecretKey, "STRIPE_SECRET_KEY")
+	envString(&cfg.Stripe.WebhookSecret, "STRIPE_WEBHOOK_SECRET")
+	envString(&cfg.Stripe.SuccessURL, "STRIPE_SUCCESS_URL")
+	envString(&cfg.Stripe.CancelURL, "STRIPE_CANCEL_URL")
+	envBool(&errs, &cfg.Stripe.DisableSignatureCheck, "DISABLE_STRIPE_SIGNATURE_CHECK")
+
+	envString(&cfg.Storage.Driver, "STORAGE_DRIVER")
+	envString(&cfg.Storage.LocalDir, "STORAGE_LOCAL_DIR")
+	envString(&cfg.Storage.SigningSecret, "STORAGE_SIGNING_SECRET")
+	envDuration(&errs, &cfg.Storage.URLTTL, "STORAGE_URL_TTL")
+	envDuration(&errs, &cfg.Storage.UploadExpiry, "UPLOAD_EXPIRY")
+	envString(&cfg.Storage.S3.Endpoint, "S3_ENDPOINT")
+	envString(&cfg.Storage.S3.Region, "S3_REGION")
+	envString(&cfg.Storage.S3.Bucket, "S3_BUCKET")
+	envString(&cfg.Storage.S3.AccessKey, "S3_ACCESS_KEY")
+	envString(&cfg.Storage.S3.SecretKey, "S3_SECRET_KEY")
+	envBool(&errs, &cfg.Storage.S3.UseSSL, "S3_USE_SSL")
+
+	envInt(&errs, &cfg.Jobs.Workers, "JOB_WORKERS")
+	envDuration(&errs, &cfg.Jobs.PollInterval, "JOB_POLL_INTERVAL")
+	envDuration(&errs, &cfg.Jobs.JobTimeout, "JOB_TIMEOUT")
+
+	envBool(&errs, &cfg.Video.Transcode, "VIDEO_TRANSCODE")
+	envString(&cfg.Video.FFmpegPath, "FFMPEG_PATH")
+	envString(&cfg.Video.FFprobePath, "FFPROBE_PATH")
+
+	envBool(&errs, &cfg.Documents.Preview, "DOCUMENT_PREVIEW")
+	envString(&cfg.Documents.PdftoppmPath, "PDFTOPPM_PATH")
+
+	envString(&cfg.Antivirus.ClamdAddress, "CLAMD_ADDRESS")
+	envDuration(&errs, &cfg.Antivirus.Timeout, "CLAMD_TIMEOUT")
+
+	envString(&cfg.Realtime.PubSub, "REALTIME_PUBSUB")
+	return errs
+}
+
+// providersFromEnv lit les providers OAuth déclarés par variables d'environnement
+func providersFromEnv() []OAuthProvider {
+	oidcName := os.Getenv("OIDC_NAME")
+	if oidcName == "" {
+		oidcName = "oidc"
+	}
+	candidates := []OAuthProvider{
+		{Name: "google", Type: "google", ClientID: os.Getenv("GOOGLE_KEY"), ClientSecret: os.Getenv("GOOGLE_SECRET")},
+		{Name: "github", Type: "github", ClientID: os.Getenv("GITHUB_KEY"), ClientSecret: os.Getenv("GITHUB_SECRET")},
+		{Name: "microsoft", Type: "microsoft", ClientID: os.Getenv("MICROSOFT_KEY"), ClientSecret: os.Getenv("MICROSOFT_SECRET")},
+		{
+			Name: "apple", Type: "apple",
+			ClientID: os.Getenv("APPLE_KEY"), ClientSecret: os.Getenv("APPLE_SECRET"),
+			TeamID: os.Getenv("APPLE_TEAM_ID"), KeyID: os.Getenv("APPLE_KEY_ID"), PrivateKey: os.Getenv("APPLE_PRIVATE_KEY"),
+		},
+		{
+			Name: oidcName, Type: "oidc",
+			ClientID: os.Getenv("OIDC_KEY"), ClientSecret: os.Getenv("OIDC_SECRET"), DiscoveryURL: os.Getenv("OIDC_DISCOVERY_URL"),
+		},
+	}
+
+	var providers []OAuthProvider
+	for _, p := range candidates {
+		if p.ClientID != "" {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// mergeProviders remplace les providers du fichier par ceux de l'environnement portant le même nom
+func mergeProviders(base, overrides []OAuthProvider) []OAuthProvider {
+	merged := append([]OAuthProvider{}, base...)
+	for _, o := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == o.Name {
+				merged[i] = o
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
+
+func envString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func envInt(errs *[]error, dst *int, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s invalide : entier attendu, reçu %q", key, v))
+		return
+	}
+	*dst = n
+}
+
+func envBool(errs *[]error, dst *bool, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s invalide : booléen attendu, reçu %q", key, v))
+		return
+	}
+	*dst = b
+}
+
+func envDuration(errs *[]error, dst *time.Duration, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s invalide : durée attendue (ex: 15m), reçu %q", key, v))
+		return
+	}
+	*dst = d
+}
+
+func envList(dst *[]string, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
@@ -1,51 +1,30 @@
 package db
 
 import (
-	"database/sql"
+	"backend/internal/config"
 	"fmt"
 	"log"
-	"os"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-
-	_ "github.com/lib/pq"
 )
 
-// DB est la connexion globale SQL
-var DB *sql.DB
-
-// GormDB est la connexion globale GORM
-var GormDB *gorm.DB
-
-// InitDB initialise la connexion PostgreSQL et GORM
-func InitDB() {
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("PGHOST"),
-		os.Getenv("PGPORT"),
-		os.Getenv("PGUSER"),
-		os.Getenv("PGPASSWORD"),
-		os.Getenv("PGDATABASE"),
-		os.Getenv("PGSSLMODE"),
-	)
-
-	var err error
-	DB, err = sql.Open("postgres", connStr)
+// Open ouvre la connexion PostgreSQL via GORM et vérifie qu'elle répond.
+// La connexion est retournée à l'appelant : aucun état global n'est conservé.
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	gdb, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
 	if err != nil {
-		log.Fatalf("Erreur ouverture DB : %v", err)
+		return nil, fmt.Errorf("ouverture GORM : %w", err)
 	}
 
-	err = DB.Ping()
+	sqlDB, err := gdb.DB()
 	if err != nil {
-		log.Fatalf("Impossible de ping la DB : %v", err)
+		return nil, fmt.Errorf("accès à la connexion SQL : %w", err)
 	}
-
-	// GORM avec la DSN, pas avec Conn: DB
-	GormDB, err = gorm.Open(postgres.Open(connStr), &gorm.Config{})
-	if err != nil {
-		log.Fatalf("Erreur ouverture GORM : %v", err)
+	if err := sqlDB.Ping(); err != nil {
+		return nil, fmt.Errorf("impossible de ping la DB : %w", err)
 	}
 
 	log.Println("✅ Connexion PostgreSQL & GORM OK")
+	return gdb, nil
 }
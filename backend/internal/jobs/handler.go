@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"backend/internal/user"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler : consultation de l'état des jobs
+type Handler struct {
+	queue *Queue
+}
+
+// NewHandler instancie un gestionnaire de route
+func NewHandler(q *Queue) *Handler {
+	return &Handler{queue: q}
+}
+
+// RegisterRoutes monte /jobs (jobs de l'utilisateur) et, sur le groupe admin, la dead-letter
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, admin *gin.RouterGroup) {
+	rg.GET("/jobs", h.ListMyJobs)
+	rg.GET("/jobs/:id", h.GetJob)
+
+	admin.GET("/jobs", h.ListJobs)
+	admin.POST("/jobs/:id/retry", h.RetryJob)
+}
+
+// GET /jobs
+// ListMyJobs godoc
+// @Summary      List my jobs
+// @Description  Background jobs started on behalf of the current user (e.g. processing of their media)
+// @Tags         jobs
+// @Security     BearerAuth
+// @Produce      json
+// @Param        status  query     string  false  "pending, running, succeeded or dead"
+// @Param        ref     query     string  false  "Related object, e.g. media:42"
+// @Success      200     {array}   jobs.JobDTO
+// @Failure      401     {object}  map[string]string "Unauthorized"
+// @Router       /api/jobs [get]
+func (h *Handler) ListMyJobs(c *gin.Context) {
+	userID := uint(c.GetInt("user_id"))
+	h.list(c, Filter{OwnerID: &userID, Status: c.Query("status"), Ref: c.Query("ref")})
+}
+
+// GET /admin/jobs
+// ListJobs godoc
+// @Summary      List jobs (admin)
+// @Description  List all jobs, e.g. status=dead for the dead-letter queue
+// @Tags         jobs
+// @Security     BearerAuth
+// @Produce      json
+// @Param        status  query     string  false  "pending, running, succeeded or dead"
+// @Param        kind    query     string  false  "Job kind, e.g. media.process"
+// @Param        ref     query     string  false  "Related object, e.g. media:42"
+// @Param        limit   query     int     false  "Max results (default 50, max 100)"
+// @Success      200     {array}   jobs.JobDTO
+// @Failure      403     {object}  map[string]string "Forbidden"
+// @Router       /api/admin/jobs [get]
+func (h *Handler) ListJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	h.list(c, Filter{Status: c.Query("status"), Kind: c.Query("kind"), Ref: c.Query("ref"), Limit: limit})
+}
+
+func (h *Handler) list(c *gin.Context, f Filter) {
+	list, err := h.queue.List(c.Request.Context(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération des jobs"})
+		return
+	}
+	result := make([]*JobDTO, len(list))
+	for i := range list {
+		result[i] = toDTO(&list[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GET /jobs/:id
+// GetJob godoc
+// @Summary      Get job status
+// @Description  Status, attempts and last error of a job (owner or admin only)
+// @Tags         jobs
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Job ID"
+// @Success      200  {object}  jobs.JobDTO
+// @Failure      404  {object}  map[string]string "Job not found"
+// @Router       /api/jobs/{id} [get]
+func (h *Handler) GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de job invalide"})
+		return
+	}
+	job, err := h.queue.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	userID := uint(c.GetInt("user_id"))
+	if c.GetString("role") != user.RoleAdmin && (job.OwnerID == nil || *job.OwnerID != userID) {
+		respondError(c, ErrJobNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, toDTO(job))
+}
+
+// POST /admin/jobs/:id/retry
+// RetryJob godoc
+// @Summary      Retry a dead job (admin)
+// @Description  Moves a dead-letter job back to pending with a fresh attempt budget
+// @Tags         jobs
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Job ID"
+// @Success      200  {object}  jobs.JobDTO
+// @Failure      404  {object}  map[string]string "Job not found"
+// @Failure      409  {object}  map[string]string "Job is not dead"
+// @Router       /api/admin/jobs/{id}/retry [post]
+func (h *Handler) RetryJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de job invalide"})
+		return
+	}
+	job, err := h.queue.Retry(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toDTO(job))
+}
+
+func respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrJobNotRetried):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du job"})
+	}
+}
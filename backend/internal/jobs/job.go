@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// Statuts d'un job
+const (
+	StatusPending   = "pending"   // En attente (y compris après un échec, jusqu'au prochain essai)
+	StatusRunning   = "running"   // Pris par un worker
+	StatusSucceeded = "succeeded" // Terminé
+	StatusDead      = "dead"      // Dead-letter : tentatives épuisées ou erreur définitive
+)
+
+// Job : tâche persistée dans la table jobs et exécutée par un worker
+type Job struct {
+	ID          uint64 `gorm:"primaryKey"`
+	Kind        string `gorm:"not null;index"` // Type de tâche, ex: media.process
+	Payload     string `gorm:"type:text;not null"`
+	OwnerID     *uint  `gorm:"index"` // Utilisateur autorisé à consulter le job
+	Ref         string `gorm:"index"` // Objet concerné, ex: media:42
+	Status      string `gorm:"not null;default:'pending'"`
+	Attempts    int    `gorm:"not null;default:0"`
+	MaxAttempts int    `gorm:"not null;default:5"`
+	RunAt       time.Time
+	LockedAt    *time.Time
+	LockedBy    string
+	LastError   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+// JobDTO pour les réponses API
+type JobDTO struct {
+	ID          uint64     `json:"id"`
+	Kind        string     `json:"kind"`
+	Ref         string     `json:"ref,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	RunAt       time.Time  `json:"run_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+func toDTO(j *Job) *JobDTO {
+	return &JobDTO{
+		ID:          j.ID,
+		Kind:        j.Kind,
+		Ref:         j.Ref,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		RunAt:       j.RunAt,
+		LastError:   j.LastError,
+		CreatedAt:   j.CreatedAt,
+		FinishedAt:  j.FinishedAt,
+	}
+}
+
+// permanentError : erreur pour laquelle un nouvel essai ne servirait à rien
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marque une erreur comme définitive : le job passe directement en dead-letter
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent indique si l'erreur a été marquée avec Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Backoff retourne le délai avant le prochain essai : 10s, 20s, 40s… plafonné à 1h
+func Backoff(attempt int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
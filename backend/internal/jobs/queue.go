@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrJobNotFound   = errors.New("job introuvable")
+	ErrJobNotRetried = errors.New("seul un job en dead-letter peut être relancé")
+)
+
+// Option personnalise un job à l'enqueue
+type Option func(*Job)
+
+// WithOwner rend le job consultable par l'utilisateur
+func WithOwner(userID uint) Option {
+	return func(j *Job) { j.OwnerID = &userID }
+}
+
+// WithRef associe le job à un objet (ex: media:42)
+func WithRef(ref string) Option {
+	return func(j *Job) { j.Ref = ref }
+}
+
+// WithMaxAttempts fixe le nombre maximal d'essais
+func WithMaxAttempts(n int) Option {
+	return func(j *Job) { j.MaxAttempts = n }
+}
+
+// WithDelay diffère la première exécution
+func WithDelay(d time.Duration) Option {
+	return func(j *Job) { j.RunAt = j.RunAt.Add(d) }
+}
+
+// Filter : critères de ListJobs
+type Filter struct {
+	OwnerID *uint
+	Status  string
+	Kind    string
+	Ref     string
+	Limit   int
+}
+
+// Queue : file de jobs persistée dans PostgreSQL
+type Queue struct {
+	db *gorm.DB
+}
+
+func NewQueue(db *gorm.DB) *Queue {
+	return &Queue{db: db}
+}
+
+// Enqueue ajoute un job
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}, opts ...Option) (*Job, error) {
+	return EnqueueTx(q.db.WithContext(ctx), kind, payload, opts...)
+}
+
+// EnqueueTx ajoute un job dans une transaction existante : le job n'existe que si la transaction est validée
+func EnqueueTx(tx *gorm.DB, kind string, payload interface{}, opts ...Option) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		Kind:        kind,
+		Payload:     string(data),
+		Status:      StatusPending,
+		MaxAttempts: 5,
+		RunAt:       time.Now(),
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Claim réserve jusqu'à limit jobs prêts ; SKIP LOCKED permet à plusieurs workers (et replicas) de se partager la file
+func (q *Queue) Claim(ctx context.Context, workerID string, kinds []string, limit int) ([]Job, error) {
+	var claimed []Job
+	err := q.db.WithContext(ctx).Raw(`
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, locked_at = now(), locked_by = ?, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= now() AND kind IN ?
+			ORDER BY run_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		StatusRunning, workerID, StatusPending, kinds, limit,
+	).Scan(&claimed).Error
+	return claimed, err
+}
+
+// MarkSucceeded termine un job
+func (q *Queue) MarkSucceeded(ctx context.Context, job *Job) error {
+	now := time.Now()
+	return q.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status = ?", job.ID, StatusRunning).
+		Updates(map[string]interface{}{
+			"status":      StatusSucceeded,
+			"locked_at":   nil,
+			"locked_by":   "",
+			"last_error":  "",
+			"finished_at": now,
+			"updated_at":  now,
+		}).Error
+}
+
+// MarkFailed replanifie le job avec backoff, ou le passe en dead-letter si les essais sont épuisés
+func (q *Queue) MarkFailed(ctx context.Context, job *Job, cause error) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"locked_at":  nil,
+		"locked_by":  "",
+		"last_error": cause.Error(),
+		"updated_at": now,
+	}
+	if IsPermanent(cause) || job.Attempts >= job.MaxAttempts {
+		updates["status"] = StatusDead
+		updates["finished_at"] = now
+	} else {
+		updates["status"] = StatusPending
+		updates["run_at"] = now.Add(Backoff(job.Attempts))
+	}
+	return q.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status = ?", job.ID, StatusRunning).
+		Updates(updates).Error
+}
+
+// RequeueStale remet en attente les jobs bloqués en running (worker arrêté brutalement)
+func (q *Queue) RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	res := q.db.WithContext(ctx).Model(&Job{}).
+		Where("status = ? AND locked_at < ?", StatusRunning, lockedBefore).
+		Updates(map[string]interface{}{
+			"status":     StatusPending,
+			"locked_at":  nil,
+			"locked_by":  "",
+			"last_error": "verrou expiré : worker interrompu",
+			"run_at":     time.Now(),
+			"updated_at": time.Now(),
+		})
+	return res.RowsAffected, res.Error
+}
+
+// Get récupère un job
+func (q *Queue) Get(ctx context.Context, id uint64) (*Job, error) {
+	var job Job
+	err := q.db.WithContext(ctx).First(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List retourne les jobs les plus récents correspondant au filtre
+func (q *Queue) List(ctx context.Context, f Filter) ([]Job, error) {
+	query := q.db.WithContext(ctx).Model(&Job{})
+	if f.OwnerID != nil {
+		query = query.Where("owner_id = ?", *f.OwnerID)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.Kind != "" {
+		query = query.Where("kind = ?", f.Kind)
+	}
+	if f.Ref != "" {
+		query = query.Where("ref = ?", f.Ref)
+	}
+	if f.Limit <= 0 || f.Limit > 100 {
+		f.Limit = 50
+	}
+	var list []Job
+	err := query.Order("id DESC").Limit(f.Limit).Find(&list).Error
+	return list, err
+}
+
+// Retry relance un job en dead-letter avec un nouveau quota d'essais
+func (q *Queue) Retry(ctx context.Context, id uint64) (*Job, error) {
+	res := q.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status = ?", id, StatusDead).
+		Updates(map[string]interface{}{
+			"status":      StatusPending,
+			"attempts":    0,
+			"run_at":      time.Now(),
+			"finished_at": nil,
+			"updated_at":  time.Now(),
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := q.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotRetried
+	}
+	return q.Get(ctx, id)
+}
@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"backend/internal/config"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HandlerFunc exécute un job ; une erreur déclenche un nouvel essai (ou la dead-letter si Permanent)
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// Store : opérations de la file utilisées par les workers (implémentée par *Queue)
+type Store interface {
+	Claim(ctx context.Context, workerID string, kinds []string, limit int) ([]Job, error)
+	MarkSucceeded(ctx context.Context, job *Job) error
+	MarkFailed(ctx context.Context, job *Job, cause error) error
+	RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error)
+}
+
+// Worker : pool de goroutines qui consomment la file
+type Worker struct {
+	store    Store
+	cfg      config.JobsConfig
+	id       string
+	handlers map[string]HandlerFunc
+}
+
+// NewWorker instancie un pool de cfg.Workers goroutines
+func NewWorker(store Store, cfg config.JobsConfig) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		store:    store,
+		cfg:      cfg,
+		id:       fmt.Sprintf("%s-%s", host, uuid.New().String()[:8]),
+		handlers: map[string]HandlerFunc{},
+	}
+}
+
+// Handle enregistre le handler d'un type de job
+func (w *Worker) Handle(kind string, h HandlerFunc) {
+	w.handlers[kind] = h
+}
+
+func (w *Worker) kinds() []string {
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// Run consomme la file jusqu'à l'annulation du contexte, puis attend la fin des jobs en cours
+func (w *Worker) Run(ctx context.Context) {
+	if len(w.handlers) == 0 || w.cfg.Workers <= 0 {
+		return
+	}
+	log.Printf("⚙️ Worker %s démarré (%d goroutines, jobs : %v)", w.id, w.cfg.Workers, w.kinds())
+
+	slots := make(chan struct{}, w.cfg.Workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	lastRequeue := time.Time{}
+
+	for {
+		// Les jobs verrouillés depuis plus longtemps que le timeout appartiennent à un worker disparu
+		if time.Since(lastRequeue) > w.cfg.JobTimeout {
+			if n, err := w.store.RequeueStale(ctx, time.Now().Add(-2*w.cfg.JobTimeout)); err != nil {
+				log.Printf("⚠️ Jobs bloqués non relancés : %v", err)
+			} else if n > 0 {
+				log.Printf("♻️ %d job(s) bloqué(s) remis en attente", n)
+			}
+			lastRequeue = time.Now()
+		}
+
+		free := w.cfg.Workers - len(slots)
+		if free > 0 {
+			claimed, err := w.store.Claim(ctx, w.id, w.kinds(), free)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Réservation de jobs impossible : %v", err)
+			}
+			for i := range claimed {
+				job := claimed[i]
+				slots <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-slots }()
+					w.Execute(ctx, &job)
+				}()
+			}
+			// File non vide : on repasse immédiatement
+			if len(claimed) == free {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Execute exécute un job réservé et enregistre son résultat
+func (w *Worker) Execute(ctx context.Context, job *Job) {
+	err := w.run(ctx, job)
+
+	// Le résultat est enregistré même si le contexte du worker est annulé pendant l'exécution
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		if err := w.store.MarkSucceeded(saveCtx, job); err != nil {
+			log.Printf("⚠️ Job %d (%s) terminé mais non enregistré : %v", job.ID, job.Kind, err)
+		}
+		return
+	}
+
+	log.Printf("❌ Job %d (%s) essai %d/%d : %v", job.ID, job.Kind, job.Attempts, job.MaxAttempts, err)
+	if err := w.store.MarkFailed(saveCtx, job, err); err != nil {
+		log.Printf("⚠️ Échec du job %d non enregistré : %v", job.ID, err)
+	}
+}
+
+func (w *Worker) run(ctx context.Context, job *Job) (err error) {
+	handler, ok := w.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("aucun handler pour le type %q", job.Kind))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic : %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.JobTimeout)
+	defer cancel()
+	return handler(ctx, job)
+}
@@ -7,8 +7,8 @@ import (
 // Like représente un like sur un post
 type Like struct {
 	ID        uint      `gorm:"primaryKey"`
-	PostID    uint      `gorm:"not null;index"`
-	UserID    uint      `gorm:"not null;index"`
+	PostID    uint      `gorm:"not null;index;uniqueIndex:idx_likes_post_user"` // Unicité (post_id, user_id) : migration 0003
+	UserID    uint      `gorm:"not null;index;uniqueIndex:idx_likes_post_user"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
 }
 
@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MaxSent : nombre d'emails conservés en mémoire par LogMailer ; au-delà, les plus anciens sont oubliés
+// (un serveur lancé par erreur avec le driver log ne voit pas sa mémoire grossir indéfiniment)
+const MaxSent = 100
+
+// LogMailer est un mailer de développement et de test :
+// les emails sont écrits dans Dir (un fichier .eml par email) ou simplement journalisés.
+type LogMailer struct {
+	Dir string
+
+	mu   sync.Mutex
+	Sent []Message // Derniers emails envoyés, MaxSent au plus (pratique pour les tests)
+}
+
+// Send enregistre le message au lieu de l'envoyer
+func (m *LogMailer) Send(msg Message) error {
+	m.mu.Lock()
+	if len(m.Sent) >= MaxSent {
+		m.Sent = append(m.Sent[:0], m.Sent[len(m.Sent)-MaxSent+1:]...)
+	}
+	m.Sent = append(m.Sent, msg)
+	m.mu.Unlock()
+
+	if m.Dir == "" {
+		log.Printf("📧 [MAIL] À: %s | Sujet: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0750); err != nil {
+		return fmt.Errorf("impossible de créer le dossier des emails: %v", err)
+	}
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), sanitizeAddress(msg.To))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, buildRFC822("dev@thinkshare.local", msg), 0640); err != nil {
+		return err
+	}
+	log.Printf("📧 [MAIL] Email pour %s écrit dans %s", msg.To, path)
+	return nil
+}
+
+// LastTo retourne le dernier email envoyé à une adresse
+func (m *LogMailer) LastTo(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.Sent) - 1; i >= 0; i-- {
+		if m.Sent[i].To == to {
+			return m.Sent[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// sanitizeAddress rend une adresse utilisable dans un nom de fichier
+func sanitizeAddress(addr string) string {
+	out := []rune{}
+	for _, r := range addr {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			out = append(out, r)
+		} else {
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
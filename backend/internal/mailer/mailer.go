@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"backend/internal/config"
+	"log"
+)
+
+// Message représente un email à envoyer (texte brut)
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer est l'interface d'envoi d'emails utilisée par l'application
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New construit le mailer selon la configuration ("smtp" ou "log")
+func New(cfg config.MailConfig) Mailer {
+	if cfg.Driver == "smtp" {
+		log.Printf("📧 Mailer SMTP configuré (%s:%d)", cfg.SMTPHost, cfg.SMTPPort)
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	}
+	log.Printf("📧 Mailer de développement (log) configuré")
+	return &LogMailer{Dir: cfg.LogDir}
+}
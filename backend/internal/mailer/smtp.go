@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer envoie les emails via un serveur SMTP (STARTTLS si supporté)
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send envoie le message au destinataire
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.Host == "" || m.From == "" {
+		return fmt.Errorf("configuration SMTP incomplète (SMTP_HOST / MAIL_FROM)")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.From, []string{msg.To}, buildRFC822(m.From, msg))
+}
+
+// buildRFC822 construit le message brut (en-têtes + corps) en UTF-8 ; le sujet est encodé en mots MIME
+func buildRFC822(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n") // En-tête ASCII (RFC 2047)
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,22 @@
+package media
+
+import (
+	"backend/internal/jobs"
+	"context"
+	"errors"
+)
+
+// ErrPostNotFound : post inexistant (contrôle d'accès aux médias d'un post)
+var ErrPostNotFound = errors.New("post non trouvé")
+
+// PostAccess vérifie l'accès au contenu d'un post (implémenté par post.Service,
+// le paquet post dépendant déjà de media)
+type PostAccess interface {
+	// CanViewPost indique si viewerID a accès au post ; ErrPostNotFound si le post n'existe pas
+	CanViewPost(postID, viewerID uint) (bool, error)
+}
+
+// Enqueuer planifie un job (implémenté par jobs.Queue)
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, payload interface{}, opts ...jobs.Option) (*jobs.Job, error)
+}
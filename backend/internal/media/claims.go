@@ -0,0 +1,104 @@
+package media
+
+import (
+	"backend/internal/jobs"
+	"backend/internal/storage"
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// claimTTL borne une réservation oubliée (processus arrêté entre le dépôt du fichier et la création du média)
+const claimTTL = time.Hour
+
+// StorageClaim réserve un fichier partagé entre son dépôt dans le stockage et la création du média qui le référence :
+// tant qu'elle court, media.release et le nettoyage des orphelins le comptent comme une référence
+type StorageClaim struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	StorageKey string    `gorm:"not null;index" json:"storage_key"`
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Claimer dépose les fichiers sous leur clé adressée par le contenu sans course avec l'effacement
+// de la dernière référence d'un fichier identique
+type Claimer interface {
+	// Promote range le fichier temporaire sous sa clé définitive et réserve celle-ci jusqu'à Done ou Abandon
+	Promote(ctx context.Context, tmpKey, key string) (uint, error)
+	// Done lève les réservations une fois les médias créés
+	Done(claimIDs ...uint)
+	// Abandon lève les réservations de médias qui n'ont pas été créés ; media.release efface alors
+	// les fichiers que plus rien ne référence
+	Abandon(claimIDs ...uint)
+}
+
+type claimer struct {
+	db    *gorm.DB
+	blobs storage.Blob
+}
+
+// NewClaimer instancie le Claimer adossé à la table storage_claims
+func NewClaimer(db *gorm.DB, blobs storage.Blob) Claimer {
+	if db == nil || blobs == nil {
+		panic("database and storage cannot be nil")
+	}
+	return &claimer{db: db, blobs: blobs}
+}
+
+func (c *claimer) Promote(ctx context.Context, tmpKey, key string) (uint, error) {
+	claim := StorageClaim{StorageKey: key, ExpiresAt: time.Now().Add(claimTTL)}
+	// Sous le verrou de la clé : un effacement en cours se termine avant la réservation, un effacement suivant la voit
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := LockStorageKeyTx(tx, key); err != nil {
+			return err
+		}
+		if err := tx.Where("storage_key = ? AND expires_at < ?", key, time.Now()).Delete(&StorageClaim{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&claim).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := storage.Promote(ctx, c.blobs, tmpKey, key); err != nil {
+		c.Abandon(claim.ID)
+		return 0, err
+	}
+	return claim.ID, nil
+}
+
+func (c *claimer) Done(claimIDs ...uint) {
+	if len(claimIDs) == 0 {
+		return
+	}
+	if err := c.db.Delete(&StorageClaim{}, claimIDs).Error; err != nil {
+		log.Printf("⚠️ Réservations %v non levées (elles expireront) : %v", claimIDs, err)
+	}
+}
+
+func (c *claimer) Abandon(claimIDs ...uint) {
+	if len(claimIDs) == 0 {
+		return
+	}
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		var claims []StorageClaim
+		if err := tx.Where("id IN ?", claimIDs).Find(&claims).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&StorageClaim{}, claimIDs).Error; err != nil {
+			return err
+		}
+		for _, claim := range claims {
+			payload := ReleasePayload{Key: claim.StorageKey, Keys: []string{claim.StorageKey}}
+			if _, err := jobs.EnqueueTx(tx, ReleaseJobKind, payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ Réservations %v non abandonnées (le nettoyage des orphelins s'en chargera) : %v", claimIDs, err)
+	}
+}
@@ -1,9 +1,13 @@
 package media
 
 import (
+	"backend/internal/auth"
+	"backend/internal/jobs"
+	"backend/internal/user"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,11 +15,14 @@ import (
 // Structure du gestionnaire HTTP pour les médias
 type Handler struct {
 	service Service
+	posts   PostAccess
+	queue   Enqueuer
 }
 
-// Créer une nouvelle instance du gestionnaire
-func NewHandler(service Service) *Handler {
-	return &Handler{service: service}
+// Créer une nouvelle instance du gestionnaire ; posts contrôle l'accès aux médias rattachés,
+// queue reçoit les nettoyages du stockage
+func NewHandler(service Service, posts PostAccess, queue Enqueuer) *Handler {
+	return &Handler{service: service, posts: posts, queue: queue}
 }
 
 // Enregistrer les routes du gestionnaire
@@ -27,7 +34,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	media.DELETE("/:id", h.DeleteMedia)
 	media.GET("/post/:postID", h.GetMediasByPostID)
 	media.PUT("/:id/metadata", h.UpdateMediaMetadata)
-	media.POST("/cleanup", h.CleanupOrphanedMedia)
+	media.POST("/cleanup", auth.RequireRole(user.RoleAdmin), h.CleanupOrphanedMedia)
+	media.GET("/:id/duplicates", auth.RequireRole(user.RoleModerator), h.GetDuplicates)
 }
 
 // Récupérer un média par son ID
@@ -41,30 +49,13 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 // @Param        id   path      int  true  "Media ID"
 // @Success      200  {object}  media.Media
 // @Failure      400  {object}  map[string]string "Invalid media ID"
+// @Failure      403  {object}  map[string]string "No access to the post of the media"
 // @Failure      404  {object}  map[string]string "Media not found"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/media/{id} [get]
 func (h *Handler) GetMediaByID(c *gin.Context) {
-	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de média invalide"})
-		return
-	}
-
-	media, err := h.service.GetMediaByID(uint(id))
-	if err != nil {
-		status := http.StatusNotFound
-		message := "Média non trouvé"
-
-		// Vérifier si c'est une erreur de base de données ou autre
-		if strings.Contains(err.Error(), "record not found") {
-			message = "Média introuvable dans la base de données"
-		} else {
-			status = http.StatusInternalServerError
-			message = "Erreur lors de la récupération du média"
-		}
-
-		c.JSON(status, gin.H{"error": message})
+	media, ok := h.findMedia(c)
+	if !ok || !h.authorizeView(c, media) {
 		return
 	}
 
@@ -81,46 +72,64 @@ func (h *Handler) GetMediaByID(c *gin.Context) {
 // @Success      200  {object}  map[string]interface{} "Media deleted successfully"
 // @Failure      400  {object}  map[string]string "Invalid media ID"
 // @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Not the owner of the media"
 // @Failure      404  {object}  map[string]string "Media not found"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/media/{id} [delete]
 func (h *Handler) DeleteMedia(c *gin.Context) {
-	// Vérifier que l'utilisateur est autorisé
-	userID := c.GetInt("user_id")
-	if userID <= 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Non autorisé"})
+	// Récupérer le média pour vérifier les permissions
+	media, ok := h.findMedia(c)
+	if !ok || !h.authorizeChange(c, media) {
 		return
 	}
 
-	// Récupérer l'ID du média
+	// Supprimer le média
+	if err := h.service.DeleteMedia(media.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression du média"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Média supprimé avec succès",
+		"id":        media.ID,
+		"type":      media.MediaType,
+		"file_name": media.FileName,
+	})
+}
+
+// Lister les doublons exacts d'un média (modération)
+// GetDuplicates godoc
+// @Summary      List exact duplicates of a media (moderators, admin)
+// @Description  Media rows sharing the same SHA-256 content hash, i.e. the same stored file
+// @Tags         media
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Media ID"
+// @Success      200  {object}  map[string]interface{} "Duplicates of the media"
+// @Failure      400  {object}  map[string]string "Invalid media ID"
+// @Failure      404  {object}  map[string]string "Media not found"
+// @Router       /api/media/{id}/duplicates [get]
+func (h *Handler) GetDuplicates(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de média invalide"})
 		return
 	}
 
-	// Récupérer le média pour vérifier les permissions
-	media, err := h.service.GetMediaByID(uint(id))
-	if err != nil {
+	duplicates, err := h.service.FindDuplicates(uint(id))
+	if errors.Is(err, ErrMediaNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Média non trouvé"})
 		return
 	}
-
-	// TODO: Vérifier que l'utilisateur est autorisé à supprimer ce média
-	// Dans une implémentation réelle, on vérifierait que le média appartient
-	// à l'utilisateur ou que l'utilisateur est administrateur
-
-	// Supprimer le média
-	if err := h.service.DeleteMedia(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression du média"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la recherche des doublons"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":   "Média supprimé avec succès",
-		"id":        id,
-		"type":      media.MediaType,
-		"file_name": media.FileName,
+		"id":         id,
+		"duplicates": duplicates,
+		"count":      len(duplicates),
 	})
 }
 
@@ -134,6 +143,8 @@ func (h *Handler) DeleteMedia(c *gin.Context) {
 // @Param        postID   path      int  true  "Post ID"
 // @Success      200  {object}  map[string]interface{} "List of media for the post"
 // @Failure      400  {object}  map[string]string "Invalid post ID"
+// @Failure      403  {object}  map[string]string "No access to the post"
+// @Failure      404  {object}  map[string]string "Post not found"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/media/post/{postID} [get]
 func (h *Handler) GetMediasByPostID(c *gin.Context) {
@@ -142,6 +153,9 @@ func (h *Handler) GetMediasByPostID(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de post invalide"})
 		return
 	}
+	if c.GetString("role") != user.RoleAdmin && !h.authorizePost(c, uint(postID)) {
+		return
+	}
 
 	medias, err := h.service.GetMediasByPostID(uint(postID))
 	if err != nil {
@@ -169,20 +183,13 @@ func (h *Handler) GetMediasByPostID(c *gin.Context) {
 // @Success      200  {object}  map[string]interface{} "Metadata updated successfully"
 // @Failure      400  {object}  map[string]string "Invalid input"
 // @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Not the owner of the media"
+// @Failure      404  {object}  map[string]string "Media not found"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/media/{id}/metadata [put]
 func (h *Handler) UpdateMediaMetadata(c *gin.Context) {
-	// Vérifier que l'utilisateur est autorisé
-	userID := c.GetInt("user_id")
-	if userID <= 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Non autorisé"})
-		return
-	}
-
-	// Récupérer l'ID du média
-	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de média invalide"})
+	media, ok := h.findMedia(c)
+	if !ok || !h.authorizeChange(c, media) {
 		return
 	}
 
@@ -191,55 +198,104 @@ func (h *Handler) UpdateMediaMetadata(c *gin.Context) {
 		Metadata string `json:"metadata"`
 	}
 
-	// Lire les données de la requête
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// Lire les données de la requête (les métadonnées sont relues en JSON par l'API des posts)
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Metadata != "" && !json.Valid([]byte(req.Metadata))) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Données de requête invalides"})
 		return
 	}
 
 	// Mettre à jour les métadonnées
-	if err := h.service.UpdateMediaMetadata(uint(id), req.Metadata); err != nil {
+	if err := h.service.UpdateMediaMetadata(media.ID, req.Metadata); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour des métadonnées"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Métadonnées mises à jour avec succès",
-		"id":      id,
+		"id":      media.ID,
 	})
 }
 
-// Nettoyer les fichiers médias orphelins
+// Planifier le nettoyage des fichiers médias orphelins
 // CleanupOrphanedMedia godoc
 // @Summary      Cleanup orphaned media files
-// @Description  Delete all media files not referenced in the database (admin only)
+// @Description  Schedule a background job deleting the stored files no longer referenced by any media (admin only); follow it with GET /api/jobs/{id}
 // @Tags         media
 // @Security     BearerAuth
 // @Produce      json
-// @Success      200  {object}  map[string]interface{} "Cleanup result"
+// @Success      202  {object}  map[string]interface{} "Cleanup job scheduled"
 // @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Forbidden"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/media/cleanup [post]
 func (h *Handler) CleanupOrphanedMedia(c *gin.Context) {
-	// Cette action devrait être réservée aux administrateurs
-	userID := c.GetInt("user_id")
-	if userID <= 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Non autorisé"})
+	// Le rôle administrateur est vérifié par auth.RequireRole au niveau de la route ;
+	// le parcours du stockage est fait par un worker (job media.cleanup), pas pendant la requête
+	userID := uint(c.GetInt("user_id"))
+	job, err := h.queue.Enqueue(c.Request.Context(), CleanupJobKind, struct{}{}, jobs.WithOwner(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la planification du nettoyage"})
 		return
 	}
 
-	// TODO: Vérifier que l'utilisateur est administrateur
-	// Dans une implémentation réelle, on vérifierait le rôle de l'utilisateur
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Nettoyage des médias orphelins planifié",
+		"job_id":  job.ID,
+		"status":  job.Status,
+	})
+}
 
-	// Nettoyer les médias orphelins
-	deleted, err := h.service.CleanupOrphanedMedia()
+// findMedia charge le média de la route (:id) ; la réponse d'erreur est déjà écrite si ok est faux
+func (h *Handler) findMedia(c *gin.Context) (*Media, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du nettoyage des médias orphelins"})
-		return
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de média invalide"})
+		return nil, false
 	}
+	media, err := h.service.GetMediaByID(uint(id))
+	if errors.Is(err, ErrMediaNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Média non trouvé"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du média"})
+		return nil, false
+	}
+	return media, true
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "Nettoyage des médias orphelins terminé",
-		"deleted_files": deleted,
-	})
+// authorizeView : l'auteur du média et les admins y ont toujours accès, les autres via le post qui le contient
+func (h *Handler) authorizeView(c *gin.Context, media *Media) bool {
+	if media.OwnerID == uint(c.GetInt("user_id")) || c.GetString("role") == user.RoleAdmin {
+		return true
+	}
+	if media.PostID == 0 {
+		// Upload pas encore publié : son existence n'est pas révélée aux autres utilisateurs
+		c.JSON(http.StatusNotFound, gin.H{"error": "Média non trouvé"})
+		return false
+	}
+	return h.authorizePost(c, media.PostID)
+}
+
+// authorizePost applique au post les règles d'accès de l'API des posts (contenu payant réservé aux abonnés)
+func (h *Handler) authorizePost(c *gin.Context, postID uint) bool {
+	ok, err := h.posts.CanViewPost(postID, uint(c.GetInt("user_id")))
+	switch {
+	case errors.Is(err, ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post non trouvé"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la vérification de l'accès"})
+	case !ok:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Accès au média refusé"})
+	}
+	return err == nil && ok
+}
+
+// authorizeChange : seuls l'auteur du média et les admins peuvent le modifier ou le supprimer
+func (h *Handler) authorizeChange(c *gin.Context, media *Media) bool {
+	if media.OwnerID == uint(c.GetInt("user_id")) || c.GetString("role") == user.RoleAdmin {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Seul l'auteur du média peut le modifier"})
+	return false
 }
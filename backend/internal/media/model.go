@@ -1,12 +1,145 @@
 package media
 
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
 type Media struct {
 	ID           uint `gorm:"primaryKey;autoIncrement"`
-	PostID       uint
+	PostID       uint // 0 tant qu'un média uploadé n'est pas rattaché à un post
+	MessageID    uint `gorm:"index"`     // Pièce jointe d'un message privé (0 sinon) : jamais rattachable à un post
+	Position     int  `gorm:"default:0"` // Ordre d'affichage dans le post
+	OwnerID      uint `gorm:"index"`     // Utilisateur qui a uploadé le fichier
 	MediaURL     string
 	MediaType    string
 	ThumbnailURL string // URL de la miniature pour les images et vidéos
 	Metadata     string `gorm:"type:text"` // Métadonnées au format JSON
 	FileSize     int64  `gorm:"default:0"` // Taille du fichier en octets
 	FileName     string // Nom original du fichier
+	// SHA-256 (hex) du contenu : MediaURL en est dérivée, plusieurs médias peuvent partager le même fichier
+	ContentHash string `gorm:"index"`
+	// Texte extrait des documents (recherche, modération) ; jamais exposé tel quel par l'API
+	ExtractedText string `gorm:"type:text" json:"-"`
+	// État du traitement en arrière-plan (pending, processing, ready, failed)
+	ProcessingStatus string `gorm:"default:ready"`
+	// Verdict de l'antivirus (vide : média antérieur à l'analyse), signature détectée ou erreur, date de l'analyse
+	ScanStatus string
+	ScanResult string
+	ScannedAt  *time.Time
+	// Versions redimensionnées des images (miniature, fil, plein écran), voir internal/mediaproc
+	Variants []Variant `gorm:"serializer:json;type:text"`
+}
+
+// États du traitement d'un média
+const (
+	ProcessingPending = "pending"    // Job en attente
+	ProcessingRunning = "processing" // Job en cours (transcodage…)
+	ProcessingReady   = "ready"      // Variantes et métadonnées disponibles
+	ProcessingFailed  = "failed"     // Traitement abandonné : seul l'original est disponible
+)
+
+// Verdicts de l'analyse antivirus
+const (
+	ScanPending  = "pending"  // Pas encore analysé : le fichier n'est pas servi
+	ScanClean    = "clean"    // Aucune menace détectée
+	ScanInfected = "infected" // Menace détectée : fichier déplacé en quarantaine
+	ScanError    = "error"    // Analyse impossible (antivirus injoignable, fichier trop gros…) : le fichier n'est pas servi
+	ScanSkipped  = "skipped"  // Aucun antivirus configuré
+)
+
+// QuarantinePrefix : dossier de stockage des fichiers infectés, jamais servis
+const QuarantinePrefix = "quarantine/"
+
+// Noms des variantes
+const (
+	VariantThumbnail = "thumbnail" // Images
+	VariantFeed      = "feed"      // Images
+	VariantFull      = "full"      // Images
+	VariantPoster    = "poster"    // Vidéos : image extraite de la vidéo
+	VariantHLS       = "hls"       // Vidéos : playlist HLS maître (format m3u8)
+	VariantPreview   = "preview"   // Documents : aperçu de la première page
+)
+
+// Variant : version dérivée d'un média (image redimensionnée sans EXIF, poster ou HLS d'une vidéo)
+type Variant struct {
+	Name   string `json:"name"`   // thumbnail, feed, full, poster, hls ou preview
+	Format string `json:"format"` // jpeg, webp ou m3u8
+	Key    string `json:"key"`    // Clé de stockage
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+}
+
+// Variant retourne la variante demandée, ou nil si elle n'existe pas
+func (m *Media) Variant(name, format string) *Variant {
+	for i := range m.Variants {
+		if m.Variants[i].Name == name && m.Variants[i].Format == format {
+			return &m.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Servable indique si le fichier peut être servi : analysé sans menace, ou sans antivirus
+func (m *Media) Servable() bool {
+	switch m.ScanStatus {
+	case ScanPending, ScanInfected, ScanError:
+		return false
+	}
+	return true
+}
+
+// StorageKeys retourne toutes les clés de stockage du média (original, miniature, variantes)
+func (m *Media) StorageKeys() []string {
+	keys := []string{m.MediaURL}
+	if m.ThumbnailURL != "" {
+		keys = append(keys, m.ThumbnailURL)
+	}
+	for _, v := range m.Variants {
+		if v.Key != m.ThumbnailURL && v.Format != "m3u8" {
+			keys = append(keys, v.Key)
+		}
+	}
+	return keys
+}
+
+// HLSPrefix retourne le dossier de l'échelle HLS d'une vidéo (playlists, segments, poster), ou "" s'il n'y en a pas
+func (m *Media) HLSPrefix() string {
+	if v := m.Variant(VariantHLS, "m3u8"); v != nil {
+		return path.Dir(v.Key) + "/"
+	}
+	return ""
+}
+
+// ProcessJobKind : job de traitement d'un média (miniature, métadonnées), voir internal/mediaproc
+const ProcessJobKind = "media.process"
+
+// ProcessPayload : payload du job ProcessJobKind
+type ProcessPayload struct {
+	MediaID uint `json:"media_id"`
+}
+
+// ReleaseJobKind : job qui efface les fichiers d'un média supprimé si plus aucun média ne les référence
+const ReleaseJobKind = "media.release"
+
+// ReleasePayload : payload du job ReleaseJobKind (clés relevées au moment de la suppression)
+type ReleasePayload struct {
+	Key       string   `json:"key"`                  // Original partagé (compteur de références)
+	Keys      []string `json:"keys"`                 // Original, miniature et variantes
+	HLSPrefix string   `json:"hls_prefix,omitempty"` // Dossier HLS d'une vidéo
+}
+
+// NewReleasePayload relève les fichiers d'un média avant sa suppression
+func NewReleasePayload(m *Media) ReleasePayload {
+	return ReleasePayload{Key: m.MediaURL, Keys: m.StorageKeys(), HLSPrefix: m.HLSPrefix()}
+}
+
+// CleanupJobKind : job qui efface les fichiers du stockage que plus aucun média ne référence (POST /api/media/cleanup)
+const CleanupJobKind = "media.cleanup"
+
+// JobRef identifie un média dans les jobs (ex: media:42)
+func JobRef(id uint) string {
+	return fmt.Sprintf("media:%d", id)
 }
@@ -1,18 +1,31 @@
 package media
 
 import (
+	"backend/internal/jobs"
 	"errors"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+var ErrMediaNotFound = errors.New("média non trouvé")
+
 // Interface du repository pour les médias
 type Repository interface {
 	Create(media *Media) error
 	FindByID(id uint) (*Media, error)
 	FindByPostID(postID uint) ([]Media, error)
+	// FindByMessageIDs liste les pièces jointes des messages, dans l'ordre d'envoi
+	FindByMessageIDs(messageIDs []uint) ([]Media, error)
 	FindAll() ([]Media, error)
 	Update(media *Media) error
+	// Delete supprime le média ; ses fichiers sont effacés par un job s'il en était la dernière référence
 	Delete(id uint) error
+	// WithStorageKey verrouille un fichier partagé (déduplication par contenu) le temps de fn, qui reçoit son nombre
+	// de références (médias et réservations en cours) : aucun média ne peut le réserver pendant que fn l'efface
+	WithStorageKey(key string, fn func(refs int64) error) error
+	// FindByContentHash liste les médias de même contenu (doublons exacts)
+	FindByContentHash(hash string) ([]Media, error)
 }
 
 type repositoryImpl struct {
@@ -35,17 +48,27 @@ func (r *repositoryImpl) FindByID(id uint) (*Media, error) {
 	result := r.db.First(&media, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("média non trouvé")
+			return nil, ErrMediaNotFound
 		}
 		return nil, result.Error
 	}
 	return &media, nil
 }
 
-// Trouver tous les médias associés à un post
+// Trouver tous les médias associés à un post, dans l'ordre d'affichage
 func (r *repositoryImpl) FindByPostID(postID uint) ([]Media, error) {
 	var medias []Media
-	result := r.db.Where("post_id = ?", postID).Find(&medias)
+	result := r.db.Where("post_id = ?", postID).Order("position ASC, id ASC").Find(&medias)
+	return medias, result.Error
+}
+
+// Trouver les pièces jointes des messages, dans l'ordre d'envoi
+func (r *repositoryImpl) FindByMessageIDs(messageIDs []uint) ([]Media, error) {
+	var medias []Media
+	if len(messageIDs) == 0 {
+		return medias, nil
+	}
+	result := r.db.Where("message_id IN ?", messageIDs).Order("message_id ASC, position ASC, id ASC").Find(&medias)
 	return medias, result.Error
 }
 
@@ -63,5 +86,56 @@ func (r *repositoryImpl) Update(media *Media) error {
 
 // Supprimer un média
 func (r *repositoryImpl) Delete(id uint) error {
-	return r.db.Delete(&Media{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var media Media
+		if err := tx.First(&media, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&media).Error; err != nil {
+			return err
+		}
+		return EnqueueReleaseTx(tx, media)
+	})
+}
+
+// Verrouiller un fichier et compter ses références le temps de fn
+func (r *repositoryImpl) WithStorageKey(key string, fn func(refs int64) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := LockStorageKeyTx(tx, key); err != nil {
+			return err
+		}
+		var medias, claims int64
+		if err := tx.Model(&Media{}).Where("media_url = ?", key).Count(&medias).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&StorageClaim{}).Where("storage_key = ? AND expires_at > ?", key, time.Now()).Count(&claims).Error; err != nil {
+			return err
+		}
+		return fn(medias + claims)
+	})
+}
+
+// LockStorageKeyTx sérialise, jusqu'à la fin de la transaction, les opérations sur un fichier partagé
+// (réservation avant dépôt, effacement de la dernière référence)
+func LockStorageKeyTx(tx *gorm.DB, key string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
+}
+
+// Trouver les médias de même contenu, du plus ancien au plus récent
+func (r *repositoryImpl) FindByContentHash(hash string) ([]Media, error) {
+	var medias []Media
+	result := r.db.Where("content_hash = ?", hash).Order("id ASC").Find(&medias)
+	return medias, result.Error
+}
+
+// EnqueueReleaseTx planifie, dans la transaction qui supprime des médias, l'effacement de leurs fichiers ;
+// le job revérifie le compteur de références au moment de s'exécuter
+func EnqueueReleaseTx(tx *gorm.DB, medias ...Media) error {
+	for i := range medias {
+		payload := NewReleasePayload(&medias[i])
+		if _, err := jobs.EnqueueTx(tx, ReleaseJobKind, payload, jobs.WithRef(JobRef(medias[i].ID))); err != nil {
+			return err
+		}
+	}
+	return nil
 }
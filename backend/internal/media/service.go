@@ -1,29 +1,37 @@
 package media
 
 import (
+	"backend/internal/storage"
+	"context"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
+	"time"
 )
 
+// orphanGracePeriod : un fichier plus récent peut appartenir à un upload ou un traitement en cours
+// dont le média n'est pas encore enregistré ; le nettoyage l'ignore
+const orphanGracePeriod = time.Hour
+
 // Interface de service pour les médias
 type Service interface {
 	GetMediaByID(id uint) (*Media, error)
 	GetMediasByPostID(postID uint) ([]Media, error)
 	DeleteMedia(id uint) error
+	FindDuplicates(id uint) ([]Media, error)
 	UpdateMediaMetadata(id uint, metadata string) error
-	CleanupOrphanedMedia() (int, error)
+	CleanupOrphanedMedia(ctx context.Context) (int, error)
 }
 
 type serviceImpl struct {
-	repo Repository
+	repo  Repository
+	blobs storage.Blob
 }
 
-// Créer une nouvelle instance du service
-func NewService(repo Repository) Service {
-	return &serviceImpl{repo: repo}
+// Créer une nouvelle instance du service (MediaURL et ThumbnailURL sont des clés de blobs)
+func NewService(repo Repository, blobs storage.Blob) Service {
+	return &serviceImpl{repo: repo, blobs: blobs}
 }
 
 // Récupérer un média par son ID
@@ -36,29 +44,34 @@ func (s *serviceImpl) GetMediasByPostID(postID uint) ([]Media, error) {
 	return s.repo.FindByPostID(postID)
 }
 
-// Supprimer un média
+// Supprimer un média ; le fichier partagé n'est effacé (par le job media.release) qu'avec sa dernière référence
 func (s *serviceImpl) DeleteMedia(id uint) error {
-	// Récupérer d'abord le média
-	media, err := s.repo.FindByID(id)
-	if err != nil {
+	if _, err := s.repo.FindByID(id); err != nil {
 		return err
 	}
+	return s.repo.Delete(id)
+}
 
-	// Supprimer le fichier physique
-	if err := os.Remove(media.MediaURL); err != nil && !os.IsNotExist(err) {
-		log.Printf("⚠️ Impossible de supprimer le fichier %s: %v", media.MediaURL, err)
-		// On continue même si le fichier n'a pas pu être supprimé
+// Lister les autres médias au contenu identique (modération des doublons exacts)
+func (s *serviceImpl) FindDuplicates(id uint) ([]Media, error) {
+	media, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
 	}
-
-	// Supprimer la miniature si elle existe
-	if media.ThumbnailURL != "" {
-		if err := os.Remove(media.ThumbnailURL); err != nil && !os.IsNotExist(err) {
-			log.Printf("⚠️ Impossible de supprimer la miniature %s: %v", media.ThumbnailURL, err)
+	duplicates := []Media{}
+	if media.ContentHash == "" {
+		return duplicates, nil
+	}
+	all, err := s.repo.FindByContentHash(media.ContentHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range all {
+		if m.ID != media.ID {
+			duplicates = append(duplicates, m)
 		}
 	}
-
-	// Supprimer l'entrée en base de données
-	return s.repo.Delete(id)
+	return duplicates, nil
 }
 
 // Mettre à jour les métadonnées d'un média
@@ -76,8 +89,8 @@ func (s *serviceImpl) UpdateMediaMetadata(id uint, metadata string) error {
 	return s.repo.Update(media)
 }
 
-// Nettoyer les fichiers médias orphelins (sans référence en BDD)
-func (s *serviceImpl) CleanupOrphanedMedia() (int, error) {
+// Nettoyer les fichiers médias orphelins (sans référence en BDD) ; exécuté par le job media.cleanup
+func (s *serviceImpl) CleanupOrphanedMedia(ctx context.Context) (int, error) {
 	// Récupérer tous les médias en base de données
 	allMedia, err := s.repo.FindAll()
 	if err != nil {
@@ -87,63 +100,83 @@ func (s *serviceImpl) CleanupOrphanedMedia() (int, error) {
 	// Créer une map pour recherche rapide
 	mediaMap := make(map[string]bool)
 	thumbnailMap := make(map[string]bool)
+	hlsMap := make(map[string]bool)
 
 	for _, m := range allMedia {
 		mediaMap[m.MediaURL] = true
 		if m.ThumbnailURL != "" {
 			thumbnailMap[m.ThumbnailURL] = true
 		}
+		for _, v := range m.Variants {
+			thumbnailMap[v.Key] = true
+		}
+		if prefix := m.HLSPrefix(); prefix != "" {
+			hlsMap[prefix] = true
+		}
 	}
 
 	// Compter les fichiers supprimés
 	deleted := 0
 
-	// Parcourir les dossiers de média
-	foldersToCheck := []string{"uploads/images", "uploads/videos", "uploads/documents", "uploads/thumbnails"}
-
-	for _, folder := range foldersToCheck {
-		// Vérifier si le dossier existe
-		if _, err := os.Stat(folder); os.IsNotExist(err) {
-			continue
-		}
-
-		// Parcourir tous les fichiers du dossier
-		err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+	// Parcourir les préfixes de média
+	prefixesToCheck := []string{"images/", "videos/", "documents/", "thumbnails/", "variants/", "hls/", "staging/"}
 
-			// Ignorer les dossiers
-			if info.IsDir() {
+	for _, prefix := range prefixesToCheck {
+		err := s.blobs.List(ctx, prefix, func(obj storage.ObjectInfo) error {
+			if time.Since(obj.ModTime) < orphanGracePeriod {
 				return nil
 			}
-
 			// Vérifier si le fichier est référencé en BDD
-			if strings.Contains(path, "/thumbnails/") {
-				// Pour les miniatures
-				if !thumbnailMap[path] {
-					// Le fichier n'est pas référencé, on le supprime
-					log.Printf("🗑️ Suppression d'une miniature orpheline: %s", path)
-					if err := os.Remove(path); err == nil {
+			if strings.HasPrefix(obj.Key, "staging/") && strings.Contains(strings.TrimPrefix(obj.Key, "staging/"), "/") {
+				// Fragment d'upload reprenable (staging/{upload}/…, avant chunks/) : géré par upload.PurgeExpired
+				return nil
+			}
+			if strings.HasPrefix(obj.Key, "staging/") {
+				// Fichier temporaire d'un upload interrompu (voir storage.PutHashed)
+				log.Printf("🗑️ Suppression d'un fichier temporaire abandonné: %s", obj.Key)
+				if err := s.blobs.Delete(ctx, obj.Key); err == nil {
+					deleted++
+				}
+			} else if strings.HasPrefix(obj.Key, "hls/") {
+				// Pour les vidéos HLS, c'est le dossier de la vidéo qui est référencé
+				if !hlsMap[path.Dir(obj.Key)+"/"] && !hlsMap[path.Dir(path.Dir(obj.Key))+"/"] {
+					log.Printf("🗑️ Suppression d'un fichier HLS orphelin: %s", obj.Key)
+					if err := s.blobs.Delete(ctx, obj.Key); err == nil {
 						deleted++
 					}
 				}
-			} else {
-				// Pour les autres fichiers média
-				if !mediaMap[path] {
+			} else if strings.HasPrefix(obj.Key, "thumbnails/") || strings.HasPrefix(obj.Key, "variants/") {
+				// Pour les miniatures et variantes d'images
+				if !thumbnailMap[obj.Key] {
 					// Le fichier n'est pas référencé, on le supprime
-					log.Printf("🗑️ Suppression d'un média orphelin: %s", path)
-					if err := os.Remove(path); err == nil {
+					log.Printf("🗑️ Suppression d'une miniature orpheline: %s", obj.Key)
+					if err := s.blobs.Delete(ctx, obj.Key); err == nil {
 						deleted++
 					}
 				}
+			} else {
+				// Pour les autres fichiers média
+				if !mediaMap[obj.Key] {
+					// Le fichier n'est pas référencé, on le supprime après revérification sous le verrou de la clé
+					// (un dépôt du même contenu a pu le réserver depuis le relevé)
+					return s.repo.WithStorageKey(obj.Key, func(refs int64) error {
+						if refs > 0 {
+							return nil
+						}
+						log.Printf("🗑️ Suppression d'un média orphelin: %s", obj.Key)
+						if err := s.blobs.Delete(ctx, obj.Key); err == nil {
+							deleted++
+						}
+						return nil
+					})
+				}
 			}
 
 			return nil
 		})
 
 		if err != nil {
-			return deleted, fmt.Errorf("erreur lors du parcours du dossier %s: %v", folder, err)
+			return deleted, fmt.Errorf("erreur lors du parcours de %s: %v", prefix, err)
 		}
 	}
 
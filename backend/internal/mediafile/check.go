@@ -0,0 +1,483 @@
+package mediafile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRejected enveloppe les refus de Check et Save (fichier dangereux, type non pris en charge, trop volumineux,
+// contenu ne correspondant pas à l'extension)
+var ErrRejected = errors.New("fichier refusé")
+
+// Types de médias supportés
+const (
+	Image    = "image"
+	Video    = "video"
+	Document = "document"
+)
+
+// --- FORMATS DE FICHIERS ---
+
+// DocumentFormats retourne la liste des formats document supportés
+func DocumentFormats() []string {
+	return []string{
+		".pdf",          // Format document portable
+		".doc", ".docx", // Formats Microsoft Word
+		".ppt", ".pptx", // Formats Microsoft PowerPoint
+		".xls", ".xlsx", // Formats Microsoft Excel
+		".txt",                 // Texte brut
+		".csv",                 // Valeurs séparées par des virgules
+		".md",                  // Markdown
+		".odt", ".ods", ".odp", // OpenDocument
+	}
+}
+
+// VideoFormats retourne la liste des formats vidéo supportés
+func VideoFormats() []string {
+	return []string{
+		".mp4",  // Format le plus courant et compatible
+		".webm", // Format web ouvert
+		".mov",  // Format Apple QuickTime
+		".avi",  // Format Microsoft
+		".mkv",  // Format conteneur Matroska
+		".m4v",  // Format Apple iTunes
+	}
+}
+
+// ImageFormats retourne la liste des formats image supportés
+func ImageFormats() []string {
+	return []string{
+		".jpg", ".jpeg", // Format JPEG
+		".png",  // Format PNG pour les images avec transparence
+		".gif",  // Format GIF pour les animations simples
+		".webp", // Format Web moderne avec compression améliorée
+		".svg",  // Format vectoriel
+	}
+}
+
+// --- VALIDATION DES FICHIERS ---
+
+// hasFormat vérifie si l'extension du fichier figure parmi les formats
+func hasFormat(filename string, formats []string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, format := range formats {
+		if ext == format {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImage vérifie si un fichier est une image valide
+func IsImage(filename string) bool {
+	return hasFormat(filename, ImageFormats())
+}
+
+// IsVideo vérifie si un fichier est une vidéo valide
+func IsVideo(filename string) bool {
+	return hasFormat(filename, VideoFormats())
+}
+
+// IsDocument vérifie si un fichier est un document valide
+func IsDocument(filename string) bool {
+	return hasFormat(filename, DocumentFormats())
+}
+
+// TypeOf retourne le type de média d'un fichier d'après son extension ("" si non pris en charge)
+func TypeOf(filename string) string {
+	switch {
+	case IsImage(filename):
+		return Image
+	case IsVideo(filename):
+		return Video
+	case IsDocument(filename):
+		return Document
+	}
+	return ""
+}
+
+// --- LIMITES DE TAILLE ---
+
+// MaxSizes : tailles maximales par type de média, communes à l'envoi direct (posts, pièces jointes des messages)
+// et aux uploads fragmentés
+var MaxSizes = map[string]int64{
+	Image:    10 * 1024 * 1024,       // 10 MB
+	Video:    2 * 1024 * 1024 * 1024, // 2 GB
+	Document: 20 * 1024 * 1024,       // 20 MB
+}
+
+// MaxPDFSize : les PDF ont une limite plus basse que les autres documents
+const MaxPDFSize = 10 * 1024 * 1024
+
+// Libellés des types de médias dans les messages d'erreur
+var typeLabels = map[string]string{
+	Image:    "image",
+	Video:    "vidéo",
+	Document: "document",
+}
+
+// CheckSize vérifie la taille d'un fichier selon son type de média (et son extension pour les PDF)
+func CheckSize(mediaType, filename string, size int64) error {
+	if size <= 0 {
+		return errors.New("taille de fichier invalide")
+	}
+	maxSize, label := MaxSizes[mediaType], typeLabels[mediaType]
+	if mediaType == Document && strings.ToLower(filepath.Ext(filename)) == ".pdf" {
+		maxSize, label = MaxPDFSize, "PDF"
+	}
+	if size > maxSize {
+		log.Printf("❌ %s trop volumineux: %.2f MB (max %.2f MB)", label, float64(size)/(1024*1024), float64(maxSize)/(1024*1024))
+		return fmt.Errorf("%s trop volumineux (maximum %.2f MB autorisés)", label, float64(maxSize)/(1024*1024))
+	}
+	return nil
+}
+
+// --- SÉCURITÉ ---
+
+// IsSuspicious vérifie si un fichier est potentiellement dangereux
+func IsSuspicious(filename string) bool {
+	// Liste d'extensions potentiellement dangereuses
+	dangerousExtensions := map[string]bool{
+		// Exécutables
+		".exe": true,
+		".bat": true,
+		".cmd": true,
+		".sh":  true,
+		".com": true,
+		".dll": true,
+		".msi": true,
+		".bin": true,
+		".app": true,
+		".dmg": true,
+
+		// Scripts
+		".php":  true,
+		".js":   true,
+		".vbs":  true,
+		".ps1":  true,
+		".py":   true,
+		".rb":   true,
+		".pl":   true,
+		".asp":  true,
+		".aspx": true,
+		".jsp":  true,
+		".cgi":  true,
+
+		// Archives potentiellement dangereuses
+		".jar": true,
+		".war": true,
+		".iso": true,
+
+		// Macros et autres
+		".scr": true,
+		".reg": true,
+		".inf": true,
+		".hta": true,
+	}
+
+	// Vérifier l'extension
+	ext := strings.ToLower(filepath.Ext(filename))
+	if dangerousExtensions[ext] {
+		log.Printf("⚠️ Extension de fichier potentiellement dangereuse détectée: %s", ext)
+		return true
+	}
+
+	// Vérifier les doubles extensions (exemple: image.jpg.exe)
+	nameParts := strings.Split(strings.ToLower(filename), ".")
+	if len(nameParts) > 2 {
+		// Ignorer la première partie (nom de base)
+		for i := 1; i < len(nameParts)-1; i++ {
+			extCandidate := "." + nameParts[len(nameParts)-1]
+			if dangerousExtensions[extCandidate] {
+				log.Printf("⚠️ Détection d'extension double potentiellement dangereuse: %s", filename)
+				return true
+			}
+		}
+	}
+
+	// Vérifier les noms de fichiers suspects
+	suspiciousPatterns := []string{
+		"virus", "malware", "hack", "crack", "keygen", "pirate",
+		"trojan", "exploit", "backdoor", "rootkit", "ransom",
+	}
+
+	lowerFilename := strings.ToLower(filename)
+	for _, pattern := range suspiciousPatterns {
+		if strings.Contains(lowerFilename, pattern) {
+			log.Printf("⚠️ Nom de fichier suspect détecté: %s (contient '%s')", filename, pattern)
+			return true
+		}
+	}
+
+	return false
+}
+
+// SanitizeName nettoie le nom de fichier pour éviter les injections
+func SanitizeName(filename string) string {
+	// Remplacer les caractères potentiellement problématiques
+	sanitized := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, filename)
+
+	// S'assurer que le nom ne commence pas par un point (fichier caché)
+	if strings.HasPrefix(sanitized, ".") {
+		sanitized = "_" + sanitized[1:]
+	}
+
+	return sanitized
+}
+
+// --- TYPE MIME ET CONTENU ---
+
+// ValidateMimeType vérifie si le type MIME annoncé correspond à l'extension déclarée
+func ValidateMimeType(file *multipart.FileHeader) bool {
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	mimeType := file.Header.Get("Content-Type")
+
+	// Si le document_type semble suspect, on tente une détection plus précise
+	if strings.Contains(mimeType, "application/octet-stream") {
+		if head, err := ReadHead(file); err == nil {
+			detectedType := Sniff(file.Filename, head)
+			if detectedType != mimeType {
+				log.Printf("ℹ️ Type MIME détecté différent: %s au lieu de %s", detectedType, mimeType)
+				mimeType = detectedType
+			}
+		}
+	}
+
+	return mimeMatchesExt(ext, mimeType)
+}
+
+// mimeMatchesExt vérifie que le type MIME correspond à l'un des types attendus pour l'extension
+func mimeMatchesExt(ext, mimeType string) bool {
+	// Mapper des extensions aux types MIME attendus
+	mimeMap := map[string][]string{
+		// Images
+		".jpg":  {"image/jpeg", "image/jpg"},
+		".jpeg": {"image/jpeg", "image/jpg"},
+		".png":  {"image/png"},
+		".gif":  {"image/gif"},
+		".webp": {"image/webp"},
+		".svg":  {"image/svg+xml", "image/svg"},
+
+		// Vidéos
+		".mp4":  {"video/mp4", "application/mp4"},
+		".webm": {"video/webm"},
+		".mov":  {"video/quicktime"},
+		".avi":  {"video/x-msvideo", "video/avi"},
+		".mkv":  {"video/x-matroska"},
+		".m4v":  {"video/x-m4v", "video/mp4"},
+
+		// Documents
+		".pdf":  {"application/pdf"},
+		".doc":  {"application/msword"},
+		".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		".xls":  {"application/vnd.ms-excel"},
+		".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		".ppt":  {"application/vnd.ms-powerpoint"},
+		".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		".txt":  {"text/plain"},
+		".csv":  {"text/csv", "application/csv", "text/plain"},
+		".md":   {"text/markdown", "text/plain"},
+	}
+
+	// Types spéciaux qui peuvent utiliser application/octet-stream
+	// (les formats Office binaires n'ont pas de signature reconnue par la détection)
+	specialBinaryTypes := map[string]bool{
+		".doc":  true,
+		".xls":  true,
+		".ppt":  true,
+		".docx": true,
+		".xlsx": true,
+		".pptx": true,
+		".zip":  true,
+		".mov":  true,
+		".mp4":  true,
+	}
+
+	// Vérifier si le type MIME correspond à l'un des types attendus pour l'extension
+	if validTypes, exists := mimeMap[ext]; exists {
+		for _, validType := range validTypes {
+			if strings.Contains(mimeType, validType) {
+				return true
+			}
+		}
+
+		// Cas spécial: certains types peuvent être envoyés comme application/octet-stream
+		if specialBinaryTypes[ext] && strings.Contains(mimeType, "application/octet-stream") {
+			log.Printf("ℹ️ Type MIME générique accepté pour %s: %s", ext, mimeType)
+			return true
+		}
+
+		// Si on arrive ici, le type MIME ne correspond pas à l'extension
+		log.Printf("⚠️ Type MIME suspect: %s ne correspond pas à l'extension %s", mimeType, ext)
+		return false
+	}
+
+	// Pour les extensions non répertoriées, on accepte mais on journalise
+	log.Printf("ℹ️ Extension non répertoriée: %s avec type MIME %s", ext, mimeType)
+	return true
+}
+
+// Sniff détermine le type MIME d'un fichier à partir de ses premiers octets (512 suffisent)
+// Utilise la signature magic number pour identifier le vrai type du fichier
+func Sniff(filename string, buffer []byte) string {
+	// Utiliser la fonction DetectContentType du package http
+	documentType := http.DetectContentType(buffer)
+
+	// Vérifier des signatures spécifiques pour plus de précision
+	if bytes.HasPrefix(buffer, []byte("%PDF")) {
+		return "application/pdf"
+	}
+
+	if bytes.HasPrefix(buffer, []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}) {
+		return "image/png"
+	}
+
+	if bytes.HasPrefix(buffer, []byte{0xFF, 0xD8}) {
+		return "image/jpeg"
+	}
+
+	if bytes.HasPrefix(buffer, []byte("GIF87a")) || bytes.HasPrefix(buffer, []byte("GIF89a")) {
+		return "image/gif"
+	}
+
+	// Check pour les fichiers MS Office (DOCX, XLSX, PPTX sont des archives ZIP)
+	if bytes.HasPrefix(buffer, []byte{0x50, 0x4B, 0x03, 0x04}) {
+		// C'est un ZIP, pourrait être DOCX/XLSX/PPTX
+		extension := strings.ToLower(filepath.Ext(filename))
+		switch extension {
+		case ".docx":
+			return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+		case ".xlsx":
+			return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		case ".pptx":
+			return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+		case ".zip":
+			return "application/zip"
+		}
+	}
+
+	// Vérifier les exécutables Windows (commencent par MZ)
+	if bytes.HasPrefix(buffer, []byte{0x4D, 0x5A}) {
+		log.Printf("⚠️ ALERTE: Signature d'exécutable Windows (MZ) détectée dans le fichier %s", filename)
+		return "application/x-msdownload"
+	}
+
+	// Vérifier les scripts
+	if bytes.Contains(buffer, []byte("<?php")) {
+		log.Printf("⚠️ ALERTE: Code PHP détecté dans le fichier %s", filename)
+		return "text/x-php"
+	}
+
+	if bytes.Contains(buffer, []byte("<script")) {
+		log.Printf("⚠️ ALERTE: Script JavaScript détecté dans le fichier %s", filename)
+		return "text/javascript"
+	}
+
+	return documentType
+}
+
+// Types réels refusés quelle que soit l'extension (voir Sniff)
+var forbiddenContentTypes = map[string]bool{
+	"application/x-msdownload": true,
+	"text/x-php":               true,
+	"text/javascript":          true,
+}
+
+// CheckContent contrôle le contenu réel d'un fichier à partir de ses premiers octets : un exécutable ou un script
+// renommé est refusé, et le type annoncé (détecté s'il est absent ou générique) doit correspondre à l'extension
+func CheckContent(filename, contentType string, head []byte) error {
+	sniffed := Sniff(filename, head)
+	if forbiddenContentTypes[sniffed] {
+		return fmt.Errorf("contenu non autorisé (%s)", sniffed)
+	}
+	if contentType == "" || strings.Contains(contentType, "application/octet-stream") {
+		contentType = sniffed
+	}
+	if !mimeMatchesExt(strings.ToLower(filepath.Ext(filename)), contentType) {
+		return errors.New("le type du fichier ne correspond pas à son extension")
+	}
+	return nil
+}
+
+// ReadHead lit les premiers octets d'un fichier envoyé, pour CheckContent
+func ReadHead(f *multipart.FileHeader) ([]byte, error) {
+	src, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(src, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return buffer[:n], nil
+}
+
+// Classify valide un fichier annoncé (upload fragmenté) et retourne son type de média.
+// Les limites sont celles de l'envoi direct (voir MaxSizes) ; le contenu est contrôlé à l'assemblage (CheckContent).
+func Classify(filename string, size int64) (string, error) {
+	if IsSuspicious(filename) {
+		log.Printf("⚠️ Tentative d'upload d'un fichier potentiellement dangereux: %s", filename)
+		return "", errors.New("format de fichier non autorisé pour des raisons de sécurité")
+	}
+
+	mediaType := TypeOf(filename)
+	if mediaType == "" {
+		return "", errors.New("type de fichier non pris en charge sur la plateforme")
+	}
+	if err := CheckSize(mediaType, filename, size); err != nil {
+		return "", err
+	}
+	return mediaType, nil
+}
+
+// Check applique l'ensemble des contrôles à un fichier envoyé (extension dangereuse, type pris en charge, taille,
+// contenu réel) et retourne son nom nettoyé et son type de média. Les refus enveloppent ErrRejected.
+func Check(f *multipart.FileHeader) (name, mediaType string, err error) {
+	// Vérifier si le fichier est potentiellement dangereux
+	if IsSuspicious(f.Filename) {
+		log.Printf("⚠️ Tentative d'upload d'un fichier potentiellement dangereux: %s", f.Filename)
+		return "", "", fmt.Errorf("%w : format de fichier non autorisé pour des raisons de sécurité", ErrRejected)
+	}
+
+	// Nettoyer le nom du fichier pour éviter les injections
+	name = SanitizeName(f.Filename)
+	if name != f.Filename {
+		log.Printf("ℹ️ Nom de fichier nettoyé: %s -> %s", f.Filename, name)
+	}
+
+	mediaType = TypeOf(name)
+	if mediaType == "" {
+		log.Printf("❌ Type de fichier non pris en charge: %s", strings.ToLower(filepath.Ext(name)))
+		return "", "", fmt.Errorf("%w : type de fichier non pris en charge sur la plateforme", ErrRejected)
+	}
+
+	// Vérifier les limites de taille selon le type de fichier
+	if err := CheckSize(mediaType, name, f.Size); err != nil {
+		return "", "", fmt.Errorf("%w : %v", ErrRejected, err)
+	}
+
+	// Vérifier le contenu réel (signature) avant de le stocker
+	head, err := ReadHead(f)
+	if err != nil {
+		return "", "", fmt.Errorf("impossible d'ouvrir le fichier source: %v", err)
+	}
+	if err := CheckContent(name, f.Header.Get("Content-Type"), head); err != nil {
+		log.Printf("⚠️ Contenu refusé pour %s: %v", name, err)
+		return "", "", fmt.Errorf("%w : %v", ErrRejected, err)
+	}
+	return name, mediaType, nil
+}
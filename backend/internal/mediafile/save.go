@@ -0,0 +1,85 @@
+package mediafile
+
+import (
+	"backend/internal/storage"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Promoter range un fichier temporaire sous sa clé adressée par le contenu et la réserve jusqu'à la création
+// du média qui la référence (media.Claimer)
+type Promoter interface {
+	Promote(ctx context.Context, tmpKey, key string) (uint, error)
+}
+
+// Stored : fichier enregistré par Save
+type Stored struct {
+	Key       string // Clé adressée par le contenu (ex: images/3f/3f9a…e1.jpg)
+	FileName  string // Nom d'origine nettoyé
+	MediaType string // image, video ou document
+	Size      int64
+	Hash      string // SHA-256 (hex)
+	ClaimID   uint   // Réservation de la clé, levée une fois le média créé (voir media.Claimer)
+}
+
+// Save contrôle (voir Check) puis enregistre un fichier dans le stockage ; un contenu déjà présent n'est pas
+// stocké une seconde fois. La clé reste réservée par claims jusqu'à la création du média qui la référence.
+func Save(ctx context.Context, blobs storage.Blob, claims Promoter, f *multipart.FileHeader) (Stored, error) {
+	log.Printf("💾 Début sauvegarde fichier: %s (taille: %d bytes)", f.Filename, f.Size)
+
+	cleanFilename, mediaType, err := Check(f)
+	if err != nil {
+		return Stored{}, err
+	}
+	ext := strings.ToLower(filepath.Ext(cleanFilename))
+	if ext == ".pdf" {
+		log.Printf("📄 Traitement de document PDF: %s", cleanFilename)
+	}
+
+	// Ouvrir le fichier source
+	src, err := f.Open()
+	if err != nil {
+		log.Printf("❌ Erreur ouverture fichier source: %v", err)
+		return Stored{}, fmt.Errorf("impossible d'ouvrir le fichier source: %v", err)
+	}
+	defer src.Close()
+
+	// Envoyer les données vers le stockage (disque local ou bucket S3)
+	log.Printf("⏳ Copie des données en cours...")
+	contentType := f.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	// Le SHA-256 est calculé pendant la copie ; le fichier est ensuite rangé sous la clé qui en dérive
+	tmpKey, sum, bytesWritten, err := storage.PutHashed(ctx, blobs, src, f.Size, contentType)
+	if err != nil {
+		log.Printf("❌ Erreur d'écriture dans le stockage: %v", err)
+		return Stored{}, fmt.Errorf("erreur lors de l'écriture du fichier: %v", err)
+	}
+	key := ContentKey(mediaType+"s", sum, ext)
+	claimID, err := claims.Promote(ctx, tmpKey, key)
+	if err != nil {
+		blobs.Delete(ctx, tmpKey)
+		log.Printf("❌ Erreur d'écriture dans le stockage: %v", err)
+		return Stored{}, fmt.Errorf("erreur lors de l'écriture du fichier: %v", err)
+	}
+
+	log.Printf("✅ Fichier enregistré avec succès: %d bytes écrits (%s)", bytesWritten, key)
+	return Stored{Key: key, FileName: cleanFilename, MediaType: mediaType, Size: bytesWritten, Hash: sum, ClaimID: claimID}, nil
+}
+
+// ContentKey génère la clé adressée par le contenu : {subDir}/{sha256[:2]}/{sha256}{ext}
+func ContentKey(subDir, sum, ext string) string {
+	return path.Join(subDir, sum[:2], sum+ext)
+}
+
+// Key génère la clé de stockage d'un média de type image, video ou document à partir de son SHA-256
+func Key(mediaType, sum, filename string) string {
+	return ContentKey(mediaType+"s", sum, strings.ToLower(filepath.Ext(SanitizeName(filename))))
+}
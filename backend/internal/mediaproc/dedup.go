@@ -0,0 +1,86 @@
+package mediaproc
+
+import (
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// reuse recopie le résultat d'un média au contenu identique déjà traité (même fichier, donc mêmes variantes) ;
+// retourne false s'il n'y en a pas
+func (p *Processor) reuse(m *media.Media) (bool, error) {
+	if m.ContentHash == "" {
+		return false, nil
+	}
+	twins, err := p.repo.FindByContentHash(m.ContentHash)
+	if err != nil {
+		return false, err
+	}
+	for _, twin := range twins {
+		if twin.ID == m.ID || twin.MediaURL != m.MediaURL || twin.MediaType != m.MediaType ||
+			twin.ProcessingStatus != media.ProcessingReady {
+			continue
+		}
+		// Un verdict « sans antivirus » ne vaut pas analyse si un antivirus est désormais configuré
+		if twin.ScanStatus != media.ScanClean && (twin.ScanStatus != media.ScanSkipped || p.scanner != nil) {
+			continue
+		}
+		m.Metadata = twin.Metadata
+		m.Variants = twin.Variants
+		m.ThumbnailURL = twin.ThumbnailURL
+		m.ExtractedText = twin.ExtractedText
+		m.ScanStatus, m.ScanResult, m.ScannedAt = twin.ScanStatus, twin.ScanResult, twin.ScannedAt
+		m.ProcessingStatus = media.ProcessingReady
+		if err := p.repo.Update(m); err != nil {
+			return false, err
+		}
+		log.Printf("♻️ Média %d : contenu identique au média %d, traitement réutilisé", m.ID, twin.ID)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *Processor) handleRelease(ctx context.Context, job *jobs.Job) error {
+	var payload media.ReleasePayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("payload invalide : %w", err))
+	}
+	return p.Release(ctx, payload)
+}
+
+// Release efface les fichiers d'un média supprimé si plus aucun média ne référence son original ;
+// le compte est refait sous le verrou de la clé, qu'un nouveau dépôt du même contenu doit aussi prendre
+func (p *Processor) Release(ctx context.Context, payload media.ReleasePayload) error {
+	return p.repo.WithStorageKey(payload.Key, func(refs int64) error {
+		if refs > 0 {
+			log.Printf("🔗 %s encore référencé %d fois : conservé", payload.Key, refs)
+			return nil
+		}
+		for _, key := range payload.Keys {
+			if err := p.blobs.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		if payload.HLSPrefix != "" {
+			if err := storage.DeletePrefix(ctx, p.blobs, payload.HLSPrefix); err != nil {
+				return err
+			}
+		}
+		log.Printf("🗑️ Fichiers de %s supprimés (dernière référence)", payload.Key)
+		return nil
+	})
+}
+
+// handleCleanup efface les fichiers du stockage que plus aucun média ne référence (POST /api/media/cleanup)
+func (p *Processor) handleCleanup(ctx context.Context, job *jobs.Job) error {
+	deleted, err := media.NewService(p.repo, p.blobs).CleanupOrphanedMedia(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("🧹 Nettoyage du stockage terminé : %d fichier(s) orphelin(s) supprimé(s)", deleted)
+	return nil
+}
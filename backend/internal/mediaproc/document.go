@@ -0,0 +1,386 @@
+package mediaproc
+
+import (
+	"archive/zip"
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/post"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	// maxExtractedText : texte conservé par document (recherche, modération)
+	maxExtractedText = 1 << 20
+	// maxXMLPart protège contre les archives Office piégées (taux de compression extrême)
+	maxXMLPart = 64 << 20
+	// previewSize : plus grand côté de l'aperçu de la première page
+	previewSize = 1080
+)
+
+var errUnsupportedDocument = errors.New("format sans extraction")
+
+// documentContent : ce que l'on sait lire d'un document
+type documentContent struct {
+	pageCount int
+	title     string
+	author    string
+	text      string
+	preview   []byte // Image embarquée (miniature Office), si présente
+}
+
+// PDFRenderer produit l'aperçu de la première page d'un PDF avec pdftoppm (poppler-utils)
+type PDFRenderer struct {
+	runner Runner
+	path   string
+}
+
+// NewPDFRenderer vérifie la présence de pdftoppm quand le runner est réel
+func NewPDFRenderer(runner Runner, pdftoppmPath string) (*PDFRenderer, error) {
+	if err := lookPath(runner, "DOCUMENT_PREVIEW", pdftoppmPath); err != nil {
+		return nil, err
+	}
+	return &PDFRenderer{runner: runner, path: pdftoppmPath}, nil
+}
+
+// FirstPage rend la première page en JPEG et retourne le chemin du fichier produit
+func (r *PDFRenderer) FirstPage(ctx context.Context, input, outPrefix string) (string, error) {
+	_, err := r.runner.Run(ctx, r.path, "-f", "1", "-l", "1", "-singlefile",
+		"-jpeg", "-scale-to", strconv.Itoa(previewSize), input, outPrefix)
+	return outPrefix + ".jpg", err
+}
+
+// processDocument extrait métadonnées et texte, et enregistre un aperçu quand c'est possible
+func (p *Processor) processDocument(ctx context.Context, m *media.Media) (*post.DocumentInfo, error) {
+	name := fileName(m)
+	info := post.DescribeDocument(name, m.FileSize, mime.TypeByExtension(filepath.Ext(name)))
+
+	workDir, err := os.MkdirTemp("", "thinkshare-document-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+	input := filepath.Join(workDir, "source"+info.Format)
+	if err := p.download(ctx, m.MediaURL, input); err != nil {
+		return nil, err
+	}
+
+	content, err := extractDocument(input, info.Format)
+	if errors.Is(err, errUnsupportedDocument) {
+		return &info, nil
+	}
+	if err != nil {
+		// Document corrompu ou protégé : on garde la description de base
+		log.Printf("⚠️ Extraction impossible pour le média %d : %v", m.ID, err)
+		return &info, nil
+	}
+	info.PageCount = content.pageCount
+	info.Title = content.title
+	info.Author = content.author
+	info.WordCount = len(strings.Fields(content.text))
+	m.ExtractedText = content.text
+
+	preview := content.preview
+	if preview == nil && info.IsPDF && p.pdf != nil {
+		file, err := p.pdf.FirstPage(ctx, input, filepath.Join(workDir, "preview"))
+		if err != nil {
+			return nil, err
+		}
+		if preview, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if preview != nil {
+		if err := p.storePreview(ctx, m, preview); err != nil {
+			return nil, err
+		}
+	}
+	return &info, nil
+}
+
+// storePreview réencode l'aperçu en JPEG (taille bornée, sans métadonnées) et l'enregistre comme variante
+func (p *Processor) storePreview(ctx context.Context, m *media.Media, data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > maxPixels {
+		// Miniature dans un format non décodable (WMF/EMF) : pas d'aperçu
+		return nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	resized := Resize(img, previewSize)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 80}); err != nil {
+		return jobs.Permanent(err)
+	}
+	key := "variants/" + strings.TrimSuffix(path.Base(m.MediaURL), path.Ext(m.MediaURL)) + "_preview.jpg"
+	size := int64(buf.Len())
+	if _, err := p.blobs.Put(ctx, key, &buf, size, "image/jpeg"); err != nil {
+		return err
+	}
+	b := resized.Bounds()
+	m.Variants = []media.Variant{{Name: media.VariantPreview, Format: "jpeg", Key: key, Width: b.Dx(), Height: b.Dy(), Size: size}}
+	m.ThumbnailURL = key
+	return nil
+}
+
+// extractDocument lit un document selon son extension
+func extractDocument(file, ext string) (content *documentContent, err error) {
+	switch ext {
+	case ".pdf":
+		// Le lecteur PDF panique sur certains fichiers malformés
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("PDF illisible : %v", r)
+			}
+		}()
+		content, err = extractPDF(file)
+	case ".docx":
+		content, err = extractOOXML(file, wordParts, "w:p")
+	case ".pptx":
+		content, err = extractOOXML(file, slideParts, "a:p")
+	case ".md", ".txt":
+		content, err = extractText(file, ext == ".md")
+	default:
+		return nil, errUnsupportedDocument
+	}
+	if err != nil {
+		return nil, err
+	}
+	content.text = cleanText(content.text)
+	content.title = cleanText(content.title)
+	content.author = cleanText(content.author)
+	return content, nil
+}
+
+func extractPDF(file string) (*documentContent, error) {
+	f, r, err := pdf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	content := &documentContent{pageCount: r.NumPage()}
+	meta := r.Trailer().Key("Info")
+	content.title = meta.Key("Title").Text()
+	content.author = meta.Key("Author").Text()
+
+	text, err := r.GetPlainText()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(text, maxExtractedText))
+	if err != nil {
+		return nil, err
+	}
+	content.text = string(data)
+	return content, nil
+}
+
+// wordParts : corps du document Word
+func wordParts(files []*zip.File) []*zip.File {
+	for _, f := range files {
+		if f.Name == "word/document.xml" {
+			return []*zip.File{f}
+		}
+	}
+	return nil
+}
+
+var slideName = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// slideParts : diapositives PowerPoint, dans l'ordre
+func slideParts(files []*zip.File) []*zip.File {
+	var slides []*zip.File
+	for _, f := range files {
+		if slideName.MatchString(f.Name) {
+			slides = append(slides, f)
+		}
+	}
+	number := func(f *zip.File) int {
+		n, _ := strconv.Atoi(slideName.FindStringSubmatch(f.Name)[1])
+		return n
+	}
+	sort.Slice(slides, func(i, j int) bool { return number(slides[i]) < number(slides[j]) })
+	return slides
+}
+
+// extractOOXML lit un document Office (zip de parties XML) : texte des éléments *:t,
+// un saut de ligne par paragraphe, métadonnées de docProps et miniature éventuelle
+func extractOOXML(file string, parts func([]*zip.File) []*zip.File, paragraph string) (*documentContent, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	content := &documentContent{}
+	var text strings.Builder
+	selected := parts(zr.File)
+	if len(selected) == 0 {
+		return nil, errors.New("document Office sans contenu")
+	}
+	for _, f := range selected {
+		if err := xmlText(f, paragraph, &text); err != nil {
+			return nil, err
+		}
+		if text.Len() >= maxExtractedText {
+			break
+		}
+	}
+	content.text = text.String()
+
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "docProps/core.xml":
+			var core struct {
+				Title   string `xml:"title"`
+				Creator string `xml:"creator"`
+			}
+			if err := decodeXMLPart(f, &core); err == nil {
+				content.title, content.author = core.Title, core.Creator
+			}
+		case f.Name == "docProps/app.xml":
+			var app struct {
+				Pages  int `xml:"Pages"`
+				Slides int `xml:"Slides"`
+			}
+			if err := decodeXMLPart(f, &app); err == nil {
+				content.pageCount = max(app.Pages, app.Slides)
+			}
+		case strings.HasPrefix(f.Name, "docProps/thumbnail."):
+			if rc, err := f.Open(); err == nil {
+				content.preview, _ = io.ReadAll(io.LimitReader(rc, maxXMLPart))
+				rc.Close()
+			}
+		}
+	}
+	if content.pageCount == 0 && paragraph == "a:p" {
+		content.pageCount = len(selected)
+	}
+	return content, nil
+}
+
+// xmlText ajoute à out le texte des éléments <*:t>, avec un saut de ligne à la fin de chaque paragraphe
+func xmlText(f *zip.File, paragraph string, out *strings.Builder) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	paragraphLocal := paragraph[strings.Index(paragraph, ":")+1:]
+	dec := xml.NewDecoder(io.LimitReader(rc, maxXMLPart))
+	inText := false
+	for out.Len() < maxExtractedText {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				out.WriteByte('\t')
+			case "br":
+				out.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case paragraphLocal:
+				out.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				out.Write(t)
+			}
+		}
+	}
+	return nil
+}
+
+func decodeXMLPart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, maxXMLPart)).Decode(v)
+}
+
+var (
+	markdownLink   = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	markdownMarkup = regexp.MustCompile("(^|\\s)[#>*+-]+\\s|[*_`~]+")
+)
+
+// extractText lit un fichier texte ; pour le Markdown, le premier titre sert de titre et la syntaxe est retirée
+func extractText(file string, markdown bool) (*documentContent, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	content := &documentContent{}
+	var text strings.Builder
+	scanner := bufio.NewScanner(io.LimitReader(f, maxExtractedText))
+	scanner.Buffer(make([]byte, 64*1024), maxExtractedText)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if markdown {
+			if content.title == "" && strings.HasPrefix(line, "# ") {
+				content.title = strings.TrimSpace(line[2:])
+			}
+			line = markdownLink.ReplaceAllString(line, "$1")
+			line = markdownMarkup.ReplaceAllString(line, "$1")
+		}
+		text.WriteString(line)
+		text.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	content.text = text.String()
+	return content, nil
+}
+
+// cleanText rend le texte stockable (UTF-8 valide, sans caractère nul refusé par PostgreSQL) et borne sa taille
+func cleanText(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.ReplaceAll(s, "\x00", "")
+	s = strings.TrimSpace(s)
+	if len(s) > maxExtractedText {
+		s = s[:maxExtractedText]
+		for !utf8.ValidString(s) {
+			s = s[:len(s)-1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,190 @@
+package mediaproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// Tags EXIF utilisés
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+// Taille en octets d'une valeur selon son type TIFF
+var tiffTypeSize = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// exifData : bloc EXIF (en-tête TIFF) d'un JPEG, modifiable en place
+type exifData struct {
+	tiff  []byte
+	order binary.ByteOrder
+	ifd0  uint32
+}
+
+// findJPEGExif retourne le bloc TIFF du segment APP1 Exif d'un JPEG ; il partage la mémoire de data
+func findJPEGExif(data []byte) *exifData {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		// Début des données de l'image : plus de segment de métadonnées
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseTIFF(segment[6:])
+		}
+		pos = end
+	}
+	return nil
+}
+
+func parseTIFF(tiff []byte) *exifData {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil
+	}
+	return &exifData{tiff: tiff, order: order, ifd0: order.Uint32(tiff[4:])}
+}
+
+// ifdEntry : entrée de 12 octets d'un répertoire TIFF
+type ifdEntry struct {
+	offset uint32 // Position de l'entrée dans le bloc TIFF
+	tag    uint16
+	typ    uint16
+	count  uint32
+}
+
+// entries liste les entrées du répertoire situé à offset (vide si le répertoire est hors limites)
+func (e *exifData) entries(offset uint32) []ifdEntry {
+	if offset == 0 || uint64(offset)+2 > uint64(len(e.tiff)) {
+		return nil
+	}
+	n := uint32(e.order.Uint16(e.tiff[offset:]))
+	if uint64(offset)+2+uint64(n)*12 > uint64(len(e.tiff)) {
+		return nil
+	}
+	list := make([]ifdEntry, n)
+	for i := uint32(0); i < n; i++ {
+		at := offset + 2 + i*12
+		list[i] = ifdEntry{
+			offset: at,
+			tag:    e.order.Uint16(e.tiff[at:]),
+			typ:    e.order.Uint16(e.tiff[at+2:]),
+			count:  e.order.Uint32(e.tiff[at+4:]),
+		}
+	}
+	return list
+}
+
+func (e *exifData) find(tag uint16) *ifdEntry {
+	for _, entry := range e.entries(e.ifd0) {
+		if entry.tag == tag {
+			return &entry
+		}
+	}
+	return nil
+}
+
+// Orientation retourne le tag Orientation (1 à 8), 1 par défaut
+func (e *exifData) Orientation() int {
+	entry := e.find(tagOrientation)
+	if entry == nil || entry.typ != 3 {
+		return 1
+	}
+	v := int(e.order.Uint16(e.tiff[entry.offset+8:]))
+	if v < 1 || v > 8 {
+		return 1
+	}
+	return v
+}
+
+// StripGPS efface les coordonnées GPS sans déplacer les autres données : les valeurs et entrées
+// du répertoire GPS sont mises à zéro et le répertoire est vidé. Retourne false s'il n'y avait rien à effacer.
+func (e *exifData) StripGPS() bool {
+	pointer := e.find(tagGPSInfo)
+	if pointer == nil {
+		return false
+	}
+	gpsIFD := e.order.Uint32(e.tiff[pointer.offset+8:])
+	entries := e.entries(gpsIFD)
+	if len(entries) == 0 {
+		return false
+	}
+	for _, entry := range entries {
+		size := uint64(tiffTypeSize[entry.typ]) * uint64(entry.count)
+		if size > 4 {
+			// Valeur stockée hors de l'entrée
+			at := uint64(e.order.Uint32(e.tiff[entry.offset+8:]))
+			if at+size <= uint64(len(e.tiff)) {
+				clear(e.tiff[at : at+size])
+			}
+		}
+		clear(e.tiff[entry.offset : entry.offset+12])
+	}
+	e.order.PutUint16(e.tiff[gpsIFD:], 0)
+	return true
+}
+
+// applyOrientation redresse une image selon le tag EXIF Orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5 à 8 : largeur et hauteur sont inversées
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Miroir horizontal
+				dx, dy = w-1-x, y
+			case 3: // Rotation 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Miroir vertical
+				dx, dy = x, h-1-y
+			case 5: // Transposition
+				dx, dy = y, x
+			case 6: // Rotation 90° horaire
+				dx, dy = h-1-y, x
+			case 7: // Transversale
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotation 90° antihoraire
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,354 @@
+package mediaproc
+
+import (
+	"backend/internal/antivirus"
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/mediafile"
+	"backend/internal/post"
+	"backend/internal/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels protège le worker contre les images compressées à dimensions démesurées
+const maxPixels = 50_000_000
+
+// variantSpec : taille maximale (plus grand côté) et qualité JPEG d'une variante
+type variantSpec struct {
+	name    string
+	maxSide int
+	quality int
+}
+
+// Variantes générées pour chaque image, de la plus petite à la plus grande
+var variantSpecs = []variantSpec{
+	{name: media.VariantThumbnail, maxSide: 320, quality: 75},
+	{name: media.VariantFeed, maxSide: 1080, quality: 80},
+	{name: media.VariantFull, maxSide: 2048, quality: 85},
+}
+
+// Processor calcule les métadonnées et variantes des médias uploadés
+type Processor struct {
+	repo       media.Repository
+	blobs      storage.Blob
+	claims     media.Claimer
+	transcoder *Transcoder       // nil : vidéos non transcodées
+	pdf        *PDFRenderer      // nil : pas d'aperçu des PDF
+	scanner    antivirus.Scanner // nil : pas d'analyse antivirus
+}
+
+// Option active un outil externe optionnel
+type Option func(*Processor)
+
+// WithTranscoder active le transcodage HLS des vidéos (VIDEO_TRANSCODE)
+func WithTranscoder(t *Transcoder) Option {
+	return func(p *Processor) { p.transcoder = t }
+}
+
+// WithPDFRenderer active l'aperçu de la première page des PDF (DOCUMENT_PREVIEW)
+func WithPDFRenderer(r *PDFRenderer) Option {
+	return func(p *Processor) { p.pdf = r }
+}
+
+// WithScanner analyse chaque original avant traitement (CLAMD_ADDRESS)
+func WithScanner(s antivirus.Scanner) Option {
+	return func(p *Processor) { p.scanner = s }
+}
+
+// NewProcessor instancie le processor ; sans option, vidéos et PDF sont décrits sans transcodage ni aperçu,
+// et les fichiers ne sont pas analysés
+func NewProcessor(repo media.Repository, blobs storage.Blob, claims media.Claimer, opts ...Option) *Processor {
+	p := &Processor{repo: repo, blobs: blobs, claims: claims}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Register branche le processor sur un worker (traitement, effacement et nettoyage des fichiers)
+func (p *Processor) Register(w *jobs.Worker) {
+	w.Handle(media.ProcessJobKind, p.handle)
+	w.Handle(media.ReleaseJobKind, p.handleRelease)
+	w.Handle(media.CleanupJobKind, p.handleCleanup)
+}
+
+func (p *Processor) handle(ctx context.Context, job *jobs.Job) error {
+	var payload media.ProcessPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("payload invalide : %w", err))
+	}
+	err := p.Process(ctx, payload.MediaID)
+	// Dernier essai raté : le fil affiche l'original sans attendre indéfiniment
+	if err != nil && (jobs.IsPermanent(err) || job.Attempts >= job.MaxAttempts) {
+		p.setStatus(payload.MediaID, media.ProcessingFailed)
+	}
+	return err
+}
+
+func (p *Processor) setStatus(mediaID uint, status string) {
+	m, err := p.repo.FindByID(mediaID)
+	if err != nil {
+		return
+	}
+	m.ProcessingStatus = status
+	if err := p.repo.Update(m); err != nil {
+		log.Printf("⚠️ État du média %d non enregistré : %v", mediaID, err)
+	}
+}
+
+// Process remplit Metadata, les variantes et ThumbnailURL d'un média (et le texte des documents)
+func (p *Processor) Process(ctx context.Context, mediaID uint) error {
+	m, err := p.repo.FindByID(mediaID)
+	if errors.Is(err, media.ErrMediaNotFound) {
+		// Média supprimé entre-temps : rien à faire
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	// Fichier déjà partagé par un média traité : rien à recalculer
+	if done, err := p.reuse(m); done || err != nil {
+		return err
+	}
+	m.ProcessingStatus = media.ProcessingRunning
+	if err := p.repo.Update(m); err != nil {
+		return err
+	}
+	if ok, err := p.scan(ctx, m); !ok || err != nil {
+		// Fichier infecté : verdict enregistré, rien d'autre à faire
+		return err
+	}
+
+	var metadata interface{}
+	switch m.MediaType {
+	case "image":
+		info, err := p.processImage(ctx, m)
+		if err != nil {
+			return err
+		}
+		metadata = info
+	case "video":
+		info, err := p.processVideo(ctx, m)
+		if err != nil {
+			return err
+		}
+		metadata = info
+	case "document":
+		info, err := p.processDocument(ctx, m)
+		if err != nil {
+			return err
+		}
+		metadata = info
+	default:
+		return jobs.Permanent(fmt.Errorf("type de média inconnu : %q", m.MediaType))
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	m.Metadata = string(data)
+	m.ProcessingStatus = media.ProcessingReady
+	if err := p.repo.Update(m); err != nil {
+		return err
+	}
+	log.Printf("🖼️ Média %d traité (%s)", m.ID, m.MediaType)
+	return nil
+}
+
+func (p *Processor) processImage(ctx context.Context, m *media.Media) (*post.ImageInfo, error) {
+	info := &post.ImageInfo{FileSize: m.FileSize}
+	if strings.EqualFold(filepath.Ext(m.MediaURL), ".svg") {
+		// Image vectorielle : pas de dimensions en pixels ni de variantes
+		info.Format = "svg"
+		return info, nil
+	}
+
+	rc, err := p.blobs.Get(ctx, m.MediaURL)
+	if err != nil {
+		return nil, notFoundIsPermanent(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// En-tête seul avant de décoder l'image complète
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("image illisible : %w", err))
+	}
+
+	orientation := 1
+	if exif := findJPEGExif(data); exif != nil {
+		orientation = exif.Orientation()
+		// Confidentialité : l'original servi aux lecteurs ne doit pas contenir la position GPS
+		if exif.StripGPS() {
+			if err := p.rekey(ctx, m, data, "image/jpeg"); err != nil {
+				return nil, err
+			}
+			log.Printf("📍 Coordonnées GPS retirées du média %d", m.ID)
+		}
+	}
+
+	width, height := cfg.Width, cfg.Height
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	fillImageInfo(info, width, height, format)
+	if cfg.Width*cfg.Height > maxPixels {
+		log.Printf("⚠️ Image %d trop grande pour générer des variantes (%dx%d)", m.ID, cfg.Width, cfg.Height)
+		return info, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("image illisible : %w", err))
+	}
+	img = applyOrientation(img, orientation)
+
+	variants, err := p.storeVariants(ctx, m.MediaURL, img)
+	if err != nil {
+		return nil, err
+	}
+	m.Variants = variants
+	if thumb := m.Variant(media.VariantThumbnail, "jpeg"); thumb != nil {
+		m.ThumbnailURL = thumb.Key
+	}
+	return info, nil
+}
+
+// rekey range l'original modifié sous la clé de son nouveau SHA-256 : l'ancien fichier, peut-être partagé par
+// d'autres médias, n'est pas réécrit, et n'est effacé que s'il n'est plus référencé
+func (p *Processor) rekey(ctx context.Context, m *media.Media, data []byte, contentType string) error {
+	tmpKey, sum, size, err := storage.PutHashed(ctx, p.blobs, bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		return err
+	}
+	key := mediafile.Key(m.MediaType, sum, m.MediaURL)
+	claimID, err := p.claims.Promote(ctx, tmpKey, key)
+	if err != nil {
+		p.blobs.Delete(ctx, tmpKey)
+		return err
+	}
+	previous := m.MediaURL
+	m.MediaURL, m.ContentHash, m.FileSize = key, sum, size
+	if err := p.repo.Update(m); err != nil {
+		p.claims.Abandon(claimID)
+		return err
+	}
+	p.claims.Done(claimID)
+	if err := p.Release(ctx, media.ReleasePayload{Key: previous, Keys: []string{previous}}); err != nil {
+		log.Printf("⚠️ Ancien original %s non effacé (le nettoyage des orphelins s'en chargera) : %v", previous, err)
+	}
+	return nil
+}
+
+type encodedVariant struct {
+	format, ext, contentType string
+	buf                      *bytes.Buffer
+}
+
+// storeVariants enregistre chaque taille en JPEG, et en WebP quand celui-ci est plus léger.
+// L'encodeur WebP (pur Go) est sans perte : il ne l'emporte que sur les images à aplats (captures, schémas).
+func (p *Processor) storeVariants(ctx context.Context, source string, img image.Image) ([]media.Variant, error) {
+	base := "variants/" + strings.TrimSuffix(path.Base(source), path.Ext(source))
+	var variants []media.Variant
+	prev := image.Point{}
+	for _, spec := range variantSpecs {
+		resized := Resize(img, spec.maxSide)
+		size := resized.Bounds().Size()
+		// Image plus petite que la variante précédente : rien de nouveau à générer
+		if size == prev {
+			continue
+		}
+		prev = size
+
+		var jpg bytes.Buffer
+		if err := jpeg.Encode(&jpg, resized, &jpeg.Options{Quality: spec.quality}); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		var webp bytes.Buffer
+		if err := nativewebp.Encode(&webp, resized, nil); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+
+		encoded := []encodedVariant{{"jpeg", ".jpg", "image/jpeg", &jpg}}
+		if webp.Len() < jpg.Len() {
+			encoded = append(encoded, encodedVariant{"webp", ".webp", "image/webp", &webp})
+		}
+		for _, e := range encoded {
+			key := base + "_" + spec.name + e.ext
+			n := int64(e.buf.Len())
+			if _, err := p.blobs.Put(ctx, key, e.buf, n, e.contentType); err != nil {
+				return nil, err
+			}
+			variants = append(variants, media.Variant{
+				Name: spec.name, Format: e.format, Key: key, Width: size.X, Height: size.Y, Size: n,
+			})
+		}
+	}
+	return variants, nil
+}
+
+// Resize retourne l'image réduite pour que son plus grand côté fasse au plus maxSide pixels (jamais agrandie)
+func Resize(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		maxSide = max(w, h)
+	}
+	if w >= h {
+		w, h = maxSide, max(1, h*maxSide/w)
+	} else {
+		w, h = max(1, w*maxSide/h), maxSide
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func fillImageInfo(info *post.ImageInfo, width, height int, format string) {
+	info.Width = width
+	info.Height = height
+	info.Format = format
+	if height > 0 {
+		info.AspectRatio = float64(width) / float64(height)
+	}
+	info.IsSquare = width == height
+	info.IsLandscape = width > height
+	info.IsPortrait = height > width
+}
+
+// fileName : nom d'origine, ou à défaut la clé de stockage
+func fileName(m *media.Media) string {
+	if m.FileName != "" {
+		return m.FileName
+	}
+	return path.Base(m.MediaURL)
+}
+
+func notFoundIsPermanent(err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package mediaproc
+
+import (
+	"backend/internal/antivirus"
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// scan soumet l'original à l'antivirus et enregistre le verdict ; un fichier infecté part en quarantaine.
+// Retourne true si le traitement peut continuer.
+func (p *Processor) scan(ctx context.Context, m *media.Media) (bool, error) {
+	switch m.ScanStatus {
+	case media.ScanClean, media.ScanSkipped:
+		// Déjà analysé lors d'un essai précédent
+		return true, nil
+	case media.ScanInfected:
+		return false, nil
+	}
+	if p.scanner == nil {
+		m.ScanStatus = media.ScanSkipped
+		return true, p.repo.Update(m)
+	}
+
+	rc, err := p.blobs.Get(ctx, m.MediaURL)
+	if err != nil {
+		return false, notFoundIsPermanent(err)
+	}
+	verdict, err := p.scanner.Scan(ctx, rc)
+	rc.Close()
+
+	now := time.Now()
+	m.ScannedAt = &now
+	if err != nil {
+		m.ScanStatus = media.ScanError
+		m.ScanResult = err.Error()
+		if uerr := p.repo.Update(m); uerr != nil {
+			return false, uerr
+		}
+		if errors.Is(err, antivirus.ErrTooLarge) {
+			// Réessayer ne changera rien tant que la limite de clamd n'est pas relevée
+			return false, jobs.Permanent(err)
+		}
+		return false, err
+	}
+	if !verdict.Infected {
+		m.ScanStatus = media.ScanClean
+		m.ScanResult = ""
+		return true, p.repo.Update(m)
+	}
+
+	log.Printf("🦠 Média %d infecté (%s) : mise en quarantaine", m.ID, verdict.Signature)
+	if err := p.quarantine(ctx, m); err != nil {
+		return false, err
+	}
+	m.ScanStatus = media.ScanInfected
+	m.ScanResult = verdict.Signature
+	m.ProcessingStatus = media.ProcessingFailed
+	return false, p.repo.Update(m)
+}
+
+// quarantine déplace l'original sous quarantine/ : il n'est plus servi mais reste disponible pour analyse
+func (p *Processor) quarantine(ctx context.Context, m *media.Media) error {
+	key := media.QuarantinePrefix + m.MediaURL
+	rc, err := p.blobs.Get(ctx, m.MediaURL)
+	if err != nil {
+		return notFoundIsPermanent(err)
+	}
+	defer rc.Close()
+	if _, err := p.blobs.Put(ctx, key, rc, m.FileSize, "application/octet-stream"); err != nil {
+		return fmt.Errorf("mise en quarantaine impossible : %w", err)
+	}
+	// La base pointe sur la quarantaine avant la suppression : un échec ne laisse pas de média sans fichier
+	original := m.MediaURL
+	m.MediaURL = key
+	if err := p.repo.Update(m); err != nil {
+		return err
+	}
+	// Fichier partagé : les autres médias seront mis en quarantaine lors de leur propre analyse
+	return p.repo.WithStorageKey(original, func(refs int64) error {
+		if refs > 0 {
+			return nil
+		}
+		if err := p.blobs.Delete(ctx, original); err != nil {
+			log.Printf("⚠️ Original infecté %s non supprimé : %v", original, err)
+		}
+		return nil
+	})
+}
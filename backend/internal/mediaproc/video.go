@@ -0,0 +1,336 @@
+package mediaproc
+
+import (
+	"backend/internal/config"
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/post"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runner exécute un programme externe et retourne sa sortie standard ; remplacé par un faux dans les tests
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner exécute réellement les commandes
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Les dernières lignes de stderr suffisent à comprendre l'échec d'ffmpeg
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 500 {
+			msg = "…" + msg[len(msg)-500:]
+		}
+		return nil, fmt.Errorf("%s : %w : %s", name, err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// lookPath vérifie que les binaires existent (inutile avec un faux runner)
+func lookPath(runner Runner, option string, bins ...string) error {
+	if _, ok := runner.(ExecRunner); !ok {
+		return nil
+	}
+	for _, bin := range bins {
+		if _, err := exec.LookPath(bin); err != nil {
+			return fmt.Errorf("%s : %s introuvable : %w", option, bin, err)
+		}
+	}
+	return nil
+}
+
+// rendition : niveau de l'échelle HLS
+type rendition struct {
+	height       int
+	videoBitrate int // kbit/s
+}
+
+// Échelle HLS, du plus haut au plus bas ; seuls les niveaux inférieurs ou égaux à la source sont produits
+var hlsLadder = []rendition{
+	{height: 1080, videoBitrate: 5000},
+	{height: 720, videoBitrate: 2800},
+	{height: 480, videoBitrate: 1400},
+	{height: 360, videoBitrate: 800},
+}
+
+const (
+	hlsSegmentSeconds = 6
+	audioBitrate      = 128 // kbit/s
+)
+
+// Transcoder pilote ffprobe / ffmpeg pour produire une échelle HLS et un poster
+type Transcoder struct {
+	runner Runner
+	cfg    config.VideoConfig
+}
+
+// NewTranscoder vérifie la présence des binaires quand le runner est réel
+func NewTranscoder(runner Runner, cfg config.VideoConfig) (*Transcoder, error) {
+	if err := lookPath(runner, "VIDEO_TRANSCODE", cfg.FFmpegPath, cfg.FFprobePath); err != nil {
+		return nil, err
+	}
+	return &Transcoder{runner: runner, cfg: cfg}, nil
+}
+
+// probeResult : sortie JSON de ffprobe (champs utilisés)
+type probeResult struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		Tags         struct {
+			Rotate string `json:"rotate"`
+		} `json:"tags"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// Probe lit les caractéristiques de la vidéo
+func (t *Transcoder) Probe(ctx context.Context, input string, size int64) (*post.VideoInfo, error) {
+	out, err := t.runner.Run(ctx, t.cfg.FFprobePath,
+		"-v", "error", "-print_format", "json", "-show_format", "-show_streams", input)
+	if err != nil {
+		return nil, err
+	}
+	var probe probeResult
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("sortie ffprobe illisible : %w", err))
+	}
+
+	info := &post.VideoInfo{FileSize: size}
+	hasVideo := false
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "video":
+			if hasVideo {
+				continue
+			}
+			hasVideo = true
+			info.Codec = s.CodecName
+			info.Width, info.Height = s.Width, s.Height
+			// Vidéo tournée (smartphone en portrait) : ffmpeg l'applique à l'encodage
+			if s.Tags.Rotate == "90" || s.Tags.Rotate == "270" || s.Tags.Rotate == "-90" {
+				info.Width, info.Height = s.Height, s.Width
+			}
+			info.Framerate = s.AvgFrameRate
+		case "audio":
+			info.HasAudio = true
+		}
+	}
+	if !hasVideo || info.Height == 0 {
+		return nil, jobs.Permanent(fmt.Errorf("aucun flux vidéo"))
+	}
+	info.DurationSecs, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Duration = formatDuration(info.DurationSecs)
+	if bps, err := strconv.Atoi(probe.Format.BitRate); err == nil {
+		info.Bitrate = fmt.Sprintf("%d kb/s", bps/1000)
+	}
+	return info, nil
+}
+
+// ladder retourne les niveaux à produire pour une source de la hauteur donnée
+func ladder(sourceHeight int) []rendition {
+	var levels []rendition
+	for _, r := range hlsLadder {
+		if r.height <= sourceHeight {
+			levels = append(levels, r)
+		}
+	}
+	if len(levels) == 0 {
+		// Source plus petite que le plus petit niveau : un seul niveau, à sa hauteur
+		last := hlsLadder[len(hlsLadder)-1]
+		levels = append(levels, rendition{height: max(2, sourceHeight-sourceHeight%2), videoBitrate: last.videoBitrate})
+	}
+	return levels
+}
+
+// Transcode produit dans outDir : {hauteur}p/index.m3u8 + segments, master.m3u8 et poster.jpg.
+// Retourne les dimensions du niveau le plus haut, qui sont aussi celles du poster.
+func (t *Transcoder) Transcode(ctx context.Context, input, outDir string, info *post.VideoInfo) (top [2]int, err error) {
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for i, r := range ladder(info.Height) {
+		// Largeur paire proportionnelle (contrainte de libx264)
+		width := info.Width * r.height / info.Height
+		width -= width % 2
+		name := fmt.Sprintf("%dp", r.height)
+		if err := os.MkdirAll(filepath.Join(outDir, name), 0o755); err != nil {
+			return top, err
+		}
+
+		args := []string{"-y", "-v", "error", "-i", input,
+			"-vf", fmt.Sprintf("scale=%d:%d", width, r.height),
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+			"-b:v", fmt.Sprintf("%dk", r.videoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", r.videoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", r.videoBitrate*3/2),
+			"-g", "48", "-keyint_min", "48", "-sc_threshold", "0",
+		}
+		if info.HasAudio {
+			args = append(args, "-c:a", "aac", "-b:a", fmt.Sprintf("%dk", audioBitrate), "-ac", "2")
+		} else {
+			args = append(args, "-an")
+		}
+		args = append(args,
+			"-f", "hls", "-hls_time", strconv.Itoa(hlsSegmentSeconds), "-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(outDir, name, "segment_%03d.ts"),
+			filepath.Join(outDir, name, "index.m3u8"),
+		)
+		if _, err := t.runner.Run(ctx, t.cfg.FFmpegPath, args...); err != nil {
+			return top, err
+		}
+
+		bandwidth := (r.videoBitrate + audioBitrate) * 1000
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n", bandwidth, width, r.height, name)
+		if i == 0 {
+			top = [2]int{width, r.height}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "master.m3u8"), []byte(master.String()), 0o644); err != nil {
+		return top, err
+	}
+
+	// Poster : image à 1s (ou au milieu des vidéos très courtes), à la taille du niveau le plus haut
+	at := 1.0
+	if info.DurationSecs > 0 && info.DurationSecs < 2 {
+		at = info.DurationSecs / 2
+	}
+	_, err = t.runner.Run(ctx, t.cfg.FFmpegPath, "-y", "-v", "error",
+		"-ss", strconv.FormatFloat(at, 'f', 2, 64), "-i", input,
+		"-frames:v", "1", "-vf", fmt.Sprintf("scale=%d:%d", top[0], top[1]), "-q:v", "3",
+		filepath.Join(outDir, "poster.jpg"))
+	return top, err
+}
+
+// processVideo transcode la vidéo (si activé) et enregistre l'échelle HLS et le poster
+func (p *Processor) processVideo(ctx context.Context, m *media.Media) (*post.VideoInfo, error) {
+	if p.transcoder == nil {
+		// Durée, codec… nécessitent ffmpeg : seule la taille est connue ici
+		return &post.VideoInfo{FileSize: m.FileSize}, nil
+	}
+
+	workDir, err := os.MkdirTemp("", "thinkshare-video-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	input := filepath.Join(workDir, "source"+path.Ext(m.MediaURL))
+	if err := p.download(ctx, m.MediaURL, input); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	info, err := p.transcoder.Probe(ctx, input, m.FileSize)
+	if err != nil {
+		return nil, err
+	}
+	outDir := filepath.Join(workDir, "out")
+	top, err := p.transcoder.Transcode(ctx, input, outDir, info)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "hls/" + strings.TrimSuffix(path.Base(m.MediaURL), path.Ext(m.MediaURL)) + "/"
+	sizes, err := p.uploadDir(ctx, outDir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	m.Variants = []media.Variant{
+		{Name: media.VariantPoster, Format: "jpeg", Key: prefix + "poster.jpg", Width: top[0], Height: top[1], Size: sizes["poster.jpg"]},
+		{Name: media.VariantHLS, Format: "m3u8", Key: prefix + "master.m3u8", Width: top[0], Height: top[1], Size: sizes["master.m3u8"]},
+	}
+	m.ThumbnailURL = prefix + "poster.jpg"
+	log.Printf("🎬 Vidéo %d transcodée en HLS (%dx%d max) en %s", m.ID, top[0], top[1], time.Since(started).Round(time.Second))
+	return info, nil
+}
+
+// download copie un objet du stockage dans un fichier local (ffmpeg lit des fichiers)
+func (p *Processor) download(ctx context.Context, key, dst string) error {
+	rc, err := p.blobs.Get(ctx, key)
+	if err != nil {
+		return notFoundIsPermanent(err)
+	}
+	defer rc.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// uploadDir envoie tous les fichiers de dir sous prefix ; retourne leur taille par chemin relatif
+func (p *Processor) uploadDir(ctx context.Context, dir, prefix string) (map[string]int64, error) {
+	sizes := map[string]int64{}
+	err := filepath.WalkDir(dir, func(file string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if _, err := p.blobs.Put(ctx, prefix+rel, f, stat.Size(), hlsContentType(rel)); err != nil {
+			return err
+		}
+		sizes[rel] = stat.Size()
+		return nil
+	})
+	return sizes, err
+}
+
+func hlsContentType(name string) string {
+	switch path.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".jpg":
+		return "image/jpeg"
+	}
+	return "application/octet-stream"
+}
+
+// formatDuration : 75.4 → 00:01:15
+func formatDuration(secs float64) string {
+	d := time.Duration(secs * float64(time.Second)).Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,148 @@
+package message
+
+import (
+	"backend/internal/mediafile"
+	"backend/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmptyMessage        = errors.New("message vide : texte ou pièce jointe requis")
+	ErrInvalidAttachment   = errors.New("pièce jointe refusée")
+	ErrTooManyAttachments  = fmt.Errorf("%d pièces jointes au plus par message", MaxAttachments)
+	ErrAttachmentsDisabled = errors.New("pièces jointes indisponibles")
+)
+
+// AttachmentMedia gère les médias des pièces jointes (post.MessageAttachments). Les pièces jointes sont des médias
+// rattachés au message : analysées par l'antivirus, servies par /media/{id} aux seuls participants
+// de la conversation (Repository.IsMessageParticipant), effacées avec leur dernière référence.
+type AttachmentMedia interface {
+	// AttachTx crée les médias des fichiers, rattachés au message, dans la transaction qui l'enregistre,
+	// et planifie leur traitement (antivirus, miniatures)
+	AttachTx(tx *gorm.DB, msg *Message, files []AttachmentFile) error
+	// List retourne les pièces jointes des messages ; les URLs sont signées pour viewerID (aucune si 0)
+	List(messageIDs []uint, viewerID uint) (map[uint][]*AttachmentDTO, error)
+	// ReleaseTx supprime les pièces jointes d'un message dans la transaction qui le supprime
+	ReleaseTx(tx *gorm.DB, messageID uint) error
+}
+
+// Claims réserve les fichiers déposés jusqu'à la création du message qui les référence (media.Claimer)
+type Claims interface {
+	mediafile.Promoter
+	// Done lève les réservations une fois les médias créés
+	Done(claimIDs ...uint)
+	// Abandon lève les réservations de médias qui n'ont pas été créés : les fichiers que plus rien
+	// ne référence sont effacés
+	Abandon(claimIDs ...uint)
+}
+
+// Attachments gère les fichiers joints aux messages : mêmes contrôles que les médias des posts (mediafile),
+// images et documents seulement, stockage dédupliqué par contenu puis médias rattachés au message (AttachmentMedia)
+type Attachments struct {
+	AttachmentMedia
+	blobs  storage.Blob
+	claims Claims
+}
+
+// NewAttachments instancie le gestionnaire des pièces jointes des messages
+func NewAttachments(blobs storage.Blob, claims Claims, medias AttachmentMedia) *Attachments {
+	if blobs == nil || claims == nil || medias == nil {
+		panic("storage, claims and attachment media cannot be nil")
+	}
+	return &Attachments{AttachmentMedia: medias, blobs: blobs, claims: claims}
+}
+
+// Store valide puis enregistre les fichiers ; rien n'est stocké si l'un d'eux est refusé.
+// Les erreurs de validation enveloppent ErrInvalidAttachment.
+func (a *Attachments) Store(ctx context.Context, files []*multipart.FileHeader) ([]AttachmentFile, error) {
+	for _, f := range files {
+		if err := checkAttachment(f); err != nil {
+			return nil, fmt.Errorf("%w : %s : %v", ErrInvalidAttachment, f.Filename, err)
+		}
+	}
+
+	stored := make([]AttachmentFile, 0, len(files))
+	for _, f := range files {
+		sf, err := mediafile.Save(ctx, a.blobs, a.claims, f)
+		if errors.Is(err, mediafile.ErrRejected) {
+			err = fmt.Errorf("%w : %s : %v", ErrInvalidAttachment, f.Filename, err)
+		}
+		if err != nil {
+			a.Abandon(stored)
+			return nil, err
+		}
+		stored = append(stored, AttachmentFile{Key: sf.Key, FileName: sf.FileName, MediaType: sf.MediaType, Size: sf.Size, Hash: sf.Hash, ClaimID: sf.ClaimID})
+	}
+	return stored, nil
+}
+
+// Done lève les réservations des fichiers enregistrés par Store une fois le message créé
+func (a *Attachments) Done(files []AttachmentFile) {
+	a.claims.Done(claimIDs(files)...)
+}
+
+// Abandon lève les réservations des fichiers d'un message qui n'a pas été créé : ceux que plus rien
+// ne référence sont effacés
+func (a *Attachments) Abandon(files []AttachmentFile) {
+	a.claims.Abandon(claimIDs(files)...)
+}
+
+func claimIDs(files []AttachmentFile) []uint {
+	ids := make([]uint, len(files))
+	for i, f := range files {
+		ids[i] = f.ClaimID
+	}
+	return ids
+}
+
+// checkAttachment applique les contrôles des médias des posts (extension dangereuse, taille, type réel
+// du contenu cohérent avec l'extension) ; seules les images et les documents peuvent être joints
+func checkAttachment(f *multipart.FileHeader) error {
+	_, mediaType, err := mediafile.Check(f)
+	if err != nil {
+		return err
+	}
+	if mediaType != mediafile.Image && mediaType != mediafile.Document {
+		return errors.New("seules les images et les documents peuvent être joints")
+	}
+	return nil
+}
+
+// storeAttachments valide et enregistre les pièces jointes d'un message avant sa création
+func (s *service) storeAttachments(files []*multipart.FileHeader) ([]AttachmentFile, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if s.attachments == nil {
+		return nil, ErrAttachmentsDisabled
+	}
+	return s.attachments.Store(context.Background(), files)
+}
+
+// withAttachments complète les messages avec leurs pièces jointes, URLs signées pour viewerID (0 : sans URL)
+func (s *service) withAttachments(viewerID uint, dtos ...*MessageDTO) error {
+	if s.attachments == nil || len(dtos) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(dtos))
+	for _, dto := range dtos {
+		if dto != nil {
+			ids = append(ids, dto.ID)
+		}
+	}
+	byMessage, err := s.attachments.List(ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for _, dto := range dtos {
+		if dto != nil {
+			dto.Attachments = byMessage[dto.ID]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package message
+
+import (
+	"backend/internal/realtime"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation introuvable")
+	ErrInvalidRecipient     = errors.New("indiquer receiver_id ou conversation_id (un seul)")
+	ErrNotGroup             = errors.New("action réservée aux groupes")
+	ErrEmptyTitle           = errors.New("le nom du groupe ne peut pas être vide")
+	ErrNotAllowed           = errors.New("action réservée aux administrateurs du groupe")
+	ErrCourseAccess         = errors.New("cours introuvable ou inaccessible")
+	ErrUserNotFound         = errors.New("utilisateur introuvable")
+	ErrParticipantNotFound  = errors.New("participant introuvable")
+	ErrInvalidParticipant   = errors.New("action impossible sur soi-même ou sur le propriétaire du groupe")
+	ErrAlreadyParticipant   = errors.New("utilisateur déjà membre du groupe")
+	ErrAlreadyInvited       = errors.New("invitation déjà envoyée")
+	ErrInviteNotFound       = errors.New("invitation introuvable")
+	ErrGroupFull            = fmt.Errorf("groupe complet (%d membres et invitations au plus)", MaxGroupSize)
+)
+
+// participation vérifie que l'utilisateur participe à la conversation ; sinon elle est introuvable pour lui
+func (s *service) participation(conversationID, userID uint) (*Conversation, *Participant, error) {
+	conv, err := s.repo.GetConversationByID(conversationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := s.repo.GetParticipant(conversationID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return conv, p, nil
+}
+
+// groupAdmin vérifie que l'utilisateur administre le groupe (owner ou admin)
+func (s *service) groupAdmin(conversationID, userID uint) (*Conversation, *Participant, error) {
+	conv, p, err := s.participation(conversationID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conv.Kind != KindGroup {
+		return nil, nil, ErrNotGroup
+	}
+	if p.Role != RoleOwner && p.Role != RoleAdmin {
+		return nil, nil, ErrNotAllowed
+	}
+	return conv, p, nil
+}
+
+// checkCourse vérifie que l'utilisateur a accès au cours du groupe (abonnement pour un cours payant)
+func (s *service) checkCourse(postID *uint, userID uint) error {
+	if postID == nil {
+		return nil
+	}
+	if s.posts == nil {
+		return ErrCourseAccess
+	}
+	ok, err := s.posts.CanViewPost(*postID, userID)
+	if err != nil || !ok {
+		return ErrCourseAccess
+	}
+	return nil
+}
+
+// checkInvitee vérifie qu'un utilisateur peut être invité dans le groupe ; withheld : l'invité a bloqué
+// l'auteur de l'invitation, qui ne lui est alors jamais remise (sans que l'auteur l'apprenne)
+func (s *service) checkInvitee(conv *Conversation, inviterID, inviteeID uint) (withheld bool, err error) {
+	if _, err := s.getUserInfoByID(inviteeID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, ErrUserNotFound
+	} else if err != nil {
+		return false, err
+	}
+	if withheld, err = s.blocks(inviterID, inviteeID); err != nil {
+		return false, err
+	}
+	return withheld, s.checkCourse(conv.PostID, inviteeID)
+}
+
+// CreateGroup crée un groupe dont l'utilisateur est propriétaire ; les utilisateurs listés sont invités
+func (s *service) CreateGroup(ownerID uint, input CreateGroupInput) (*ConversationDTO, error) {
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		return nil, ErrEmptyTitle
+	}
+	if err := s.checkCourse(input.PostID, ownerID); err != nil {
+		return nil, err
+	}
+	conv := &Conversation{Kind: KindGroup, Title: title, PostID: input.PostID, CreatedBy: ownerID}
+
+	seen := map[uint]bool{ownerID: true}
+	var invitees []uint
+	for _, id := range input.InviteeIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		withheld, err := s.checkInvitee(conv, ownerID, id)
+		if err != nil {
+			return nil, fmt.Errorf("invitation de l'utilisateur %d : %w", id, err)
+		}
+		if !withheld {
+			invitees = append(invitees, id)
+		}
+	}
+	if len(invitees)+1 > MaxGroupSize {
+		return nil, ErrGroupFull
+	}
+
+	if err := s.repo.CreateGroup(conv, ownerID, invitees); err != nil {
+		return nil, err
+	}
+	s.notify(realtime.TypeConversationInvite, ownerID, inviteEvent(conv), invitees...)
+	return s.GetConversationDetails(conv.ID, ownerID)
+}
+
+// GetConversationDetails retourne une conversation et ses participants
+func (s *service) GetConversationDetails(conversationID, userID uint) (*ConversationDTO, error) {
+	conv, me, err := s.participation(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	participants, err := s.repo.GetParticipants(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := s.userCache()
+	dto := &ConversationDTO{
+		ID:           conv.ID,
+		Kind:         conv.Kind,
+		Title:        conv.Title,
+		PostID:       conv.PostID,
+		CreatedBy:    conv.CreatedBy,
+		CreatedAt:    conv.CreatedAt,
+		MyRole:       me.Role,
+		Participants: make([]*ParticipantDTO, 0, len(participants)),
+	}
+	for _, p := range participants {
+		dto.Participants = append(dto.Participants, &ParticipantDTO{
+			User:              users.get(p.UserID),
+			Role:              p.Role,
+			LastReadMessageID: p.LastReadMessageID,
+			JoinedAt:          p.JoinedAt,
+		})
+	}
+	return dto, nil
+}
+
+// RenameGroup renomme un groupe (owner ou admin)
+func (s *service) RenameGroup(conversationID, userID uint, input UpdateGroupInput) (*ConversationDTO, error) {
+	if _, _, err := s.groupAdmin(conversationID, userID); err != nil {
+		return nil, err
+	}
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		return nil, ErrEmptyTitle
+	}
+	if err := s.repo.UpdateTitle(conversationID, title); err != nil {
+		return nil, err
+	}
+	s.notifyParticipants(conversationID, realtime.TypeConversationUpdated, userID, updateEvent(conversationID))
+	return s.GetConversationDetails(conversationID, userID)
+}
+
+// Invite invite un utilisateur dans le groupe (owner ou admin) ; il devient membre en acceptant
+func (s *service) Invite(conversationID, inviterID, inviteeID uint) error {
+	conv, _, err := s.groupAdmin(conversationID, inviterID)
+	if err != nil {
+		return err
+	}
+	if inviteeID == inviterID {
+		return ErrInvalidParticipant
+	}
+	if _, err := s.repo.GetParticipant(conversationID, inviteeID); err == nil {
+		return ErrAlreadyParticipant
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	withheld, err := s.checkInvitee(conv, inviterID, inviteeID)
+	if err != nil {
+		return err
+	}
+	count, err := s.repo.CountMembers(conversationID)
+	if err != nil {
+		return err
+	}
+	if count >= MaxGroupSize {
+		return ErrGroupFull
+	}
+	if withheld {
+		return nil
+	}
+
+	if err := s.repo.CreateInvite(&Invite{ConversationID: conversationID, InviteeID: inviteeID, InviterID: inviterID}); err != nil {
+		return err
+	}
+	s.notify(realtime.TypeConversationInvite, inviterID, inviteEvent(conv), inviteeID)
+	return nil
+}
+
+// GetInvites liste les invitations reçues par l'utilisateur
+func (s *service) GetInvites(userID uint) ([]*InviteDTO, error) {
+	raws, err := s.repo.GetInvitesFor(userID)
+	if err != nil {
+		return nil, err
+	}
+	users := s.userCache()
+	invites := make([]*InviteDTO, 0, len(raws))
+	for _, raw := range raws {
+		invites = append(invites, &InviteDTO{
+			ID:             raw.ID,
+			ConversationID: raw.ConversationID,
+			Title:          raw.Title,
+			Inviter:        users.get(raw.InviterID),
+			CreatedAt:      raw.CreatedAt,
+		})
+	}
+	return invites, nil
+}
+
+// AcceptInvite fait rejoindre le groupe à l'invité ; l'accès au cours est revérifié (abonnement expiré…)
+func (s *service) AcceptInvite(inviteID, userID uint) (*ConversationDTO, error) {
+	inv, err := s.repo.GetInvite(inviteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && inv.InviteeID != userID) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	conv, err := s.repo.GetConversationByID(inv.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCourse(conv.PostID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AcceptInvite(inv); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInviteNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	s.notifyParticipants(conv.ID, realtime.TypeConversationUpdated, userID, updateEvent(conv.ID))
+	return s.GetConversationDetails(conv.ID, userID)
+}
+
+// DeleteInvite refuse une invitation (l'invité) ou l'annule (owner ou admin du groupe)
+func (s *service) DeleteInvite(inviteID, userID uint) error {
+	inv, err := s.repo.GetInvite(inviteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInviteNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if inv.InviteeID != userID {
+		if _, _, err := s.groupAdmin(inv.ConversationID, userID); err != nil {
+			return ErrInviteNotFound
+		}
+	}
+	return s.repo.DeleteInvite(inviteID)
+}
+
+// Leave fait quitter le groupe ; un propriétaire qui part transmet le groupe à l'admin, sinon au membre, le plus ancien
+func (s *service) Leave(conversationID, userID uint) error {
+	conv, me, err := s.participation(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if conv.Kind != KindGroup {
+		return ErrNotGroup
+	}
+
+	var successor uint
+	if me.Role == RoleOwner {
+		participants, err := s.repo.GetParticipants(conversationID)
+		if err != nil {
+			return err
+		}
+		for _, p := range participants {
+			if p.UserID == userID {
+				continue
+			}
+			if p.Role == RoleAdmin {
+				successor = p.UserID
+				break
+			}
+			if successor == 0 {
+				successor = p.UserID
+			}
+		}
+	}
+
+	if err := s.repo.RemoveParticipant(conversationID, userID, successor); err != nil {
+		return err
+	}
+	s.notifyParticipants(conversationID, realtime.TypeConversationUpdated, userID, updateEvent(conversationID))
+	return nil
+}
+
+// RemoveParticipant exclut un participant : le propriétaire exclut n'importe qui, un admin seulement les membres
+func (s *service) RemoveParticipant(conversationID, actorID, userID uint) error {
+	_, actor, err := s.groupAdmin(conversationID, actorID)
+	if err != nil {
+		return err
+	}
+	if userID == actorID {
+		return ErrInvalidParticipant // Quitter le groupe : Leave
+	}
+	target, err := s.repo.GetParticipant(conversationID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrParticipantNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if target.Role == RoleOwner {
+		return ErrInvalidParticipant
+	}
+	if actor.Role == RoleAdmin && target.Role != RoleMember {
+		return ErrNotAllowed
+	}
+
+	if err := s.repo.RemoveParticipant(conversationID, userID, 0); err != nil {
+		return err
+	}
+	// L'exclu est prévenu pour retirer le groupe de sa liste
+	participants, err := s.participantIDs(conversationID)
+	if err == nil {
+		s.notify(realtime.TypeConversationUpdated, actorID, updateEvent(conversationID), append(participants, userID)...)
+	}
+	return nil
+}
+
+// SetRole nomme ou retire un admin ; role owner transfère la propriété (l'ancien propriétaire devient admin).
+// Réservé au propriétaire.
+func (s *service) SetRole(conversationID, actorID, userID uint, role ParticipantRole) error {
+	_, actor, err := s.groupAdmin(conversationID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Role != RoleOwner {
+		return ErrNotAllowed
+	}
+	if userID == actorID {
+		return ErrInvalidParticipant
+	}
+	if _, err := s.repo.GetParticipant(conversationID, userID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrParticipantNotFound
+	} else if err != nil {
+		return err
+	}
+
+	switch role {
+	case RoleOwner:
+		err = s.repo.TransferOwnership(conversationID, actorID, userID)
+	case RoleAdmin, RoleMember:
+		err = s.repo.SetRole(conversationID, userID, role)
+	default:
+		return fmt.Errorf("rôle invalide : %q (owner, admin ou member)", role)
+	}
+	if err != nil {
+		return err
+	}
+	s.notifyParticipants(conversationID, realtime.TypeConversationUpdated, actorID, updateEvent(conversationID))
+	return nil
+}
+
+func inviteEvent(conv *Conversation) map[string]interface{} {
+	return map[string]interface{}{"conversation_id": conv.ID, "title": conv.Title}
+}
+
+func updateEvent(conversationID uint) map[string]interface{} {
+	return map[string]interface{}{"conversation_id": conversationID}
+}
@@ -0,0 +1,417 @@
+package message
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerConversationRoutes ajoute les routes des conversations (groupes, invitations, curseurs de lecture)
+func (h *Handler) registerConversationRoutes(rg *gin.RouterGroup, writeLimits ...gin.HandlerFunc) {
+	conv := rg.Group("/conversations")
+
+	conv.POST("", append(writeLimits, h.CreateGroup)...)
+	conv.GET("/invites", h.GetInvites)
+	conv.POST("/invites/:inviteID/accept", h.AcceptInvite)
+	conv.DELETE("/invites/:inviteID", h.DeleteInvite)
+
+	conv.GET("/:id", h.GetConversationDetails)
+	conv.PATCH("/:id", h.RenameGroup)
+	conv.GET("/:id/messages", h.GetMessages)
+	conv.POST("/:id/read", h.MarkConversationRead)
+	conv.POST("/:id/invites", append(writeLimits, h.Invite)...)
+	conv.POST("/:id/leave", h.Leave)
+	conv.DELETE("/:id/participants/:userID", h.RemoveParticipant)
+	conv.PATCH("/:id/participants/:userID", h.SetRole)
+}
+
+// conversationError traduit les erreurs métier des conversations en réponse HTTP
+func conversationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrConversationNotFound), errors.Is(err, ErrInviteNotFound),
+		errors.Is(err, ErrParticipantNotFound), errors.Is(err, ErrUserNotFound), errors.Is(err, ErrRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotAllowed), errors.Is(err, ErrCourseAccess), errors.Is(err, ErrUserBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotGroup), errors.Is(err, ErrEmptyTitle), errors.Is(err, ErrInvalidParticipant):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAlreadyParticipant), errors.Is(err, ErrAlreadyInvited), errors.Is(err, ErrGroupFull):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+// pathID lit un identifiant positif dans l'URL
+func pathID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// POST /conversations
+// CreateGroup godoc
+// @Summary      Create a group conversation
+// @Description  Create a group owned by the authenticated user. With post_id, the group is a study group attached to a course: the owner and every invitee must have access to it (subscription for paid courses). The listed users are invited and join by accepting
+// @Tags         conversations
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  message.CreateGroupInput  true  "Title, optional course and invitees"
+// @Success      201   {object}  message.ConversationDTO
+// @Failure      400   {object}  map[string]string "Invalid input"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Course not accessible"
+// @Failure      404   {object}  map[string]string "Invitee not found"
+// @Failure      409   {object}  map[string]string "Group full"
+// @Router       /api/conversations [post]
+func (h *Handler) CreateGroup(c *gin.Context) {
+	var input CreateGroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	dto, err := h.service.CreateGroup(uint(c.GetInt("user_id")), input)
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, dto)
+}
+
+// GET /conversations/:id
+// GetConversationDetails godoc
+// @Summary      Get a conversation
+// @Description  Get a conversation the authenticated user takes part in, with its participants, their roles and read cursors
+// @Tags         conversations
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path  int  true  "Conversation ID"
+// @Success      200  {object}  message.ConversationDTO
+// @Failure      400  {object}  map[string]string "Invalid conversation ID"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Conversation not found"
+// @Router       /api/conversations/{id} [get]
+func (h *Handler) GetConversationDetails(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	dto, err := h.service.GetConversationDetails(id, uint(c.GetInt("user_id")))
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dto)
+}
+
+// PATCH /conversations/:id
+// RenameGroup godoc
+// @Summary      Rename a group
+// @Description  Change the title of a group (owner or admin)
+// @Tags         conversations
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int  true  "Conversation ID"
+// @Param        body  body  message.UpdateGroupInput  true  "New title"
+// @Success      200   {object}  message.ConversationDTO
+// @Failure      400   {object}  map[string]string "Invalid input"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Not an admin of the group"
+// @Failure      404   {object}  map[string]string "Conversation not found"
+// @Router       /api/conversations/{id} [patch]
+func (h *Handler) RenameGroup(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	var input UpdateGroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	dto, err := h.service.RenameGroup(id, uint(c.GetInt("user_id")), input)
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dto)
+}
+
+// GET /conversations/:id/messages
+// GetMessages godoc
+// @Summary      Get the messages of a conversation
+// @Description  Get one page of the messages of a conversation (direct or group), in chronological order. Same cursors as /api/messages/{otherUserID}
+// @Tags         conversations
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id      path   int  true   "Conversation ID"
+// @Param        before  query  int  false  "Return messages older than this message ID"
+// @Param        after   query  int  false  "Return messages newer than this message ID"
+// @Param        limit   query  int  false  "Number of messages (default 50, max 100)"
+// @Success      200  {object}  message.ConversationPage
+// @Failure      400  {object}  map[string]string "Invalid conversation ID or cursor"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Conversation not found"
+// @Router       /api/conversations/{id}/messages [get]
+func (h *Handler) GetMessages(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	before, okBefore := queryID(c, "before")
+	after, okAfter := queryID(c, "after")
+	limit, okLimit := queryID(c, "limit")
+	if !okBefore || !okAfter || !okLimit || (before > 0 && after > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor: use before or after (message IDs) and limit"})
+		return
+	}
+
+	page, err := h.service.GetMessages(id, uint(c.GetInt("user_id")), PageQuery{Before: before, After: after, Limit: int(limit)})
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// POST /conversations/:id/read
+// MarkConversationRead godoc
+// @Summary      Mark a conversation as read
+// @Description  Move the read cursor of the authenticated user up to message_id (latest message when omitted). The cursor never moves back; participants receive a message.read event
+// @Tags         conversations
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int  true  "Conversation ID"
+// @Param        body  body  message.ReadInput  false  "Last read message ID"
+// @Success      200   {object}  map[string]string "Conversation marked as read"
+// @Failure      400   {object}  map[string]string "Invalid input"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      404   {object}  map[string]string "Conversation not found"
+// @Router       /api/conversations/{id}/read [post]
+func (h *Handler) MarkConversationRead(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	var input ReadInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+			return
+		}
+	}
+
+	if err := h.service.MarkConversationRead(id, uint(c.GetInt("user_id")), input.MessageID); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation marked as read"})
+}
+
+// POST /conversations/:id/invites
+// Invite godoc
+// @Summary      Invite a user to a group
+// @Description  Invite a user to a group (owner or admin). For a study group, the invitee must have access to the course. A group holds at most 200 members and pending invites
+// @Tags         conversations
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int  true  "Conversation ID"
+// @Param        body  body  message.InviteInput  true  "Invited user"
+// @Success      201   {object}  map[string]string "Invitation sent"
+// @Failure      400   {object}  map[string]string "Invalid input"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Not an admin of the group or course not accessible to the invitee"
+// @Failure      404   {object}  map[string]string "Conversation or user not found"
+// @Failure      409   {object}  map[string]string "Already a member, already invited or group full"
+// @Router       /api/conversations/{id}/invites [post]
+func (h *Handler) Invite(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	var input InviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	if err := h.service.Invite(id, uint(c.GetInt("user_id")), input.UserID); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Invitation sent"})
+}
+
+// GET /conversations/invites
+// GetInvites godoc
+// @Summary      Get my group invitations
+// @Description  List the pending group invitations of the authenticated user, most recent first
+// @Tags         conversations
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   message.InviteDTO
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/conversations/invites [get]
+func (h *Handler) GetInvites(c *gin.Context) {
+	invites, err := h.service.GetInvites(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invitations"})
+		return
+	}
+	c.JSON(http.StatusOK, invites)
+}
+
+// POST /conversations/invites/:inviteID/accept
+// AcceptInvite godoc
+// @Summary      Accept a group invitation
+// @Description  Join the group as a member. Course access is checked again for study groups. Messages sent before joining count as read
+// @Tags         conversations
+// @Security     BearerAuth
+// @Produce      json
+// @Param        inviteID  path  int  true  "Invitation ID"
+// @Success      200  {object}  message.ConversationDTO
+// @Failure      400  {object}  map[string]string "Invalid invitation ID"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Course not accessible"
+// @Failure      404  {object}  map[string]string "Invitation not found"
+// @Router       /api/conversations/invites/{inviteID}/accept [post]
+func (h *Handler) AcceptInvite(c *gin.Context) {
+	id, ok := pathID(c, "inviteID")
+	if !ok {
+		return
+	}
+	dto, err := h.service.AcceptInvite(id, uint(c.GetInt("user_id")))
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dto)
+}
+
+// DELETE /conversations/invites/:inviteID
+// DeleteInvite godoc
+// @Summary      Decline or cancel a group invitation
+// @Description  The invitee declines the invitation; an owner or admin of the group cancels it
+// @Tags         conversations
+// @Security     BearerAuth
+// @Param        inviteID  path  int  true  "Invitation ID"
+// @Success      200  {object}  map[string]string "Invitation deleted"
+// @Failure      400  {object}  map[string]string "Invalid invitation ID"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Invitation not found"
+// @Router       /api/conversations/invites/{inviteID} [delete]
+func (h *Handler) DeleteInvite(c *gin.Context) {
+	id, ok := pathID(c, "inviteID")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteInvite(id, uint(c.GetInt("user_id"))); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation deleted"})
+}
+
+// POST /conversations/:id/leave
+// Leave godoc
+// @Summary      Leave a group
+// @Description  Leave a group. When the owner leaves, the oldest admin (or else the oldest member) becomes owner
+// @Tags         conversations
+// @Security     BearerAuth
+// @Param        id   path  int  true  "Conversation ID"
+// @Success      200  {object}  map[string]string "Group left"
+// @Failure      400  {object}  map[string]string "Invalid conversation ID or not a group"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Conversation not found"
+// @Router       /api/conversations/{id}/leave [post]
+func (h *Handler) Leave(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.Leave(id, uint(c.GetInt("user_id"))); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Group left"})
+}
+
+// DELETE /conversations/:id/participants/:userID
+// RemoveParticipant godoc
+// @Summary      Remove a participant
+// @Description  Remove a participant from a group. The owner can remove anyone, an admin only members
+// @Tags         conversations
+// @Security     BearerAuth
+// @Param        id      path  int  true  "Conversation ID"
+// @Param        userID  path  int  true  "Removed user ID"
+// @Success      200  {object}  map[string]string "Participant removed"
+// @Failure      400  {object}  map[string]string "Invalid ID, not a group, or target is the owner or yourself"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Not allowed"
+// @Failure      404  {object}  map[string]string "Conversation or participant not found"
+// @Router       /api/conversations/{id}/participants/{userID} [delete]
+func (h *Handler) RemoveParticipant(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "userID")
+	if !ok {
+		return
+	}
+	if err := h.service.RemoveParticipant(id, uint(c.GetInt("user_id")), userID); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed"})
+}
+
+// PATCH /conversations/:id/participants/:userID
+// SetRole godoc
+// @Summary      Change the role of a participant
+// @Description  Promote a member to admin or demote an admin (owner only). Role owner transfers the ownership; the former owner becomes admin
+// @Tags         conversations
+// @Security     BearerAuth
+// @Accept       json
+// @Param        id      path  int  true  "Conversation ID"
+// @Param        userID  path  int  true  "Participant user ID"
+// @Param        body    body  message.RoleInput  true  "New role"
+// @Success      200  {object}  map[string]string "Role updated"
+// @Failure      400  {object}  map[string]string "Invalid input"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Not the owner"
+// @Failure      404  {object}  map[string]string "Conversation or participant not found"
+// @Router       /api/conversations/{id}/participants/{userID} [patch]
+func (h *Handler) SetRole(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "userID")
+	if !ok {
+		return
+	}
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	if err := h.service.SetRole(id, uint(c.GetInt("user_id")), userID, input.Role); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
+}
@@ -0,0 +1,241 @@
+package message
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetOrCreateDirect retourne la conversation privée entre deux utilisateurs, créée au premier message ;
+// request est l'état de la demande de message du destinataire à la création
+func (r *repository) GetOrCreateDirect(senderID, receiverID uint, request RequestState) (*Conversation, error) {
+	key := generateConversationKey(senderID, receiverID)
+	var conv Conversation
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		conv = Conversation{Kind: KindDirect, DirectKey: &key, CreatedBy: senderID}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&conv)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Déjà créée (éventuellement à l'instant par l'autre participant)
+			return tx.Where("direct_key = ?", key).First(&conv).Error
+		}
+		now := time.Now()
+		return tx.Create([]Participant{
+			{ConversationID: conv.ID, UserID: senderID, Role: RoleMember, JoinedAt: now},
+			{ConversationID: conv.ID, UserID: receiverID, Role: RoleMember, Request: request, JoinedAt: now},
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// FindDirect retourne la conversation privée entre deux utilisateurs (gorm.ErrRecordNotFound si aucun message échangé)
+func (r *repository) FindDirect(user1ID, user2ID uint) (*Conversation, error) {
+	var conv Conversation
+	err := r.db.Where("direct_key = ?", generateConversationKey(user1ID, user2ID)).First(&conv).Error
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// CreateGroup crée un groupe, son propriétaire et les invitations initiales
+func (r *repository) CreateGroup(conv *Conversation, ownerID uint, inviteeIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(conv).Error; err != nil {
+			return err
+		}
+		owner := Participant{ConversationID: conv.ID, UserID: ownerID, Role: RoleOwner, JoinedAt: time.Now()}
+		if err := tx.Create(&owner).Error; err != nil {
+			return err
+		}
+		if len(inviteeIDs) == 0 {
+			return nil
+		}
+		invites := make([]Invite, 0, len(inviteeIDs))
+		for _, id := range inviteeIDs {
+			invites = append(invites, Invite{ConversationID: conv.ID, InviteeID: id, InviterID: ownerID})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&invites).Error
+	})
+}
+
+// GetConversationByID récupère une conversation par son ID
+func (r *repository) GetConversationByID(id uint) (*Conversation, error) {
+	var conv Conversation
+	if err := r.db.First(&conv, id).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// UpdateTitle renomme un groupe
+func (r *repository) UpdateTitle(conversationID uint, title string) error {
+	return r.db.Model(&Conversation{}).Where("id = ?", conversationID).Update("title", title).Error
+}
+
+// GetParticipant retourne la participation d'un utilisateur (gorm.ErrRecordNotFound s'il n'en fait pas partie)
+func (r *repository) GetParticipant(conversationID, userID uint) (*Participant, error) {
+	var p Participant
+	err := r.db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&p).Error
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// IsMessageParticipant indique si userID participe à la conversation d'un message (non supprimé) :
+// accès aux pièces jointes servies par /media/{id}
+func (r *repository) IsMessageParticipant(messageID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Table("messages AS m").
+		Joins("JOIN conversation_participants p ON p.conversation_id = m.conversation_id").
+		Where("m.id = ? AND m.deleted_at IS NULL AND p.user_id = ?", messageID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetParticipants liste les participants, du plus ancien au plus récent
+func (r *repository) GetParticipants(conversationID uint) ([]Participant, error) {
+	var participants []Participant
+	err := r.db.Where("conversation_id = ?", conversationID).Order("joined_at ASC, user_id ASC").Find(&participants).Error
+	return participants, err
+}
+
+// CountMembers compte les participants et les invitations en attente (taille maximale d'un groupe)
+func (r *repository) CountMembers(conversationID uint) (int64, error) {
+	var count int64
+	err := r.db.Raw(`
+		SELECT (SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?)
+		     + (SELECT COUNT(*) FROM conversation_invites WHERE conversation_id = ?)`,
+		conversationID, conversationID).Scan(&count).Error
+	return count, err
+}
+
+// RemoveParticipant retire un participant ; successorID (si non nul) devient propriétaire dans la même transaction.
+// Quand le dernier participant part, les invitations en attente sont annulées (le groupe reste archivé).
+func (r *repository) RemoveParticipant(conversationID, userID, successorID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).Delete(&Participant{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if successorID > 0 {
+			if err := tx.Model(&Participant{}).
+				Where("conversation_id = ? AND user_id = ?", conversationID, successorID).
+				Update("role", RoleOwner).Error; err != nil {
+				return err
+			}
+		}
+		var remaining int64
+		if err := tx.Model(&Participant{}).Where("conversation_id = ?", conversationID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return tx.Where("conversation_id = ?", conversationID).Delete(&Invite{}).Error
+		}
+		return nil
+	})
+}
+
+// SetRole change le rôle d'un participant
+func (r *repository) SetRole(conversationID, userID uint, role ParticipantRole) error {
+	return r.db.Model(&Participant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Update("role", role).Error
+}
+
+// TransferOwnership donne la propriété du groupe à toID ; l'ancien propriétaire devient admin
+func (r *repository) TransferOwnership(conversationID, fromID, toID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Participant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, fromID).
+			Update("role", RoleAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Participant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, toID).
+			Update("role", RoleOwner).Error
+	})
+}
+
+// AdvanceReadCursor avance le curseur de lecture (jamais en arrière) ; false si rien n'a changé
+func (r *repository) AdvanceReadCursor(conversationID, userID, messageID uint) (bool, error) {
+	res := r.db.Model(&Participant{}).
+		Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", conversationID, userID, messageID).
+		Update("last_read_message_id", messageID)
+	return res.RowsAffected > 0, res.Error
+}
+
+// SetRequest change l'état de la demande de message d'un participant
+func (r *repository) SetRequest(conversationID, userID uint, request RequestState) error {
+	return r.db.Model(&Participant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Update("request", request).Error
+}
+
+// CreateInvite enregistre une invitation (ErrAlreadyInvited si elle existe déjà)
+func (r *repository) CreateInvite(inv *Invite) error {
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(inv)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAlreadyInvited
+	}
+	return nil
+}
+
+// GetInvite récupère une invitation par son ID
+func (r *repository) GetInvite(id uint) (*Invite, error) {
+	var inv Invite
+	if err := r.db.First(&inv, id).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetInvitesFor liste les invitations reçues par un utilisateur, avec le nom du groupe
+func (r *repository) GetInvitesFor(userID uint) ([]*InviteRaw, error) {
+	var invites []*InviteRaw
+	err := r.db.Table("conversation_invites AS i").
+		Select("i.*, c.title").
+		Joins("JOIN conversations c ON c.id = i.conversation_id").
+		Where("i.invitee_id = ?", userID).
+		Order("i.id DESC").
+		Scan(&invites).Error
+	return invites, err
+}
+
+// DeleteInvite supprime une invitation (refus ou annulation)
+func (r *repository) DeleteInvite(id uint) error {
+	return r.db.Delete(&Invite{}, id).Error
+}
+
+// AcceptInvite ajoute l'invité comme membre ; l'historique existant est considéré comme lu
+func (r *repository) AcceptInvite(inv *Invite) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&Invite{}, inv.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound // Déjà acceptée, refusée ou annulée
+		}
+		var lastID uint
+		if err := tx.Model(&Message{}).Select("COALESCE(MAX(id), 0)").
+			Where("conversation_id = ?", inv.ConversationID).Scan(&lastID).Error; err != nil {
+			return err
+		}
+		member := Participant{ConversationID: inv.ConversationID, UserID: inv.InviteeID, Role: RoleMember, LastReadMessageID: lastID, JoinedAt: time.Now()}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error
+	})
+}
@@ -1,8 +1,10 @@
 package message
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,42 +18,68 @@ func NewHandler(service Service) *Handler {
 }
 
 // RegisterRoutes ajoute les routes liées à la messagerie
-func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, writeLimits ...gin.HandlerFunc) {
 	msg := rg.Group("/messages")
 	msg.Use() // Auth middleware déjà appliqué au niveau de rg
 
-	msg.POST("", h.SendMessage)
+	msg.POST("", append(writeLimits, h.SendMessage)...) // Anti-spam : limites passées par l'appelant
 	msg.GET("/conversations", h.GetPreviews)
+	msg.GET("/search", h.SearchMessages)
+	msg.GET("/requests", h.GetRequests)
+	msg.POST("/requests/:id/accept", h.AcceptRequest)
+	msg.DELETE("/requests/:id", h.DeclineRequest)
 	msg.GET("/:otherUserID", h.GetConversation)
 	msg.PATCH("/:senderID/read", h.MarkAsRead)
 
 	msg.PUT("/:id", h.UpdateMessage)
 	msg.DELETE("/:id", h.DeleteMessage)
+
+	h.registerConversationRoutes(rg, writeLimits...)
 }
 
 // POST /messages
 // SendMessage godoc
-// @Summary      Send a private message
-// @Description  Send a private message to another user
+// @Summary      Send a message
+// @Description  Send a private message to another user (receiver_id) or a message to a group the user belongs to (conversation_id). As multipart/form-data, up to 5 attachments (images and PDFs up to 10 MB, other documents up to 20 MB) checked like post media; their URLs appear once the antivirus has cleared them. Until the receiver accepts a private conversation, their direct message policy applies (everyone, followers or subscribers) and the first contact from a user they do not follow lands in their message requests
 // @Tags         messages
 // @Security     BearerAuth
 // @Accept       json
+// @Accept       multipart/form-data
 // @Produce      json
-// @Param        body  body  message.CreateMessageInput  true  "Message content and receiver ID"
+// @Param        body             body      message.CreateMessageInput  false  "Message content and receiver ID or conversation ID (JSON)"
+// @Param        receiver_id      formData  int     false  "Receiver user ID (multipart)"
+// @Param        conversation_id  formData  int     false  "Conversation ID (multipart)"
+// @Param        content          formData  string  false  "Message content (multipart, optional with attachments)"
+// @Param        attachments      formData  file    false  "Attachments (images or documents, max 5)"
 // @Success      201   {object}  message.MessageDTO
-// @Failure      400   {object}  map[string]string "Invalid input"
+// @Failure      400   {object}  map[string]string "Invalid input or attachment refused"
 // @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Receiver does not accept messages from the sender, or blocked by the sender"
+// @Failure      404   {object}  map[string]string "Receiver or conversation not found"
 // @Router       /api/messages [post]
 func (h *Handler) SendMessage(c *gin.Context) {
 	var input CreateMessageInput
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
 		return
 	}
+	if form, err := c.MultipartForm(); err == nil {
+		input.Files = form.File["attachments"]
+	}
 
 	senderID := c.GetInt("user_id")
 	dto, err := h.service.Send(uint(senderID), input)
-	if err != nil {
+	switch {
+	case errors.Is(err, ErrConversationNotFound), errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrRecipientUnavailable), errors.Is(err, ErrUserBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrAttachmentsDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -61,7 +89,7 @@ func (h *Handler) SendMessage(c *gin.Context) {
 // GET /messages/conversations
 // GetPreviews godoc
 // @Summary      Get all conversations
-// @Description  Get a preview of all conversations (last message, user info, unread count)
+// @Description  Get a preview of all conversations, direct and groups (last message, other user or group title, unread count). Message requests appear once accepted
 // @Tags         messages
 // @Security     BearerAuth
 // @Produce      json
@@ -79,16 +107,89 @@ func (h *Handler) GetPreviews(c *gin.Context) {
 	c.JSON(http.StatusOK, previews)
 }
 
+// GET /messages/requests
+// GetRequests godoc
+// @Summary      Get message requests
+// @Description  Get the pending message requests: private conversations started by users the authenticated user does not follow. Reading a request sends no read receipt; replying or accepting moves it to the conversations
+// @Tags         messages
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200   {array}   message.MessagePreviewDTO
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      500   {object}  map[string]string "Internal server error"
+// @Router       /api/messages/requests [get]
+func (h *Handler) GetRequests(c *gin.Context) {
+	requests, err := h.service.GetRequests(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message requests"})
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// POST /messages/requests/:id/accept
+// AcceptRequest godoc
+// @Summary      Accept a message request
+// @Description  Move a pending message request to the conversations; read receipts are sent from then on
+// @Tags         messages
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path  int  true  "Conversation ID"
+// @Success      200  {object}  map[string]string "Message request accepted"
+// @Failure      400  {object}  map[string]string "Invalid conversation ID"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Message request not found"
+// @Router       /api/messages/requests/{id}/accept [post]
+func (h *Handler) AcceptRequest(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.AcceptRequest(id, uint(c.GetInt("user_id"))); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Message request accepted"})
+}
+
+// DELETE /messages/requests/:id
+// DeclineRequest godoc
+// @Summary      Decline a message request
+// @Description  Hide a pending message request. The sender is not told and their next messages are not notified; writing to them reopens the conversation
+// @Tags         messages
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path  int  true  "Conversation ID"
+// @Success      200  {object}  map[string]string "Message request declined"
+// @Failure      400  {object}  map[string]string "Invalid conversation ID"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Message request not found"
+// @Router       /api/messages/requests/{id} [delete]
+func (h *Handler) DeclineRequest(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeclineRequest(id, uint(c.GetInt("user_id"))); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Message request declined"})
+}
+
 // GET /messages/:otherUserID
 // GetConversation godoc
 // @Summary      Get conversation with a user
-// @Description  Get all messages exchanged with a specific user
+// @Description  Get one page of the messages exchanged with a specific user, in chronological order. Without cursor, the latest messages; before loads older messages, after newer ones (catch-up after a reconnection)
 // @Tags         messages
 // @Security     BearerAuth
 // @Produce      json
-// @Param        otherUserID  path  int  true  "Other user ID"
-// @Success      200   {array}   message.MessageDTO
-// @Failure      400   {object}  map[string]string "Invalid user ID"
+// @Param        otherUserID  path   int  true   "Other user ID"
+// @Param        before       query  int  false  "Return messages older than this message ID"
+// @Param        after        query  int  false  "Return messages newer than this message ID"
+// @Param        limit        query  int  false  "Number of messages (default 50, max 100)"
+// @Success      200   {object}  message.ConversationPage
+// @Failure      400   {object}  map[string]string "Invalid user ID or cursor"
 // @Failure      401   {object}  map[string]string "Unauthorized"
 // @Failure      500   {object}  map[string]string "Internal server error"
 // @Router       /api/messages/{otherUserID} [get]
@@ -100,12 +201,74 @@ func (h *Handler) GetConversation(c *gin.Context) {
 		return
 	}
 
-	convo, err := h.service.GetConversation(uint(userID), uint(otherID))
+	before, okBefore := queryID(c, "before")
+	after, okAfter := queryID(c, "after")
+	limit, okLimit := queryID(c, "limit")
+	if !okBefore || !okAfter || !okLimit || (before > 0 && after > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor: use before or after (message IDs) and limit"})
+		return
+	}
+
+	page, err := h.service.GetConversation(uint(userID), uint(otherID), PageQuery{Before: before, After: after, Limit: int(limit)})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load messages"})
 		return
 	}
-	c.JSON(http.StatusOK, convo)
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /messages/search
+// SearchMessages godoc
+// @Summary      Search my messages
+// @Description  Full-text search in the conversations of the authenticated user (deleted messages excluded), most recent first. Each hit comes with a snippet (HTML-escaped, matches wrapped in <mark>) and the previous and next messages of its conversation. Query syntax: words, "exact phrase", -excluded, or
+// @Tags         messages
+// @Security     BearerAuth
+// @Produce      json
+// @Param        q       query  string  true   "Search terms"
+// @Param        with    query  int     false  "Only search the conversation with this user"
+// @Param        conversation_id  query  int  false  "Only search this conversation (group)"
+// @Param        before  query  int     false  "Return hits older than this message ID (next page)"
+// @Param        limit   query  int     false  "Number of hits (default 20, max 100)"
+// @Success      200   {object}  message.SearchResult
+// @Failure      400   {object}  map[string]string "Invalid query"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      500   {object}  map[string]string "Internal server error"
+// @Router       /api/messages/search [get]
+func (h *Handler) SearchMessages(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < 2 || len(q) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query must be between 2 and 200 characters"})
+		return
+	}
+	with, okWith := queryID(c, "with")
+	conversationID, okConv := queryID(c, "conversation_id")
+	before, okBefore := queryID(c, "before")
+	limit, okLimit := queryID(c, "limit")
+	if !okWith || !okConv || !okBefore || !okLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid with, conversation_id, before or limit"})
+		return
+	}
+
+	result, err := h.service.Search(uint(userID), SearchQuery{Query: q, With: with, ConversationID: conversationID, Before: before, Limit: int(limit)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// queryID lit un paramètre entier positif optionnel (0 si absent)
+func queryID(c *gin.Context, name string) (uint, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(n), true
 }
 
 // PATCH /messages/:senderID/read
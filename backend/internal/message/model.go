@@ -1,7 +1,10 @@
 package message
 
 import (
+	"mime/multipart"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // MessageStatus représente l'état d'un message
@@ -14,34 +17,181 @@ const (
 	StatusDeleted  MessageStatus = "DELETED"
 )
 
-// Message représente un message privé entre deux utilisateurs
+// Message représente un message d'une conversation (privée ou de groupe)
 type Message struct {
-	ID         uint          `gorm:"primaryKey"`
-	SenderID   uint          `gorm:"not null"`
-	ReceiverID uint          `gorm:"not null"`
-	Content    string        `gorm:"type:text;not null"`
-	Status     MessageStatus `gorm:"default:'UNREAD'"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	DeletedAt  *time.Time `gorm:"index"`
+	ID             uint          `gorm:"primaryKey"`
+	ConversationID uint          `gorm:"not null;index"`
+	SenderID       uint          `gorm:"not null"`
+	ReceiverID     uint          `gorm:"not null"` // Conversation privée : l'autre participant ; 0 dans un groupe
+	Content        string        `gorm:"type:text;not null"`
+	Status         MessageStatus `gorm:"default:'UNREAD'"`       // Conversation privée uniquement ; les groupes suivent les curseurs de lecture
+	Withheld       bool          `gorm:"not null;default:false"` // Expéditeur bloqué par le destinataire : visible de son seul auteur, jamais remis
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"` // Suppression logique : exclu de l'historique, des aperçus et de la recherche
+}
+
+// ConversationKind : conversation privée à deux ou groupe
+type ConversationKind string
+
+const (
+	KindDirect ConversationKind = "direct"
+	KindGroup  ConversationKind = "group"
+)
+
+// ParticipantRole : rôle d'un participant dans un groupe
+type ParticipantRole string
+
+const (
+	RoleOwner  ParticipantRole = "owner"  // Créateur (ou successeur) : nomme les admins, ne peut pas être exclu
+	RoleAdmin  ParticipantRole = "admin"  // Invite, exclut les membres, renomme le groupe
+	RoleMember ParticipantRole = "member" // Lit et écrit
+)
+
+// RequestState : demande de message (premier contact d'un inconnu en conversation privée), côté destinataire
+type RequestState string
+
+const (
+	RequestNone     RequestState = ""         // Conversation acceptée : boîte de réception
+	RequestPending  RequestState = "pending"  // Demande en attente : hors de la boîte de réception, sans accusé de lecture
+	RequestDeclined RequestState = "declined" // Demande refusée : masquée, sans notification ; l'expéditeur n'en sait rien
+)
+
+// MaxGroupSize : participants et invitations en attente d'un groupe
+const MaxGroupSize = 200
+
+// Conversation : fil de messages entre ses participants. Une conversation privée est unique par paire
+// d'utilisateurs (DirectKey) ; un groupe d'étude peut être rattaché à un cours (post) du créateur.
+type Conversation struct {
+	ID        uint             `gorm:"primaryKey"`
+	Kind      ConversationKind `gorm:"type:varchar(10);not null"`
+	Title     string           `gorm:"type:varchar(100)"`
+	PostID    *uint            `gorm:"index"`       // Cours du groupe : seuls ceux qui y ont accès peuvent rejoindre
+	DirectKey *string          `gorm:"uniqueIndex"` // "a-b" (a < b) pour les conversations privées
+	CreatedBy uint             `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Participant : membre d'une conversation et son curseur de lecture
+type Participant struct {
+	ConversationID    uint            `gorm:"primaryKey"`
+	UserID            uint            `gorm:"primaryKey"`
+	Role              ParticipantRole `gorm:"type:varchar(10);not null"`
+	LastReadMessageID uint            `gorm:"not null;default:0"`                   // Messages d'ID supérieur non lus
+	Request           RequestState    `gorm:"type:varchar(10);not null;default:''"` // Demande de message (conversation privée) ; accepté en répondant
+	JoinedAt          time.Time
+}
+
+// TableName : participants des conversations
+func (Participant) TableName() string {
+	return "conversation_participants"
+}
+
+// Invite : invitation en attente à rejoindre un groupe
+type Invite struct {
+	ID             uint `gorm:"primaryKey"`
+	ConversationID uint `gorm:"not null;uniqueIndex:idx_conversation_invites_invitee"`
+	InviteeID      uint `gorm:"not null;uniqueIndex:idx_conversation_invites_invitee"`
+	InviterID      uint `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// TableName : invitations aux groupes
+func (Invite) TableName() string {
+	return "conversation_invites"
+}
+
+const (
+	DefaultPageSize = 50  // Messages par page d'historique
+	MaxPageSize     = 100 // Taille maximale d'une page (historique ou recherche)
+)
+
+// PageQuery : curseur de l'historique d'une conversation (IDs de messages, au plus l'un des deux)
+type PageQuery struct {
+	Before uint // Messages plus anciens que cet ID (remonter l'historique)
+	After  uint // Messages plus récents que cet ID (rattrapage après une reconnexion)
+	Limit  int
+}
+
+// ConversationPage : page de l'historique, toujours en ordre chronologique
+type ConversationPage struct {
+	Messages []*MessageDTO `json:"messages"`
+	HasMore  bool          `json:"has_more"` // D'autres messages existent dans le sens demandé
+}
+
+// SearchQuery : recherche plein texte dans les conversations d'un utilisateur
+type SearchQuery struct {
+	Query          string // Syntaxe websearch : mots, "expression exacte", -exclu, or
+	With           uint   // Limite la recherche à la conversation privée avec cet utilisateur (0 : toutes)
+	ConversationID uint   // Limite la recherche à une conversation (0 : toutes)
+	Before         uint   // Curseur : résultats plus anciens que cet ID
+	Limit          int
 }
 
-// DTO pour la création d’un message (reçu via JSON)
+// SearchHit : message trouvé, avec ses voisins dans la conversation
+type SearchHit struct {
+	Message  *MessageDTO `json:"message"`
+	Snippet  string      `json:"snippet"`            // Extrait HTML échappé, termes trouvés entre <mark></mark>
+	Previous *MessageDTO `json:"previous,omitempty"` // Message précédent de la conversation
+	Next     *MessageDTO `json:"next,omitempty"`     // Message suivant de la conversation
+}
+
+// SearchResult : résultats du plus récent au plus ancien
+type SearchResult struct {
+	Hits    []*SearchHit `json:"hits"`
+	HasMore bool         `json:"has_more"` // Page suivante : before = ID du dernier résultat
+}
+
+// DTO pour la création d’un message (JSON, ou multipart avec pièces jointes) : à un utilisateur
+// (conversation privée) ou dans une conversation. Le texte est facultatif s'il y a des pièces jointes.
 type CreateMessageInput struct {
-	ReceiverID uint   `json:"receiver_id" binding:"required"`
-	Content    string `json:"content" binding:"required"`
+	ReceiverID     uint   `json:"receiver_id" form:"receiver_id"`
+	ConversationID uint   `json:"conversation_id" form:"conversation_id"`
+	Content        string `json:"content" form:"content"`
+
+	Files []*multipart.FileHeader `json:"-" form:"-"` // Pièces jointes (champ multipart attachments)
+}
+
+// MaxAttachments : pièces jointes d'un message (images et documents)
+const MaxAttachments = 5
+
+// AttachmentFile : fichier joint validé et enregistré dans le stockage, en attente de son message
+type AttachmentFile struct {
+	Key       string // Clé de stockage adressée par le contenu
+	FileName  string // Nom d'origine nettoyé
+	MediaType string // image ou document
+	Size      int64
+	Hash      string // SHA-256 (hex)
+	ClaimID   uint   // Réservation de la clé de stockage jusqu'à la création du message
+}
+
+// AttachmentDTO : pièce jointe d'un message. L'URL, signée pour le lecteur, n'est présente qu'une fois le fichier
+// validé par l'antivirus (jamais dans les événements temps réel : relire la conversation).
+type AttachmentDTO struct {
+	ID         uint   `json:"id"`
+	Type       string `json:"type"` // image ou document
+	FileName   string `json:"file_name"`
+	FileSize   int64  `json:"file_size"`
+	Status     string `json:"status"`                // Traitement : pending, processing, ready ou failed
+	Scan       string `json:"scan_status,omitempty"` // Verdict antivirus : pending, clean, infected, error ou skipped
+	URL        string `json:"url,omitempty"`
+	PreviewURL string `json:"preview_url,omitempty"` // Miniature d'une image, aperçu de la première page d'un document
 }
 
 // DTO pour l'affichage enrichi d’un message
 type MessageDTO struct {
-	ID        uint          `json:"id"`
-	Content   string        `json:"content"`
-	Status    MessageStatus `json:"status"`
-	CreatedAt time.Time     `json:"created_at"`
+	ID             uint          `json:"id"`
+	ConversationID uint          `json:"conversation_id"`
+	Content        string        `json:"content"`
+	Status         MessageStatus `json:"status"`
+	CreatedAt      time.Time     `json:"created_at"`
 
-	// Infos utilisateur enrichies
+	// Infos utilisateur enrichies (pas de destinataire dans un groupe)
 	Sender   *UserInfo `json:"sender"`
 	Receiver *UserInfo `json:"receiver"`
+
+	Attachments []*AttachmentDTO `json:"attachments,omitempty"`
 }
 
 // Représente les infos de base d’un utilisateur (utilisé dans les DTOs)
@@ -53,18 +203,113 @@ type UserInfo struct {
 
 // MessagePreviewDTO = structure pour la liste des conversations
 type MessagePreviewDTO struct {
-	ConversationID string    `json:"conversation_id"` // clé virtuelle: "user1-user2"
-	LastMessage    string    `json:"last_message"`
-	Timestamp      time.Time `json:"timestamp"`
-	UnreadCount    int       `json:"unread_count"`
-	OtherUser      *UserInfo `json:"other_user"` // celui avec qui je parle
+	ConversationID   uint             `json:"conversation_id"`
+	Kind             ConversationKind `json:"kind"`            // direct ou group
+	Title            string           `json:"title,omitempty"` // Nom du groupe
+	LastMessage      string           `json:"last_message"`
+	Timestamp        time.Time        `json:"timestamp"`
+	UnreadCount      int              `json:"unread_count"` // Messages des autres après mon curseur de lecture
+	ParticipantCount int              `json:"participant_count"`
+	OtherUser        *UserInfo        `json:"other_user,omitempty"` // Conversation privée : celui avec qui je parle
 }
 
 type MessagePreviewRaw struct {
-	LastMessage    string    `json:"last_message"`
-	OtherUserID    uint      `json:"other_user_id"`
-	OtherUsername  string    `json:"other_username"`
-	OtherAvatarURL string    `json:"other_avatar_url"`
+	ConversationID   uint             `json:"conversation_id"`
+	Kind             ConversationKind `json:"kind"`
+	Title            string           `json:"title"`
+	LastMessage      string           `json:"last_message"`
+	OtherUserID      uint             `json:"other_user_id"`
+	OtherUsername    string           `json:"other_username"`
+	OtherAvatarURL   string           `json:"other_avatar_url"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UnreadCount      int              `json:"unread_count"`
+	ParticipantCount int              `json:"participant_count"`
+}
+
+// CreateGroupInput : création d'un groupe ; les utilisateurs listés sont invités
+type CreateGroupInput struct {
+	Title      string `json:"title" binding:"required,max=100"`
+	PostID     *uint  `json:"post_id"` // Cours (post) autour duquel le groupe est créé
+	InviteeIDs []uint `json:"invitee_ids"`
+}
+
+// UpdateGroupInput : renommage d'un groupe
+type UpdateGroupInput struct {
+	Title string `json:"title" binding:"required,max=100"`
+}
+
+// InviteInput : invitation d'un utilisateur dans un groupe
+type InviteInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// RoleInput : changement de rôle (owner transfère la propriété du groupe)
+type RoleInput struct {
+	Role ParticipantRole `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// ReadInput : avance le curseur de lecture (dernier message de la conversation si absent)
+type ReadInput struct {
+	MessageID uint `json:"message_id"`
+}
+
+// ConversationDTO : conversation et ses participants
+type ConversationDTO struct {
+	ID           uint              `json:"id"`
+	Kind         ConversationKind  `json:"kind"`
+	Title        string            `json:"title,omitempty"`
+	PostID       *uint             `json:"post_id,omitempty"`
+	CreatedBy    uint              `json:"created_by"`
+	CreatedAt    time.Time         `json:"created_at"`
+	MyRole       ParticipantRole   `json:"my_role"`
+	Participants []*ParticipantDTO `json:"participants"`
+}
+
+// ParticipantDTO : participant et son curseur de lecture (accusés de lecture des groupes)
+type ParticipantDTO struct {
+	User              *UserInfo       `json:"user"`
+	Role              ParticipantRole `json:"role"`
+	LastReadMessageID uint            `json:"last_read_message_id"`
+	JoinedAt          time.Time       `json:"joined_at"`
+}
+
+// InviteDTO : invitation reçue
+type InviteDTO struct {
+	ID             uint      `json:"id"`
+	ConversationID uint      `json:"conversation_id"`
+	Title          string    `json:"title"`
+	Inviter        *UserInfo `json:"inviter"`
 	CreatedAt      time.Time `json:"created_at"`
-	UnreadCount    int       `json:"unread_count"`
+}
+
+// InviteRaw : invitation avec le nom du groupe
+type InviteRaw struct {
+	Invite
+	Title string
+}
+
+// MessageSearchRaw : ligne de résultat de la recherche (message, extrait et voisins)
+type MessageSearchRaw struct {
+	ID             uint
+	ConversationID uint
+	SenderID       uint
+	ReceiverID     uint
+	Content        string
+	Status         MessageStatus
+	CreatedAt      time.Time
+	Snippet        string
+
+	PrevID         *uint
+	PrevSenderID   *uint
+	PrevReceiverID *uint
+	PrevContent    *string
+	PrevStatus     MessageStatus
+	PrevCreatedAt  *time.Time
+
+	NextID         *uint
+	NextSenderID   *uint
+	NextReceiverID *uint
+	NextContent    *string
+	NextStatus     MessageStatus
+	NextCreatedAt  *time.Time
 }
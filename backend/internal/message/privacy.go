@@ -0,0 +1,160 @@
+package message
+
+import (
+	"backend/internal/realtime"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserBlocked          = errors.New("vous avez bloqué cet utilisateur")
+	ErrRecipientUnavailable = errors.New("cet utilisateur ne peut pas recevoir vos messages")
+	ErrRequestNotFound      = errors.New("demande de message introuvable")
+)
+
+// Privacy : réglages de confidentialité des utilisateurs (user.Service). Un utilisateur bloqué obtient les mêmes
+// réponses que s'il ne l'était pas : ses messages privés sont enregistrés mais retenus (visibles de lui seul)
+// et ses invitations dans un groupe ne sont jamais remises.
+type Privacy interface {
+	IsBlocked(blockerID, blockedID uint) (bool, error)
+	// AcceptsMessagesFrom applique le réglage des messages privés du destinataire (everyone, followers, subscribers)
+	AcceptsMessagesFrom(receiverID, senderID uint) (bool, error)
+	Follows(followerID, creatorID uint) (bool, error)
+}
+
+// blocks vérifie les blocages entre sender et receiver : ErrUserBlocked si sender a bloqué receiver ;
+// withheld si receiver a bloqué sender
+func (s *service) blocks(senderID, receiverID uint) (withheld bool, err error) {
+	if s.privacy == nil {
+		return false, nil
+	}
+	blocked, err := s.privacy.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, ErrUserBlocked
+	}
+	return s.privacy.IsBlocked(receiverID, senderID)
+}
+
+// direct retourne la conversation privée dans laquelle sender écrit à receiver (créée au premier message)
+// et si le message doit être retenu. Tant que le destinataire n'a pas accepté la conversation, son réglage
+// des messages privés s'applique ; le premier contact d'un utilisateur qu'il ne suit pas devient une demande de message.
+func (s *service) direct(senderID, receiverID uint) (*Conversation, bool, error) {
+	if _, err := s.getUserInfoByID(receiverID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrUserNotFound
+	} else if err != nil {
+		return nil, false, err
+	}
+	if s.privacy == nil {
+		conv, err := s.repo.GetOrCreateDirect(senderID, receiverID, RequestNone)
+		return conv, false, err
+	}
+	// Le blocage ne change aucune réponse : les vérifications suivantes s'appliquent de la même façon
+	withheld, err := s.blocks(senderID, receiverID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	conv, err := s.repo.FindDirect(senderID, receiverID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+	if conv != nil {
+		receiver, err := s.repo.GetParticipant(conv.ID, receiverID)
+		if err != nil {
+			return nil, false, err
+		}
+		if receiver.Request == RequestNone {
+			return conv, withheld, nil
+		}
+	}
+
+	accepts, err := s.privacy.AcceptsMessagesFrom(receiverID, senderID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !accepts {
+		return nil, false, ErrRecipientUnavailable
+	}
+	if conv != nil {
+		return conv, withheld, nil
+	}
+
+	request := RequestPending
+	if follows, err := s.privacy.Follows(receiverID, senderID); err != nil {
+		return nil, false, err
+	} else if follows {
+		request = RequestNone
+	}
+	conv, err = s.repo.GetOrCreateDirect(senderID, receiverID, request)
+	return conv, withheld, err
+}
+
+// directByID applique les règles de direct à une conversation privée désignée par son ID :
+// écrire par conversation_id ne contourne ni le blocage ni le réglage des messages privés
+func (s *service) directByID(conv *Conversation, senderID uint) (*Conversation, bool, error) {
+	participants, err := s.repo.GetParticipants(conv.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	peerID := peerOf(userIDs(participants), senderID)
+	if peerID == 0 {
+		return nil, false, ErrConversationNotFound
+	}
+	return s.direct(senderID, peerID)
+}
+
+// audience répartit les participants qui reçoivent les événements d'un message : boîte de réception ou
+// demandes de messages en attente. Une demande refusée ne notifie plus ; un message retenu n'est poussé qu'à son auteur.
+func audience(participants []Participant, msg *Message) (inbox, requests []uint) {
+	for _, p := range participants {
+		switch {
+		case p.UserID == msg.SenderID:
+			inbox = append(inbox, p.UserID)
+		case msg.Withheld || p.Request == RequestDeclined:
+		case p.Request == RequestPending:
+			requests = append(requests, p.UserID)
+		default:
+			inbox = append(inbox, p.UserID)
+		}
+	}
+	return inbox, requests
+}
+
+// GetRequests liste les demandes de messages en attente, la plus récente en premier
+func (s *service) GetRequests(userID uint) ([]*MessagePreviewDTO, error) {
+	return s.previews(userID, RequestPending)
+}
+
+// AcceptRequest fait passer une demande de message dans la boîte de réception ; les accusés de lecture reprennent
+func (s *service) AcceptRequest(conversationID, userID uint) error {
+	return s.answerRequest(conversationID, userID, RequestNone)
+}
+
+// DeclineRequest masque une demande de message ; l'expéditeur n'en est pas informé et ses messages suivants
+// ne sont plus notifiés. Écrire à l'expéditeur rouvre la conversation.
+func (s *service) DeclineRequest(conversationID, userID uint) error {
+	return s.answerRequest(conversationID, userID, RequestDeclined)
+}
+
+func (s *service) answerRequest(conversationID, userID uint, request RequestState) error {
+	_, p, err := s.participation(conversationID, userID)
+	if errors.Is(err, ErrConversationNotFound) {
+		return ErrRequestNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if p.Request != RequestPending {
+		return ErrRequestNotFound
+	}
+	if err := s.repo.SetRequest(conversationID, userID, request); err != nil {
+		return err
+	}
+	// Les autres sessions de l'utilisateur mettent à jour leurs listes ; l'expéditeur n'est pas prévenu
+	s.notify(realtime.TypeConversationUpdated, userID, updateEvent(conversationID), userID)
+	return nil
+}
@@ -2,19 +2,45 @@ package message
 
 import (
 	"errors"
-	_ "fmt"
+	"fmt"
 
 	"gorm.io/gorm"
 )
 
 type Repository interface {
-	CreateMessage(msg *Message) error
-	GetConversation(user1ID, user2ID uint) ([]*Message, error)
-	GetConversationPreviews(userID uint) ([]*MessagePreviewRaw, error)
-	MarkMessagesAsRead(senderID, receiverID uint) error
+	CreateMessage(msg *Message, inTx func(tx *gorm.DB) error) error
+	GetMessages(conversationID, viewerID uint, page PageQuery) ([]*Message, error)
+	SearchMessages(userID uint, query SearchQuery) ([]*MessageSearchRaw, error)
+	GetConversationPreviews(userID uint, request RequestState) ([]*MessagePreviewRaw, error)
+	MarkMessagesAsRead(conversationID, readerID, upToID uint) (int64, error)
 	UpdateMessage(msgID, userID uint, content string) error
-	DeleteMessage(msgID, userID uint) error
+	DeleteMessage(msgID, userID uint, inTx func(tx *gorm.DB) error) error
 	GetMessageByID(msgID uint) (*Message, error)
+	GetLastMessageID(conversationID, viewerID uint) (uint, error)
+	GetContactIDs(userID uint) ([]uint, error)
+
+	// Conversations et participants (conversation_repository.go)
+	GetOrCreateDirect(senderID, receiverID uint, request RequestState) (*Conversation, error)
+	FindDirect(user1ID, user2ID uint) (*Conversation, error)
+	CreateGroup(conv *Conversation, ownerID uint, inviteeIDs []uint) error
+	GetConversationByID(id uint) (*Conversation, error)
+	UpdateTitle(conversationID uint, title string) error
+	GetParticipant(conversationID, userID uint) (*Participant, error)
+	GetParticipants(conversationID uint) ([]Participant, error)
+	IsMessageParticipant(messageID, userID uint) (bool, error)
+	CountMembers(conversationID uint) (int64, error)
+	RemoveParticipant(conversationID, userID, successorID uint) error
+	SetRole(conversationID, userID uint, role ParticipantRole) error
+	TransferOwnership(conversationID, fromID, toID uint) error
+	AdvanceReadCursor(conversationID, userID, messageID uint) (bool, error)
+	SetRequest(conversationID, userID uint, request RequestState) error
+
+	// Invitations
+	CreateInvite(inv *Invite) error
+	GetInvite(id uint) (*Invite, error)
+	GetInvitesFor(userID uint) ([]*InviteRaw, error)
+	DeleteInvite(id uint) error
+	AcceptInvite(inv *Invite) error
 }
 
 type repository struct {
@@ -25,53 +51,138 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db}
 }
 
-// Create a new message
-func (r *repository) CreateMessage(msg *Message) error {
-	return r.db.Create(msg).Error
+// Create a new message ; the conversation is read by its sender up to this message.
+// inTx (optionnel) s'exécute dans la même transaction, une fois l'ID attribué (pièces jointes).
+func (r *repository) CreateMessage(msg *Message, inTx func(tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if inTx != nil {
+			if err := inTx(tx); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Participant{}).
+			Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", msg.ConversationID, msg.SenderID, msg.ID).
+			Update("last_read_message_id", msg.ID).Error
+	})
 }
 
-// Get full conversation between two users (ordered by CreatedAt)
-func (r *repository) GetConversation(user1ID, user2ID uint) ([]*Message, error) {
+// Get one page of a conversation as seen by viewer (page.Limit messages around the cursor, ordered by ID)
+func (r *repository) GetMessages(conversationID, viewerID uint, page PageQuery) ([]*Message, error) {
 	var messages []*Message
-	err := r.db.
-		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
-			user1ID, user2ID, user2ID, user1ID).
-		Order("created_at ASC").
-		Find(&messages).Error
+	query := r.db.Where("conversation_id = ?", conversationID).
+		Where("withheld = false OR sender_id = ?", viewerID).
+		Limit(page.Limit)
 
-	return messages, err
+	if page.After > 0 {
+		err := query.Where("id > ?", page.After).Order("id ASC").Find(&messages).Error
+		return messages, err
+	}
+
+	// Derniers messages (avant le curseur), remis dans l'ordre chronologique
+	if page.Before > 0 {
+		query = query.Where("id < ?", page.Before)
+	}
+	if err := query.Order("id DESC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
 }
 
-// Get preview of all conversations with last message, user info and unread count
-func (r *repository) GetConversationPreviews(userID uint) ([]*MessagePreviewRaw, error) {
-	var previews []*MessagePreviewRaw
+// searchConfig : configuration plein texte, identique à celle de l'index idx_messages_content_fts
+// ('simple' : pas de racinisation, les conversations mélangent les langues)
+const searchConfig = "'simple'"
 
-	// Subquery to find the latest message per conversation
-	subquery := r.db.
-		Table("messages").
-		Select("CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END AS other_user_id, MAX(created_at) AS last_time", userID).
-		Where("sender_id = ? OR receiver_id = ?", userID, userID).
-		Group("other_user_id")
+// Voisin d'un message dans sa conversation (hors messages supprimés, et retenus sauf ceux de l'utilisateur)
+const searchNeighbour = `
+	SELECT n.id, n.sender_id, n.receiver_id, n.content, n.status, n.created_at FROM messages n
+	WHERE n.deleted_at IS NULL AND n.conversation_id = m.conversation_id
+	AND (n.withheld = false OR n.sender_id = ?)
+	AND n.id %s m.id ORDER BY n.id %s LIMIT 1`
 
-	// Join to fetch message + user info + unread count
+// Full-text search in the user's conversations, most recent first, with a highlighted snippet and the neighbouring messages
+func (r *repository) SearchMessages(userID uint, query SearchQuery) ([]*MessageSearchRaw, error) {
+	var hits []*MessageSearchRaw
+
+	// Le contenu est échappé avant ts_headline : seules les balises <mark> de l'extrait sont du HTML
 	tx := r.db.Table("messages AS m").
 		Select(`
-			m.content AS last_message,
-			u.id AS other_user_id,
-			u.username AS other_username,
-			u.avatar_url AS other_avatar_url,
-			m.created_at,
+			m.id, m.conversation_id, m.sender_id, m.receiver_id, m.content, COALESCE(m.status, '') AS status, m.created_at,
+			ts_headline(`+searchConfig+`,
+				replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				q.query, 'StartSel=<mark>, StopSel=</mark>, MinWords=10, MaxWords=30, MaxFragments=2'
+			) AS snippet,
+			prev.id AS prev_id, prev.sender_id AS prev_sender_id, prev.receiver_id AS prev_receiver_id,
+			prev.content AS prev_content, COALESCE(prev.status, '') AS prev_status, prev.created_at AS prev_created_at,
+			nxt.id AS next_id, nxt.sender_id AS next_sender_id, nxt.receiver_id AS next_receiver_id,
+			nxt.content AS next_content, COALESCE(nxt.status, '') AS next_status, nxt.created_at AS next_created_at
+		`).
+		Joins("CROSS JOIN websearch_to_tsquery("+searchConfig+", ?) AS q(query)", query.Query).
+		Joins("LEFT JOIN LATERAL ("+fmt.Sprintf(searchNeighbour, "<", "DESC")+") AS prev ON true", userID).
+		Joins("LEFT JOIN LATERAL ("+fmt.Sprintf(searchNeighbour, ">", "ASC")+") AS nxt ON true", userID).
+		Where("m.deleted_at IS NULL").
+		Where("m.withheld = false OR m.sender_id = ?", userID).
+		Where("m.conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)", userID).
+		Where("to_tsvector(" + searchConfig + ", m.content) @@ q.query")
+
+	if query.With > 0 {
+		tx = tx.Where("m.conversation_id = (SELECT id FROM conversations WHERE direct_key = ?)", generateConversationKey(userID, query.With))
+	}
+	if query.ConversationID > 0 {
+		tx = tx.Where("m.conversation_id = ?", query.ConversationID)
+	}
+	if query.Before > 0 {
+		tx = tx.Where("m.id < ?", query.Before)
+	}
+
+	err := tx.Order("m.id DESC").Limit(query.Limit).Scan(&hits).Error
+	return hits, err
+}
+
+// Get preview of the conversations of the user (direct and groups) with last message, other user and unread count ;
+// request selects the inbox (RequestNone) or the pending message requests
+func (r *repository) GetConversationPreviews(userID uint, request RequestState) ([]*MessagePreviewRaw, error) {
+	var previews []*MessagePreviewRaw
+
+	// Dernier message visible de chaque conversation ; non lus : messages des autres après le curseur de lecture
+	tx := r.db.Table("conversation_participants AS p").
+		Select(`
+			c.id AS conversation_id,
+			c.kind,
+			c.title,
+			COALESCE(lm.content, '') AS last_message,
+			COALESCE(lm.created_at, c.created_at) AS created_at,
+			COALESCE(u.id, 0) AS other_user_id,
+			COALESCE(u.username, '') AS other_username,
+			COALESCE(u.avatar_url, '') AS other_avatar_url,
 			(
 				SELECT COUNT(*) FROM messages AS unread
-				WHERE unread.sender_id = m.sender_id
-				AND unread.receiver_id = m.receiver_id
-				AND unread.status = 'UNREAD'
-				AND unread.receiver_id = ?
-			) AS unread_count
-		`, userID).
-		Joins("JOIN users u ON u.id = CASE WHEN m.sender_id = ? THEN m.receiver_id ELSE m.sender_id END", userID).
-		Joins("JOIN (?) AS conv ON ((m.sender_id = ? AND m.receiver_id = conv.other_user_id) OR (m.receiver_id = ? AND m.sender_id = conv.other_user_id)) AND m.created_at = conv.last_time", subquery, userID, userID).
-		Order("m.created_at DESC")
+				WHERE unread.conversation_id = c.id
+				AND unread.id > p.last_read_message_id
+				AND unread.sender_id <> p.user_id
+				AND unread.withheld = false
+				AND unread.deleted_at IS NULL
+			) AS unread_count,
+			(SELECT COUNT(*) FROM conversation_participants AS cp WHERE cp.conversation_id = c.id) AS participant_count
+		`).
+		Joins("JOIN conversations c ON c.id = p.conversation_id").
+		Joins(`LEFT JOIN LATERAL (
+			SELECT m.content, m.created_at FROM messages m
+			WHERE m.conversation_id = c.id AND m.deleted_at IS NULL
+			AND (m.withheld = false OR m.sender_id = p.user_id)
+			ORDER BY m.id DESC LIMIT 1
+		) AS lm ON true`).
+		Joins("LEFT JOIN conversation_participants op ON c.kind = ? AND op.conversation_id = c.id AND op.user_id <> p.user_id", KindDirect).
+		Joins("LEFT JOIN users u ON u.id = op.user_id").
+		Where("p.user_id = ? AND p.request = ?", userID, request).
+		// Une conversation privée sans message visible n'est pas listée ; un groupe l'est dès sa création
+		Where("c.kind = ? OR lm.created_at IS NOT NULL", KindGroup).
+		Order("COALESCE(lm.created_at, c.created_at) DESC")
 
 	if err := tx.Scan(&previews).Error; err != nil {
 		return nil, err
@@ -80,16 +191,16 @@ func (r *repository) GetConversationPreviews(userID uint) ([]*MessagePreviewRaw,
 	return previews, nil
 }
 
-// Mark all unread messages from sender to receiver as read
-func (r *repository) MarkMessagesAsRead(senderID, receiverID uint) error {
+// Mark the unread messages addressed to reader in a direct conversation as read, up to upToID ; returns how many were updated
+func (r *repository) MarkMessagesAsRead(conversationID, readerID, upToID uint) (int64, error) {
 	res := r.db.Model(&Message{}).
-		Where("sender_id = ? AND receiver_id = ? AND status = ?", senderID, receiverID, "UNREAD").
+		Where("conversation_id = ? AND receiver_id = ? AND status = ? AND id <= ? AND withheld = false", conversationID, readerID, "UNREAD", upToID).
 		Update("status", "READ")
 
 	if res.Error != nil {
-		return res.Error
+		return 0, res.Error
 	}
-	return nil
+	return res.RowsAffected, nil
 }
 
 // Utilitaire pour générer une clé de conversation unique entre 2 utilisateurs (ex: "2-5")
@@ -114,16 +225,22 @@ func (r *repository) UpdateMessage(msgID, userID uint, content string) error {
 	return nil
 }
 
-// Supprime un message (seul l'auteur peut supprimer)
-func (r *repository) DeleteMessage(msgID, userID uint) error {
-	res := r.db.Where("id = ? AND sender_id = ?", msgID, userID).Delete(&Message{})
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return errors.New("message not found or not owned by user")
-	}
-	return nil
+// Supprime un message (seul l'auteur peut supprimer) ; suppression logique (deleted_at).
+// inTx (optionnel) s'exécute dans la même transaction (pièces jointes).
+func (r *repository) DeleteMessage(msgID, userID uint, inTx func(tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND sender_id = ?", msgID, userID).Delete(&Message{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("message not found or not owned by user")
+		}
+		if inTx != nil {
+			return inTx(tx)
+		}
+		return nil
+	})
 }
 
 // GetMessageByID récupère un message par son ID
@@ -135,3 +252,31 @@ func (r *repository) GetMessageByID(msgID uint) (*Message, error) {
 	}
 	return &msg, nil
 }
+
+// GetLastMessageID retourne l'ID du dernier message de la conversation visible de viewer (0 si aucun)
+func (r *repository) GetLastMessageID(conversationID, viewerID uint) (uint, error) {
+	var id uint
+	err := r.db.Model(&Message{}).
+		Select("COALESCE(MAX(id), 0)").
+		Where("conversation_id = ?", conversationID).
+		Where("withheld = false OR sender_id = ?", viewerID).
+		Scan(&id).Error
+	return id, err
+}
+
+// GetContactIDs liste les correspondants de userID dans ses conversations privées acceptées des deux côtés,
+// hors blocage dans un sens ou dans l'autre (présence et indicateur de saisie)
+func (r *repository) GetContactIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Table("conversation_participants AS p").
+		Select("DISTINCT op.user_id").
+		Joins("JOIN conversations c ON c.id = p.conversation_id AND c.kind = ?", KindDirect).
+		Joins("JOIN conversation_participants op ON op.conversation_id = p.conversation_id AND op.user_id <> p.user_id").
+		Where("p.user_id = ? AND p.request = ? AND op.request = ?", userID, RequestNone, RequestNone).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = p.user_id AND b.blocked_id = op.user_id) OR (b.blocker_id = op.user_id AND b.blocked_id = p.user_id)
+		)`).
+		Scan(&ids).Error
+	return ids, err
+}
@@ -1,142 +1,437 @@
 package message
 
 import (
+	"backend/internal/realtime"
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// Service définit la logique métier pour les messages privés.
+// Service définit la logique métier de la messagerie : conversations privées et groupes.
 type Service interface {
 	Send(senderID uint, input CreateMessageInput) (*MessageDTO, error)
-	GetConversation(user1ID, user2ID uint) ([]*MessageDTO, error)
+	GetConversation(user1ID, user2ID uint, page PageQuery) (*ConversationPage, error)
+	GetMessages(conversationID, userID uint, page PageQuery) (*ConversationPage, error)
+	Search(userID uint, query SearchQuery) (*SearchResult, error)
 	GetPreviews(userID uint) ([]*MessagePreviewDTO, error)
+	GetRequests(userID uint) ([]*MessagePreviewDTO, error)
+	AcceptRequest(conversationID, userID uint) error
+	DeclineRequest(conversationID, userID uint) error
 	MarkRead(senderID, receiverID uint) error
+	MarkConversationRead(conversationID, userID, messageID uint) error
 	UpdateMessage(msgID, userID uint, input UpdateMessageInput) (*MessageDTO, error)
 	DeleteMessage(msgID, userID uint) error
+
+	// Groupes (conversation.go)
+	CreateGroup(ownerID uint, input CreateGroupInput) (*ConversationDTO, error)
+	GetConversationDetails(conversationID, userID uint) (*ConversationDTO, error)
+	RenameGroup(conversationID, userID uint, input UpdateGroupInput) (*ConversationDTO, error)
+	Invite(conversationID, inviterID, inviteeID uint) error
+	GetInvites(userID uint) ([]*InviteDTO, error)
+	AcceptInvite(inviteID, userID uint) (*ConversationDTO, error)
+	DeleteInvite(inviteID, userID uint) error
+	Leave(conversationID, userID uint) error
+	RemoveParticipant(conversationID, actorID, userID uint) error
+	SetRole(conversationID, actorID, userID uint, role ParticipantRole) error
+}
+
+// Notifier pousse les événements de la messagerie aux clients connectés (realtime.Hub)
+type Notifier interface {
+	Publish(ctx context.Context, to []uint, ev realtime.Event) error
+}
+
+// PostAccess vérifie l'accès à un post (post.Service) : un groupe d'étude rattaché à un cours
+// n'accueille que les utilisateurs qui peuvent le consulter
+type PostAccess interface {
+	CanViewPost(postID, viewerID uint) (bool, error)
 }
 
 type service struct {
-	repo Repository
-	db   *gorm.DB
+	repo        Repository
+	db          *gorm.DB
+	notifier    Notifier
+	posts       PostAccess
+	attachments *Attachments
+	privacy     Privacy
 }
 
 type UpdateMessageInput struct {
 	Content string `json:"content" binding:"required"`
 }
 
-// NewService initialise un nouveau service de messagerie.
-func NewService(repo Repository, db *gorm.DB) Service {
+// NewService initialise un nouveau service de messagerie ; notifier peut être nil (pas de temps réel),
+// posts aussi (groupes non rattachables à un cours), de même que attachments (pas de pièces jointes)
+// et privacy (ni blocage, ni réglage des messages privés, ni demandes de messages).
+func NewService(repo Repository, db *gorm.DB, notifier Notifier, posts PostAccess, attachments *Attachments, privacy Privacy) Service {
 	if repo == nil || db == nil {
 		panic("message repository and db cannot be nil")
 	}
-	return &service{repo: repo, db: db}
+	return &service{repo: repo, db: db, notifier: notifier, posts: posts, attachments: attachments, privacy: privacy}
 }
 
-// Send crée un message et renvoie son DTO enrichi.
+// Send crée un message, dans la conversation privée avec receiver_id ou dans la conversation indiquée,
+// et renvoie son DTO enrichi. Répondre dans une conversation privée accepte la demande de message.
 func (s *service) Send(senderID uint, input CreateMessageInput) (*MessageDTO, error) {
+	if (input.ReceiverID == 0) == (input.ConversationID == 0) {
+		return nil, ErrInvalidRecipient
+	}
 	if senderID == input.ReceiverID {
 		return nil, errors.New("you can't send a message to yourself")
 	}
+	if strings.TrimSpace(input.Content) == "" && len(input.Files) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	if len(input.Files) > MaxAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	var conv *Conversation
+	var withheld bool
+	var err error
+	if input.ReceiverID > 0 {
+		conv, withheld, err = s.direct(senderID, input.ReceiverID)
+	} else {
+		conv, _, err = s.participation(input.ConversationID, senderID)
+		if err == nil && conv.Kind == KindDirect {
+			conv, withheld, err = s.directByID(conv, senderID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	participants, err := s.repo.GetParticipants(conv.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	msg := &Message{
-		SenderID:   senderID,
-		ReceiverID: input.ReceiverID,
-		Content:    input.Content,
-		Status:     StatusUnread,
+		ConversationID: conv.ID,
+		SenderID:       senderID,
+		Content:        input.Content,
+		Status:         StatusUnread,
+		Withheld:       withheld,
+	}
+	if conv.Kind == KindDirect {
+		msg.ReceiverID = peerOf(userIDs(participants), senderID)
 	}
 
-	if err := s.repo.CreateMessage(msg); err != nil {
+	// Fichiers validés et stockés avant le message ; leurs médias sont créés dans sa transaction.
+	// En cas d'échec, les fichiers déjà stockés sont effacés s'ils ne sont pas partagés.
+	files, err := s.storeAttachments(input.Files)
+	if err != nil {
+		return nil, err
+	}
+	var attach func(tx *gorm.DB) error
+	if len(files) > 0 {
+		attach = func(tx *gorm.DB) error { return s.attachments.AttachTx(tx, msg, files) }
+	}
+	if err := s.repo.CreateMessage(msg, attach); err != nil {
+		if len(files) > 0 {
+			s.attachments.Abandon(files)
+		}
 		return nil, err
 	}
+	if len(files) > 0 {
+		s.attachments.Done(files)
+	}
+	// Répondre accepte la demande de message
+	for _, p := range participants {
+		if p.UserID == senderID && p.Request != RequestNone {
+			if err := s.repo.SetRequest(conv.ID, senderID, RequestNone); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	// Enrichir avec les infos utilisateur
 	senderInfo, err := s.getUserInfoByID(senderID)
 	if err != nil {
 		return nil, err
 	}
-	receiverInfo, err := s.getUserInfoByID(input.ReceiverID)
+	var receiverInfo *UserInfo
+	if msg.ReceiverID > 0 {
+		if receiverInfo, err = s.getUserInfoByID(msg.ReceiverID); err != nil {
+			return nil, err
+		}
+	}
+
+	dto := &MessageDTO{
+		ID:             msg.ID,
+		ConversationID: msg.ConversationID,
+		Content:        msg.Content,
+		Status:         msg.Status,
+		CreatedAt:      msg.CreatedAt,
+		Sender:         senderInfo,
+		Receiver:       receiverInfo,
+	}
+	// Pièces jointes en attente de l'antivirus : pas encore d'URL
+	if len(files) > 0 {
+		if err := s.withAttachments(0, dto); err != nil {
+			return nil, err
+		}
+	}
+	inbox, requests := audience(participants, msg)
+	s.notify(realtime.TypeMessageCreated, senderID, dto, inbox...)
+	s.notify(realtime.TypeMessageRequest, senderID, dto, requests...)
+	return dto, nil
+}
+
+// GetConversation récupère une page de la conversation privée entre deux utilisateurs, enrichie, en ordre chronologique.
+// Sans curseur, ce sont les derniers messages de la conversation.
+func (s *service) GetConversation(user1ID, user2ID uint, page PageQuery) (*ConversationPage, error) {
+	conv, err := s.repo.FindDirect(user1ID, user2ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &ConversationPage{Messages: []*MessageDTO{}}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	return s.page(conv.ID, user1ID, page)
+}
 
-	return &MessageDTO{
-		ID:        msg.ID,
-		Content:   msg.Content,
-		Status:    msg.Status,
-		CreatedAt: msg.CreatedAt,
-		Sender:    senderInfo,
-		Receiver:  receiverInfo,
-	}, nil
+// GetMessages récupère une page d'une conversation dont l'utilisateur est participant.
+func (s *service) GetMessages(conversationID, userID uint, page PageQuery) (*ConversationPage, error) {
+	if _, _, err := s.participation(conversationID, userID); err != nil {
+		return nil, err
+	}
+	return s.page(conversationID, userID, page)
 }
 
-// GetConversation récupère tous les messages entre deux utilisateurs, enrichis.
-func (s *service) GetConversation(user1ID, user2ID uint) ([]*MessageDTO, error) {
-	msgs, err := s.repo.GetConversation(user1ID, user2ID)
+// page charge une page de la conversation ; les URLs des pièces jointes sont signées pour viewerID
+func (s *service) page(conversationID, viewerID uint, page PageQuery) (*ConversationPage, error) {
+	page.Limit = pageSize(page.Limit, DefaultPageSize)
+	limit := page.Limit
+	page.Limit++ // Un message de plus pour savoir s'il reste une page
+	msgs, err := s.repo.GetMessages(conversationID, viewerID, page)
 	if err != nil {
 		return nil, err
 	}
+	hasMore := len(msgs) > limit
+	if hasMore {
+		if page.After > 0 {
+			msgs = msgs[:limit]
+		} else {
+			msgs = msgs[1:] // Le plus ancien, au-delà de la page
+		}
+	}
 
-	user1, err := s.getUserInfoByID(user1ID)
-	if err != nil {
+	users := s.userCache()
+	dtos := make([]*MessageDTO, 0, len(msgs))
+	for _, m := range msgs {
+		dtos = append(dtos, users.message(m.ID, m.ConversationID, m.SenderID, m.ReceiverID, m.Content, m.Status, m.CreatedAt))
+	}
+	if err := s.withAttachments(viewerID, dtos...); err != nil {
 		return nil, err
 	}
-	user2, err := s.getUserInfoByID(user2ID)
+	return &ConversationPage{Messages: dtos, HasMore: hasMore}, nil
+}
+
+// Search cherche dans les conversations de l'utilisateur (messages supprimés exclus), du plus récent au plus ancien.
+func (s *service) Search(userID uint, query SearchQuery) (*SearchResult, error) {
+	query.Limit = pageSize(query.Limit, 20)
+	limit := query.Limit
+	query.Limit++
+	raws, err := s.repo.SearchMessages(userID, query)
 	if err != nil {
 		return nil, err
 	}
+	result := &SearchResult{Hits: []*SearchHit{}, HasMore: len(raws) > limit}
+	if result.HasMore {
+		raws = raws[:limit]
+	}
 
-	var dtos []*MessageDTO
-	for _, m := range msgs {
-		dto := &MessageDTO{
-			ID:        m.ID,
-			Content:   m.Content,
-			Status:    m.Status,
-			CreatedAt: m.CreatedAt,
+	users := s.userCache()
+	for _, raw := range raws {
+		hit := &SearchHit{
+			Message: users.message(raw.ID, raw.ConversationID, raw.SenderID, raw.ReceiverID, raw.Content, raw.Status, raw.CreatedAt),
+			Snippet: raw.Snippet,
 		}
-
-		if m.SenderID == user1ID {
-			dto.Sender = user1
-			dto.Receiver = user2
-		} else {
-			dto.Sender = user2
-			dto.Receiver = user1
+		if raw.PrevID != nil {
+			hit.Previous = users.message(*raw.PrevID, raw.ConversationID, *raw.PrevSenderID, *raw.PrevReceiverID, *raw.PrevContent, raw.PrevStatus, *raw.PrevCreatedAt)
 		}
+		if raw.NextID != nil {
+			hit.Next = users.message(*raw.NextID, raw.ConversationID, *raw.NextSenderID, *raw.NextReceiverID, *raw.NextContent, raw.NextStatus, *raw.NextCreatedAt)
+		}
+		result.Hits = append(result.Hits, hit)
+	}
 
-		dtos = append(dtos, dto)
+	messages := make([]*MessageDTO, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		messages = append(messages, hit.Message)
 	}
-	return dtos, nil
+	if err := s.withAttachments(userID, messages...); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// GetPreviews retourne un aperçu des dernières conversations avec chaque utilisateur.
+// pageSize borne la taille de page demandée (valeur par défaut si absente)
+func pageSize(limit, defaultSize int) int {
+	if limit <= 0 {
+		return defaultSize
+	}
+	return min(limit, MaxPageSize)
+}
+
+// GetPreviews retourne un aperçu des conversations de l'utilisateur (privées et groupes), la plus récente en premier.
+// Les demandes de messages n'y figurent qu'une fois acceptées.
 func (s *service) GetPreviews(userID uint) ([]*MessagePreviewDTO, error) {
-	rawPreviews, err := s.repo.GetConversationPreviews(userID)
+	return s.previews(userID, RequestNone)
+}
+
+// previews : boîte de réception (RequestNone) ou demandes de messages en attente
+func (s *service) previews(userID uint, request RequestState) ([]*MessagePreviewDTO, error) {
+	rawPreviews, err := s.repo.GetConversationPreviews(userID, request)
 	if err != nil {
 		return nil, err
 	}
 
-	var previews []*MessagePreviewDTO
+	previews := make([]*MessagePreviewDTO, 0, len(rawPreviews))
 	for _, raw := range rawPreviews {
 		dto := &MessagePreviewDTO{
-			ConversationID: generateConversationKey(userID, raw.OtherUserID),
-			LastMessage:    raw.LastMessage,
-			Timestamp:      raw.CreatedAt,
-			UnreadCount:    raw.UnreadCount,
-			OtherUser: &UserInfo{
+			ConversationID:   raw.ConversationID,
+			Kind:             raw.Kind,
+			Title:            raw.Title,
+			LastMessage:      raw.LastMessage,
+			Timestamp:        raw.CreatedAt,
+			UnreadCount:      raw.UnreadCount,
+			ParticipantCount: raw.ParticipantCount,
+		}
+		if raw.OtherUserID > 0 {
+			dto.OtherUser = &UserInfo{
 				ID:        raw.OtherUserID,
 				Username:  raw.OtherUsername,
 				AvatarURL: raw.OtherAvatarURL,
-			},
+			}
 		}
 		previews = append(previews, dto)
 	}
 	return previews, nil
 }
 
-// MarkRead marque tous les messages de sender vers receiver comme lus.
+// MarkRead marque comme lus les messages de sender vers receiver (conversation privée) et envoie l'accusé de lecture.
 func (s *service) MarkRead(senderID, receiverID uint) error {
-	return s.repo.MarkMessagesAsRead(senderID, receiverID)
+	conv, err := s.repo.FindDirect(senderID, receiverID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lastID, err := s.repo.GetLastMessageID(conv.ID, receiverID)
+	if err != nil {
+		return err
+	}
+	return s.markRead(conv, receiverID, lastID)
+}
+
+// MarkConversationRead avance le curseur de lecture jusqu'à messageID (dernier message si 0).
+func (s *service) MarkConversationRead(conversationID, userID, messageID uint) error {
+	conv, _, err := s.participation(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	lastID, err := s.repo.GetLastMessageID(conv.ID, userID)
+	if err != nil {
+		return err
+	}
+	if messageID == 0 || messageID > lastID {
+		messageID = lastID
+	}
+	return s.markRead(conv, userID, messageID)
+}
+
+// markRead avance le curseur du lecteur ; dans une conversation privée, le statut des messages reçus suit.
+// L'accusé de lecture n'est envoyé que si quelque chose a changé, et jamais pour une demande de message
+// non acceptée (l'expéditeur ne doit pas savoir qu'elle a été vue).
+func (s *service) markRead(conv *Conversation, readerID, upToID uint) error {
+	if upToID == 0 {
+		return nil
+	}
+	reader, err := s.repo.GetParticipant(conv.ID, readerID)
+	if err != nil {
+		return err
+	}
+	if reader.Request != RequestNone {
+		return nil
+	}
+	advanced, err := s.repo.AdvanceReadCursor(conv.ID, readerID, upToID)
+	if err != nil {
+		return err
+	}
+	if conv.Kind == KindDirect {
+		updated, err := s.repo.MarkMessagesAsRead(conv.ID, readerID, upToID)
+		if err != nil {
+			return err
+		}
+		advanced = advanced || updated > 0
+	}
+	if !advanced {
+		return nil
+	}
+
+	participants, err := s.participantIDs(conv.ID)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"conversation_id":      conv.ID,
+		"reader_id":            readerID,
+		"last_read_message_id": upToID,
+		"read_at":              time.Now(),
+	}
+	if conv.Kind == KindDirect {
+		data["sender_id"] = peerOf(participants, readerID)
+	}
+	s.notify(realtime.TypeMessageRead, readerID, data, participants...)
+	return nil
+}
+
+// notify pousse un événement aux participants d'une conversation ; le message est déjà enregistré,
+// un échec de diffusion est seulement journalisé (les clients se resynchronisent via l'API REST).
+func (s *service) notify(eventType string, from uint, data interface{}, to ...uint) {
+	if s.notifier == nil || len(to) == 0 {
+		return
+	}
+	ev, err := realtime.NewEvent(eventType, from, data)
+	if err == nil {
+		err = s.notifier.Publish(context.Background(), to, ev)
+	}
+	if err != nil {
+		log.Printf("⚠️ Événement %s non diffusé : %v", eventType, err)
+	}
+}
+
+// participantIDs liste les participants d'une conversation (destinataires de ses événements).
+func (s *service) participantIDs(conversationID uint) ([]uint, error) {
+	participants, err := s.repo.GetParticipants(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return userIDs(participants), nil
+}
+
+func userIDs(participants []Participant) []uint {
+	ids := make([]uint, 0, len(participants))
+	for _, p := range participants {
+		ids = append(ids, p.UserID)
+	}
+	return ids
+}
+
+// peerOf retourne l'autre participant d'une conversation privée.
+func peerOf(participants []uint, userID uint) uint {
+	for _, id := range participants {
+		if id != userID {
+			return id
+		}
+	}
+	return 0
 }
 
 // getUserInfoByID récupère les infos publiques (username, avatar) d'un utilisateur.
@@ -163,7 +458,42 @@ func (s *service) getUserInfoByID(userID uint) (*UserInfo, error) {
 	}, nil
 }
 
-// Utilitaire : génère une clé unique pour une conversation.
+// userInfos : infos utilisateur chargées une seule fois par requête (listes de messages, participants)
+type userInfos struct {
+	s     *service
+	users map[uint]*UserInfo
+}
+
+func (s *service) userCache() *userInfos {
+	return &userInfos{s: s, users: map[uint]*UserInfo{}}
+}
+
+// get retourne les infos d'un utilisateur (nil pour 0 ou un compte supprimé)
+func (u *userInfos) get(id uint) *UserInfo {
+	if id == 0 {
+		return nil
+	}
+	if info, ok := u.users[id]; ok {
+		return info
+	}
+	info, _ := u.s.getUserInfoByID(id)
+	u.users[id] = info
+	return info
+}
+
+func (u *userInfos) message(id, conversationID, senderID, receiverID uint, content string, status MessageStatus, createdAt time.Time) *MessageDTO {
+	return &MessageDTO{
+		ID:             id,
+		ConversationID: conversationID,
+		Content:        content,
+		Status:         status,
+		CreatedAt:      createdAt,
+		Sender:         u.get(senderID),
+		Receiver:       u.get(receiverID),
+	}
+}
+
+// Utilitaire : génère une clé unique pour une conversation privée.
 func generateConversationKey(user1ID, user2ID uint) string {
 	if user1ID < user2ID {
 		return fmt.Sprintf("%d-%d", user1ID, user2ID)
@@ -185,20 +515,61 @@ func (s *service) UpdateMessage(msgID, userID uint, input UpdateMessageInput) (*
 		return nil, err
 	}
 
-	senderInfo, _ := s.getUserInfoByID(updated.SenderID)
-	receiverInfo, _ := s.getUserInfoByID(updated.ReceiverID)
-
-	return &MessageDTO{
-		ID:        updated.ID,
-		Content:   updated.Content,
-		Status:    updated.Status,
-		CreatedAt: updated.CreatedAt,
-		Sender:    senderInfo,
-		Receiver:  receiverInfo,
-	}, nil
+	users := s.userCache()
+	dto := users.message(updated.ID, updated.ConversationID, updated.SenderID, updated.ReceiverID, updated.Content, updated.Status, updated.CreatedAt)
+	// Diffusé à ceux qui voient le message : pièces jointes sans URL (signées par lecteur)
+	if err := s.withAttachments(0, dto); err != nil {
+		return nil, err
+	}
+	s.notifyMessage(updated, realtime.TypeMessageUpdated, dto)
+	return dto, nil
 }
 
-// DeleteMessage supprime un message si l'utilisateur est l'expéditeur.
+// DeleteMessage supprime un message si l'utilisateur est l'expéditeur, avec ses pièces jointes
+// (fichiers effacés avec leur dernière référence).
 func (s *service) DeleteMessage(msgID, userID uint) error {
-	return s.repo.DeleteMessage(msgID, userID)
+	msg, err := s.repo.GetMessageByID(msgID)
+	if err != nil || msg.SenderID != userID {
+		return errors.New("message not found or not owned by user")
+	}
+	var release func(tx *gorm.DB) error
+	if s.attachments != nil {
+		release = func(tx *gorm.DB) error { return s.attachments.ReleaseTx(tx, msgID) }
+	}
+	if err := s.repo.DeleteMessage(msgID, userID, release); err != nil {
+		return err
+	}
+	s.notifyMessage(msg, realtime.TypeMessageDeleted, map[string]interface{}{
+		"id":              msgID,
+		"conversation_id": msg.ConversationID,
+	})
+	return nil
+}
+
+// notifyMessage pousse un événement sur un message à ceux qui le voient (demandes en attente comprises,
+// auteur seul pour un message retenu).
+func (s *service) notifyMessage(msg *Message, eventType string, data interface{}) {
+	if s.notifier == nil {
+		return
+	}
+	participants, err := s.repo.GetParticipants(msg.ConversationID)
+	if err != nil {
+		log.Printf("⚠️ Événement %s non diffusé : %v", eventType, err)
+		return
+	}
+	inbox, requests := audience(participants, msg)
+	s.notify(eventType, msg.SenderID, data, append(inbox, requests...)...)
+}
+
+// notifyParticipants pousse un événement à tous les participants de la conversation.
+func (s *service) notifyParticipants(conversationID uint, eventType string, from uint, data interface{}) {
+	if s.notifier == nil {
+		return
+	}
+	participants, err := s.participantIDs(conversationID)
+	if err != nil {
+		log.Printf("⚠️ Événement %s non diffusé : %v", eventType, err)
+		return
+	}
+	s.notify(eventType, from, data, participants...)
 }
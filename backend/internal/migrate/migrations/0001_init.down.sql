@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS post_accesses;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS auth_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,104 @@
+-- Schéma initial, tel que créé auparavant par AutoMigrate.
+-- IF NOT EXISTS permet d'adopter une base existante sans la recréer.
+
+CREATE TABLE IF NOT EXISTS users (
+    id              bigserial PRIMARY KEY,
+    username        text,
+    full_name       text,
+    name            text,
+    first_name      text,
+    bio             text,
+    avatar_url      text,
+    email           text,
+    password_hash   text,
+    role            text,
+    created_at      timestamptz,
+    monthly_price   double precision DEFAULT 0,
+    stripe_price_id varchar(64)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_first_name ON users (first_name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS auth_tokens (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint,
+    token      text,
+    expires_at timestamptz,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_tokens_token ON auth_tokens (token);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id            bigserial PRIMARY KEY,
+    creator_id    bigint NOT NULL,
+    content       text,
+    visibility    varchar(10) DEFAULT 'public',
+    is_paid_only  boolean DEFAULT false,
+    document_type varchar(50),
+    created_at    timestamptz,
+    updated_at    timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_posts_creator_id ON posts (creator_id);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id         bigserial PRIMARY KEY,
+    post_id    bigint NOT NULL,
+    user_id    bigint NOT NULL,
+    text       text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id);
+
+CREATE TABLE IF NOT EXISTS likes (
+    id         bigserial PRIMARY KEY,
+    post_id    bigint NOT NULL,
+    user_id    bigint NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_likes_post_id ON likes (post_id);
+CREATE INDEX IF NOT EXISTS idx_likes_user_id ON likes (user_id);
+
+CREATE TABLE IF NOT EXISTS media (
+    id            bigserial PRIMARY KEY,
+    post_id       bigint,
+    media_url     text,
+    media_type    text,
+    thumbnail_url text,
+    metadata      text,
+    file_size     bigint DEFAULT 0,
+    file_name     text
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                     bigserial PRIMARY KEY,
+    subscriber_id          bigint,
+    creator_id             bigint,
+    start_date             timestamptz,
+    end_date               timestamptz,
+    is_active              boolean,
+    type                   text,
+    stripe_subscription_id text
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id          bigserial PRIMARY KEY,
+    sender_id   bigint NOT NULL,
+    receiver_id bigint NOT NULL,
+    content     text NOT NULL,
+    status      text DEFAULT 'UNREAD',
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages (deleted_at);
+
+CREATE TABLE IF NOT EXISTS post_accesses (
+    id         bigserial PRIMARY KEY,
+    post_id    bigint,
+    user_id    bigint,
+    comment_id bigint
+);
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS user_identities;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_last_counter,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS email_verified_at,
+    DROP COLUMN IF EXISTS email_verified;
+
+DROP INDEX IF EXISTS idx_auth_tokens_session_id;
+DROP INDEX IF EXISTS idx_auth_tokens_purpose;
+DROP INDEX IF EXISTS idx_auth_tokens_user_id;
+ALTER TABLE auth_tokens
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS payload,
+    DROP COLUMN IF EXISTS session_id,
+    DROP COLUMN IF EXISTS purpose;
@@ -0,0 +1,37 @@
+-- Sessions (refresh tokens rotatifs), tokens à usage unique, vérification d'email,
+-- identités OAuth multiples et double authentification TOTP.
+
+ALTER TABLE auth_tokens
+    ADD COLUMN IF NOT EXISTS purpose    varchar(32) DEFAULT 'refresh',
+    ADD COLUMN IF NOT EXISTS session_id varchar(64),
+    ADD COLUMN IF NOT EXISTS payload    text,
+    ADD COLUMN IF NOT EXISTS revoked_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_id ON auth_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_purpose ON auth_tokens (purpose);
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_session_id ON auth_tokens (session_id);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified    boolean,
+    ADD COLUMN IF NOT EXISTS email_verified_at timestamptz,
+    ADD COLUMN IF NOT EXISTS totp_secret       varchar(64),
+    ADD COLUMN IF NOT EXISTS totp_enabled      boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS totp_last_counter bigint DEFAULT 0;
+
+-- Les comptes antérieurs à la vérification d'email sont considérés comme vérifiés (sinon bloqués
+-- par RequireVerifiedEmail dès le déploiement) ; seuls les nouveaux comptes doivent confirmer leur adresse
+UPDATE users SET email_verified = true, email_verified_at = COALESCE(email_verified_at, created_at)
+WHERE email_verified IS NULL;
+ALTER TABLE users
+    ALTER COLUMN email_verified SET DEFAULT false,
+    ALTER COLUMN email_verified SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint NOT NULL,
+    provider   varchar(64) NOT NULL,
+    subject    varchar(255) NOT NULL,
+    email      text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identity_provider_subject ON user_identities (provider, subject);
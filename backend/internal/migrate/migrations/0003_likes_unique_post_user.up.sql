@@ -0,0 +1,10 @@
+-- Un utilisateur ne peut liker un post qu'une fois : on supprime les doublons
+-- (en gardant le like le plus ancien) avant d'ajouter la contrainte.
+
+DELETE FROM likes l
+USING likes d
+WHERE l.post_id = d.post_id
+  AND l.user_id = d.user_id
+  AND l.id > d.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_likes_post_user ON likes (post_id, user_id);
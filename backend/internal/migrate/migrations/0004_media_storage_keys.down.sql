@@ -0,0 +1,5 @@
+UPDATE media SET media_url = 'uploads/' || media_url
+WHERE media_url <> '' AND media_url !~ '^(uploads/|https?://)';
+
+UPDATE media SET thumbnail_url = 'uploads/' || thumbnail_url
+WHERE thumbnail_url <> '' AND thumbnail_url !~ '^(uploads/|https?://)';
@@ -0,0 +1,8 @@
+-- Les médias référencent désormais une clé de stockage (ex: images/user_1_...jpg)
+-- et non plus un chemin disque : on retire le préfixe uploads/ des lignes existantes.
+
+UPDATE media SET media_url = regexp_replace(media_url, '^(\./)?uploads/', '')
+WHERE media_url ~ '^(\./)?uploads/';
+
+UPDATE media SET thumbnail_url = regexp_replace(thumbnail_url, '^(\./)?uploads/', '')
+WHERE thumbnail_url ~ '^(\./)?uploads/';
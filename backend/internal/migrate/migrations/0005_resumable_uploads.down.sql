@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS uploads;
+
+DROP INDEX IF EXISTS idx_media_owner_id;
+ALTER TABLE media DROP COLUMN IF EXISTS owner_id;
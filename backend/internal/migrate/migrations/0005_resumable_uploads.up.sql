@@ -0,0 +1,34 @@
+-- Uploads fragmentés : les fragments sont stockés comme objets temporaires (staging/{upload}/...)
+-- et assemblés à la complétion en un média rattachable à un post.
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS owner_id bigint;
+UPDATE media m SET owner_id = p.creator_id
+FROM posts p
+WHERE m.post_id = p.id AND m.owner_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_media_owner_id ON media (owner_id);
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id           uuid PRIMARY KEY,
+    user_id      bigint NOT NULL,
+    file_name    text NOT NULL,
+    content_type text,
+    media_type   text NOT NULL,
+    size         bigint NOT NULL,
+    received     bigint NOT NULL DEFAULT 0,
+    checksum     text,
+    status       text NOT NULL DEFAULT 'pending',
+    media_id     bigint,
+    expires_at   timestamptz NOT NULL,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_uploads_user_id ON uploads (user_id);
+CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads (expires_at);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id   uuid NOT NULL REFERENCES uploads (id) ON DELETE CASCADE,
+    position    bigint NOT NULL,
+    size        bigint NOT NULL,
+    storage_key text NOT NULL,
+    PRIMARY KEY (upload_id, position)
+);
@@ -0,0 +1,24 @@
+-- File de jobs (traitement des médias…) : les workers réservent les jobs avec FOR UPDATE SKIP LOCKED.
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id           bigserial PRIMARY KEY,
+    kind         text NOT NULL,
+    payload      text NOT NULL,
+    owner_id     bigint,
+    ref          text,
+    status       text NOT NULL DEFAULT 'pending',
+    attempts     integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 5,
+    run_at       timestamptz NOT NULL DEFAULT now(),
+    locked_at    timestamptz,
+    locked_by    text,
+    last_error   text,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    finished_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_ready ON jobs (run_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_kind ON jobs (kind);
+CREATE INDEX IF NOT EXISTS idx_jobs_owner_id ON jobs (owner_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_ref ON jobs (ref);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (status);
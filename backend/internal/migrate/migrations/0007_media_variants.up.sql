@@ -0,0 +1,2 @@
+-- Variantes redimensionnées des images (JSON : nom, format, clé, dimensions, taille)
+ALTER TABLE media ADD COLUMN IF NOT EXISTS variants text;
@@ -0,0 +1,2 @@
+-- État du traitement en arrière-plan des médias (pending, processing, ready, failed)
+ALTER TABLE media ADD COLUMN IF NOT EXISTS processing_status text NOT NULL DEFAULT 'ready';
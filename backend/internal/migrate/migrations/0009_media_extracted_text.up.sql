@@ -0,0 +1,2 @@
+-- Texte extrait des documents (PDF, DOCX, PPTX, Markdown) pour la recherche et la modération
+ALTER TABLE media ADD COLUMN IF NOT EXISTS extracted_text text;
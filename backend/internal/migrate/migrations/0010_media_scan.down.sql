@@ -0,0 +1,3 @@
+ALTER TABLE media DROP COLUMN IF EXISTS scanned_at;
+ALTER TABLE media DROP COLUMN IF EXISTS scan_result;
+ALTER TABLE media DROP COLUMN IF EXISTS scan_status;
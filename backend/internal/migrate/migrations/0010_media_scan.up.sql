@@ -0,0 +1,4 @@
+-- Verdict de l'analyse antivirus des médias (pending, clean, infected, error, skipped ; vide pour les médias existants)
+ALTER TABLE media ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS scan_result text NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS scanned_at timestamptz;
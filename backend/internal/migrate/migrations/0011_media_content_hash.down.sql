@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_media_media_url;
+DROP INDEX IF EXISTS idx_media_content_hash;
+ALTER TABLE media DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,5 @@
+-- Déduplication par contenu : SHA-256 des fichiers, clés de stockage partagées entre médias
+ALTER TABLE media ADD COLUMN IF NOT EXISTS content_hash text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_media_content_hash ON media (content_hash);
+-- Compteur de références d'un fichier (suppression de la dernière référence)
+CREATE INDEX IF NOT EXISTS idx_media_media_url ON media (media_url);
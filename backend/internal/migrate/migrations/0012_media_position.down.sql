@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_media_post_position;
+ALTER TABLE media DROP COLUMN IF EXISTS position;
@@ -0,0 +1,3 @@
+-- Ordre d'affichage des médias dans un post (modifiable à l'édition du post)
+ALTER TABLE media ADD COLUMN IF NOT EXISTS position integer NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_media_post_position ON media (post_id, position);
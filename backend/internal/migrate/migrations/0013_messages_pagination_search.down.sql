@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_content_fts;
+DROP INDEX IF EXISTS idx_messages_sender_receiver_id;
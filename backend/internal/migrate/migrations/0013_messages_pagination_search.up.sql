@@ -0,0 +1,4 @@
+-- Historique des conversations paginé par curseur (id) : messages d'une paire d'utilisateurs dans l'ordre
+CREATE INDEX IF NOT EXISTS idx_messages_sender_receiver_id ON messages (sender_id, receiver_id, id);
+-- Recherche plein texte (configuration 'simple', identique aux requêtes) hors messages supprimés
+CREATE INDEX IF NOT EXISTS idx_messages_content_fts ON messages USING gin (to_tsvector('simple', content)) WHERE deleted_at IS NULL;
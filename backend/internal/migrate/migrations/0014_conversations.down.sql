@@ -0,0 +1,8 @@
+CREATE INDEX IF NOT EXISTS idx_messages_sender_receiver_id ON messages (sender_id, receiver_id, id);
+-- Les messages de groupe n'ont pas de destinataire : ils disparaissent avec les groupes
+DELETE FROM messages WHERE receiver_id = 0;
+DROP INDEX IF EXISTS idx_messages_conversation_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS conversation_id;
+DROP TABLE IF EXISTS conversation_invites;
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS conversations;
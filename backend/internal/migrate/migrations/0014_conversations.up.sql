@@ -0,0 +1,72 @@
+-- Conversations de premier ordre : privées (une par paire d'utilisateurs) ou groupes d'étude
+CREATE TABLE IF NOT EXISTS conversations (
+    id         bigserial PRIMARY KEY,
+    kind       varchar(10) NOT NULL,
+    title      varchar(100) NOT NULL DEFAULT '',
+    post_id    bigint,
+    direct_key text,
+    created_by bigint NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_direct_key ON conversations (direct_key);
+CREATE INDEX IF NOT EXISTS idx_conversations_post_id ON conversations (post_id);
+
+-- Participants, rôles (owner, admin, member) et curseurs de lecture
+CREATE TABLE IF NOT EXISTS conversation_participants (
+    conversation_id      bigint NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    user_id              bigint NOT NULL,
+    role                 varchar(10) NOT NULL,
+    last_read_message_id bigint NOT NULL DEFAULT 0,
+    joined_at            timestamptz,
+    PRIMARY KEY (conversation_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_conversation_participants_user_id ON conversation_participants (user_id);
+
+-- Invitations en attente
+CREATE TABLE IF NOT EXISTS conversation_invites (
+    id              bigserial PRIMARY KEY,
+    conversation_id bigint NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    invitee_id      bigint NOT NULL,
+    inviter_id      bigint NOT NULL,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_invites_invitee ON conversation_invites (conversation_id, invitee_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_invites_invitee_id ON conversation_invites (invitee_id);
+
+-- Reprise des messages privés existants : une conversation à deux par paire (clé "a-b", a < b)
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS conversation_id bigint;
+
+INSERT INTO conversations (kind, title, direct_key, created_by, created_at, updated_at)
+SELECT 'direct', '',
+       LEAST(sender_id, receiver_id)::text || '-' || GREATEST(sender_id, receiver_id)::text,
+       (array_agg(sender_id ORDER BY id))[1],
+       MIN(created_at), now()
+FROM messages
+WHERE conversation_id IS NULL
+GROUP BY LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id)
+ON CONFLICT (direct_key) DO NOTHING;
+
+UPDATE messages m SET conversation_id = c.id
+FROM conversations c
+WHERE m.conversation_id IS NULL
+  AND c.direct_key = LEAST(m.sender_id, m.receiver_id)::text || '-' || GREATEST(m.sender_id, m.receiver_id)::text;
+
+-- Curseur de lecture : juste avant le premier message encore non lu, sinon le dernier message
+INSERT INTO conversation_participants (conversation_id, user_id, role, last_read_message_id, joined_at)
+SELECT c.id, p.user_id, 'member',
+       COALESCE(
+           (SELECT MIN(m.id) - 1 FROM messages m
+            WHERE m.conversation_id = c.id AND m.receiver_id = p.user_id AND m.status = 'UNREAD' AND m.deleted_at IS NULL),
+           (SELECT MAX(m.id) FROM messages m WHERE m.conversation_id = c.id),
+           0),
+       c.created_at
+FROM conversations c
+CROSS JOIN LATERAL (VALUES (split_part(c.direct_key, '-', 1)::bigint), (split_part(c.direct_key, '-', 2)::bigint)) AS p(user_id)
+WHERE c.kind = 'direct'
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE messages ALTER COLUMN conversation_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id, id);
+-- L'historique est désormais lu par conversation
+DROP INDEX IF EXISTS idx_messages_sender_receiver_id;
@@ -0,0 +1,4 @@
+-- Les pièces jointes deviendraient des uploads orphelins : supprimées (fichiers repris par le nettoyage du stockage)
+DELETE FROM media WHERE message_id <> 0;
+DROP INDEX IF EXISTS idx_media_message_id;
+ALTER TABLE media DROP COLUMN IF EXISTS message_id;
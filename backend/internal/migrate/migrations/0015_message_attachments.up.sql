@@ -0,0 +1,3 @@
+-- Pièces jointes des messages privés : médias rattachés à un message (0 pour les médias des posts et les uploads)
+ALTER TABLE media ADD COLUMN IF NOT EXISTS message_id bigint NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_media_message_id ON media (message_id, position) WHERE message_id <> 0;
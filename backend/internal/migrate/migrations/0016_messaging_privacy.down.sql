@@ -0,0 +1,9 @@
+-- Les contenus retenus redeviendraient visibles : supprimés
+DELETE FROM comments WHERE withheld;
+ALTER TABLE comments DROP COLUMN IF EXISTS withheld;
+DELETE FROM media WHERE message_id IN (SELECT id FROM messages WHERE withheld);
+DELETE FROM messages WHERE withheld;
+ALTER TABLE messages DROP COLUMN IF EXISTS withheld;
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS request;
+DROP TABLE IF EXISTS user_blocks;
+ALTER TABLE users DROP COLUMN IF EXISTS dm_policy;
@@ -0,0 +1,18 @@
+-- Qui peut ouvrir une conversation privée : everyone, followers (abonnés gratuits ou payants) ou subscribers (abonnés payants)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dm_policy varchar(16) NOT NULL DEFAULT 'everyone';
+
+-- Liste de blocage : messages privés, commentaires et profil
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id bigint NOT NULL,
+    blocked_id bigint NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+-- Demandes de messages : premier contact d'un inconnu en attente (pending) ou refusé (declined) ; '' : accepté
+ALTER TABLE conversation_participants ADD COLUMN IF NOT EXISTS request varchar(10) NOT NULL DEFAULT '';
+
+-- Messages et commentaires d'un utilisateur bloqué : enregistrés mais visibles de leur seul auteur
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS withheld boolean NOT NULL DEFAULT false;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS withheld boolean NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Les créateurs promus par la migration ne sont pas distinguables de ceux nommés par un admin : rien à annuler
+SELECT 1;
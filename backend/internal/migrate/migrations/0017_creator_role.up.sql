@@ -0,0 +1,5 @@
+-- La publication est réservée au rôle "creator" : les comptes qui publient déjà
+-- ou ont fixé un prix d'abonnement le deviennent.
+UPDATE users SET role = 'creator'
+WHERE (role IS NULL OR role NOT IN ('creator', 'moderator', 'admin'))
+  AND (monthly_price > 0 OR EXISTS (SELECT 1 FROM posts WHERE posts.creator_id = users.id));
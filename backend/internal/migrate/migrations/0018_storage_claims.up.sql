@@ -0,0 +1,10 @@
+-- Réservations des fichiers partagés (déduplication par contenu) entre leur dépôt dans le stockage et la création
+-- du média qui les référence : media.release et le nettoyage des orphelins les comptent comme des références.
+
+CREATE TABLE IF NOT EXISTS storage_claims (
+    id          bigserial PRIMARY KEY,
+    storage_key text NOT NULL,
+    expires_at  timestamptz NOT NULL,
+    created_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_storage_claims_storage_key ON storage_claims (storage_key);
@@ -1,8 +1,8 @@
 package payment
 
 import (
-	"fmt"
-	"os"
+	"backend/internal/config"
+	"log"
 
 	"github.com/stripe/stripe-go/v78"
 	"github.com/stripe/stripe-go/v78/checkout/session"
@@ -10,9 +10,14 @@ import (
 	"github.com/stripe/stripe-go/v78/product"
 )
 
-func InitStripe() {
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-	fmt.Println("Stripe key loaded:", stripe.Key)
+// InitStripe configure la clé API Stripe (la clé n'est jamais journalisée)
+func InitStripe(cfg config.StripeConfig) {
+	stripe.Key = cfg.SecretKey
+	if cfg.SecretKey == "" {
+		log.Printf("⚠️ STRIPE_SECRET_KEY absente : les paiements sont désactivés")
+		return
+	}
+	log.Printf("💳 Stripe configuré")
 }
 
 // CreateStripeCheckoutSession crée une session de paiement Stripe et retourne l'URL
@@ -1,13 +1,11 @@
 package post
 
 import (
-	"backend/internal/db"
-	"backend/internal/models"
 	"log"
 )
 
 // CheckPostAccess vérifie si un utilisateur a accès à un post payant
-func CheckPostAccess(userID uint, creatorID uint, isPaidOnly bool) bool {
+func CheckPostAccess(repo Repository, userID uint, creatorID uint, isPaidOnly bool) bool {
 	// Si le post n'est pas payant, accès libre
 	if !isPaidOnly {
 		log.Printf("[ACCESS] userID=%d, creatorID=%d, isPaidOnly=%v => accès libre", userID, creatorID, isPaidOnly)
@@ -21,10 +19,7 @@ func CheckPostAccess(userID uint, creatorID uint, isPaidOnly bool) bool {
 	}
 
 	// Nouvelle logique : si l'utilisateur a au moins une subscription active (peu importe le type/status)
-	var count int64
-	err := db.GormDB.Model(&models.Subscription{}).
-		Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", userID, creatorID, true).
-		Count(&count).Error
+	count, err := repo.CountActiveSubscriptions(userID, creatorID)
 	if err != nil {
 		log.Printf("[ACCESS][ERROR] Erreur DB lors du comptage des subscriptions: %v", err)
 	}
@@ -34,11 +29,11 @@ func CheckPostAccess(userID uint, creatorID uint, isPaidOnly bool) bool {
 }
 
 // FilterPostsWithAccess filtre une liste de posts selon l'accès de l'utilisateur
-func FilterPostsWithAccess(posts []*PostDTO, userID uint) []*PostDTO {
+func FilterPostsWithAccess(repo Repository, posts []*PostDTO, userID uint) []*PostDTO {
 	var result []*PostDTO
 
 	for _, post := range posts {
-		hasAccess := CheckPostAccess(userID, post.CreatorID, post.IsPaidOnly)
+		hasAccess := CheckPostAccess(repo, userID, post.CreatorID, post.IsPaidOnly)
 
 		postDTO := &PostDTO{
 			ID:           post.ID,
@@ -49,12 +44,12 @@ func FilterPostsWithAccess(posts []*PostDTO, userID uint) []*PostDTO {
 			CreatedAt:    post.CreatedAt,
 			UpdatedAt:    post.UpdatedAt,
 			HasAccess:    hasAccess,
-			MediaURLs:    post.MediaURLs,
 		}
 
 		if hasAccess {
 			// L'utilisateur a accès, on montre le contenu complet
 			postDTO.Content = post.Content
+			postDTO.Media = post.Media
 		} else {
 			// L'utilisateur n'a pas accès, on montre un message
 			postDTO.Content = "🔒 Ce contenu est réservé aux abonnés payants. Abonnez-vous pour y accéder !"
@@ -67,11 +62,11 @@ func FilterPostsWithAccess(posts []*PostDTO, userID uint) []*PostDTO {
 }
 
 // FilterPostsFromModelsWithAccess filtre une liste de posts modèles selon l'accès de l'utilisateur
-func FilterPostsFromModelsWithAccess(posts []*Post, userID uint) []*PostDTO {
+func FilterPostsFromModelsWithAccess(repo Repository, posts []*Post, userID uint) []*PostDTO {
 	var result []*PostDTO
 
 	for _, post := range posts {
-		hasAccess := CheckPostAccess(userID, post.CreatorID, post.IsPaidOnly)
+		hasAccess := CheckPostAccess(repo, userID, post.CreatorID, post.IsPaidOnly)
 
 		postDTO := &PostDTO{
 			ID:           post.ID,
@@ -0,0 +1,99 @@
+package post
+
+import (
+	"backend/internal/media"
+	"backend/internal/message"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageAttachments implémente message.AttachmentMedia : les pièces jointes, validées et stockées par
+// message.Attachments, deviennent des médias rattachés au message (analyse antivirus, miniatures, URLs signées,
+// effacement des fichiers avec leur dernière référence)
+type MessageAttachments struct {
+	repo   media.Repository
+	signer *MediaURLSigner
+}
+
+// NewMessageAttachments instancie le gestionnaire des médias des pièces jointes
+func NewMessageAttachments(repo media.Repository, signer *MediaURLSigner) *MessageAttachments {
+	if repo == nil || signer == nil {
+		panic("media repository and media URL signer cannot be nil")
+	}
+	return &MessageAttachments{repo: repo, signer: signer}
+}
+
+// AttachTx crée les médias des fichiers, rattachés au message, et planifie leur traitement
+func (a *MessageAttachments) AttachTx(tx *gorm.DB, msg *message.Message, files []message.AttachmentFile) error {
+	medias := make([]media.Media, len(files))
+	for i, f := range files {
+		medias[i] = media.Media{
+			MediaURL:         f.Key,
+			MediaType:        f.MediaType,
+			FileSize:         f.Size,
+			FileName:         f.FileName,
+			ContentHash:      f.Hash,
+			OwnerID:          msg.SenderID,
+			MessageID:        msg.ID,
+			Position:         i,
+			ProcessingStatus: media.ProcessingPending,
+			ScanStatus:       media.ScanPending,
+		}
+	}
+	if err := tx.Create(&medias).Error; err != nil {
+		return err
+	}
+	ids := make([]uint, len(medias))
+	for i := range medias {
+		ids[i] = medias[i].ID
+	}
+	return enqueueProcessTx(tx, msg.SenderID, ids...)
+}
+
+// List retourne les pièces jointes des messages ; seuls les fichiers validés par l'antivirus ont une URL
+func (a *MessageAttachments) List(messageIDs []uint, viewerID uint) (map[uint][]*message.AttachmentDTO, error) {
+	medias, err := a.repo.FindByMessageIDs(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	byMessage := make(map[uint][]*message.AttachmentDTO)
+	for i := range medias {
+		m := &medias[i]
+		dto := &message.AttachmentDTO{
+			ID:       m.ID,
+			Type:     m.MediaType,
+			FileName: m.FileName,
+			FileSize: m.FileSize,
+			Status:   m.ProcessingStatus,
+			Scan:     m.ScanStatus,
+		}
+		if viewerID > 0 && m.Servable() {
+			dto.URL = a.signer.URL(m.ID, viewerID)
+			if v := attachmentPreview(m); v != nil {
+				dto.PreviewURL = a.signer.VariantURL(m.ID, viewerID, v.Name, v.Format)
+			}
+		}
+		byMessage[m.MessageID] = append(byMessage[m.MessageID], dto)
+	}
+	return byMessage, nil
+}
+
+// attachmentPreview : miniature d'une image, aperçu de la première page d'un document
+func attachmentPreview(m *media.Media) *media.Variant {
+	if v := m.Variant(media.VariantThumbnail, "jpeg"); v != nil {
+		return v
+	}
+	return m.Variant(media.VariantPreview, "jpeg")
+}
+
+// ReleaseTx supprime les pièces jointes du message ; le job media.release efface les fichiers
+// que plus aucun média ne référence
+func (a *MessageAttachments) ReleaseTx(tx *gorm.DB, messageID uint) error {
+	var deleted []media.Media
+	res := tx.Clauses(clause.Returning{}).Where("message_id = ?", messageID).Delete(&deleted)
+	if res.Error != nil {
+		return res.Error
+	}
+	return media.EnqueueReleaseTx(tx, deleted...)
+}
@@ -0,0 +1,119 @@
+package post
+
+import (
+	"backend/internal/media"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Durée de validité de l'URL de stockage vers laquelle /media/{id} redirige
+const storageRedirectTTL = time.Minute
+
+var (
+	ErrInvalidHLSPath  = errors.New("fichier HLS invalide")
+	ErrMediaNotFound   = errors.New("média introuvable")
+	ErrMediaForbidden  = errors.New("accès au média refusé")
+	ErrMediaBlocked    = errors.New("média non validé par l'antivirus")
+	ErrInvalidMediaURL = errors.New("lien de média invalide ou expiré")
+)
+
+// MediaURLSigner produit les URLs de diffusion des médias : /media/{id}?viewer=&expires=&sig=
+// La signature lie l'URL au lecteur pour lequel elle a été émise ; l'accès est revérifié à chaque téléchargement.
+type MediaURLSigner struct {
+	baseURL string
+	secret  []byte
+	ttl     time.Duration
+}
+
+// NewMediaURLSigner instancie le signataire (secret : STORAGE_SIGNING_SECRET, ttl : STORAGE_URL_TTL)
+func NewMediaURLSigner(baseURL string, secret []byte, ttl time.Duration) *MediaURLSigner {
+	return &MediaURLSigner{baseURL: strings.TrimRight(baseURL, "/"), secret: secret, ttl: ttl}
+}
+
+// URL retourne l'URL signée d'un média pour un lecteur
+func (s *MediaURLSigner) URL(mediaID, viewerID uint) string {
+	return fmt.Sprintf("%s/media/%d?%s", s.baseURL, mediaID, s.query(mediaID, viewerID).Encode())
+}
+
+// VariantURL retourne l'URL signée d'une variante d'image (…&variant=feed&format=webp).
+// La variante n'est pas signée : le lien donne accès au média entier.
+func (s *MediaURLSigner) VariantURL(mediaID, viewerID uint, variant, format string) string {
+	q := s.query(mediaID, viewerID)
+	q.Set("variant", variant)
+	q.Set("format", format)
+	return fmt.Sprintf("%s/media/%d?%s", s.baseURL, mediaID, q.Encode())
+}
+
+// HLSURL retourne l'URL signée d'un fichier de l'échelle HLS d'une vidéo (playlist de niveau ou segment)
+func (s *MediaURLSigner) HLSURL(mediaID, viewerID uint, file string) string {
+	q := s.query(mediaID, viewerID)
+	q.Set("variant", media.VariantHLS)
+	q.Set("format", "m3u8")
+	q.Set("file", file)
+	return fmt.Sprintf("%s/media/%d?%s", s.baseURL, mediaID, q.Encode())
+}
+
+func (s *MediaURLSigner) query(mediaID, viewerID uint) url.Values {
+	viewer := strconv.FormatUint(uint64(viewerID), 10)
+	expires := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("viewer", viewer)
+	q.Set("expires", expires)
+	q.Set("sig", s.sign(mediaID, viewer, expires))
+	return q
+}
+
+// Verify contrôle la signature et l'expiration, et retourne le lecteur auquel l'URL est liée
+func (s *MediaURLSigner) Verify(mediaID uint, viewer, expires, sig string) (uint, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return 0, ErrInvalidMediaURL
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(mediaID, viewer, expires))) {
+		return 0, ErrInvalidMediaURL
+	}
+	viewerID, err := strconv.ParseUint(viewer, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidMediaURL
+	}
+	return uint(viewerID), nil
+}
+
+func (s *MediaURLSigner) sign(mediaID uint, viewer, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "media\n%d\n%s\n%s", mediaID, viewer, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hlsFile valide le chemin d'un fichier HLS relatif au dossier de la playlist maître
+func hlsFile(file string) (string, error) {
+	clean := path.Clean(file)
+	if file == "" || strings.HasPrefix(clean, "/") || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", ErrInvalidHLSPath
+	}
+	return clean, nil
+}
+
+// rewritePlaylist remplace les URIs relatives d'une playlist m3u8 par des URLs signées :
+// les URLs de stockage ne peuvent pas être résolues relativement (signature par fichier).
+func rewritePlaylist(playlist []byte, dir string, sign func(file string) string) []byte {
+	var out bytes.Buffer
+	for _, line := range strings.Split(strings.TrimRight(string(playlist), "\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = sign(path.Join(dir, line))
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
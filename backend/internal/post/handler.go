@@ -1,10 +1,16 @@
 package post
 
 import (
+	"backend/internal/auth"
 	"backend/internal/media"
+	"backend/internal/storage"
+	"backend/internal/user"
+	"errors"
+	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 
@@ -14,27 +20,38 @@ import (
 // Handler structure
 type Handler struct {
 	service Service
+	blobs   storage.Blob
+	signer  *MediaURLSigner
+	claims  media.Claimer
 }
 
-// NewHandler instancie un gestionnaire de route
-func NewHandler(s Service) *Handler {
-	if err := checkUploadsDirectorySecurity(); err != nil {
-		log.Printf("⚠️ Problème dossier uploads: %v", err)
-	}
-	return &Handler{service: s}
+// NewHandler instancie un gestionnaire de route ; les fichiers uploadés sont écrits dans blobs,
+// leurs clés réservées par claims jusqu'à la création du post
+func NewHandler(s Service, blobs storage.Blob, signer *MediaURLSigner, claims media.Claimer) *Handler {
+	return &Handler{service: s, blobs: blobs, signer: signer, claims: claims}
+}
+
+// RegisterMediaRoutes monte la diffusion des médias hors du groupe authentifié :
+// les balises <img>/<video> ne peuvent pas envoyer de Bearer, c'est l'URL signée qui fait foi
+func (h *Handler) RegisterMediaRoutes(r gin.IRoutes) {
+	r.GET("/media/:id", h.ServeMedia)
+	r.HEAD("/media/:id", h.ServeMedia)
 }
 
-func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+// RegisterRoutes monte les routes des posts ; verifiedEmail et mfaEnrollment sont les contrôles
+// d'auth.Service (email vérifié, 2FA des créateurs payants) appliqués aux écritures
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, verifiedEmail, mfaEnrollment gin.HandlerFunc) {
 	posts := rg.Group("/posts")
 
-	posts.POST("/", h.CreatePost)
+	posts.POST("/", auth.RequireRole(user.RoleCreator), verifiedEmail, mfaEnrollment, h.CreatePost)
 	posts.GET("", h.GetAllPosts)
 	posts.GET("/user/:id", h.GetPostsByUser) // Posts d'un utilisateur spécifique
 	posts.GET("/:id", h.GetPostByID)
-	posts.PUT("/:id", h.UpdatePost)
-	posts.DELETE("/:id", h.DeletePost)
+	posts.PUT("/:id", mfaEnrollment, h.UpdatePost)
+	posts.DELETE("/:id", mfaEnrollment, h.DeletePost)
 
-	posts.GET("/media/stats", h.GetMediaStats)
+	// Statistiques globales : réservées aux administrateurs
+	posts.GET("/media/stats", auth.RequireRole(user.RoleAdmin), h.GetMediaStats)
 }
 
 // Utilitaire: extraire les clés du form
@@ -46,6 +63,15 @@ func getMapKeys(m map[string][]*multipart.FileHeader) []string {
 	return keys
 }
 
+// Utilitaire: fichier refusé (type, taille, contenu) -> 400, erreur de stockage -> 500
+func respondSaveError(c *gin.Context, err error, message string) {
+	if errors.Is(err, ErrInvalidMedia) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
 // POST /posts : Créer un post
 // CreatePost godoc
 // @Summary      Create a new post
@@ -60,9 +86,11 @@ func getMapKeys(m map[string][]*multipart.FileHeader) []string {
 // @Param        images         formData  file    false  "Images (max 10, only if no video/documents)"
 // @Param        video          formData  file    false  "Video (only if no images/documents)"
 // @Param        documents      formData  file    false  "Documents (max 5, only if no images/video)"
+// @Param        media_ids      formData  string  false  "IDs of media uploaded via /api/uploads (comma separated or repeated)"
 // @Success      201  {object}  post.PostDTO
 // @Failure      400  {object}  map[string]string "Invalid input"
 // @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Creator role required"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/posts [post]
 func (h *Handler) CreatePost(c *gin.Context) {
@@ -93,6 +121,22 @@ func (h *Handler) CreatePost(c *gin.Context) {
 	videos := form.File["video"]
 	documents := form.File["documents"]
 
+	// Médias déjà envoyés par upload fragmenté (POST /api/uploads) : media_ids=1&media_ids=2 ou media_ids=1,2
+	var mediaIDs []uint
+	for _, raw := range form.Value["media_ids"] {
+		for _, part := range strings.Split(raw, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(part, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "media_ids invalide"})
+				return
+			}
+			mediaIDs = append(mediaIDs, uint(id))
+		}
+	}
+
 	if visibility != string(Public) && visibility != string(Private) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility invalide"})
 		return
@@ -118,22 +162,31 @@ func (h *Handler) CreatePost(c *gin.Context) {
 
 	var medias []media.Media
 
+	// Fichiers déposés : clés réservées jusqu'à la création du post, effacées s'il échoue (sauf contenu partagé)
+	var claimIDs []uint
+	created := false
+	defer func() {
+		if created {
+			h.claims.Done(claimIDs...)
+		} else {
+			h.claims.Abandon(claimIDs...)
+		}
+	}()
+
 	// Images
 	for _, img := range images {
 		if !IsValidImage(img.Filename) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Format image invalide"})
 			return
 		}
-		if !IsUnderSize(img, 100*1024*1024) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Image trop lourde (max 100MB)"})
-			return
-		}
-		path, _, fileSize, err := saveFile(uint(userID), img)
+		// Taille (voir mediafile.MaxSizes) et contenu réel vérifiés par saveFile
+		stored, err := saveFile(c.Request.Context(), h.blobs, h.claims, img)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sauvegarde image"})
+			respondSaveError(c, err, "Erreur sauvegarde image")
 			return
 		}
-		medias = append(medias, media.Media{MediaURL: path, MediaType: "image", FileSize: fileSize})
+		claimIDs = append(claimIDs, stored.ClaimID)
+		medias = append(medias, newMedia(stored, uint(userID)))
 	}
 
 	// Documents
@@ -142,16 +195,14 @@ func (h *Handler) CreatePost(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Format document invalide"})
 			return
 		}
-		if !IsUnderSize(doc, 200*1024*1024) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Document trop lourd (max 200MB)"})
-			return
-		}
-		path, _, fileSize, err := saveFile(uint(userID), doc)
+		// Taille (voir mediafile.MaxSizes) et contenu réel vérifiés par saveFile
+		stored, err := saveFile(c.Request.Context(), h.blobs, h.claims, doc)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sauvegarde document"})
+			respondSaveError(c, err, "Erreur sauvegarde document")
 			return
 		}
-		medias = append(medias, media.Media{MediaURL: path, MediaType: "document", FileSize: fileSize})
+		claimIDs = append(claimIDs, stored.ClaimID)
+		medias = append(medias, newMedia(stored, uint(userID)))
 	}
 
 	// Vidéo
@@ -161,16 +212,14 @@ func (h *Handler) CreatePost(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Format vidéo invalide"})
 			return
 		}
-		if !IsUnderSize(video, 2*1024*1024*1024) { // 2GB max pour la vidéo
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Vidéo trop lourde (max 2GB)"})
-			return
-		}
-		path, _, fileSize, err := saveFile(uint(userID), video)
+		// Taille (voir mediafile.MaxSizes) et contenu réel vérifiés par saveFile
+		stored, err := saveFile(c.Request.Context(), h.blobs, h.claims, video)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sauvegarde vidéo"})
+			respondSaveError(c, err, "Erreur sauvegarde vidéo")
 			return
 		}
-		medias = append(medias, media.Media{MediaURL: path, MediaType: "video", FileSize: fileSize})
+		claimIDs = append(claimIDs, stored.ClaimID)
+		medias = append(medias, newMedia(stored, uint(userID)))
 	}
 
 	input := CreatePostInput{
@@ -179,9 +228,11 @@ func (h *Handler) CreatePost(c *gin.Context) {
 		IsPaidOnly:   isPaidOnly,
 		DocumentType: documentType,
 		Media:        medias,
+		MediaIDs:     mediaIDs,
 	}
 
 	postDTO, err := h.service.CreatePost(uint(userID), input)
+	created = err == nil
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "invalid") || strings.Contains(err.Error(), "invalide") {
@@ -264,7 +315,7 @@ func (h *Handler) GetAllPosts(c *gin.Context) {
 // PUT /posts/:id
 // UpdatePost godoc
 // @Summary      Update a post
-// @Description  Update the content, visibility, or document type of a post
+// @Description  Update the content, visibility, or document type of a post. media_ids, when present, is the complete ordered list of its media: missing ones are deleted, new ones must be unattached uploads of the creator
 // @Tags         posts
 // @Security     BearerAuth
 // @Accept       json
@@ -296,6 +347,8 @@ func (h *Handler) UpdatePost(c *gin.Context) {
 		status := http.StatusForbidden
 		if strings.Contains(err.Error(), "post non trouvé") {
 			status = http.StatusNotFound
+		} else if errors.Is(err, ErrInvalidMedia) {
+			status = http.StatusBadRequest
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
@@ -334,15 +387,46 @@ func (h *Handler) DeletePost(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// DELETE /moderation/posts/:id
+// ModeratePost godoc
+// @Summary      Remove a post (moderation)
+// @Description  Delete any post and its media, whoever its creator (moderators and admins)
+// @Tags         moderation
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Post ID"
+// @Success      204  "No Content"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Forbidden"
+// @Failure      404  {object}  map[string]string "Post not found"
+// @Router       /api/moderation/posts/{id} [delete]
+func (h *Handler) ModeratePost(c *gin.Context) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	if err := h.service.RemovePost(uint(postID)); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "post non trouvé") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("🛡️ Post %d supprimé par le modérateur %d", postID, c.GetInt("user_id"))
+	c.Status(http.StatusNoContent)
+}
+
 // GET /posts/media/stats
 // GetMediaStats godoc
 // @Summary      Get media statistics
-// @Description  Retrieve statistics and recommendations about uploaded media
+// @Description  Retrieve statistics and recommendations about uploaded media (admin only)
 // @Tags         posts
 // @Security     BearerAuth
 // @Produce      json
 // @Success      200  {object}  map[string]interface{} "Media statistics and recommendations"
 // @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Forbidden"
 // @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/posts/media/stats [get]
 func (h *Handler) GetMediaStats(c *gin.Context) {
@@ -399,3 +483,113 @@ func (h *Handler) GetPostsByUser(c *gin.Context) {
 		}(),
 	})
 }
+
+// servePlaylist sert une playlist HLS en signant les URLs des playlists de niveau et des segments
+func (h *Handler) servePlaylist(c *gin.Context, mediaID, viewerID uint, key, file string) {
+	rc, err := h.blobs.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fichier HLS introuvable"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Playlist %s illisible : %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Média indisponible"})
+		return
+	}
+	defer rc.Close()
+	playlist, err := io.ReadAll(io.LimitReader(rc, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Média indisponible"})
+		return
+	}
+
+	dir := path.Dir(file)
+	body := rewritePlaylist(playlist, dir, func(ref string) string {
+		return h.signer.HLSURL(mediaID, viewerID, ref)
+	})
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", body)
+}
+
+// GET /media/:id
+// ServeMedia godoc
+// @Summary      Download a post media
+// @Description  Checks the viewer-bound signed URL returned in the post media list, re-checks access to the post, then redirects to a short-lived storage URL
+// @Tags         media
+// @Param        id       path      int     true  "Media ID"
+// @Param        viewer   query     int     true  "Viewer the URL was issued to"
+// @Param        expires  query     int     true  "Expiry (unix timestamp)"
+// @Param        sig      query     string  true  "HMAC signature"
+// @Param        variant  query     string  false "Variant: thumbnail, feed or full (images), poster or hls (videos)"
+// @Param        format   query     string  false "Variant format: jpeg (default), webp or m3u8"
+// @Param        file     query     string  false "HLS only: file relative to the master playlist (default master.m3u8)"
+// @Success      200      {string}  string  "HLS playlist with signed URIs"
+// @Success      302
+// @Failure      403  {object}  map[string]string "Invalid or expired link, or no access to the post"
+// @Failure      404  {object}  map[string]string "Media or variant not found"
+// @Failure      409  {object}  map[string]string "Not yet scanned by the antivirus, or quarantined"
+// @Router       /media/{id} [get]
+func (h *Handler) ServeMedia(c *gin.Context) {
+	mediaID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de média invalide"})
+		return
+	}
+
+	viewerID, err := h.signer.Verify(uint(mediaID), c.Query("viewer"), c.Query("expires"), c.Query("sig"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// L'accès est revérifié : un abonnement résilié coupe l'accès avant l'expiration du lien
+	m, err := h.service.GetMediaForViewer(uint(mediaID), viewerID)
+	switch {
+	case errors.Is(err, ErrMediaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrMediaForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrMediaBlocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération du média"})
+		return
+	}
+
+	key := m.MediaURL
+	if name := c.Query("variant"); name != "" {
+		variant := m.Variant(name, c.DefaultQuery("format", "jpeg"))
+		if variant == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variante introuvable"})
+			return
+		}
+		key = variant.Key
+		if variant.Format == "m3u8" {
+			// Fichier de l'échelle HLS, relatif au dossier de la playlist maître
+			file, err := hlsFile(c.DefaultQuery("file", path.Base(variant.Key)))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			key = path.Join(path.Dir(variant.Key), file)
+			if path.Ext(file) == ".m3u8" {
+				h.servePlaylist(c, m.ID, viewerID, key, file)
+				return
+			}
+		}
+	}
+
+	url, err := h.blobs.SignedURL(c.Request.Context(), key, storageRedirectTTL)
+	if err != nil {
+		log.Printf("❌ URL de stockage impossible pour le média %d: %v", m.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Média indisponible"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Redirect(http.StatusFound, url)
+}
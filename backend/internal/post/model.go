@@ -21,6 +21,7 @@ type CreatePostInput struct {
 	IsPaidOnly   bool          `json:"is_paid_only"` // Nouveau champ pour création
 	DocumentType string        `json:"document_type,omitempty"`
 	Media        []media.Media `json:"media"`
+	MediaIDs     []uint        `json:"media_ids,omitempty"` // Médias issus d'uploads fragmentés (POST /api/uploads)
 }
 
 type UpdatePostInput struct {
@@ -28,6 +29,9 @@ type UpdatePostInput struct {
 	Visibility   Visibility `json:"visibility" binding:"omitempty,oneof=public private"`
 	IsPaidOnly   *bool      `json:"is_paid_only,omitempty"` // Pointeur pour permettre la mise à jour
 	DocumentType string     `json:"document_type,omitempty"`
+	// Liste complète et ordonnée des médias du post : absents retirés (et supprimés), uploads ajoutés
+	// (voir /api/uploads), ordre d'affichage ; nil laisse les médias inchangés
+	MediaIDs *[]uint `json:"media_ids,omitempty"`
 }
 
 type Post struct {
@@ -41,20 +45,56 @@ type Post struct {
 	UpdatedAt    time.Time
 
 	Media      []media.Media           `gorm:"foreignKey:PostID"`
+	UploadIDs  []uint                  `gorm:"-"` // Médias déjà uploadés à rattacher à la création
 	PostAccess []postaccess.PostAccess `gorm:"foreignKey:PostID"`
 }
 
+// MediaDTO : média d'un post, avec ses URLs de diffusion signées pour le lecteur
+type MediaDTO struct {
+	ID       uint         `json:"id"`
+	Type     string       `json:"type"`          // image, video ou document
+	URL      string       `json:"url,omitempty"` // Fichier original (absent tant que l'antivirus ne l'a pas validé)
+	FileName string       `json:"file_name,omitempty"`
+	Status   string       `json:"status"`                // pending, processing, ready ou failed
+	Scan     string       `json:"scan_status,omitempty"` // Verdict antivirus : pending, clean, infected, error ou skipped
+	Variants []VariantDTO `json:"variants,omitempty"`    // Variantes d'images, poster et HLS des vidéos, une fois traités
+	Key      string       `json:"-"`                     // Clé de stockage (dédoublonnage)
+
+	servable bool
+	variants []media.Variant
+}
+
+// VariantDTO : image redimensionnée (thumbnail, feed, full en JPEG ou WebP), poster (JPEG) ou playlist HLS (m3u8) d'une vidéo
+type VariantDTO struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// NewMediaDTO prépare un média pour PostDTO ; les URLs sont signées par le service selon l'accès du lecteur
+func NewMediaDTO(m *media.Media) MediaDTO {
+	return MediaDTO{
+		ID: m.ID, Type: m.MediaType, FileName: m.FileName, Status: m.ProcessingStatus, Scan: m.ScanStatus, Key: m.MediaURL,
+		servable: m.Servable(), variants: m.Variants,
+	}
+}
+
 // PostDTO pour les réponses API
 type PostDTO struct {
-	ID           uint      `json:"id"`
-	CreatorID    uint      `json:"creator_id"`
-	Content      string    `json:"content"`
-	Visibility   string    `json:"visibility"`
-	IsPaidOnly   bool      `json:"is_paid_only"`
-	DocumentType string    `json:"document_type,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	MediaURLs    []string  `json:"media_urls"`
+	ID           uint       `json:"id"`
+	CreatorID    uint       `json:"creator_id"`
+	Content      string     `json:"content"`
+	Visibility   string     `json:"visibility"`
+	IsPaidOnly   bool       `json:"is_paid_only"`
+	DocumentType string     `json:"document_type,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Media        []MediaDTO `json:"media"`
+
+	// Médias masqués quand le lecteur n'a pas accès au post
+	LockedMediaCount int `json:"locked_media_count,omitempty"`
 
 	// Statistiques
 	LikeCount    int  `json:"like_count"`
@@ -1,13 +1,17 @@
 package post
 
 import (
-	"backend/internal/db"
+	"backend/internal/jobs"
 	"backend/internal/media"
+	"backend/internal/models"
 
 	userModel "backend/internal/user"
 	"errors"
+	"fmt"
+	"sort"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
@@ -16,6 +20,8 @@ type Repository interface {
 	GetAll(page, limit int) ([]*Post, int64, error)
 	GetByCreatorID(creatorID uint, page, limit int) ([]*Post, int64, error)
 	Update(post *Post) error
+	// UpdateWithMedia enregistre le post et fixe la liste ordonnée de ses médias (retraits, uploads ajoutés)
+	UpdateWithMedia(post *Post, mediaIDs []uint) error
 	Delete(id uint) error
 
 	// Méthodes pour les statistiques
@@ -30,32 +36,88 @@ type Repository interface {
 	// Méthodes pour le scroll infini
 	GetAllAfter(afterID uint, limit int) ([]*Post, error)
 	GetByCreatorAfter(creatorID, afterID uint, limit int) ([]*Post, error)
+
+	// Contrôle d'accès aux posts payants
+	CountActiveSubscriptions(subscriberID, creatorID uint) (int64, error)
+
+	// Diffusion des médias
+	GetMediaByID(id uint) (*media.Media, error)
+
+	// Médias uploadés par ownerID et pas encore rattachés à un post
+	GetAttachableMedia(ownerID uint, ids []uint) ([]media.Media, error)
 }
 
 type repository struct {
 	db *gorm.DB
 }
 
-func NewRepository() Repository {
-	return &repository{db: db.GormDB}
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
 }
 
 func (r *repository) Create(post *Post) error {
 	if post == nil {
 		return errors.New("post cannot be nil")
 	}
-	// Sauvegarde le post
-	if err := r.db.Create(post).Error; err != nil {
-		return err
-	}
-	// Sauvegarde les médias associés (si présents)
-	if len(post.Media) > 0 {
-		for i := range post.Media {
-			post.Media[i].PostID = post.ID
-			post.Media[i].ID = 0 // Laisse GORM gérer l'auto-incrément
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Sauvegarde le post
+		if err := tx.Create(post).Error; err != nil {
+			return err
 		}
-		// Crée tous les médias en une seule requête
-		if err := r.db.Create(&post.Media).Error; err != nil {
+		// Sauvegarde les médias associés (si présents), dans l'ordre reçu
+		if len(post.Media) > 0 {
+			for i := range post.Media {
+				post.Media[i].PostID = post.ID
+				post.Media[i].ID = 0 // Laisse GORM gérer l'auto-incrément
+				post.Media[i].Position = i
+				post.Media[i].ProcessingStatus = media.ProcessingPending
+				post.Media[i].ScanStatus = media.ScanPending
+			}
+			// Crée tous les médias en une seule requête
+			if err := tx.Create(&post.Media).Error; err != nil {
+				return err
+			}
+		}
+		// Rattache les médias uploadés, après les fichiers envoyés directement
+		for i, id := range post.UploadIDs {
+			if err := attachUploadTx(tx, post, id, len(post.Media)+i); err != nil {
+				return err
+			}
+		}
+		// Traitement des médias en arrière-plan (variantes, transcodage, métadonnées), enregistré avec le post
+		mediaIDs := append([]uint{}, post.UploadIDs...)
+		for _, m := range post.Media {
+			mediaIDs = append(mediaIDs, m.ID)
+		}
+		return enqueueProcessTx(tx, post.CreatorID, mediaIDs...)
+	})
+}
+
+// attachUploadTx rattache un média uploadé au post ; la condition protège contre un double rattachement concurrent
+func attachUploadTx(tx *gorm.DB, post *Post, mediaID uint, position int) error {
+	res := tx.Model(&media.Media{}).
+		Where("id = ? AND owner_id = ? AND (post_id IS NULL OR post_id = 0) AND message_id = 0", mediaID, post.CreatorID).
+		Updates(map[string]interface{}{
+			"post_id":           post.ID,
+			"position":          position,
+			"processing_status": media.ProcessingPending,
+			"scan_status":       media.ScanPending,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return fmt.Errorf("%w : média introuvable ou déjà utilisé", ErrInvalidMedia)
+	}
+	return nil
+}
+
+// enqueueProcessTx planifie le traitement des médias dans la transaction qui les rattache
+func enqueueProcessTx(tx *gorm.DB, ownerID uint, mediaIDs ...uint) error {
+	for _, id := range mediaIDs {
+		_, err := jobs.EnqueueTx(tx, media.ProcessJobKind, media.ProcessPayload{MediaID: id},
+			jobs.WithOwner(ownerID), jobs.WithRef(media.JobRef(id)))
+		if err != nil {
 			return err
 		}
 	}
@@ -119,6 +181,45 @@ func (r *repository) Update(post *Post) error {
 	return r.db.Save(post).Error
 }
 
+func (r *repository) UpdateWithMedia(post *Post, mediaIDs []uint) error {
+	if post == nil {
+		return errors.New("post cannot be nil")
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(post).Error; err != nil {
+			return err
+		}
+		// Médias retirés du post : supprimés, leurs fichiers effacés avec leur dernière référence (job media.release)
+		var removed []media.Media
+		query := tx.Clauses(clause.Returning{}).Where("post_id = ?", post.ID)
+		if len(mediaIDs) > 0 {
+			query = query.Where("id NOT IN ?", mediaIDs)
+		}
+		if err := query.Delete(&removed).Error; err != nil {
+			return err
+		}
+		if err := media.EnqueueReleaseTx(tx, removed...); err != nil {
+			return err
+		}
+		// Médias conservés : nouvel ordre ; uploads ajoutés : rattachés puis traités
+		var attached []uint
+		for i, id := range mediaIDs {
+			res := tx.Model(&media.Media{}).Where("id = ? AND post_id = ?", id, post.ID).Update("position", i)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 1 {
+				continue
+			}
+			if err := attachUploadTx(tx, post, id, i); err != nil {
+				return err
+			}
+			attached = append(attached, id)
+		}
+		return enqueueProcessTx(tx, post.CreatorID, attached...)
+	})
+}
+
 func (r *repository) Delete(id uint) error {
 	tx := r.db.Begin()
 	defer func() {
@@ -127,8 +228,13 @@ func (r *repository) Delete(id uint) error {
 		}
 	}()
 
-	// Supprimer les médias associés
-	if err := tx.Where("post_id = ?", id).Delete(&media.Media{}).Error; err != nil {
+	// Supprimer les médias associés ; chaque fichier n'est effacé qu'avec sa dernière référence (job media.release)
+	var medias []media.Media
+	if err := tx.Clauses(clause.Returning{}).Where("post_id = ?", id).Delete(&medias).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := media.EnqueueReleaseTx(tx, medias...); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -189,10 +295,17 @@ func (r *repository) GetPostsWithStats(posts []*Post, userID uint) ([]*PostDTO,
 			return nil, err
 		}
 
-		// Récupérer les URLs des médias
-		mediaURLs := make([]string, len(post.Media))
-		for i, media := range post.Media {
-			mediaURLs[i] = media.MediaURL
+		// Récupérer les médias dans l'ordre d'affichage (les URLs sont signées par le service)
+		medias := append([]media.Media{}, post.Media...)
+		sort.SliceStable(medias, func(i, j int) bool {
+			if medias[i].Position != medias[j].Position {
+				return medias[i].Position < medias[j].Position
+			}
+			return medias[i].ID < medias[j].ID
+		})
+		mediaList := make([]MediaDTO, len(medias))
+		for i := range medias {
+			mediaList[i] = NewMediaDTO(&medias[i])
 		}
 
 		// Récupérer les infos du créateur
@@ -211,7 +324,7 @@ func (r *repository) GetPostsWithStats(posts []*Post, userID uint) ([]*PostDTO,
 			DocumentType: post.DocumentType,
 			CreatedAt:    post.CreatedAt,
 			UpdatedAt:    post.UpdatedAt,
-			MediaURLs:    mediaURLs,
+			Media:        mediaList,
 			LikeCount:    stats.LikeCount,
 			CommentCount: stats.CommentCount,
 			UserHasLiked: stats.UserHasLiked,
@@ -266,3 +379,28 @@ func (r *repository) GetByCreatorAfter(creatorID, afterID uint, limit int) ([]*P
 	err := query.Find(&posts).Error
 	return posts, err
 }
+
+// CountActiveSubscriptions compte les abonnements actifs d'un utilisateur à un créateur
+func (r *repository) CountActiveSubscriptions(subscriberID, creatorID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Subscription{}).
+		Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", subscriberID, creatorID, true).
+		Count(&count).Error
+	return count, err
+}
+
+// GetMediaByID récupère un média
+func (r *repository) GetMediaByID(id uint) (*media.Media, error) {
+	var m media.Media
+	if err := r.db.First(&m, id).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetAttachableMedia récupère les médias uploadés par ownerID qui ne sont rattachés à aucun post
+func (r *repository) GetAttachableMedia(ownerID uint, ids []uint) ([]media.Media, error) {
+	var medias []media.Media
+	err := r.db.Where("id IN ? AND owner_id = ? AND (post_id IS NULL OR post_id = 0) AND message_id = 0", ids, ownerID).Find(&medias).Error
+	return medias, err
+}
@@ -1,8 +1,12 @@
 package post
 
 import (
+	"backend/internal/media"
 	"errors"
+	"fmt"
 	"strings"
+
+	"gorm.io/gorm"
 )
 
 type Service interface {
@@ -12,20 +16,39 @@ type Service interface {
 	GetPostsByCreator(creatorID uint, page, limit int, userID uint) ([]*PostDTO, int64, error)
 	UpdatePost(postID, creatorID uint, input UpdatePostInput) (*PostDTO, error)
 	DeletePost(postID, creatorID uint) error
+	RemovePost(postID uint) error
 	GetMediaStatistics() (interface{}, interface{})
 	GetAllPostsAfter(afterID uint, limit int, userID uint) ([]*PostDTO, error)
 	GetPostsByCreatorAfter(creatorID, afterID uint, limit int, userID uint) ([]*PostDTO, error)
+	GetMediaForViewer(mediaID, viewerID uint) (*media.Media, error)
+	CanViewPost(postID, viewerID uint) (bool, error)
+}
+
+// MessageParticipants contrôle l'accès aux pièces jointes des messages (message.Repository)
+type MessageParticipants interface {
+	// IsMessageParticipant indique si userID participe à la conversation d'un message (non supprimé)
+	IsMessageParticipant(messageID, userID uint) (bool, error)
 }
 
 type service struct {
-	repo Repository
+	repo         Repository
+	signer       *MediaURLSigner
+	participants MessageParticipants
 }
 
-func NewService(repo Repository) Service {
+// NewService instancie le service ; les médias sont exposés via des URLs signées liées au lecteur,
+// les pièces jointes des messages aux seuls participants de la conversation
+func NewService(repo Repository, signer *MediaURLSigner, participants MessageParticipants) Service {
 	if repo == nil {
 		panic("repository cannot be nil")
 	}
-	return &service{repo: repo}
+	if signer == nil {
+		panic("media URL signer cannot be nil")
+	}
+	if participants == nil {
+		panic("message participants cannot be nil")
+	}
+	return &service{repo: repo, signer: signer, participants: participants}
 }
 
 func (s *service) GetMediaStatistics() (interface{}, interface{}) {
@@ -64,6 +87,22 @@ func (s *service) CreatePost(creatorID uint, input CreatePostInput) (*PostDTO, e
 	if input.Visibility != Public && input.Visibility != Private {
 		return nil, errors.New("invalid visibility")
 	}
+	uploadIDs := uniqueIDs(input.MediaIDs)
+	allMedia := input.Media
+	if len(uploadIDs) > 0 {
+		uploaded, err := s.repo.GetAttachableMedia(creatorID, uploadIDs)
+		if err != nil {
+			return nil, errors.New("erreur lors de la récupération des médias")
+		}
+		if len(uploaded) != len(uploadIDs) {
+			return nil, fmt.Errorf("%w : média introuvable ou déjà utilisé", ErrInvalidMedia)
+		}
+		allMedia = append(append([]media.Media{}, input.Media...), uploaded...)
+	}
+	if err := validateMediaMix(allMedia); err != nil {
+		return nil, err
+	}
+
 	post := &Post{
 		CreatorID:    creatorID,
 		Content:      strings.TrimSpace(input.Content),
@@ -71,8 +110,12 @@ func (s *service) CreatePost(creatorID uint, input CreatePostInput) (*PostDTO, e
 		IsPaidOnly:   input.IsPaidOnly,
 		DocumentType: input.DocumentType,
 		Media:        input.Media,
+		UploadIDs:    uploadIDs,
 	}
 	if err := s.repo.Create(post); err != nil {
+		if errors.Is(err, ErrInvalidMedia) {
+			return nil, err
+		}
 		return nil, errors.New("erreur lors de la création du post")
 	}
 	return s.GetPostByID(post.ID, creatorID)
@@ -91,16 +134,17 @@ func (s *service) GetPostByID(id, userID uint) (*PostDTO, error) {
 	}
 
 	dto := postsDTO[0]
-	removeDuplicateMediaURLs(dto) // ✅
+	removeDuplicateMedia(dto) // ✅
 
 	// Vérifier l'accès au contenu
-	hasAccess := CheckPostAccess(userID, post.CreatorID, post.IsPaidOnly)
+	hasAccess := CheckPostAccess(s.repo, userID, post.CreatorID, post.IsPaidOnly)
 	dto.HasAccess = hasAccess
 	dto.IsPaidOnly = post.IsPaidOnly
 
 	if !hasAccess {
 		dto.Content = "🔒 Ce contenu est réservé aux abonnés payants. Abonnez-vous pour y accéder !"
 	}
+	s.resolveMedia(dto, userID)
 
 	creator, err := s.repo.GetCreatorInfo(post.CreatorID)
 	if err == nil {
@@ -109,16 +153,69 @@ func (s *service) GetPostByID(id, userID uint) (*PostDTO, error) {
 	return dto, nil
 }
 
-func removeDuplicateMediaURLs(dto *PostDTO) {
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	var unique []uint
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func removeDuplicateMedia(dto *PostDTO) {
 	seen := map[string]bool{}
-	unique := []string{}
-	for _, url := range dto.MediaURLs {
-		if !seen[url] {
-			seen[url] = true
-			unique = append(unique, url)
+	unique := []MediaDTO{}
+	for _, m := range dto.Media {
+		if !seen[m.Key] {
+			seen[m.Key] = true
+			unique = append(unique, m)
 		}
 	}
-	dto.MediaURLs = unique
+	dto.Media = unique
+}
+
+// resolveMedia signe les URLs de diffusion (original et variantes) pour le lecteur.
+// Les médias d'un post verrouillé ne sont pas exposés : seul leur nombre est indiqué.
+func (s *service) resolveMedia(dto *PostDTO, viewerID uint) {
+	if !dto.HasAccess {
+		dto.LockedMediaCount = len(dto.Media)
+		dto.Media = []MediaDTO{}
+		return
+	}
+	for i := range dto.Media {
+		m := &dto.Media[i]
+		if !m.servable {
+			// Pas encore validé par l'antivirus, ou en quarantaine : aucune URL
+			continue
+		}
+		m.URL = s.signer.URL(m.ID, viewerID)
+		m.Variants = make([]VariantDTO, len(m.variants))
+		for j, v := range m.variants {
+			m.Variants[j] = VariantDTO{
+				Name:   v.Name,
+				Format: v.Format,
+				Width:  v.Width,
+				Height: v.Height,
+				URL:    s.signer.VariantURL(m.ID, viewerID, v.Name, v.Format),
+			}
+		}
+	}
+}
+
+// withAccess applique le contrôle d'accès à une liste de posts (scroll infini)
+func (s *service) withAccess(dtos []*PostDTO, userID uint) []*PostDTO {
+	for _, dto := range dtos {
+		removeDuplicateMedia(dto)
+		dto.HasAccess = CheckPostAccess(s.repo, userID, dto.CreatorID, dto.IsPaidOnly)
+		if !dto.HasAccess {
+			dto.Content = "🔒 Ce contenu est réservé aux abonnés payants. Abonnez-vous pour y accéder !"
+		}
+		s.resolveMedia(dto, userID)
+	}
+	return dtos
 }
 
 func (s *service) GetAllPosts(page, limit int, userID uint) ([]*PostDTO, int64, error) {
@@ -141,7 +238,7 @@ func (s *service) GetAllPosts(page, limit int, userID uint) ([]*PostDTO, int64,
 
 	// Appliquer le contrôle d'accès pour tous les posts
 	for _, dto := range postsDTO {
-		removeDuplicateMediaURLs(dto) // ✅
+		removeDuplicateMedia(dto) // ✅
 
 		// Trouver le post original pour récupérer IsPaidOnly
 		var originalPost *Post
@@ -153,7 +250,7 @@ func (s *service) GetAllPosts(page, limit int, userID uint) ([]*PostDTO, int64,
 		}
 
 		if originalPost != nil {
-			hasAccess := CheckPostAccess(userID, originalPost.CreatorID, originalPost.IsPaidOnly)
+			hasAccess := CheckPostAccess(s.repo, userID, originalPost.CreatorID, originalPost.IsPaidOnly)
 			dto.HasAccess = hasAccess
 			dto.IsPaidOnly = originalPost.IsPaidOnly
 
@@ -161,6 +258,7 @@ func (s *service) GetAllPosts(page, limit int, userID uint) ([]*PostDTO, int64,
 				dto.Content = "🔒 Ce contenu est réservé aux abonnés payants. Abonnez-vous pour y accéder !"
 			}
 		}
+		s.resolveMedia(dto, userID)
 	}
 
 	return postsDTO, total, nil
@@ -191,7 +289,7 @@ func (s *service) GetPostsByCreator(creatorID uint, page, limit int, userID uint
 
 	// Appliquer le contrôle d'accès pour tous les posts
 	for _, dto := range postsDTO {
-		removeDuplicateMediaURLs(dto) // ✅
+		removeDuplicateMedia(dto) // ✅
 
 		// Trouver le post original pour récupérer IsPaidOnly
 		var originalPost *Post
@@ -203,7 +301,7 @@ func (s *service) GetPostsByCreator(creatorID uint, page, limit int, userID uint
 		}
 
 		if originalPost != nil {
-			hasAccess := CheckPostAccess(userID, originalPost.CreatorID, originalPost.IsPaidOnly)
+			hasAccess := CheckPostAccess(s.repo, userID, originalPost.CreatorID, originalPost.IsPaidOnly)
 			dto.HasAccess = hasAccess
 			dto.IsPaidOnly = originalPost.IsPaidOnly
 
@@ -211,6 +309,7 @@ func (s *service) GetPostsByCreator(creatorID uint, page, limit int, userID uint
 				dto.Content = "🔒 Ce contenu est réservé aux abonnés payants. Abonnez-vous pour y accéder !"
 			}
 		}
+		s.resolveMedia(dto, userID)
 	}
 
 	return postsDTO, total, nil
@@ -237,7 +336,46 @@ func (s *service) UpdatePost(postID, creatorID uint, input UpdatePostInput) (*Po
 		post.DocumentType = input.DocumentType
 	}
 
-	if err := s.repo.Update(post); err != nil {
+	if input.MediaIDs == nil {
+		if err := s.repo.Update(post); err != nil {
+			return nil, errors.New("erreur lors de la mise à jour")
+		}
+		return s.GetPostByID(postID, creatorID)
+	}
+
+	// Médias : liste finale ordonnée, soumise aux mêmes règles qu'à la création
+	mediaIDs := uniqueIDs(*input.MediaIDs)
+	current := map[uint]media.Media{}
+	for _, m := range post.Media {
+		current[m.ID] = m
+	}
+	var final []media.Media
+	var added []uint
+	for _, id := range mediaIDs {
+		if m, ok := current[id]; ok {
+			final = append(final, m)
+		} else {
+			added = append(added, id)
+		}
+	}
+	if len(added) > 0 {
+		uploaded, err := s.repo.GetAttachableMedia(creatorID, added)
+		if err != nil {
+			return nil, errors.New("erreur lors de la récupération des médias")
+		}
+		if len(uploaded) != len(added) {
+			return nil, fmt.Errorf("%w : média introuvable ou déjà utilisé", ErrInvalidMedia)
+		}
+		final = append(final, uploaded...)
+	}
+	if err := validateMediaMix(final); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateWithMedia(post, mediaIDs); err != nil {
+		if errors.Is(err, ErrInvalidMedia) {
+			return nil, err
+		}
 		return nil, errors.New("erreur lors de la mise à jour")
 	}
 
@@ -256,12 +394,24 @@ func (s *service) DeletePost(postID, creatorID uint) error {
 	return s.repo.Delete(postID)
 }
 
+// RemovePost supprime un post quel que soit son auteur (modération)
+func (s *service) RemovePost(postID uint) error {
+	if _, err := s.repo.GetByID(postID); err != nil {
+		return errors.New("post non trouvé")
+	}
+	return s.repo.Delete(postID)
+}
+
 func (s *service) GetAllPostsAfter(afterID uint, limit int, userID uint) ([]*PostDTO, error) {
 	posts, err := s.repo.GetAllAfter(afterID, limit)
 	if err != nil {
 		return nil, err
 	}
-	return s.repo.GetPostsWithStats(posts, userID)
+	dtos, err := s.repo.GetPostsWithStats(posts, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.withAccess(dtos, userID), nil
 }
 
 func (s *service) GetPostsByCreatorAfter(creatorID, afterID uint, limit int, userID uint) ([]*PostDTO, error) {
@@ -269,5 +419,57 @@ func (s *service) GetPostsByCreatorAfter(creatorID, afterID uint, limit int, use
 	if err != nil {
 		return nil, err
 	}
-	return s.repo.GetPostsWithStats(posts, userID)
+	dtos, err := s.repo.GetPostsWithStats(posts, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.withAccess(dtos, userID), nil
+}
+
+// CanViewPost indique si viewerID a accès au contenu d'un post (contrôle d'accès de l'API /api/media)
+func (s *service) CanViewPost(postID, viewerID uint) (bool, error) {
+	post, err := s.repo.GetByID(postID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, media.ErrPostNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return CheckPostAccess(s.repo, viewerID, post.CreatorID, post.IsPaidOnly), nil
+}
+
+// GetMediaForViewer retourne un média si le lecteur a accès au post qui le contient
+// (ou, pour une pièce jointe, s'il participe à la conversation du message)
+func (s *service) GetMediaForViewer(mediaID, viewerID uint) (*media.Media, error) {
+	m, err := s.repo.GetMediaByID(mediaID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.MessageID != 0 {
+		ok, err := s.participants.IsMessageParticipant(m.MessageID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrMediaForbidden
+		}
+	} else {
+		post, err := s.repo.GetByID(m.PostID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMediaNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !CheckPostAccess(s.repo, viewerID, post.CreatorID, post.IsPaidOnly) {
+			return nil, ErrMediaForbidden
+		}
+	}
+	if !m.Servable() {
+		return nil, ErrMediaBlocked
+	}
+	return m, nil
 }
@@ -0,0 +1,261 @@
+package ratelimit
+
+import (
+	"backend/internal/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyFunc extrait une clé de limitation de la requête ("" = pas de limitation pour cette clé)
+type KeyFunc func(c *gin.Context) string
+
+// ByIP limite par adresse IP du client
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser limite par utilisateur authentifié (à placer après AuthMiddleware)
+func ByUser(c *gin.Context) string {
+	if id := c.GetInt("user_id"); id != 0 {
+		return "user:" + strconv.Itoa(id)
+	}
+	return ""
+}
+
+// ByJSONField limite par la valeur d'un champ du corps JSON (le corps reste lisible par le handler)
+func ByJSONField(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		value := strings.ToLower(strings.TrimSpace(JSONField(c, field)))
+		if value == "" {
+			return ""
+		}
+		return field + ":" + value
+	}
+}
+
+// JSONField lit un champ texte du corps JSON ("" s'il est absent) ; le corps reste lisible par le handler
+func JSONField(c *gin.Context, field string) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload map[string]interface{}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	value, _ := payload[field].(string)
+	return value
+}
+
+// ByEmail limite par le champ "email" du corps JSON
+var ByEmail = ByJSONField("email")
+
+// Policy décrit une limitation simple : Limit requêtes par fenêtre Window
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// BackoffPolicy décrit une limitation basée sur les échecs (réponses 401) :
+// délai exponentiel après FreeAttempts échecs, puis verrouillage temporaire.
+type BackoffPolicy struct {
+	Name             string
+	FreeAttempts     int           // Échecs tolérés sans délai
+	BaseDelay        time.Duration // Délai après le premier échec au-delà de FreeAttempts (doublé ensuite)
+	MaxDelay         time.Duration
+	LockoutThreshold int // Nombre d'échecs déclenchant le verrouillage
+	LockoutDuration  time.Duration
+	FailureWindow    time.Duration // Durée pendant laquelle les échecs sont comptés
+	FailureStatus    int           // Statut de réponse comptabilisé comme un échec (401 par défaut)
+}
+
+// DefaultLoginPolicy : 3 essais libres, puis 1s, 2s, 4s... et verrouillage 15 min au 10e échec
+var DefaultLoginPolicy = BackoffPolicy{
+	Name:             "login",
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	FailureWindow:    time.Hour,
+}
+
+// Limiter applique les politiques de limitation à l'aide d'un Store
+type Limiter struct {
+	store Store
+}
+
+// New crée un limiteur ; un store en mémoire est utilisé si store est nil
+func New(store Store) *Limiter {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Limiter{store: store}
+}
+
+// NewStore crée le store configuré ; un Redis injoignable empêche le démarrage
+func NewStore(cfg config.RateLimitConfig) (Store, error) {
+	if cfg.Store != "redis" {
+		log.Printf("🚦 Rate limiting : store en mémoire")
+		return NewMemoryStore(), nil
+	}
+
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL invalide : %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("redis injoignable (%s) : %w", opts.Addr, err)
+	}
+	log.Printf("🚦 Rate limiting : store Redis (%s)", opts.Addr)
+	return NewRedisStore(client), nil
+}
+
+// tooManyRequests interrompt la requête avec un 429 et l'en-tête Retry-After
+func tooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       "trop de tentatives, réessayez plus tard",
+		"retry_after": seconds,
+	})
+}
+
+// collectKeys calcule les clés de la requête, préfixées par le nom de la politique
+func collectKeys(c *gin.Context, name string, keyFuncs []KeyFunc) []string {
+	keys := make([]string, 0, len(keyFuncs))
+	for _, fn := range keyFuncs {
+		if k := fn(c); k != "" {
+			keys = append(keys, name+":"+k)
+		}
+	}
+	return keys
+}
+
+// Throttle limite le nombre de requêtes par fenêtre, pour chacune des clés
+func (l *Limiter) Throttle(p Policy, keyFuncs ...KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		for _, key := range collectKeys(c, p.Name, keyFuncs) {
+			count, err := l.store.Incr(ctx, key, p.Window)
+			if err != nil {
+				// En cas de panne du store, on laisse passer plutôt que de bloquer le service
+				log.Printf("⚠️ Rate limiting indisponible (%s) : %v", key, err)
+				continue
+			}
+			if count > int64(p.Limit) {
+				tooManyRequests(c, p.Window)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// Backoff refuse les requêtes des clés bloquées, puis comptabilise les échecs (401, ou p.FailureStatus) après le handler.
+// Un succès remet à zéro les compteurs, sauf ceux par IP (un attaquant ne peut pas les effacer
+// en se connectant à son propre compte).
+func (l *Limiter) Backoff(p BackoffPolicy, keyFuncs ...KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		keys := collectKeys(c, p.Name, keyFuncs)
+
+		for _, key := range keys {
+			remaining, err := l.store.LockedFor(ctx, key)
+			if err != nil {
+				log.Printf("⚠️ Rate limiting indisponible (%s) : %v", key, err)
+				continue
+			}
+			if remaining > 0 {
+				tooManyRequests(c, remaining)
+				return
+			}
+		}
+
+		c.Next()
+
+		failure := p.FailureStatus
+		if failure == 0 {
+			failure = http.StatusUnauthorized
+		}
+		status := c.Writer.Status()
+		switch {
+		case status == failure:
+			for _, key := range keys {
+				l.recordFailure(ctx, p, key)
+			}
+		case status >= 200 && status < 300:
+			for _, key := range keys {
+				if !strings.HasPrefix(key, p.Name+":ip:") {
+					if err := l.store.Reset(ctx, key); err != nil {
+						log.Printf("⚠️ Rate limiting : reset impossible (%s) : %v", key, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// recordFailure comptabilise un échec et bloque la clé si nécessaire
+func (l *Limiter) recordFailure(ctx context.Context, p BackoffPolicy, key string) {
+	failures, err := l.store.Incr(ctx, key, p.FailureWindow)
+	if err != nil {
+		log.Printf("⚠️ Rate limiting indisponible (%s) : %v", key, err)
+		return
+	}
+
+	var delay time.Duration
+	switch {
+	case p.LockoutThreshold > 0 && failures >= int64(p.LockoutThreshold):
+		delay = p.LockoutDuration
+		log.Printf("🔒 Verrouillage temporaire de %s (%d échecs, %s)", key, failures, delay)
+	case failures > int64(p.FreeAttempts):
+		delay = BackoffDelay(p, failures)
+	default:
+		return
+	}
+
+	if err := l.store.Lock(ctx, key, delay); err != nil {
+		log.Printf("⚠️ Rate limiting : verrouillage impossible (%s) : %v", key, err)
+	}
+}
+
+// BackoffDelay retourne le délai imposé après un nombre d'échecs donné (hors verrouillage)
+func BackoffDelay(p BackoffPolicy, failures int64) time.Duration {
+	exponent := failures - int64(p.FreeAttempts) - 1
+	if exponent < 0 {
+		return 0
+	}
+	if exponent > 30 {
+		exponent = 30
+	}
+	delay := p.BaseDelay * time.Duration(1<<exponent)
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
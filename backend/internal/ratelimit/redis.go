@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore partage les compteurs entre plusieurs instances (Redis ou compatible : Valkey, KeyDB...)
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore crée un store Redis ; les clés sont préfixées par "ratelimit:"
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	k := s.prefix + "count:" + key
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, k)
+	pipe.ExpireNX(ctx, k, window) // N'allonge pas la fenêtre en cours
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	return s.client.Set(ctx, s.prefix+"lock:"+key, 1, d).Err()
+}
+
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.prefix+"lock:"+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil // -2 : clé absente, -1 : pas d'expiration (ne devrait pas arriver)
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+"count:"+key, s.prefix+"lock:"+key).Err()
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store conserve les compteurs et les verrous du limiteur.
+// Toutes les clés expirent d'elles-mêmes : aucune purge n'est nécessaire côté appelant.
+type Store interface {
+	// Incr incrémente le compteur et fixe son expiration à la première incrémentation
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Lock bloque la clé pendant la durée donnée
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor retourne le temps de blocage restant (0 si la clé n'est pas bloquée)
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset supprime compteur et verrou
+	Reset(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryStore est le store par défaut (un seul processus)
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryEntry
+	locks    map[string]time.Time
+	lastGC   time.Time
+}
+
+// NewMemoryStore crée un store en mémoire
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]memoryEntry),
+		locks:    make(map[string]time.Time),
+		lastGC:   time.Now(),
+	}
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.gc(now)
+
+	entry, ok := s.counters[key]
+	if !ok || now.After(entry.expiresAt) {
+		entry = memoryEntry{expiresAt: now.Add(window)}
+	}
+	entry.count++
+	s.counters[key] = entry
+	return entry.count, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = time.Now().Add(d)
+	return nil
+}
+
+func (s *MemoryStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	delete(s.locks, key)
+	return nil
+}
+
+// gc supprime les entrées expirées (au plus une fois par minute)
+func (s *MemoryStore) gc(now time.Time) {
+	if now.Sub(s.lastGC) < time.Minute {
+		return
+	}
+	s.lastGC = now
+	for k, e := range s.counters {
+		if now.After(e.expiresAt) {
+			delete(s.counters, k)
+		}
+	}
+	for k, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, k)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait = 10 * time.Second
+	// pongWait : sans pong (ni message) pendant ce délai, la connexion est considérée perdue
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// sessionCheckInterval : fréquence de revérification de la session (logout, révocation)
+	sessionCheckInterval = time.Minute
+	// maxClientMessage : taille maximale d'un message envoyé par le client
+	maxClientMessage = 4096
+	// sendBuffer : événements en attente d'envoi ; au-delà, le client est trop lent et déconnecté
+	sendBuffer = 64
+	// typingThrottle : un même état de saisie n'est pas relayé plus souvent
+	typingThrottle = 2 * time.Second
+)
+
+// clientMessage : message reçu du client
+type clientMessage struct {
+	Type   string `json:"type"`   // typing
+	To     uint   `json:"to"`     // Destinataire
+	Active *bool  `json:"active"` // typing : saisie en cours (true par défaut) ou arrêtée
+}
+
+// client : une WebSocket ouverte par un utilisateur
+type client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	userID    uint
+	sessionID string
+	out       chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	typing map[uint]typingState // Dernier état de saisie relayé, par destinataire (lecture seule dans readLoop)
+}
+
+type typingState struct {
+	active bool
+	at     time.Time
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, userID uint, sessionID string) *client {
+	return &client{
+		hub:       hub,
+		conn:      conn,
+		userID:    userID,
+		sessionID: sessionID,
+		out:       make(chan []byte, sendBuffer),
+		done:      make(chan struct{}),
+		typing:    map[uint]typingState{},
+	}
+}
+
+// push met un événement encodé en file d'envoi sans jamais bloquer le hub
+func (c *client) push(data []byte) {
+	select {
+	case c.out <- data:
+	default:
+		log.Printf("⚠️ Temps réel : client trop lent (utilisateur %d), connexion fermée", c.userID)
+		c.close()
+	}
+}
+
+func (c *client) send(ev Event) {
+	if data, err := json.Marshal(ev); err == nil {
+		c.push(data)
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// writeLoop envoie les événements et les pings, et ferme la connexion quand la session n'est plus valide
+func (c *client) writeLoop(sessionActive func(string) bool) {
+	ping := time.NewTicker(pingPeriod)
+	session := time.NewTicker(sessionCheckInterval)
+	defer func() {
+		ping.Stop()
+		session.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case data := <-c.out:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-session.C:
+			if !sessionActive(c.sessionID) {
+				c.writeClose(websocket.ClosePolicyViolation, "session revoked")
+				return
+			}
+		case <-c.done:
+			c.writeClose(websocket.CloseGoingAway, "")
+			return
+		}
+	}
+}
+
+func (c *client) writeClose(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+}
+
+// readLoop traite les messages du client jusqu'à la fermeture de la connexion
+func (c *client) readLoop(ctx context.Context) {
+	defer c.close()
+	c.conn.SetReadLimit(maxClientMessage)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("⚠️ Temps réel : connexion de l'utilisateur %d perdue : %v", c.userID, err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.sendError("message JSON invalide")
+			continue
+		}
+		switch msg.Type {
+		case TypeTyping:
+			c.relayTyping(ctx, msg)
+		default:
+			c.sendError("type de message inconnu : " + msg.Type)
+		}
+	}
+}
+
+// relayTyping transmet l'indicateur de saisie au destinataire, sans répéter le même état en rafale.
+// Il n'est relayé qu'aux contacts : ni demande de message en attente, ni blocage (ignoré sans erreur)
+func (c *client) relayTyping(ctx context.Context, msg clientMessage) {
+	if msg.To == 0 || msg.To == c.userID {
+		c.sendError("destinataire invalide")
+		return
+	}
+	active := msg.Active == nil || *msg.Active
+	now := time.Now()
+	if last, ok := c.typing[msg.To]; ok && last.active == active && now.Sub(last.at) < typingThrottle {
+		return
+	}
+	c.typing[msg.To] = typingState{active: active, at: now}
+	if !c.hub.isContact(c.userID, msg.To) {
+		return
+	}
+
+	ev, err := NewEvent(TypeTyping, c.userID, typingData{Active: active})
+	if err == nil {
+		err = c.hub.Publish(ctx, []uint{msg.To}, ev)
+	}
+	if err != nil {
+		log.Printf("⚠️ Temps réel : saisie de l'utilisateur %d non relayée : %v", c.userID, err)
+	}
+}
+
+func (c *client) sendError(message string) {
+	if ev, err := NewEvent(TypeError, 0, map[string]string{"error": message}); err == nil {
+		c.send(ev)
+	}
+}
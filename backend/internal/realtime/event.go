@@ -0,0 +1,63 @@
+package realtime
+
+import (
+	"encoding/json"
+)
+
+// Types d'événements poussés aux clients
+const (
+	TypeMessageCreated = "message.created" // Nouveau message (data : message.MessageDTO)
+	TypeMessageUpdated = "message.updated" // Message modifié (data : message.MessageDTO)
+	TypeMessageDeleted = "message.deleted" // Message supprimé (data : {"id", "conversation_id"})
+	TypeMessageRead    = "message.read"    // Accusé de lecture (data : {"conversation_id", "reader_id", "last_read_message_id", "read_at"}, "sender_id" en conversation privée)
+	TypeMessageRequest = "message.request" // Message d'un inconnu, dans les demandes de messages (data : message.MessageDTO)
+	TypePresence       = "presence"        // Connexion ou déconnexion d'un contact (data : {"online"})
+	TypeTyping         = "typing"          // Saisie en cours (data : {"active"})
+	TypeError          = "error"           // Message du client refusé (data : {"error"})
+
+	TypeConversationInvite  = "conversation.invite"  // Invitation à rejoindre un groupe (data : {"conversation_id", "title"})
+	TypeConversationUpdated = "conversation.updated" // Groupe renommé, membres ou rôles modifiés (data : {"conversation_id"})
+
+	// typePresenceSync : présence des utilisateurs connectés à une instance, jamais transmise aux clients
+	typePresenceSync = "presence.sync"
+)
+
+// Event : événement transmis tel quel (JSON) sur la WebSocket
+type Event struct {
+	Type string          `json:"type"`
+	From uint            `json:"from,omitempty"` // Utilisateur à l'origine de l'événement
+	Data json.RawMessage `json:"data,omitempty"`
+	// Data retiré car trop volumineux pour le transport (NOTIFY) : le client relit la conversation via l'API REST
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// NewEvent construit un événement dont data est encodé en JSON
+func NewEvent(eventType string, from uint, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: eventType, From: from, Data: raw}, nil
+}
+
+// Envelope : événement adressé à des utilisateurs, tel qu'il circule entre les instances
+type Envelope struct {
+	To       []uint `json:"to"`
+	Event    Event  `json:"event"`
+	Instance string `json:"instance"` // Instance émettrice (suivi de la présence)
+}
+
+// presenceData : data des événements TypePresence
+type presenceData struct {
+	Online bool `json:"online"`
+}
+
+// presenceSyncData : data des événements typePresenceSync
+type presenceSyncData struct {
+	Users []uint `json:"users"`
+}
+
+// typingData : data des événements TypeTyping
+type typingData struct {
+	Active bool `json:"active"`
+}
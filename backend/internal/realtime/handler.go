@@ -0,0 +1,99 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// bearerProtocol : sous-protocole portant le jeton d'accès (auth.WebSocketProtocol, non importé : auth dépend de message)
+const bearerProtocol = "bearer"
+
+// Handler : ouverture des WebSockets de l'API temps réel
+type Handler struct {
+	hub           *Hub
+	sessionActive func(sessionID string) bool
+	upgrader      websocket.Upgrader
+}
+
+// NewHandler instancie le gestionnaire ; sessionActive est revérifiée régulièrement (auth.IsSessionActive)
+// et les navigateurs ne sont acceptés que depuis les origines données (FRONTEND_URL…)
+func NewHandler(hub *Hub, sessionActive func(sessionID string) bool, allowedOrigins ...string) *Handler {
+	h := &Handler{hub: hub, sessionActive: sessionActive}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{bearerProtocol},
+		CheckOrigin:     checkOrigin(allowedOrigins),
+	}
+	return h
+}
+
+// RegisterRoutes monte /realtime (derrière auth.AuthMiddleware)
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/realtime", h.Connect)
+}
+
+// GET /realtime
+// Connect godoc
+// @Summary      Open the real-time WebSocket
+// @Description  Upgrades to a WebSocket pushing message.created, message.request, message.updated, message.deleted, message.read, conversation.invite, conversation.updated, presence and typing events as JSON {type, from, data}. Browsers pass the access token as sub-protocols: new WebSocket(url, ["bearer", token]). Clients send {"type": "typing", "to": userID, "active": true}, relayed to their contacts only.
+// @Tags         realtime
+// @Security     BearerAuth
+// @Success      101  "Switching Protocols"
+// @Failure      400  {object}  map[string]string "Not a WebSocket handshake"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Origin not allowed"
+// @Router       /api/realtime [get]
+func (h *Handler) Connect(c *gin.Context) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "WebSocket attendue"})
+		return
+	}
+	if !h.upgrader.CheckOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Origine non autorisée"})
+		return
+	}
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// La réponse d'erreur a déjà été écrite par l'upgrader
+		log.Printf("⚠️ Temps réel : ouverture de la WebSocket refusée : %v", err)
+		return
+	}
+
+	// La connexion survit à la requête : elle ne doit pas être annulée avec elle
+	ctx := context.Background()
+	cl := newClient(h.hub, conn, uint(c.GetInt("user_id")), c.GetString("session_id"))
+	go cl.writeLoop(h.sessionActive)
+	h.hub.register(ctx, cl)
+	cl.readLoop(ctx)
+	h.hub.unregister(ctx, cl)
+}
+
+// checkOrigin accepte les clients natifs (sans en-tête Origin), la même origine que l'API et les origines autorisées
+func checkOrigin(allowed []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, a := range allowed {
+			if a != "" && strings.EqualFold(strings.TrimRight(a, "/"), origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,274 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// presenceInterval : fréquence à laquelle chaque instance republie ses utilisateurs connectés
+	presenceInterval = 30 * time.Second
+	// presenceTTL : au-delà, un utilisateur vu sur une autre instance est considéré déconnecté (instance arrêtée)
+	presenceTTL = 75 * time.Second
+	// maxRecipients : destinataires par enveloppe, pour rester sous la limite de NOTIFY
+	maxRecipients = 500
+)
+
+// ContactsFunc retourne les utilisateurs prévenus de la présence de userID (ses correspondants)
+type ContactsFunc func(userID uint) ([]uint, error)
+
+// Hub remet les événements aux WebSockets de cette instance et suit la présence des utilisateurs
+// sur l'ensemble des instances
+type Hub struct {
+	pubsub   PubSub
+	contacts ContactsFunc
+	instance string
+
+	mu      sync.RWMutex
+	clients map[uint]map[*client]struct{} // Connexions locales par utilisateur
+	remote  map[uint]map[string]time.Time // Utilisateurs connectés aux autres instances (dernier signe de vie)
+}
+
+// NewHub crée le hub ; Run doit être lancé pour recevoir les événements
+func NewHub(pubsub PubSub, contacts ContactsFunc) *Hub {
+	return &Hub{
+		pubsub:   pubsub,
+		contacts: contacts,
+		instance: uuid.New().String(),
+		clients:  map[uint]map[*client]struct{}{},
+		remote:   map[uint]map[string]time.Time{},
+	}
+}
+
+// Run reçoit les événements de toutes les instances et publie régulièrement la présence locale, jusqu'à l'annulation de ctx.
+// Il ne retourne qu'une fois l'abonnement terminé.
+func (h *Hub) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := h.pubsub.Subscribe(ctx, h.deliver); err != nil {
+			log.Printf("❌ Temps réel : abonnement impossible : %v", err)
+		}
+	}()
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.syncPresence(ctx)
+		}
+	}
+}
+
+// Publish envoie un événement à toutes les connexions des destinataires, quelle que soit leur instance
+func (h *Hub) Publish(ctx context.Context, to []uint, ev Event) error {
+	for len(to) > maxRecipients {
+		if err := h.pubsub.Publish(ctx, Envelope{To: to[:maxRecipients], Event: ev, Instance: h.instance}); err != nil {
+			return err
+		}
+		to = to[maxRecipients:]
+	}
+	return h.pubsub.Publish(ctx, Envelope{To: to, Event: ev, Instance: h.instance})
+}
+
+// Online indique si l'utilisateur a au moins une connexion ouverte, sur cette instance ou une autre
+func (h *Hub) Online(userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.onlineLocked(userID, time.Now())
+}
+
+func (h *Hub) onlineLocked(userID uint, now time.Time) bool {
+	if len(h.clients[userID]) > 0 {
+		return true
+	}
+	for _, seen := range h.remote[userID] {
+		if now.Sub(seen) < presenceTTL {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver remet une enveloppe aux connexions locales des destinataires
+func (h *Hub) deliver(env Envelope) {
+	switch env.Event.Type {
+	case typePresenceSync:
+		h.trackSync(env)
+		return
+	case TypePresence:
+		h.trackPresence(env)
+	}
+
+	data, err := json.Marshal(env.Event)
+	if err != nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, userID := range env.To {
+		for c := range h.clients[userID] {
+			c.push(data)
+		}
+	}
+}
+
+// trackPresence met à jour la présence vue sur une autre instance
+func (h *Hub) trackPresence(env Envelope) {
+	if env.Instance == h.instance {
+		return
+	}
+	var data presenceData
+	if err := json.Unmarshal(env.Event.Data, &data); err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if data.Online {
+		h.seenLocked(env.Event.From, env.Instance, time.Now())
+	} else if instances := h.remote[env.Event.From]; instances != nil {
+		delete(instances, env.Instance)
+		if len(instances) == 0 {
+			delete(h.remote, env.Event.From)
+		}
+	}
+}
+
+// trackSync enregistre les utilisateurs connectés à une autre instance et oublie ceux qui n'ont plus donné signe de vie
+func (h *Hub) trackSync(env Envelope) {
+	if env.Instance == h.instance {
+		return
+	}
+	var data presenceSyncData
+	if err := json.Unmarshal(env.Event.Data, &data); err != nil {
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range data.Users {
+		h.seenLocked(userID, env.Instance, now)
+	}
+	for userID, instances := range h.remote {
+		for instance, seen := range instances {
+			if now.Sub(seen) >= presenceTTL {
+				delete(instances, instance)
+			}
+		}
+		if len(instances) == 0 {
+			delete(h.remote, userID)
+		}
+	}
+}
+
+func (h *Hub) seenLocked(userID uint, instance string, now time.Time) {
+	if h.remote[userID] == nil {
+		h.remote[userID] = map[string]time.Time{}
+	}
+	h.remote[userID][instance] = now
+}
+
+// syncPresence republie les utilisateurs connectés à cette instance (signe de vie pour les autres)
+func (h *Hub) syncPresence(ctx context.Context) {
+	h.mu.RLock()
+	users := make([]uint, 0, len(h.clients))
+	for userID := range h.clients {
+		users = append(users, userID)
+	}
+	h.mu.RUnlock()
+
+	for len(users) > 0 {
+		n := min(len(users), maxRecipients)
+		ev, err := NewEvent(typePresenceSync, 0, presenceSyncData{Users: users[:n]})
+		if err == nil {
+			err = h.pubsub.Publish(ctx, Envelope{Event: ev, Instance: h.instance})
+		}
+		if err != nil {
+			log.Printf("⚠️ Temps réel : présence non publiée : %v", err)
+			return
+		}
+		users = users[n:]
+	}
+}
+
+// register ajoute une connexion ; à la première connexion de l'utilisateur, ses contacts sont prévenus.
+// Le client reçoit l'état des contacts déjà connectés.
+func (h *Hub) register(ctx context.Context, c *client) {
+	h.mu.Lock()
+	first := len(h.clients[c.userID]) == 0
+	if first {
+		h.clients[c.userID] = map[*client]struct{}{}
+	}
+	h.clients[c.userID][c] = struct{}{}
+	h.mu.Unlock()
+
+	contacts, err := h.contacts(c.userID)
+	if err != nil {
+		log.Printf("⚠️ Temps réel : contacts de l'utilisateur %d introuvables : %v", c.userID, err)
+	}
+	for _, contactID := range contacts {
+		if h.Online(contactID) {
+			if ev, err := NewEvent(TypePresence, contactID, presenceData{Online: true}); err == nil {
+				c.send(ev)
+			}
+		}
+	}
+	if first {
+		h.publishPresence(ctx, c.userID, contacts, true)
+	}
+}
+
+// isContact indique si otherID fait partie des contacts de userID (conversation privée acceptée, sans blocage)
+func (h *Hub) isContact(userID, otherID uint) bool {
+	contacts, err := h.contacts(userID)
+	if err != nil {
+		log.Printf("⚠️ Temps réel : contacts de l'utilisateur %d introuvables : %v", userID, err)
+		return false
+	}
+	return slices.Contains(contacts, otherID)
+}
+
+// unregister retire une connexion ; si l'utilisateur n'est plus connecté nulle part, ses contacts sont prévenus
+func (h *Hub) unregister(ctx context.Context, c *client) {
+	h.mu.Lock()
+	delete(h.clients[c.userID], c)
+	last := len(h.clients[c.userID]) == 0
+	if last {
+		delete(h.clients, c.userID)
+	}
+	h.mu.Unlock()
+	if !last {
+		return
+	}
+
+	contacts, err := h.contacts(c.userID)
+	if err != nil {
+		log.Printf("⚠️ Temps réel : contacts de l'utilisateur %d introuvables : %v", c.userID, err)
+	}
+	if h.Online(c.userID) {
+		// Toujours connecté sur une autre instance : seules les instances sont prévenues
+		contacts = nil
+	}
+	h.publishPresence(ctx, c.userID, contacts, false)
+}
+
+// publishPresence prévient les contacts ; l'enveloppe est publiée même sans contact pour que les autres instances suivent la présence
+func (h *Hub) publishPresence(ctx context.Context, userID uint, contacts []uint, online bool) {
+	ev, err := NewEvent(TypePresence, userID, presenceData{Online: online})
+	if err == nil {
+		err = h.Publish(ctx, contacts, ev)
+	}
+	if err != nil {
+		log.Printf("⚠️ Temps réel : présence de l'utilisateur %d non publiée : %v", userID, err)
+	}
+}
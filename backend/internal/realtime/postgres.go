@@ -0,0 +1,109 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	// notifyChannel : canal LISTEN/NOTIFY partagé par toutes les instances
+	notifyChannel = "realtime"
+	// maxNotifyPayload : NOTIFY refuse les payloads de 8000 octets ou plus
+	maxNotifyPayload = 7900
+)
+
+// Postgres relaie les événements entre instances par LISTEN/NOTIFY, sans autre infrastructure que la base.
+// Les notifications émises pendant une reconnexion sont perdues : les clients se resynchronisent via l'API REST.
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres crée un PubSub sur la base de l'API ; l'écoute occupe une connexion du pool
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Publish(ctx context.Context, env Envelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	if len(payload) >= maxNotifyPayload {
+		// Message trop long pour NOTIFY : le client est prévenu et relit la conversation
+		env.Event.Data = nil
+		env.Event.Truncated = true
+		if payload, err = json.Marshal(env); err != nil {
+			return err
+		}
+		if len(payload) >= maxNotifyPayload {
+			return fmt.Errorf("événement %s trop volumineux pour NOTIFY (%d destinataires)", env.Event.Type, len(env.To))
+		}
+	}
+	_, err = p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", notifyChannel, string(payload))
+	return err
+}
+
+// Subscribe écoute le canal et se reconnecte (délai croissant, plafonné à 30 s) si la connexion est perdue
+func (p *Postgres) Subscribe(ctx context.Context, deliver func(Envelope)) error {
+	delay := time.Second
+	for {
+		err := p.listen(ctx, deliver, func() { delay = time.Second })
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("⚠️ Écoute LISTEN %s interrompue : %v (nouvel essai dans %s)", notifyChannel, err, delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// listen réserve une connexion du pool et remet chaque notification reçue ; connected est appelé une fois l'écoute établie
+func (p *Postgres) listen(ctx context.Context, deliver func(Envelope), connected func()) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("LISTEN nécessite le driver pgx")
+		}
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return err
+		}
+		connected()
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					return err
+				}
+				// Arrêt : la connexion rendue au pool ne doit plus écouter
+				if !pgConn.IsClosed() {
+					_, _ = pgConn.Exec(context.Background(), "UNLISTEN *")
+				}
+				return nil
+			}
+			var env Envelope
+			if err := json.Unmarshal([]byte(n.Payload), &env); err != nil {
+				log.Printf("⚠️ Notification %s illisible : %v", notifyChannel, err)
+				continue
+			}
+			deliver(env)
+		}
+	})
+}
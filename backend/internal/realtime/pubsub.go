@@ -0,0 +1,51 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+)
+
+// PubSub transporte les événements entre les instances de l'API : chaque instance reçoit toutes les enveloppes
+// publiées et les remet aux WebSockets qu'elle héberge
+type PubSub interface {
+	// Publish diffuse l'enveloppe à toutes les instances (y compris l'émettrice)
+	Publish(ctx context.Context, env Envelope) error
+	// Subscribe appelle deliver pour chaque enveloppe reçue, jusqu'à l'annulation de ctx
+	Subscribe(ctx context.Context, deliver func(Envelope)) error
+}
+
+// Local est le PubSub par défaut (un seul processus)
+type Local struct {
+	mu   sync.RWMutex
+	subs map[int]func(Envelope)
+	next int
+}
+
+// NewLocal crée un PubSub en mémoire
+func NewLocal() *Local {
+	return &Local{subs: map[int]func(Envelope){}}
+}
+
+func (l *Local) Publish(_ context.Context, env Envelope) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, deliver := range l.subs {
+		deliver(env)
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(ctx context.Context, deliver func(Envelope)) error {
+	l.mu.Lock()
+	id := l.next
+	l.next++
+	l.subs[id] = deliver
+	l.mu.Unlock()
+
+	<-ctx.Done()
+
+	l.mu.Lock()
+	delete(l.subs, id)
+	l.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"backend/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound   = errors.New("objet introuvable")
+	ErrInvalidKey = errors.New("clé de stockage invalide")
+)
+
+// ObjectInfo décrit un objet stocké
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Blob est un stockage d'objets adressés par clé (ex: "images/user_1_...jpg").
+// Les clés utilisent toujours des "/" et ne commencent jamais par "/".
+type Blob interface {
+	// Put écrit le contenu de r sous la clé et retourne le nombre d'octets écrits (size = -1 si inconnue)
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete supprime l'objet ; supprimer une clé absente n'est pas une erreur
+	Delete(ctx context.Context, key string) error
+	// Rename déplace un objet (dst est remplacé s'il existe)
+	Rename(ctx context.Context, src, dst string) error
+	// SignedURL retourne une URL de lecture valable ttl
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// List appelle fn pour chaque objet dont la clé commence par prefix
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// New instancie le driver configuré (STORAGE_DRIVER). publicBaseURL sert aux URLs signées du driver local.
+func New(cfg config.StorageConfig, publicBaseURL string) (Blob, error) {
+	switch cfg.Driver {
+	case "s3":
+		return NewS3(cfg.S3)
+	case "local", "":
+		return NewLocal(cfg.LocalDir, publicBaseURL, []byte(cfg.SigningSecret))
+	default:
+		return nil, fmt.Errorf("driver de stockage inconnu : %q", cfg.Driver)
+	}
+}
+
+// ValidateKey refuse les clés absolues ou qui remontent l'arborescence
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	if path.Clean(key) != key {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// PutHashed écrit r sous une clé temporaire (staging/) en calculant son SHA-256 (hex) au fil de l'écriture.
+// L'objet est ensuite rangé sous sa clé définitive par Promote, ou supprimé.
+func PutHashed(ctx context.Context, b Blob, r io.Reader, size int64, contentType string) (tmpKey, sum string, n int64, err error) {
+	tmpKey = "staging/" + uuid.New().String()
+	hash := sha256.New()
+	n, err = b.Put(ctx, tmpKey, io.TeeReader(r, hash), size, contentType)
+	if err != nil {
+		b.Delete(ctx, tmpKey)
+		return "", "", 0, err
+	}
+	return tmpKey, hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// Promote range un objet temporaire sous sa clé adressée par le contenu ; si cette clé existe déjà,
+// le contenu est identique et le temporaire est simplement supprimé
+func Promote(ctx context.Context, b Blob, tmpKey, key string) error {
+	if _, err := b.Stat(ctx, key); err == nil {
+		return b.Delete(ctx, tmpKey)
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return b.Rename(ctx, tmpKey, key)
+}
+
+// DeletePrefix supprime tous les objets sous un préfixe (ex: dossier HLS d'une vidéo)
+func DeletePrefix(ctx context.Context, b Blob, prefix string) error {
+	var keys []string
+	err := b.List(ctx, prefix, func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := b.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalURLPrefix est le chemin sous lequel le driver local sert ses URLs signées
+const LocalURLPrefix = "/files/"
+
+// tmpSuffix marque les fichiers en cours d'écriture (ignorés par List)
+const tmpSuffix = ".part"
+
+// Local stocke les objets sur le disque ; les URLs signées (HMAC) sont servies par ServeHTTP
+type Local struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocal prépare le dossier racine et vérifie qu'il est accessible en écriture
+func NewLocal(root, baseURL string, secret []byte) (*Local, error) {
+	if root == "" {
+		return nil, errors.New("dossier de stockage local non configuré")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("secret de signature des URLs non configuré")
+	}
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return nil, fmt.Errorf("impossible de créer le dossier %s : %v", root, err)
+	}
+
+	// Vérifier si on peut écrire dans le dossier
+	testFile := filepath.Join(root, "test_write_permission.tmp")
+	f, err := os.Create(testFile)
+	if err != nil {
+		return nil, fmt.Errorf("impossible d'écrire dans le dossier %s : %v", root, err)
+	}
+	f.Close()
+	os.Remove(testFile)
+	log.Printf("📁 Stockage local : %s", root)
+
+	return &Local{root: root, baseURL: strings.TrimRight(baseURL, "/"), secret: secret}, nil
+}
+
+// path retourne le chemin disque d'une clé
+func (l *Local) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return 0, err
+	}
+
+	// Écriture dans un fichier temporaire puis renommage : un lecteur ne voit jamais un fichier partiel
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*"+tmpSuffix)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("taille écrite (%d) différente de la taille attendue (%d)", written, size)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return written, nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return localInfo(key, info), nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Rename(ctx context.Context, src, dst string) error {
+	from, err := l.path(src)
+	if err != nil {
+		return err
+	}
+	to, err := l.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SignedURL retourne {baseURL}/files/{key}?expires=...&sig=...
+func (l *Local) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("sig", l.sign(key, expires))
+	return l.baseURL + LocalURLPrefix + (&url.URL{Path: key}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+func (l *Local) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	dir := l.root
+	if p := strings.TrimSuffix(prefix, "/"); p != "" {
+		var err error
+		if dir, err = l.path(p); err != nil {
+			return err
+		}
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, tmpSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(localInfo(key, info))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP sert un objet à partir d'une URL signée non expirée (requêtes Range supportées)
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LocalURLPrefix)
+	expires := r.URL.Query().Get("expires")
+	sig := r.URL.Query().Get("sig")
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp || !hmac.Equal([]byte(sig), []byte(l.sign(key, expires))) {
+		http.Error(w, "lien invalide ou expiré", http.StatusForbidden)
+		return
+	}
+
+	p, err := l.path(key)
+	if err != nil {
+		http.Error(w, "lien invalide", http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(max(exp-time.Now().Unix(), 0), 10))
+	http.ServeContent(w, r, path.Base(key), info.ModTime(), f)
+}
+
+func localInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     info.ModTime(),
+	}
+}
@@ -5,19 +5,33 @@ import (
 	"strconv"
 	"time"
 
-	"backend/internal/db"
+	"backend/internal/config"
 	"backend/internal/models"
+	"backend/internal/user"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// Handler structure
+type Handler struct {
+	db     *gorm.DB
+	users  user.UserRepository
+	stripe config.StripeConfig
+}
+
+// NewHandler instancie les handlers d'abonnement (gratuit et payant via Stripe)
+func NewHandler(db *gorm.DB, users user.UserRepository, stripeCfg config.StripeConfig) *Handler {
+	return &Handler{db: db, users: users, stripe: stripeCfg}
+}
+
 // SubscriptionInput pour la requête
 type SubscriptionInput struct {
 	CreatorID uint   `json:"creator_id" binding:"required"`
 	Type      string `json:"type" binding:"required,oneof=paid free"`
 }
 
-// SubscribeHandler godoc
+// Subscribe godoc
 // @Summary S’abonner à un créateur (payant ou gratuit)
 // @Tags Subscription
 // @Accept json
@@ -28,7 +42,7 @@ type SubscriptionInput struct {
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/subscribe [post]
-func SubscribeHandler(c *gin.Context) {
+func (h *Handler) Subscribe(c *gin.Context) {
 	var input SubscriptionInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Entrée invalide"})
@@ -42,7 +56,7 @@ func SubscribeHandler(c *gin.Context) {
 	}
 
 	var existing models.Subscription
-	err := db.GormDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, input.CreatorID).First(&existing).Error
+	err := h.db.Where("subscriber_id = ? AND creator_id = ?", subscriberID, input.CreatorID).First(&existing).Error
 
 	// Si déjà abonné
 	if err == nil {
@@ -62,7 +76,7 @@ func SubscribeHandler(c *gin.Context) {
 			} else {
 				existing.EndDate = time.Time{}
 			}
-			if err := db.GormDB.Save(&existing).Error; err != nil {
+			if err := h.db.Save(&existing).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour de l'abonnement"})
 				return
 			}
@@ -82,7 +96,7 @@ func SubscribeHandler(c *gin.Context) {
 			existing.StartDate = now
 			existing.EndDate = now.AddDate(0, 1, 0)
 			existing.IsActive = true
-			if err := db.GormDB.Save(&existing).Error; err != nil {
+			if err := h.db.Save(&existing).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du renouvellement"})
 				return
 			}
@@ -103,14 +117,14 @@ func SubscribeHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Pour un abonnement payant, utilisez /api/subscribe/paid"})
 		return
 	}
-	if err := db.GormDB.Create(&sub).Error; err != nil {
+	if err := h.db.Create(&sub).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'abonnement"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Abonnement réussi", "subscription": sub})
 }
 
-// UnsubscribeHandler godoc
+// Unsubscribe godoc
 // @Summary Se désabonner d’un créateur
 // @Tags Subscription
 // @Security BearerAuth
@@ -119,7 +133,7 @@ func SubscribeHandler(c *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /api/unsubscribe [post]
-func UnsubscribeHandler(c *gin.Context) {
+func (h *Handler) Unsubscribe(c *gin.Context) {
 	creatorID, err := strconv.Atoi(c.Query("creator_id"))
 	if err != nil || creatorID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "creator_id invalide"})
@@ -128,14 +142,14 @@ func UnsubscribeHandler(c *gin.Context) {
 
 	subscriberID := c.GetInt("user_id")
 	var sub models.Subscription
-	if err := db.GormDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).First(&sub).Error; err != nil {
+	if err := h.db.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).First(&sub).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Abonnement non trouvé"})
 		return
 	}
 
 	// Désactive l'abonnement (soft delete)
 	sub.IsActive = false
-	if err := db.GormDB.Save(&sub).Error; err != nil {
+	if err := h.db.Save(&sub).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors du désabonnement"})
 		return
 	}
@@ -143,16 +157,16 @@ func UnsubscribeHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Désabonnement réussi"})
 }
 
-// GetFollowersHandler godoc
+// GetFollowers godoc
 // @Summary Récupère tous les followers de l'utilisateur connecté
 // @Tags Subscription
 // @Security BearerAuth
 // @Success 200 {array} uint
 // @Router /api/followers [get]
-func GetFollowersHandler(c *gin.Context) {
+func (h *Handler) GetFollowers(c *gin.Context) {
 	userID := c.GetInt("user_id")
 	var followers []models.Subscription
-	if err := db.GormDB.Where("creator_id = ? AND is_active = ?", userID, true).Find(&followers).Error; err != nil {
+	if err := h.db.Where("creator_id = ? AND is_active = ?", userID, true).Find(&followers).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Erreur lors de la récupération"})
 		return
 	}
@@ -166,21 +180,21 @@ func GetFollowersHandler(c *gin.Context) {
 	c.JSON(200, gin.H{"followers": followerIDs})
 }
 
-// GetFollowersByUserHandler godoc
+// GetFollowersByUser godoc
 // @Summary Récupère tous les followers d’un utilisateur par son ID, avec tag paid/free
 // @Tags Subscription
 // @Security BearerAuth
 // @Param id path int true "ID du créateur"
 // @Success 200 {object} map[string][]map[string]interface{}
 // @Router /api/followers/{id} [get]
-func GetFollowersByUserHandler(c *gin.Context) {
+func (h *Handler) GetFollowersByUser(c *gin.Context) {
 	creatorID, err := strconv.Atoi(c.Param("id"))
 	if err != nil || creatorID <= 0 {
 		c.JSON(400, gin.H{"error": "ID invalide"})
 		return
 	}
 	var followers []models.Subscription
-	if err := db.GormDB.Where("creator_id = ? AND is_active = ?", creatorID, true).Find(&followers).Error; err != nil {
+	if err := h.db.Where("creator_id = ? AND is_active = ?", creatorID, true).Find(&followers).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Erreur lors de la récupération"})
 		return
 	}
@@ -206,16 +220,16 @@ func GetFollowersByUserHandler(c *gin.Context) {
 	})
 }
 
-// GetMySubscriptionsHandler godoc
+// GetMySubscriptions godoc
 // @Summary Récupère la liste des utilisateurs suivis par l'utilisateur connecté (avec tag paid/free)
 // @Tags Subscription
 // @Security BearerAuth
 // @Success 200 {object} map[string][]map[string]interface{}
 // @Router /api/subscriptions [get]
-func GetMySubscriptionsHandler(c *gin.Context) {
+func (h *Handler) GetMySubscriptions(c *gin.Context) {
 	userID := c.GetInt("user_id")
 	var subs []models.Subscription
-	if err := db.GormDB.Where("subscriber_id = ? AND is_active = ?", userID, true).Find(&subs).Error; err != nil {
+	if err := h.db.Where("subscriber_id = ? AND is_active = ?", userID, true).Find(&subs).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Erreur lors de la récupération"})
 		return
 	}
@@ -2,9 +2,7 @@ package subscription
 
 import (
 	"backend/internal/payment"
-	"backend/internal/user"
 	"net/http"
-	"os"
 	"strconv"
 
 	"log"
@@ -12,7 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// SubscribePaidStripeHandler godoc
+// SubscribePaidStripe godoc
 // @Summary Crée une session Stripe pour l’abonnement payant
 // @Tags Subscription
 // @Accept json
@@ -23,8 +21,8 @@ import (
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/subscribe/paid [post]
-// SubscribePaidStripeHandler : Crée une session Stripe pour l'abonnement mensuel
-func SubscribePaidStripeHandler(c *gin.Context) {
+// SubscribePaidStripe : Crée une session Stripe pour l'abonnement mensuel
+func (h *Handler) SubscribePaidStripe(c *gin.Context) {
 	var input SubscriptionInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Entrée invalide"})
@@ -37,7 +35,7 @@ func SubscribePaidStripeHandler(c *gin.Context) {
 		return
 	}
 
-	creator, err := user.GetUserByID(input.CreatorID)
+	creator, err := h.users.GetByID(input.CreatorID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Créateur introuvable"})
 		return
@@ -50,15 +48,15 @@ func SubscribePaidStripeHandler(c *gin.Context) {
 
 	log.Printf("[STRIPE] Création session Stripe: subscriberID=%d, creatorID=%d, price=%.2f", subscriberID, input.CreatorID, creator.MonthlyPrice)
 
-	subscriber, err := user.GetUserByID(uint(subscriberID))
+	subscriber, err := h.users.GetByID(uint(subscriberID))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Abonné introuvable"})
 		return
 	}
 	customerEmail := subscriber.Email
 
-	successURL := os.Getenv("STRIPE_SUCCESS_URL")
-	cancelURL := os.Getenv("STRIPE_CANCEL_URL")
+	successURL := h.stripe.SuccessURL
+	cancelURL := h.stripe.CancelURL
 
 	metadata := map[string]string{
 		"creator_id":    strconv.Itoa(int(input.CreatorID)),
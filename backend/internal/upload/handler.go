@@ -0,0 +1,203 @@
+package upload
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler structure
+type Handler struct {
+	service Service
+}
+
+// NewHandler instancie un gestionnaire de route
+func NewHandler(s Service) *Handler {
+	return &Handler{service: s}
+}
+
+// RegisterRoutes monte le protocole d'upload reprenable :
+// POST /uploads → PATCH /uploads/:id (Upload-Offset) … → POST /uploads/:id/complete → media_id
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, middlewares ...gin.HandlerFunc) {
+	uploads := rg.Group("/uploads", middlewares...)
+	uploads.POST("", h.Init)
+	uploads.GET("/:id", h.Status)
+	uploads.HEAD("/:id", h.Status)
+	uploads.PATCH("/:id", h.AppendChunk)
+	uploads.POST("/:id/complete", h.Complete)
+	uploads.DELETE("/:id", h.Abort)
+}
+
+// POST /uploads
+// Init godoc
+// @Summary      Start a resumable upload
+// @Description  Declares a file (name, total size, optional SHA-256) and returns an upload ID; chunks are then sent with PATCH
+// @Tags         uploads
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      upload.InitInput  true  "File to upload"
+// @Success      201   {object}  upload.UploadDTO
+// @Failure      400   {object}  map[string]string "Invalid file, size or checksum"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Router       /api/uploads [post]
+func (h *Handler) Init(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	var input InitInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides"})
+		return
+	}
+	dto, err := h.service.Init(uint(userID), input)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Header("Location", "/api/uploads/"+dto.ID)
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, dto)
+}
+
+// GET /uploads/:id
+// Status godoc
+// @Summary      Get upload state
+// @Description  Returns the current offset so an interrupted upload can resume (also exposed as the Upload-Offset header, HEAD supported)
+// @Tags         uploads
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      string  true  "Upload ID"
+// @Success      200  {object}  upload.UploadDTO
+// @Failure      404  {object}  map[string]string "Upload not found"
+// @Router       /api/uploads/{id} [get]
+func (h *Handler) Status(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	dto, err := h.service.Get(uint(userID), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(dto.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(dto.Size, 10))
+	c.Header("Cache-Control", "no-store")
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, dto)
+}
+
+// PATCH /uploads/:id
+// AppendChunk godoc
+// @Summary      Send a chunk
+// @Description  Appends the raw request body at Upload-Offset (max 16 MB per chunk, Content-Length required). On 409 the client resumes from the returned Upload-Offset.
+// @Tags         uploads
+// @Security     BearerAuth
+// @Accept       application/offset+octet-stream
+// @Param        id             path    string  true  "Upload ID"
+// @Param        Upload-Offset  header  int     true  "Offset of the first byte of the chunk"
+// @Success      204
+// @Failure      404  {object}  map[string]string "Upload not found"
+// @Failure      409  {object}  map[string]string "Offset mismatch (current offset in Upload-Offset)"
+// @Failure      410  {object}  map[string]string "Upload expired"
+// @Failure      413  {object}  map[string]string "Chunk too large"
+// @Router       /api/uploads/{id} [patch]
+func (h *Handler) AppendChunk(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "En-tête Upload-Offset invalide"})
+		return
+	}
+	if c.Request.ContentLength <= 0 {
+		c.JSON(http.StatusLengthRequired, gin.H{"error": "Content-Length obligatoire"})
+		return
+	}
+	if c.Request.ContentLength > MaxChunkSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrChunkTooLarge.Error()})
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, MaxChunkSize)
+
+	newOffset, err := h.service.AppendChunk(c.Request.Context(), uint(userID), c.Param("id"), offset, body, c.Request.ContentLength)
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /uploads/:id/complete
+// Complete godoc
+// @Summary      Complete an upload
+// @Description  Assembles the chunks, verifies the SHA-256 checksum and creates a media; pass its media_id to POST /api/posts
+// @Tags         uploads
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string                true   "Upload ID"
+// @Param        body  body      upload.CompleteInput  false  "Checksum (if not given at init)"
+// @Success      201   {object}  upload.UploadDTO
+// @Failure      400   {object}  map[string]string "Missing or invalid checksum"
+// @Failure      409   {object}  map[string]string "Upload incomplete"
+// @Failure      422   {object}  map[string]string "Checksum mismatch"
+// @Router       /api/uploads/{id}/complete [post]
+func (h *Handler) Complete(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	var input CompleteInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides"})
+			return
+		}
+	}
+	dto, err := h.service.Complete(c.Request.Context(), uint(userID), c.Param("id"), input)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, dto)
+}
+
+// DELETE /uploads/:id
+// Abort godoc
+// @Summary      Abort an upload
+// @Description  Deletes an unfinished upload and its chunks
+// @Tags         uploads
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Upload ID"
+// @Success      204
+// @Failure      404  {object}  map[string]string "Upload not found"
+// @Failure      409  {object}  map[string]string "Upload already completed"
+// @Router       /api/uploads/{id} [delete]
+func (h *Handler) Abort(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if err := h.service.Abort(c.Request.Context(), uint(userID), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondError traduit les erreurs du service en statut HTTP
+func respondError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := "Erreur lors de l'upload"
+	switch {
+	case errors.Is(err, ErrUploadNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, ErrOffsetConflict), errors.Is(err, ErrUploadIncomplete), errors.Is(err, ErrUploadCompleted):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, ErrUploadExpired):
+		status, message = http.StatusGone, err.Error()
+	case errors.Is(err, ErrChunkTooLarge):
+		status, message = http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, ErrChecksumMismatch):
+		status, message = http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, ErrInvalidUploadSpec), errors.Is(err, ErrInvalidChecksum), errors.Is(err, ErrChecksumRequired):
+		status, message = http.StatusBadRequest, err.Error()
+	}
+	c.JSON(status, gin.H{"error": message})
+}
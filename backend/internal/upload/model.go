@@ -0,0 +1,78 @@
+package upload
+
+import "time"
+
+// Statuts d'un upload fragmenté
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+)
+
+// Upload : fichier envoyé en plusieurs fragments (PATCH successifs) puis assemblé en média
+type Upload struct {
+	ID          string `gorm:"type:uuid;primaryKey"`
+	UserID      uint   `gorm:"not null;index"`
+	FileName    string `gorm:"not null"`
+	ContentType string
+	MediaType   string `gorm:"not null"` // image, video ou document
+	Size        int64  `gorm:"not null"` // Taille totale annoncée à l'initialisation
+	Received    int64  `gorm:"not null;default:0"`
+	Checksum    string // SHA-256 (hex) attendu, fourni à l'initialisation ou à la complétion
+	Status      string `gorm:"not null;default:'pending'"`
+	MediaID     *uint
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Chunk : fragment reçu, stocké sous sa propre clé jusqu'à l'assemblage
+type Chunk struct {
+	UploadID   string `gorm:"type:uuid;primaryKey"`
+	Position   int64  `gorm:"primaryKey"` // Offset du premier octet du fragment
+	Size       int64  `gorm:"not null"`
+	StorageKey string `gorm:"not null"`
+}
+
+func (Chunk) TableName() string {
+	return "upload_chunks"
+}
+
+// InitInput : corps de POST /api/uploads
+type InitInput struct {
+	FileName    string `json:"filename" binding:"required"`
+	Size        int64  `json:"size" binding:"required,gt=0"`
+	ContentType string `json:"content_type"`
+	Checksum    string `json:"checksum"` // SHA-256 (hex), optionnel ici
+}
+
+// CompleteInput : corps de POST /api/uploads/:id/complete
+type CompleteInput struct {
+	Checksum string `json:"checksum"` // SHA-256 (hex), obligatoire s'il n'a pas été fourni à l'initialisation
+}
+
+// UploadDTO : état d'un upload renvoyé au client
+type UploadDTO struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"filename"`
+	MediaType string    `json:"media_type"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Status    string    `json:"status"`
+	MediaID   *uint     `json:"media_id,omitempty"`
+	ChunkSize int64     `json:"max_chunk_size"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func toDTO(u *Upload) *UploadDTO {
+	return &UploadDTO{
+		ID:        u.ID,
+		FileName:  u.FileName,
+		MediaType: u.MediaType,
+		Size:      u.Size,
+		Offset:    u.Received,
+		Status:    u.Status,
+		MediaID:   u.MediaID,
+		ChunkSize: MaxChunkSize,
+		ExpiresAt: u.ExpiresAt,
+	}
+}
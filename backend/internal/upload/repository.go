@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"backend/internal/media"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUploadNotFound = errors.New("upload introuvable")
+	// ErrOffsetConflict : un autre fragment a été reçu entre-temps pour cette position
+	ErrOffsetConflict = errors.New("offset de fragment en conflit")
+)
+
+type Repository interface {
+	Create(u *Upload) error
+	GetByID(id string) (*Upload, error)
+	// AppendChunk enregistre un fragment et avance Received si l'offset est toujours celui attendu
+	AppendChunk(u *Upload, chunk *Chunk) error
+	ListChunks(uploadID string) ([]Chunk, error)
+	// Complete crée le média assemblé et marque l'upload terminé (expiresAt : délai pour le rattacher à un post)
+	Complete(u *Upload, m *media.Media, expiresAt time.Time) error
+	Delete(id string) error
+	ListExpired(now time.Time, limit int) ([]Upload, error)
+	// DeleteUnattachedMedia supprime un média jamais rattaché à un post (sans effet s'il l'a été)
+	// et planifie l'effacement de son fichier
+	DeleteUnattachedMedia(mediaID uint) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Create(u *Upload) error {
+	return r.db.Create(u).Error
+}
+
+func (r *repository) GetByID(id string) (*Upload, error) {
+	var u Upload
+	err := r.db.First(&u, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *repository) AppendChunk(u *Upload, chunk *Chunk) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Upload{}).
+			Where("id = ? AND received = ? AND status = ? AND expires_at > ?", u.ID, chunk.Position, StatusPending, time.Now()).
+			Updates(map[string]interface{}{"received": chunk.Position + chunk.Size, "updated_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOffsetConflict
+		}
+		res = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(chunk)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOffsetConflict
+		}
+		u.Received = chunk.Position + chunk.Size
+		return nil
+	})
+}
+
+func (r *repository) ListChunks(uploadID string) ([]Chunk, error) {
+	var chunks []Chunk
+	err := r.db.Where("upload_id = ?", uploadID).Order("position ASC").Find(&chunks).Error
+	return chunks, err
+}
+
+func (r *repository) Complete(u *Upload, m *media.Media, expiresAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&Upload{}).
+			Where("id = ? AND status = ?", u.ID, StatusPending).
+			Updates(map[string]interface{}{
+				"status":     StatusCompleted,
+				"media_id":   m.ID,
+				"checksum":   u.Checksum,
+				"expires_at": expiresAt,
+				"updated_at": time.Now(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOffsetConflict
+		}
+		if err := tx.Where("upload_id = ?", u.ID).Delete(&Chunk{}).Error; err != nil {
+			return err
+		}
+		u.Status = StatusCompleted
+		u.MediaID = &m.ID
+		u.ExpiresAt = expiresAt
+		return nil
+	})
+}
+
+func (r *repository) Delete(id string) error {
+	return r.db.Delete(&Upload{}, "id = ?", id).Error
+}
+
+func (r *repository) ListExpired(now time.Time, limit int) ([]Upload, error) {
+	var uploads []Upload
+	err := r.db.Where("expires_at < ?", now).Order("expires_at ASC").Limit(limit).Find(&uploads).Error
+	return uploads, err
+}
+
+func (r *repository) DeleteUnattachedMedia(mediaID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var deleted []media.Media
+		res := tx.Clauses(clause.Returning{}).
+			Where("id = ? AND (post_id IS NULL OR post_id = 0)", mediaID).
+			Delete(&deleted)
+		if res.Error != nil {
+			return res.Error
+		}
+		return media.EnqueueReleaseTx(tx, deleted...)
+	})
+}
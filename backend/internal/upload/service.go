@@ -0,0 +1,356 @@
+package upload
+
+import (
+	"backend/internal/media"
+	"backend/internal/mediafile"
+	"backend/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxChunkSize : taille maximale d'un fragment (PATCH)
+const MaxChunkSize int64 = 16 * 1024 * 1024
+
+// ChunkPrefix : préfixe des fragments dans le stockage (chunks/{upload}/{offset}-…)
+const ChunkPrefix = "chunks/"
+
+var (
+	ErrUploadExpired     = errors.New("upload expiré")
+	ErrUploadCompleted   = errors.New("upload déjà terminé")
+	ErrUploadIncomplete  = errors.New("upload incomplet")
+	ErrChunkTooLarge     = errors.New("fragment trop volumineux")
+	ErrChecksumRequired  = errors.New("checksum SHA-256 obligatoire")
+	ErrChecksumMismatch  = errors.New("le checksum SHA-256 ne correspond pas au fichier reçu")
+	ErrInvalidChecksum   = errors.New("checksum SHA-256 invalide (64 caractères hexadécimaux attendus)")
+	ErrInvalidUploadSpec = errors.New("fichier refusé")
+)
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type Service interface {
+	Init(userID uint, input InitInput) (*UploadDTO, error)
+	Get(userID uint, id string) (*UploadDTO, error)
+	// AppendChunk écrit un fragment à l'offset donné et retourne le nouvel offset
+	AppendChunk(ctx context.Context, userID uint, id string, offset int64, r io.Reader, size int64) (int64, error)
+	Complete(ctx context.Context, userID uint, id string, input CompleteInput) (*UploadDTO, error)
+	Abort(ctx context.Context, userID uint, id string) error
+	// PurgeExpired supprime les uploads expirés (fragments, et médias jamais rattachés à un post)
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+type service struct {
+	repo   Repository
+	blobs  storage.Blob
+	claims media.Claimer
+	expiry time.Duration
+}
+
+// NewService instancie le service ; expiry est la durée de vie d'un upload inachevé
+// (puis, une fois terminé, le délai pour rattacher le média à un post)
+func NewService(repo Repository, blobs storage.Blob, claims media.Claimer, expiry time.Duration) Service {
+	if repo == nil || blobs == nil || claims == nil {
+		panic("repository, storage and claimer cannot be nil")
+	}
+	return &service{repo: repo, blobs: blobs, claims: claims, expiry: expiry}
+}
+
+func (s *service) Init(userID uint, input InitInput) (*UploadDTO, error) {
+	mediaType, err := mediafile.Classify(input.FileName, input.Size)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidUploadSpec, err)
+	}
+	checksum := strings.ToLower(strings.TrimSpace(input.Checksum))
+	if checksum != "" && !sha256Hex.MatchString(checksum) {
+		return nil, ErrInvalidChecksum
+	}
+
+	u := &Upload{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		FileName:    input.FileName,
+		ContentType: input.ContentType,
+		MediaType:   mediaType,
+		Size:        input.Size,
+		Checksum:    checksum,
+		Status:      StatusPending,
+		ExpiresAt:   time.Now().Add(s.expiry),
+	}
+	if err := s.repo.Create(u); err != nil {
+		return nil, err
+	}
+	log.Printf("📤 Upload %s initialisé : %s (%d octets, user %d)", u.ID, u.FileName, u.Size, userID)
+	return toDTO(u), nil
+}
+
+// load retourne l'upload s'il appartient à l'utilisateur (sinon introuvable)
+func (s *service) load(userID uint, id string) (*Upload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUploadNotFound
+	}
+	u, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.UserID != userID {
+		return nil, ErrUploadNotFound
+	}
+	return u, nil
+}
+
+func (s *service) Get(userID uint, id string) (*UploadDTO, error) {
+	u, err := s.load(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return toDTO(u), nil
+}
+
+func (s *service) AppendChunk(ctx context.Context, userID uint, id string, offset int64, r io.Reader, size int64) (int64, error) {
+	u, err := s.load(userID, id)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case u.Status == StatusCompleted:
+		return u.Received, ErrUploadCompleted
+	case time.Now().After(u.ExpiresAt):
+		return u.Received, ErrUploadExpired
+	case offset != u.Received:
+		return u.Received, ErrOffsetConflict
+	case size <= 0 || size > MaxChunkSize || offset+size > u.Size:
+		return u.Received, ErrChunkTooLarge
+	}
+
+	// Chaque tentative a sa propre clé : deux envois concurrents au même offset ne s'écrasent pas.
+	// Les fragments (chunks/) n'appartiennent qu'aux uploads : ils sont effacés à la complétion ou par PurgeExpired,
+	// jamais par le nettoyage des orphelins
+	key := fmt.Sprintf("%s%s/%020d-%s", ChunkPrefix, u.ID, offset, uuid.New().String()[:8])
+	if _, err := s.blobs.Put(ctx, key, r, size, "application/octet-stream"); err != nil {
+		return u.Received, fmt.Errorf("écriture du fragment : %w", err)
+	}
+
+	if err := s.repo.AppendChunk(u, &Chunk{UploadID: u.ID, Position: offset, Size: size, StorageKey: key}); err != nil {
+		s.blobs.Delete(ctx, key)
+		if errors.Is(err, ErrOffsetConflict) {
+			if fresh, getErr := s.repo.GetByID(u.ID); getErr == nil {
+				return fresh.Received, err
+			}
+		}
+		return u.Received, err
+	}
+	return u.Received, nil
+}
+
+func (s *service) Complete(ctx context.Context, userID uint, id string, input CompleteInput) (*UploadDTO, error) {
+	u, err := s.load(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	// Complétion idempotente : un client qui n'a pas reçu la réponse peut réessayer
+	if u.Status == StatusCompleted {
+		return toDTO(u), nil
+	}
+	if time.Now().After(u.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	if u.Received != u.Size {
+		return nil, ErrUploadIncomplete
+	}
+
+	expected := u.Checksum
+	if given := strings.ToLower(strings.TrimSpace(input.Checksum)); given != "" {
+		if !sha256Hex.MatchString(given) {
+			return nil, ErrInvalidChecksum
+		}
+		if expected != "" && given != expected {
+			return nil, ErrChecksumMismatch
+		}
+		expected = given
+	}
+	if expected == "" {
+		return nil, ErrChecksumRequired
+	}
+
+	chunks, err := s.repo.ListChunks(u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assemblage en flux : les fragments sont relus dans l'ordre, hachés, puis rangés sous la clé dérivée du contenu
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.copyChunks(ctx, pw, chunks, u.Size))
+	}()
+	tmpKey, sum, written, err := storage.PutHashed(ctx, s.blobs, pr, u.Size, u.ContentType)
+	pr.Close()
+	if err != nil {
+		return nil, fmt.Errorf("assemblage de l'upload : %w", err)
+	}
+	if sum != expected {
+		s.blobs.Delete(ctx, tmpKey)
+		log.Printf("❌ Upload %s : checksum %s attendu, %s reçu", u.ID, expected, sum)
+		return nil, ErrChecksumMismatch
+	}
+	// Mêmes contrôles de contenu que l'envoi direct : exécutable ou script renommé, type incohérent avec l'extension
+	head, err := s.readHead(ctx, tmpKey)
+	if err != nil {
+		s.blobs.Delete(ctx, tmpKey)
+		return nil, fmt.Errorf("assemblage de l'upload : %w", err)
+	}
+	if err := mediafile.CheckContent(u.FileName, u.ContentType, head); err != nil {
+		s.blobs.Delete(ctx, tmpKey)
+		log.Printf("❌ Upload %s : contenu refusé : %v", u.ID, err)
+		return nil, fmt.Errorf("%w : %v", ErrInvalidUploadSpec, err)
+	}
+	// Un fichier identique déjà stocké est réutilisé : l'assemblage est alors abandonné
+	key := mediafile.Key(u.MediaType, sum, u.FileName)
+	claimID, err := s.claims.Promote(ctx, tmpKey, key)
+	if err != nil {
+		s.blobs.Delete(ctx, tmpKey)
+		return nil, fmt.Errorf("assemblage de l'upload : %w", err)
+	}
+
+	u.Checksum = expected
+	m := &media.Media{
+		OwnerID:     u.UserID,
+		MediaURL:    key,
+		MediaType:   u.MediaType,
+		FileSize:    written,
+		FileName:    u.FileName,
+		ContentHash: sum,
+	}
+	// En cas d'échec, le fichier est effacé par media.release s'il n'est pas partagé
+	if err := s.repo.Complete(u, m, time.Now().Add(s.expiry)); err != nil {
+		s.claims.Abandon(claimID)
+		return nil, err
+	}
+	s.claims.Done(claimID)
+	s.deleteChunkObjects(ctx, chunks)
+
+	log.Printf("✅ Upload %s terminé : média %d (%s)", u.ID, m.ID, key)
+	return toDTO(u), nil
+}
+
+// readHead lit les premiers octets du fichier assemblé (détection du type réel)
+func (s *service) readHead(ctx context.Context, key string) ([]byte, error) {
+	rc, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// copyChunks écrit les fragments bout à bout en vérifiant qu'ils couvrent exactement le fichier
+func (s *service) copyChunks(ctx context.Context, w io.Writer, chunks []Chunk, size int64) error {
+	var next int64
+	for _, chunk := range chunks {
+		if chunk.Position != next {
+			return fmt.Errorf("fragment manquant à l'offset %d", next)
+		}
+		rc, err := s.blobs.Get(ctx, chunk.StorageKey)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if n != chunk.Size {
+			return fmt.Errorf("fragment %d : %d octets lus, %d attendus", chunk.Position, n, chunk.Size)
+		}
+		next += n
+	}
+	if next != size {
+		return fmt.Errorf("%d octets assemblés, %d attendus", next, size)
+	}
+	return nil
+}
+
+func (s *service) deleteChunkObjects(ctx context.Context, chunks []Chunk) {
+	for _, chunk := range chunks {
+		if err := s.blobs.Delete(ctx, chunk.StorageKey); err != nil {
+			log.Printf("⚠️ Fragment %s non supprimé : %v", chunk.StorageKey, err)
+		}
+	}
+}
+
+func (s *service) Abort(ctx context.Context, userID uint, id string) error {
+	u, err := s.load(userID, id)
+	if err != nil {
+		return err
+	}
+	if u.Status == StatusCompleted {
+		return ErrUploadCompleted
+	}
+	return s.purge(ctx, u)
+}
+
+// purge supprime un upload, ses fragments et, s'il n'a jamais été rattaché à un post, son média
+func (s *service) purge(ctx context.Context, u *Upload) error {
+	chunks, err := s.repo.ListChunks(u.ID)
+	if err != nil {
+		return err
+	}
+	s.deleteChunkObjects(ctx, chunks)
+
+	// Le fichier du média jamais rattaché est effacé par le job media.release s'il n'est plus référencé
+	if u.MediaID != nil {
+		if err := s.repo.DeleteUnattachedMedia(*u.MediaID); err != nil {
+			return err
+		}
+	}
+	return s.repo.Delete(u.ID)
+}
+
+func (s *service) PurgeExpired(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		expired, err := s.repo.ListExpired(time.Now(), 100)
+		if err != nil {
+			return purged, err
+		}
+		if len(expired) == 0 {
+			return purged, nil
+		}
+		for i := range expired {
+			if err := s.purge(ctx, &expired[i]); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
+
+// RunJanitor purge périodiquement les uploads expirés jusqu'à l'annulation du contexte
+func RunJanitor(ctx context.Context, s Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("⚠️ Purge des uploads expirés : %v", err)
+			} else if n > 0 {
+				log.Printf("🧹 %d upload(s) expiré(s) supprimé(s)", n)
+			}
+		}
+	}
+}
@@ -1,13 +1,24 @@
 package user
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetProfileHandler godoc
+// Handler structure
+type Handler struct {
+	service Service
+}
+
+// NewHandler instancie un gestionnaire de route
+func NewHandler(s Service) *Handler {
+	return &Handler{service: s}
+}
+
+// GetProfile godoc
 // @Summary      Get current user profile
 // @Description  Returns the profile information of the authenticated user
 // @Tags         user
@@ -17,11 +28,11 @@ import (
 // @Failure      401  {object} map[string]string "Unauthorized"
 // @Failure      404  {object} map[string]string "User not found"
 // @Router       /api/profile [get]
-func GetProfileHandler(c *gin.Context) {
+func (h *Handler) GetProfile(c *gin.Context) {
 	// Récupère l'ID depuis le contexte (JWT)
 	userID := c.GetInt("user_id")
 
-	user, err := GetProfile(uint(userID))
+	user, err := h.service.GetProfile(uint(userID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -38,7 +49,7 @@ func GetProfileHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, profile)
 }
 
-// UpdateProfileHandler godoc
+// UpdateProfile godoc
 // @Summary      Update current user profile
 // @Description  Update profile fields (full name, bio, avatar)
 // @Tags         user
@@ -51,7 +62,7 @@ func GetProfileHandler(c *gin.Context) {
 // @Failure      401  {object} map[string]string "Unauthorized"
 // @Failure      500  {object} map[string]string "Internal server error"
 // @Router       /api/profile [put]
-func UpdateProfileHandler(c *gin.Context) {
+func (h *Handler) UpdateProfile(c *gin.Context) {
 	var input UpdateUserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry"})
@@ -61,7 +72,7 @@ func UpdateProfileHandler(c *gin.Context) {
 	// Récupère l'ID depuis le contexte (JWT)
 	userID := c.GetInt("user_id")
 
-	if err := UpdateProfile(uint(userID), input); err != nil {
+	if err := h.service.UpdateProfile(uint(userID), input); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -69,24 +80,25 @@ func UpdateProfileHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
-// GetUserProfileHandler godoc
+// GetUserProfile godoc
 // @Summary      Get public user profile
-// @Description  Returns the public profile of a user by their ID
+// @Description  Returns the public profile of a user by their ID. A user who blocked the viewer is reported as not found
 // @Tags         user
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id   path      int  true  "User ID"
 // @Success      200  {object} ProfileDTO
 // @Failure      400  {object} map[string]string "Invalid user ID"
 // @Failure      404  {object} map[string]string "User not found"
 // @Router       /api/users/{id}/profile [get]
-func GetUserProfileHandler(c *gin.Context) {
+func (h *Handler) GetUserProfile(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil || id <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	user, err := GetProfile(uint(id))
+	user, err := h.service.GetPublicProfile(uint(c.GetInt("user_id")), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -101,3 +113,171 @@ func GetUserProfileHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, profile)
 }
+
+// UpdateUserRole godoc
+// @Summary      Update a user's role
+// @Description  Change the role of a user (admin only)
+// @Tags         user
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                   true  "User ID"
+// @Param        body  body  user.UpdateRoleInput  true  "New role"
+// @Success      200  {object} map[string]string "Role updated successfully"
+// @Failure      400  {object} map[string]string "Invalid input"
+// @Failure      403  {object} map[string]string "Forbidden"
+// @Failure      404  {object} map[string]string "User not found"
+// @Router       /api/admin/users/{id}/role [put]
+func (h *Handler) UpdateUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	if err := h.service.UpdateRole(uint(id), input.Role); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully", "role": input.Role})
+}
+
+// GetPrivacy godoc
+// @Summary      Get privacy settings
+// @Description  Returns who may start a private conversation with the authenticated user: everyone, followers (free or paid subscribers) or subscribers (paid subscribers only)
+// @Tags         user
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object} PrivacySettings
+// @Failure      401  {object} map[string]string "Unauthorized"
+// @Failure      404  {object} map[string]string "User not found"
+// @Router       /api/profile/privacy [get]
+func (h *Handler) GetPrivacy(c *gin.Context) {
+	settings, err := h.service.GetPrivacy(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePrivacy godoc
+// @Summary      Update privacy settings
+// @Description  Choose who may start a private conversation: everyone, followers or subscribers. Conversations already accepted are not affected; first contacts from users the authenticated user does not follow land in message requests
+// @Tags         user
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  user.PrivacySettingsInput  true  "Direct message policy"
+// @Success      200  {object} PrivacySettings
+// @Failure      400  {object} map[string]string "Invalid policy"
+// @Failure      401  {object} map[string]string "Unauthorized"
+// @Failure      500  {object} map[string]string "Internal server error"
+// @Router       /api/profile/privacy [put]
+func (h *Handler) UpdatePrivacy(c *gin.Context) {
+	var input PrivacySettingsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry"})
+		return
+	}
+
+	settings, err := h.service.UpdatePrivacy(uint(c.GetInt("user_id")), input)
+	if err != nil {
+		if errors.Is(err, ErrInvalidDMPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListBlocked godoc
+// @Summary      List blocked users
+// @Description  Returns the block list of the authenticated user, most recent first
+// @Tags         user
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  BlockedUserDTO
+// @Failure      401  {object} map[string]string "Unauthorized"
+// @Failure      500  {object} map[string]string "Internal server error"
+// @Router       /api/profile/blocks [get]
+func (h *Handler) ListBlocked(c *gin.Context) {
+	blocked, err := h.service.ListBlocked(uint(c.GetInt("user_id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, blocked)
+}
+
+// BlockUser godoc
+// @Summary      Block a user
+// @Description  Add a user to the block list. The blocked user is never told: their private messages and their comments on the authenticated user's posts are kept visible to them only, and the authenticated user's profile appears not to exist. Comments they post elsewhere are hidden from the authenticated user
+// @Tags         user
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object} map[string]string "User blocked"
+// @Failure      400  {object} map[string]string "Invalid user ID"
+// @Failure      401  {object} map[string]string "Unauthorized"
+// @Failure      404  {object} map[string]string "User not found"
+// @Router       /api/users/{id}/block [post]
+func (h *Handler) BlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.service.Block(uint(c.GetInt("user_id")), uint(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrCannotBlockSelf):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// UnblockUser godoc
+// @Summary      Unblock a user
+// @Description  Remove a user from the block list. Messages and comments withheld while they were blocked stay hidden
+// @Tags         user
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object} map[string]string "User unblocked"
+// @Failure      400  {object} map[string]string "Invalid user ID"
+// @Failure      401  {object} map[string]string "Unauthorized"
+// @Failure      500  {object} map[string]string "Internal server error"
+// @Router       /api/users/{id}/block [delete]
+func (h *Handler) UnblockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.service.Unblock(uint(c.GetInt("user_id")), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
@@ -0,0 +1,57 @@
+package user
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrIdentityNotFound = errors.New("identité externe non trouvée")
+
+// UserIdentity relie un utilisateur à un compte externe (Google, GitHub, Apple, OIDC...).
+// Un même utilisateur peut posséder plusieurs identités ; le couple (provider, subject) est unique.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	UserID    uint      `gorm:"index;not null" json:"user_id" example:"1"`
+	Provider  string    `gorm:"size:64;not null;uniqueIndex:idx_identity_provider_subject" json:"provider" example:"github"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_identity_provider_subject" json:"-"` // ID de l'utilisateur chez le provider
+	Email     string    `json:"email" example:"haithem@example.com"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName permet de forcer le nom de la table "user_identities"
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// FindIdentity retourne l'identité correspondant au couple (provider, subject)
+func (r *repository) FindIdentity(provider, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, ErrIdentityNotFound
+	}
+	return &identity, nil
+}
+
+// CreateIdentity rattache une identité externe à un utilisateur
+func (r *repository) CreateIdentity(identity *UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// ListIdentities retourne les identités externes d'un utilisateur
+func (r *repository) ListIdentities(userID uint) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+// DeleteIdentity supprime une identité appartenant à l'utilisateur
+func (r *repository) DeleteIdentity(userID uint, provider string) error {
+	result := r.db.Where("user_id = ? AND provider = ?", userID, provider).Delete(&UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
@@ -8,21 +8,27 @@ import (
 
 // User représente le modèle complet d'un utilisateur (en base de données)
 type User struct {
-	ID            uint                  `gorm:"primaryKey" json:"id" example:"1"`
-	Username      string                `gorm:"uniqueIndex" json:"username" example:"haithemdev"`
-	FullName      string                `json:"full_name" example:"Haithem Hammami"`
-	Name          string                `gorm:"uniqueIndex" json:"name" example:"Hammami"`
-	FirstName     string                `gorm:"uniqueIndex" json:"first_name" example:"Haithem"`
-	Bio           string                `json:"bio" example:"Étudiant à l’EEMI et dev fullstack"`
-	AvatarURL     string                `gorm:"column:avatar_url" json:"avatar_url" example:"https://cdn.thinkshare/avatar.jpg"`
-	Email         string                `gorm:"uniqueIndex" json:"email" example:"haithem@example.com"`
-	PasswordHash  string                `json:"-"`
-	Role          string                `json:"role" example:"user"`
-	CreatedAt     time.Time             `json:"created_at" example:"2024-01-01T15:04:05Z"`
-	Posts         []UserPost            `gorm:"foreignKey:CreatorID" json:"posts,omitempty"`
-	Subscriptions []models.Subscription `gorm:"foreignKey:SubscriberID" json:"subscriptions,omitempty"`
-	MessagesSent  []message.Message     `gorm:"foreignKey:SenderID" json:"messages_sent,omitempty"`
-	MessagesRecv  []message.Message     `gorm:"foreignKey:ReceiverID" json:"messages_recv,omitempty"`
+	ID              uint                  `gorm:"primaryKey" json:"id" example:"1"`
+	Username        string                `gorm:"uniqueIndex" json:"username" example:"haithemdev"`
+	FullName        string                `json:"full_name" example:"Haithem Hammami"`
+	Name            string                `gorm:"uniqueIndex" json:"name" example:"Hammami"`
+	FirstName       string                `gorm:"uniqueIndex" json:"first_name" example:"Haithem"`
+	Bio             string                `json:"bio" example:"Étudiant à l’EEMI et dev fullstack"`
+	AvatarURL       string                `gorm:"column:avatar_url" json:"avatar_url" example:"https://cdn.thinkshare/avatar.jpg"`
+	Email           string                `gorm:"uniqueIndex" json:"email" example:"haithem@example.com"`
+	PasswordHash    string                `json:"-"`
+	Role            string                `json:"role" example:"user"`
+	EmailVerified   bool                  `gorm:"not null;default:false" json:"email_verified" example:"true"` // Adresse email confirmée
+	EmailVerifiedAt *time.Time            `json:"email_verified_at,omitempty"`
+	TOTPSecret      string                `gorm:"column:totp_secret;size:64" json:"-"`                           // Secret TOTP (en attente tant que TOTPEnabled est faux)
+	TOTPEnabled     bool                  `gorm:"column:totp_enabled;default:false" json:"totp_enabled"`         // Double authentification active
+	TOTPLastCounter int64                 `gorm:"column:totp_last_counter;default:0" json:"-"`                   // Dernier pas de temps accepté (anti-rejeu)
+	DMPolicy        DMPolicy              `gorm:"column:dm_policy;type:varchar(16);default:'everyone'" json:"-"` // Qui peut ouvrir une conversation privée (jamais exposé aux autres)
+	CreatedAt       time.Time             `json:"created_at" example:"2024-01-01T15:04:05Z"`
+	Posts           []UserPost            `gorm:"foreignKey:CreatorID" json:"posts,omitempty"`
+	Subscriptions   []models.Subscription `gorm:"foreignKey:SubscriberID" json:"subscriptions,omitempty"`
+	MessagesSent    []message.Message     `gorm:"foreignKey:SenderID" json:"messages_sent,omitempty"`
+	MessagesRecv    []message.Message     `gorm:"foreignKey:ReceiverID" json:"messages_recv,omitempty"`
 
 	MonthlyPrice  float64 `gorm:"column:monthly_price;type:double precision;default:0" json:"monthly_price"` // Prix mensuel de l'abonnement payant
 	StripePriceID string  `json:"stripe_price_id" gorm:"size:64"`                                            // Price Stripe associé au créateur
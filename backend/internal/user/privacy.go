@@ -0,0 +1,130 @@
+package user
+
+import (
+	"backend/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidDMPolicy = errors.New("réglage des messages privés invalide (everyone, followers ou subscribers)")
+	ErrCannotBlockSelf = errors.New("vous ne pouvez pas vous bloquer vous-même")
+)
+
+// DMPolicy : qui peut ouvrir une conversation privée avec l'utilisateur
+type DMPolicy string
+
+const (
+	DMEveryone    DMPolicy = "everyone"    // Tout le monde (premier contact d'un inconnu : demande de message)
+	DMFollowers   DMPolicy = "followers"   // Abonnés, gratuits ou payants
+	DMSubscribers DMPolicy = "subscribers" // Abonnés payants uniquement
+)
+
+// IsValid indique si le réglage fait partie des trois niveaux
+func (p DMPolicy) IsValid() bool {
+	switch p {
+	case DMEveryone, DMFollowers, DMSubscribers:
+		return true
+	}
+	return false
+}
+
+// Block : utilisateur bloqué. Le blocage vaut pour les messages privés, les commentaires et le profil ;
+// l'utilisateur bloqué n'en est jamais informé (ses messages et commentaires restent visibles de lui seul).
+type Block struct {
+	BlockerID uint `gorm:"primaryKey"`
+	BlockedID uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// TableName permet de forcer le nom de la table "user_blocks"
+func (Block) TableName() string {
+	return "user_blocks"
+}
+
+// PrivacySettings représente les réglages de confidentialité de l'utilisateur connecté
+type PrivacySettings struct {
+	DMPolicy DMPolicy `json:"dm_policy" example:"followers"`
+}
+
+// PrivacySettingsInput représente la modification des réglages de confidentialité
+type PrivacySettingsInput struct {
+	DMPolicy DMPolicy `json:"dm_policy" binding:"required" example:"followers"` // everyone, followers ou subscribers
+}
+
+// BlockedUserDTO : utilisateur de la liste de blocage
+type BlockedUserDTO struct {
+	ID        uint      `json:"id" example:"2"`
+	Username  string    `json:"username" example:"spammeur"`
+	AvatarURL string    `json:"avatar_url"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// GetDMPolicy retourne le réglage des messages privés d'un utilisateur
+func (r *repository) GetDMPolicy(userID uint) (DMPolicy, error) {
+	var user User
+	if err := r.db.Select("id, dm_policy").First(&user, userID).Error; err != nil {
+		return "", ErrUserNotFound
+	}
+	if user.DMPolicy == "" {
+		return DMEveryone, nil
+	}
+	return user.DMPolicy, nil
+}
+
+// UpdateDMPolicy modifie le réglage des messages privés
+func (r *repository) UpdateDMPolicy(userID uint, policy DMPolicy) error {
+	result := r.db.Model(&User{}).Where("id = ?", userID).Update("dm_policy", policy)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CreateBlock ajoute blockedID à la liste de blocage de blockerID (sans effet s'il y est déjà)
+func (r *repository) CreateBlock(blockerID, blockedID uint) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Block{BlockerID: blockerID, BlockedID: blockedID}).Error
+}
+
+// DeleteBlock retire blockedID de la liste de blocage de blockerID
+func (r *repository) DeleteBlock(blockerID, blockedID uint) error {
+	return r.db.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&Block{}).Error
+}
+
+// ListBlocks retourne la liste de blocage, les plus récents en premier
+func (r *repository) ListBlocks(blockerID uint) ([]BlockedUserDTO, error) {
+	blocked := []BlockedUserDTO{}
+	err := r.db.Table("user_blocks AS b").
+		Select("u.id, u.username, u.avatar_url, b.created_at AS blocked_at").
+		Joins("JOIN users u ON u.id = b.blocked_id").
+		Where("b.blocker_id = ?", blockerID).
+		Order("b.created_at DESC").
+		Scan(&blocked).Error
+	return blocked, err
+}
+
+// IsBlocked indique si blockerID a bloqué blockedID
+func (r *repository) IsBlocked(blockerID, blockedID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&Block{}).Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Count(&count).Error
+	return count > 0, err
+}
+
+// HasActiveSubscription indique si subscriberID suit creatorID ; paidOnly : abonnement payant en cours
+// (Stripe, ou payant manuel non expiré)
+func (r *repository) HasActiveSubscription(subscriberID, creatorID uint, paidOnly bool) (bool, error) {
+	query := r.db.Model(&models.Subscription{}).
+		Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", subscriberID, creatorID, true)
+	if paidOnly {
+		query = query.Where("type = ? OR (type = ? AND end_date > ?)", "stripe", "paid", time.Now())
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
@@ -1,25 +1,57 @@
 package user
 
 import (
-	"backend/internal/db"
 	"errors"
+
+	"gorm.io/gorm"
 )
 
 var ErrUserNotFound = errors.New("utilisateur non trouvé")
 
-func GetUserByID(id uint) (*User, error) {
+// UserRepository interface
+type UserRepository interface {
+	GetByID(id uint) (*User, error)
+	UpdateProfile(id uint, input UpdateUserInput) error
+	UpdateRole(id uint, role string) error
+
+	// Identités externes (OAuth)
+	FindIdentity(provider, subject string) (*UserIdentity, error)
+	CreateIdentity(identity *UserIdentity) error
+	ListIdentities(userID uint) ([]UserIdentity, error)
+	DeleteIdentity(userID uint, provider string) error
+
+	// Confidentialité : messages privés et liste de blocage (privacy.go)
+	GetDMPolicy(userID uint) (DMPolicy, error)
+	UpdateDMPolicy(userID uint, policy DMPolicy) error
+	CreateBlock(blockerID, blockedID uint) error
+	DeleteBlock(blockerID, blockedID uint) error
+	ListBlocks(blockerID uint) ([]BlockedUserDTO, error)
+	IsBlocked(blockerID, blockedID uint) (bool, error)
+	HasActiveSubscription(subscriberID, creatorID uint, paidOnly bool) (bool, error)
+}
+
+// repository implémentation
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) UserRepository {
+	return &repository{db: db}
+}
+
+func (r *repository) GetByID(id uint) (*User, error) {
 	var user User
-	result := db.GormDB.First(&user, id)
+	result := r.db.First(&user, id)
 	if result.Error != nil {
 		return nil, ErrUserNotFound
 	}
 	return &user, nil
 }
 
-func UpdateUserProfile(id uint, input UpdateUserInput) error {
+func (r *repository) UpdateProfile(id uint, input UpdateUserInput) error {
 	// Vérifie d'abord si l'utilisateur existe
 	var user User
-	result := db.GormDB.First(&user, id)
+	result := r.db.First(&user, id)
 	if result.Error != nil {
 		return ErrUserNotFound
 	}
@@ -39,22 +71,18 @@ func UpdateUserProfile(id uint, input UpdateUserInput) error {
 		updates["stripe_price_id"] = input.StripePriceID
 	}
 
-	result = db.GormDB.Model(&user).Updates(updates)
+	result = r.db.Model(&user).Updates(updates)
 	return result.Error
 }
 
-// UserRepository interface
-type UserRepository interface {
-	GetByID(id uint) (*User, error)
-}
-
-// repository implémentation
-type repository struct{}
-
-func NewRepository() UserRepository {
-	return &repository{}
-}
-
-func (r *repository) GetByID(id uint) (*User, error) {
-	return GetUserByID(id)
+// UpdateRole modifie le rôle d'un utilisateur
+func (r *repository) UpdateRole(id uint, role string) error {
+	result := r.db.Model(&User{}).Where("id = ?", id).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
@@ -0,0 +1,31 @@
+package user
+
+// Rôles applicatifs (cf. matrice rôles / permissions du cahier des charges)
+const (
+	RoleUser      = "user"      // Abonné : consulte, like, commente, s'abonne
+	RoleCreator   = "creator"   // Créateur : publie et fixe ses tarifs
+	RoleModerator = "moderator" // Modérateur : modère le contenu signalé
+	RoleAdmin     = "admin"     // Administrateur : gestion globale de la plateforme
+)
+
+// IsValidRole indique si le rôle fait partie du modèle de rôles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleCreator, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// NormalizeRole ramène les anciennes valeurs (ex: "google") ou vides au rôle "user"
+func NormalizeRole(role string) string {
+	if IsValidRole(role) {
+		return role
+	}
+	return RoleUser
+}
+
+// UpdateRoleInput représente la modification du rôle d'un utilisateur par un admin
+type UpdateRoleInput struct {
+	Role string `json:"role" binding:"required,oneof=user creator moderator admin" example:"creator"`
+}
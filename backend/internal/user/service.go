@@ -1,13 +1,120 @@
 package user
 
-func GetProfile(userID uint) (*User, error) {
-	return GetUserByID(userID)
+type Service interface {
+	GetProfile(userID uint) (*User, error)
+	GetPublicProfile(viewerID, userID uint) (*User, error)
+	UpdateProfile(userID uint, input UpdateUserInput) error
+	UpdateRole(userID uint, role string) error
+
+	// Confidentialité : réglage des messages privés et liste de blocage
+	GetPrivacy(userID uint) (*PrivacySettings, error)
+	UpdatePrivacy(userID uint, input PrivacySettingsInput) (*PrivacySettings, error)
+	Block(userID, targetID uint) error
+	Unblock(userID, targetID uint) error
+	ListBlocked(userID uint) ([]BlockedUserDTO, error)
+
+	// Utilisés par la messagerie (message.Privacy)
+	IsBlocked(blockerID, blockedID uint) (bool, error)
+	AcceptsMessagesFrom(receiverID, senderID uint) (bool, error)
+	Follows(followerID, creatorID uint) (bool, error)
+}
+
+type service struct {
+	repo UserRepository
+}
+
+func NewService(repo UserRepository) Service {
+	if repo == nil {
+		panic("repository cannot be nil")
+	}
+	return &service{repo: repo}
+}
+
+func (s *service) GetProfile(userID uint) (*User, error) {
+	return s.repo.GetByID(userID)
+}
+
+// GetPublicProfile retourne le profil de userID vu par viewerID ; pour un utilisateur bloqué,
+// le profil est introuvable, comme celui d'un compte inexistant
+func (s *service) GetPublicProfile(viewerID, userID uint) (*User, error) {
+	if viewerID != userID {
+		blocked, err := s.repo.IsBlocked(userID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, ErrUserNotFound
+		}
+	}
+	return s.repo.GetByID(userID)
+}
+
+func (s *service) UpdateProfile(userID uint, input UpdateUserInput) error {
+	return s.repo.UpdateProfile(userID, input)
+}
+
+func (s *service) UpdateRole(userID uint, role string) error {
+	return s.repo.UpdateRole(userID, role)
+}
+
+func (s *service) GetPrivacy(userID uint) (*PrivacySettings, error) {
+	policy, err := s.repo.GetDMPolicy(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivacySettings{DMPolicy: policy}, nil
+}
+
+func (s *service) UpdatePrivacy(userID uint, input PrivacySettingsInput) (*PrivacySettings, error) {
+	if !input.DMPolicy.IsValid() {
+		return nil, ErrInvalidDMPolicy
+	}
+	if err := s.repo.UpdateDMPolicy(userID, input.DMPolicy); err != nil {
+		return nil, err
+	}
+	return &PrivacySettings{DMPolicy: input.DMPolicy}, nil
+}
+
+// Block ajoute un utilisateur à la liste de blocage ; il n'en est pas informé
+func (s *service) Block(userID, targetID uint) error {
+	if userID == targetID {
+		return ErrCannotBlockSelf
+	}
+	if _, err := s.repo.GetByID(targetID); err != nil {
+		return err
+	}
+	return s.repo.CreateBlock(userID, targetID)
+}
+
+func (s *service) Unblock(userID, targetID uint) error {
+	return s.repo.DeleteBlock(userID, targetID)
+}
+
+func (s *service) ListBlocked(userID uint) ([]BlockedUserDTO, error) {
+	return s.repo.ListBlocks(userID)
+}
+
+func (s *service) IsBlocked(blockerID, blockedID uint) (bool, error) {
+	return s.repo.IsBlocked(blockerID, blockedID)
 }
 
-func UpdateProfile(userID uint, input UpdateUserInput) error {
-	return UpdateUserProfile(userID, input)
+// AcceptsMessagesFrom indique si le réglage des messages privés de receiverID laisse senderID ouvrir une conversation
+func (s *service) AcceptsMessagesFrom(receiverID, senderID uint) (bool, error) {
+	policy, err := s.repo.GetDMPolicy(receiverID)
+	if err != nil {
+		return false, err
+	}
+	switch policy {
+	case DMFollowers:
+		return s.repo.HasActiveSubscription(senderID, receiverID, false)
+	case DMSubscribers:
+		return s.repo.HasActiveSubscription(senderID, receiverID, true)
+	default:
+		return true, nil
+	}
 }
 
-func SetUserMonthlyPrice(userID uint, price float64) error {
-	return SetUserMonthlyPrice(userID, price)
+// Follows indique si followerID est abonné (gratuit ou payant) à creatorID
+func (s *service) Follows(followerID, creatorID uint) (bool, error) {
+	return s.repo.HasActiveSubscription(followerID, creatorID, false)
 }
@@ -1,218 +1,170 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
 
 	_ "backend/docs"
 
-	"backend/internal/auth"
-	"backend/internal/comment"
+	"backend/internal/app"
+	"backend/internal/config"
 	"backend/internal/db"
-	"backend/internal/like"
-	"backend/internal/media"
-	"backend/internal/message"
-	"backend/internal/models"
-	"backend/internal/payment"
-	"backend/internal/post"
-	"backend/internal/postaccess"
-	"backend/internal/subscription"
-	"backend/internal/user"
-
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"backend/internal/migrate"
 )
 
 func main() {
-	// ✅ Configurer le mode Gin
-	mode := os.Getenv("GIN_MODE")
-	if mode == "release" {
-		gin.SetMode(gin.ReleaseMode)
-	} else {
-		gin.SetMode(gin.DebugMode)
+	// ✅ Charger la configuration (fichier YAML optionnel + variables d'environnement)
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "Fichier de configuration YAML (optionnel)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
+	// ✅ Configurer le mode Gin
+	gin.SetMode(cfg.Server.GinMode)
+
 	// ✅ Initialiser la DB
-	db.InitDB()
-
-	// ✅ Migrer les tables (si nécessaires)
-	migrations := []struct {
-		name  string
-		model interface{}
-	}{
-		{"users", &user.User{}},
-		{"auth_tokens", &auth.AuthToken{}},
-		{"posts", &post.Post{}},
-		{"comments", &comment.Comment{}},
-		{"likes", &like.Like{}},
-		{"media", &media.Media{}},
-		{"subscriptions", &models.Subscription{}},
-		{"messages", &message.Message{}},
-		{"postaccess", &postaccess.PostAccess{}},
+	gdb, err := db.Open(cfg.Database)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	for _, m := range migrations {
-		if err := db.GormDB.AutoMigrate(m.model); err != nil {
-			log.Printf("❌ Erreur migration %s : %v", m.name, err)
-		} else {
-			log.Printf("✅ Table %s migrée ou déjà existante", m.name)
-		}
+	// ✅ Migrations SQL versionnées
+	migrator, err := migrate.New(gdb)
+	if err != nil {
+		log.Fatalf("❌ Migrations : %v", err)
 	}
 
-	// ✅ S'assurer que le dossier uploads existe avec les bonnes permissions
-	uploadsDir := "uploads"
-	// Vérifier si le dossier existe
-	if _, err := os.Stat(uploadsDir); os.IsNotExist(err) {
-		log.Printf("📁 Création du dossier uploads...")
-		if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-			log.Printf("❌ Erreur lors de la création du dossier uploads: %v", err)
-		} else {
-			log.Printf("✅ Dossier uploads créé avec succès")
+	// Sous-commande : `migrate up | down [n] | status`
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(migrator, flag.Args()[1:]); err != nil {
+			log.Fatalf("❌ %v", err)
 		}
-	} else {
-		// Si le dossier existe, on vérifie les permissions
-		info, _ := os.Stat(uploadsDir)
-		mode := info.Mode()
-		log.Printf("📁 Dossier uploads existe déjà avec les permissions: %v", mode)
-
-		// Vérifier si on peut écrire dans le dossier
-		testFile := filepath.Join(uploadsDir, "test_write_permission.tmp")
-		if f, err := os.Create(testFile); err != nil {
-			log.Printf("❌ ATTENTION: Impossible d'écrire dans le dossier uploads: %v", err)
-		} else {
-			f.Close()
-			os.Remove(testFile)
-			log.Printf("✅ Les permissions d'écriture dans uploads sont correctes")
+		return
+	}
+
+	if cfg.Database.AutoMigrate {
+		if _, err := migrator.Up(); err != nil {
+			log.Fatalf("❌ Migrations : %v", err)
 		}
 	}
+	// Refuser de servir sur un schéma en retard
+	if err := migrator.EnsureUpToDate(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
-	// ✅ Démarrage serveur
-	r := gin.Default()
-
-	// Middleware CORS (doit être avant les routes)
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// Sous-commande : `worker` (traitement des jobs sans serveur HTTP)
+	if flag.Arg(0) == "worker" {
+		if err := runWorker(cfg, gdb); err != nil {
+			log.Fatalf("❌ %v", err)
 		}
-		c.Next()
-	})
-
-	// Page d'accueil simple
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "Bienvenue sur ThinkShare API",
-			"version": "1.0.0",
-			"endpoints": gin.H{
-				"auth": []string{"/register", "/login", "/auth/google"},
-				"api":  []string{"/api/posts", "/api/comments", "/api/profile"},
-				"docs": "/swagger/index.html",
-			},
-		})
-	})
-
-	// Swagger
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// 🔐 Auth routes (registration, login, OAuth)
-	auth.InitGoth()
-	auth.RegisterRoutes(r)
-
-	// 🔧 Routes de debug (seulement en mode développement)
-	if gin.Mode() != gin.ReleaseMode {
-		r.GET("/debug/mode", func(c *gin.Context) {
-			c.JSON(200, gin.H{
-				"mode":         gin.Mode(),
-				"env_gin_mode": os.Getenv("GIN_MODE"),
-				"is_debug":     gin.Mode() != gin.ReleaseMode,
-				"server_time":  time.Now().Format(time.RFC3339),
-			})
-		})
-		// Route pour tester l'authentification
-		r.GET("/api/test-auth", auth.AuthMiddleware(), func(c *gin.Context) {
-			userID := c.GetInt("user_id")
-			c.JSON(200, gin.H{
-				"message": "Authentification réussie",
-				"user_id": userID,
-				"time":    time.Now().Format(time.RFC3339),
-			})
-		})
-		log.Printf("🔧 Routes de debug activées (mode développement)")
+		return
 	}
 
-	// Initialiser Stripe
-	payment.InitStripe()
-
-	// Route publique pour le webhook Stripe (avant les routes protégées)
-	r.POST("/api/payment/webhook", payment.StripeWebhookHandler)
-	// 🔐 Routes API protégées
-	api := r.Group("/api", auth.AuthMiddleware())
-	{
-		// 👤 Routes utilisateur
-		api.GET("/profile", user.GetProfileHandler)
-		api.PUT("/profile", user.UpdateProfileHandler)
-		api.GET("/users/:id", user.GetUserProfileHandler)
-		api.POST("/subscribe", subscription.SubscribeHandler)
-		// 💳 Routes paiement Stripe (abonnement payant, one-shot, webhook)
-		api.POST("/subscribe/paid", subscription.SubscribePaidStripeHandler) // Crée une session Stripe pour abonnement
-
-		api.POST("/unsubscribe", subscription.UnsubscribeHandler)
-		api.GET("/followers/:id", subscription.GetFollowersByUserHandler)
-		api.GET("/subscriptions", subscription.GetMySubscriptionsHandler)
-
-		// 📝 Routes posts
-		postRepo := post.NewRepository()
-		postService := post.NewService(postRepo)
-		postHandler := post.NewHandler(postService)
-		postHandler.RegisterRoutes(api)
-
-		// 💬 Routes commentaires
-		commentRepo := comment.NewRepository(db.GormDB)
-		userRepo := user.NewRepository()
-		commentService := comment.NewService(commentRepo, postRepo, userRepo)
-		commentHandler := comment.NewHandler(commentService)
-		commentHandler.RegisterRoutes(api)
-
-		// 💖 Routes likes
-		likeRepo := like.NewRepository(db.GormDB)
-		likeService := like.NewService(likeRepo, postRepo)
-		likeHandler := like.NewHandler(likeService)
-		likeHandler.RegisterRoutes(api)
-
-		// 📩 Routes messagerie privée
-		messageRepo := message.NewRepository(db.GormDB)
-		messageService := message.NewService(messageRepo, db.GormDB)
-		messageHandler := message.NewHandler(messageService)
-		messageHandler.RegisterRoutes(api)
-
-		log.Printf("✅ Routes API protégées configurées")
+	// ✅ Démarrage serveur
+	a, err := app.New(cfg, gdb)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	// Endpoint pour les métriques Prometheus (toujours accessible)
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	port := cfg.Server.Port
+	srv := &http.Server{Addr: ":" + port, Handler: a.Router}
 
-	// Servir les fichiers statiques du dossier uploads
-	r.Static("/uploads", "./uploads")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Port dynamique
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	go func() {
+		log.Printf("🚀 Serveur ThinkShare lancé sur le port : %s", port)
+		log.Printf("📚 Documentation Swagger : %s/swagger/index.html", cfg.Server.PublicBaseURL)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("❌ Erreur de lancement : %v", err)
+		}
+	}()
+
+	// SIGINT/SIGTERM : plus de nouvelles requêtes, puis arrêt des tâches de fond
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️ Arrêt du serveur HTTP : %v", err)
 	}
+	a.Close()
+	log.Printf("👋 Serveur arrêté")
+}
 
-	log.Printf("🚀 Serveur ThinkShare lancé sur le port : %s", port)
-	log.Printf("📚 Documentation Swagger : http://localhost:%s/swagger/index.html", port)
+// runWorker consomme la file de jobs jusqu'à SIGINT/SIGTERM, puis termine les jobs en cours
+func runWorker(cfg *config.Config, gdb *gorm.DB) error {
+	if cfg.Jobs.Workers == 0 {
+		return fmt.Errorf("JOB_WORKERS doit être supérieur à 0 pour la sous-commande worker")
+	}
+	worker, err := app.NewWorker(cfg, gdb)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	worker.Run(ctx)
+	log.Printf("👋 Worker arrêté")
+	return nil
+}
 
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("❌ Erreur de lancement : %v", err)
+// runMigrate exécute la sous-commande de migration
+func runMigrate(m *migrate.Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage : migrate up | down [n] | status")
+	}
+	switch args[0] {
+	case "up":
+		done, err := m.Up()
+		if err != nil {
+			return err
+		}
+		log.Printf("✅ %d migration(s) appliquée(s)", len(done))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("nombre d'étapes invalide : %q", args[1])
+			}
+			steps = n
+		}
+		done, err := m.Down(steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("↩️ %d migration(s) annulée(s)", len(done))
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "en attente"
+			switch {
+			case s.Missing:
+				state = "appliquée (inconnue de ce binaire) le " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			case s.Applied:
+				state = "appliquée le " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return fmt.Errorf("commande de migration inconnue : %q (up, down, status)", args[0])
 	}
+	return nil
 }
@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"backend/internal/app"
+	"backend/internal/config"
+	"backend/internal/user"
+)
+
+// Un compte sans le rôle requis est authentifié mais reçoit 403 sur les routes réservées
+func TestApp_RoleRestrictedRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Defaults()
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.SessionSecret = cfg.Auth.JWTSecret
+	cfg.Storage.SigningSecret = cfg.Auth.JWTSecret
+	cfg.Storage.LocalDir = t.TempDir()
+	cfg.Jobs.Workers = 0
+
+	a, err := app.New(cfg, testDB)
+	require.NoError(t, err)
+	t.Cleanup(a.Close)
+
+	s := newAuthService(t)
+	plain := createAuthUser(t, 109)
+	creator := createAuthUser(t, 110)
+	require.NoError(t, testDB.Model(&creator).Update("role", user.RoleCreator).Error)
+
+	tests := []struct {
+		name   string
+		userID uint
+		method string
+		path   string
+	}{
+		{"publication par un utilisateur simple", plain.ID, http.MethodPost, "/api/posts/"},
+		{"modération par un utilisateur simple", plain.ID, http.MethodDelete, "/api/moderation/posts/1"},
+		{"modération par un créateur", creator.ID, http.MethodDelete, "/api/moderation/comments/1"},
+		{"doublons de médias par un créateur", creator.ID, http.MethodGet, "/api/media/1/duplicates"},
+		{"nettoyage des médias par un créateur", creator.ID, http.MethodPost, "/api/media/cleanup"},
+		{"changement de rôle par un créateur", creator.ID, http.MethodPut, "/api/admin/users/1/role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := s.IssueSession(tt.userID)
+			require.NoError(t, err)
+
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tokens.Token)
+			w := httptest.NewRecorder()
+			a.Router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"backend/internal/auth"
+	"backend/internal/config"
+	"backend/internal/user"
+)
+
+func newAuthService(t *testing.T) *auth.Service {
+	cfg := config.Defaults()
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.SessionSecret = cfg.Auth.JWTSecret
+	return auth.NewService(cfg, testDB, nil)
+}
+
+// createAuthUser crée un compte dédié au test (IDs explicites, comme testUser), supprimé avec ses tokens à la fin
+func createAuthUser(t *testing.T, id uint) user.User {
+	name := fmt.Sprintf("auth_%d", id)
+	u := user.User{
+		ID:        id,
+		Username:  name,
+		Name:      name,
+		FirstName: name,
+		Email:     name + "@test.com",
+		Role:      "user",
+	}
+	require.NoError(t, testDB.Create(&u).Error)
+	t.Cleanup(func() {
+		testDB.Where("user_id = ?", id).Delete(&auth.AuthToken{})
+		testDB.Unscoped().Delete(&user.User{}, id)
+	})
+	return u
+}
+
+func sessionOf(t *testing.T, s *auth.Service, access string) string {
+	claims, err := s.ParseJWT(access)
+	require.NoError(t, err)
+	return claims.SessionID
+}
+
+func TestRefreshSession_RotatesRefreshToken(t *testing.T) {
+	s := newAuthService(t)
+	u := createAuthUser(t, 101)
+
+	first, err := s.IssueSession(u.ID)
+	require.NoError(t, err)
+	second, err := s.RefreshSession(first.RefreshToken)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken, "chaque refresh émet un nouveau refresh token")
+	assert.Equal(t, sessionOf(t, s, first.Token), sessionOf(t, s, second.Token), "la session est conservée")
+	assert.True(t, s.IsSessionActive(sessionOf(t, s, second.Token)))
+
+	third, err := s.RefreshSession(second.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEmpty(t, third.RefreshToken)
+}
+
+// Rejouer un refresh token déjà consommé révoque toute la session, y compris le token émis à sa place
+func TestRefreshSession_ReplayRevokesSession(t *testing.T) {
+	s := newAuthService(t)
+	u := createAuthUser(t, 102)
+
+	first, err := s.IssueSession(u.ID)
+	require.NoError(t, err)
+	second, err := s.RefreshSession(first.RefreshToken)
+	require.NoError(t, err)
+	sessionID := sessionOf(t, s, second.Token)
+
+	_, err = s.RefreshSession(first.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused)
+	assert.False(t, s.IsSessionActive(sessionID))
+
+	_, err = s.RefreshSession(second.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused, "le token légitime de la session est révoqué lui aussi")
+
+	_, err = s.RefreshSession("inconnu")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+}
+
+func TestRevokeAllSessions_EndsEverySessionOfTheUser(t *testing.T) {
+	s := newAuthService(t)
+	u := createAuthUser(t, 103)
+	other := createAuthUser(t, 104)
+
+	phone, err := s.IssueSession(u.ID)
+	require.NoError(t, err)
+	laptop, err := s.IssueSession(u.ID)
+	require.NoError(t, err)
+	kept, err := s.IssueSession(other.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, s.RevokeAllSessions(u.ID))
+
+	assert.False(t, s.IsSessionActive(sessionOf(t, s, phone.Token)))
+	assert.False(t, s.IsSessionActive(sessionOf(t, s, laptop.Token)))
+	assert.True(t, s.IsSessionActive(sessionOf(t, s, kept.Token)), "les sessions des autres comptes restent ouvertes")
+
+	_, err = s.RefreshSession(laptop.RefreshToken)
+	assert.Error(t, err)
+}
+
+// Vecteur de l'annexe B de la RFC 7636
+const (
+	rfc7636Verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfc7636Challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+// Le code d'autorisation OAuth n'est échangé qu'avec le bon code_verifier et la même redirect_uri,
+// et une seule fois : une tentative ratée le brûle aussi
+func TestExchangeOAuthCode_PKCEAndSingleUse(t *testing.T) {
+	s := newAuthService(t)
+	u := createAuthUser(t, 105)
+	const redirectURI = "http://localhost:3000/auth/callback"
+
+	tests := []struct {
+		name        string
+		verifier    string
+		redirectURI string
+		ok          bool
+	}{
+		{"vecteur RFC 7636", rfc7636Verifier, redirectURI, true},
+		{"mauvais code_verifier", rfc7636Verifier + "x", redirectURI, false},
+		{"code_verifier vide", "", redirectURI, false},
+		{"mauvaise redirect_uri", rfc7636Verifier, "thinkshare://oauth", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := s.CreateOAuthCode(u.ID, redirectURI, rfc7636Challenge)
+			require.NoError(t, err)
+
+			resp, err := s.ExchangeOAuthCode(code, tt.verifier, tt.redirectURI)
+			if tt.ok {
+				require.NoError(t, err)
+				tokens, ok := resp.(*auth.TokenResponse)
+				require.True(t, ok)
+				assert.Equal(t, u.ID, tokens.UserID)
+			} else {
+				assert.ErrorIs(t, err, auth.ErrInvalidOAuthCode)
+			}
+
+			// Rejouer le code, même avec les bons paramètres, échoue toujours
+			_, err = s.ExchangeOAuthCode(code, rfc7636Verifier, redirectURI)
+			assert.ErrorIs(t, err, auth.ErrInvalidOAuthCode)
+		})
+	}
+}
+
+// createMFAUser crée un compte avec la 2FA active et retourne son secret TOTP
+func createMFAUser(t *testing.T, id uint) (user.User, string) {
+	u := createAuthUser(t, id)
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "Thinkshare", AccountName: u.Email})
+	require.NoError(t, err)
+	require.NoError(t, testDB.Model(&u).Updates(map[string]interface{}{"totp_secret": key.Secret(), "totp_enabled": true}).Error)
+	return u, key.Secret()
+}
+
+// addRecoveryCode enregistre un code de secours (stocké haché, sans tiret ni majuscule)
+func addRecoveryCode(t *testing.T, userID uint, normalized string) {
+	sum := sha256.Sum256([]byte(normalized))
+	require.NoError(t, testDB.Create(&auth.AuthToken{
+		UserID:    userID,
+		Token:     hex.EncodeToString(sum[:]),
+		Purpose:   auth.PurposeRecoveryCode,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}).Error)
+}
+
+func currentTOTP(t *testing.T, secret string) string {
+	code, err := totp.GenerateCodeCustom(secret, time.Now(), totp.ValidateOpts{Period: 30, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+	require.NoError(t, err)
+	return code
+}
+
+// mfaLogin poste la seconde étape du login sur un nouveau challenge si mfaToken est vide
+func mfaLogin(t *testing.T, s *auth.Service, userID uint, mfaToken string, input auth.MFALoginInput) (string, int) {
+	if mfaToken == "" {
+		var err error
+		mfaToken, err = s.CreateActionToken(userID, auth.PurposeMFAChallenge, auth.MFAChallengeTTL)
+		require.NoError(t, err)
+	}
+	input.MFAToken = mfaToken
+	body, _ := json.Marshal(input)
+
+	r := gin.New()
+	r.POST("/auth/2fa/login", s.MFALoginHandler)
+	req, _ := http.NewRequest(http.MethodPost, "/auth/2fa/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return mfaToken, w.Code
+}
+
+// Un code TOTP accepté ne peut pas resservir dans le même pas de temps, même sur un autre challenge
+func TestMFALogin_RejectsReplayedTOTPCode(t *testing.T) {
+	s := newAuthService(t)
+	u, secret := createMFAUser(t, 106)
+	code := currentTOTP(t, secret)
+
+	_, status := mfaLogin(t, s, u.ID, "", auth.MFALoginInput{Code: code})
+	require.Equal(t, http.StatusOK, status)
+
+	_, status = mfaLogin(t, s, u.ID, "", auth.MFALoginInput{Code: code})
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+// Un code de secours est à usage unique
+func TestMFALogin_RecoveryCodeIsConsumed(t *testing.T) {
+	s := newAuthService(t)
+	u, _ := createMFAUser(t, 107)
+	addRecoveryCode(t, u.ID, "k3f9q7xw2m")
+
+	_, status := mfaLogin(t, s, u.ID, "", auth.MFALoginInput{RecoveryCode: "K3F9Q-7XW2M"})
+	require.Equal(t, http.StatusOK, status, "casse et tiret sont ignorés")
+
+	_, status = mfaLogin(t, s, u.ID, "", auth.MFALoginInput{RecoveryCode: "k3f9q-7xw2m"})
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+// Un mauvais code ne consomme pas le challenge (faute de frappe) ; un code valide le consomme
+func TestMFALogin_WrongCodeKeepsChallenge(t *testing.T) {
+	s := newAuthService(t)
+	u, secret := createMFAUser(t, 108)
+	addRecoveryCode(t, u.ID, "k3f9q7xw2m")
+
+	challenge, status := mfaLogin(t, s, u.ID, "", auth.MFALoginInput{Code: "abcdef"})
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	_, status = mfaLogin(t, s, u.ID, challenge, auth.MFALoginInput{Code: currentTOTP(t, secret)})
+	require.Equal(t, http.StatusOK, status, "le challenge reste utilisable après un mauvais code")
+
+	_, status = mfaLogin(t, s, u.ID, challenge, auth.MFALoginInput{RecoveryCode: "k3f9q-7xw2m"})
+	assert.Equal(t, http.StatusUnauthorized, status, "le challenge est consommé après une connexion réussie, même avec un code valide")
+}
@@ -0,0 +1,6 @@
+package integration
+
+import "gorm.io/gorm"
+
+// testDB est la connexion utilisée par les tests d'intégration, ouverte dans TestMain
+var testDB *gorm.DB
@@ -4,10 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
-	"os"
 	"testing"
 
-	"backend/internal/db"
+	"backend/internal/config"
 	"backend/internal/models"
 	"backend/internal/payment"
 
@@ -18,13 +17,13 @@ import (
 func TestStripeEndToEndBackendFlow(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.POST("/webhook", payment.StripeWebhookHandler)
+	r.POST("/webhook", payment.StripeWebhookHandler(testDB, config.StripeConfig{WebhookSecret: "test", DisableSignatureCheck: true}))
 
 	subscriberID := uint(1003) // à adapter
 	creatorID := uint(7)
 
 	// Nettoyage
-	db.GormDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).Delete(&models.Subscription{})
+	testDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).Delete(&models.Subscription{})
 
 	// 1. Simule le paiement Stripe (webhook checkout.session.completed)
 	session := map[string]interface{}{
@@ -42,9 +41,6 @@ func TestStripeEndToEndBackendFlow(t *testing.T) {
 	}
 	payload, _ := json.Marshal(event)
 
-	os.Setenv("STRIPE_WEBHOOK_SECRET", "test")
-	os.Setenv("DISABLE_STRIPE_SIGNATURE_CHECK", "true")
-
 	req := httptest.NewRequest("POST", "/webhook", bytes.NewBuffer(payload))
 	req.Header.Set("Stripe-Signature", "test")
 	w := httptest.NewRecorder()
@@ -56,7 +52,7 @@ func TestStripeEndToEndBackendFlow(t *testing.T) {
 
 	// 2. Vérifie la subscription créée/active
 	var found models.Subscription
-	err := db.GormDB.Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", subscriberID, creatorID, true).First(&found).Error
+	err := testDB.Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", subscriberID, creatorID, true).First(&found).Error
 	if err != nil {
 		t.Fatalf("Subscription Stripe non trouvée ou inactive après webhook: %v", err)
 	}
@@ -75,7 +71,7 @@ func TestStripeEndToEndBackendFlow(t *testing.T) {
 		},
 	}
 	found.StripeSubscriptionID = "stripe_sub_id_test"
-	db.GormDB.Save(&found)
+	testDB.Save(&found)
 
 	payload2, _ := json.Marshal(subscriptionEvent)
 	req2 := httptest.NewRequest("POST", "/webhook", bytes.NewBuffer(payload2))
@@ -88,7 +84,7 @@ func TestStripeEndToEndBackendFlow(t *testing.T) {
 	}
 
 	var found2 models.Subscription
-	err = db.GormDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).First(&found2).Error
+	err = testDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).First(&found2).Error
 	if err != nil {
 		t.Fatalf("Subscription Stripe non trouvée après désactivation: %v", err)
 	}
@@ -4,10 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
-	"os"
 	"testing"
 
-	"backend/internal/db"
+	"backend/internal/config"
 	"backend/internal/models"
 	"backend/internal/payment"
 
@@ -19,13 +18,13 @@ func TestStripeWebhookHandler_CreatesSubscription(t *testing.T) {
 	// Setup
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.POST("/webhook", payment.StripeWebhookHandler)
+	r.POST("/webhook", payment.StripeWebhookHandler(testDB, config.StripeConfig{WebhookSecret: "test", DisableSignatureCheck: true}))
 
 	subscriberID := uint(1002) // à adapter
 	creatorID := uint(7)
 
 	// Nettoyage
-	db.GormDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).Delete(&models.Subscription{})
+	testDB.Where("subscriber_id = ? AND creator_id = ?", subscriberID, creatorID).Delete(&models.Subscription{})
 
 	// Simule un event Stripe checkout.session.completed
 	session := map[string]interface{}{
@@ -48,8 +47,6 @@ func TestStripeWebhookHandler_CreatesSubscription(t *testing.T) {
 	req.Header.Set("Stripe-Signature", "test") // ignoré car on ne vérifie pas la signature ici
 	w := httptest.NewRecorder()
 
-	os.Setenv("STRIPE_WEBHOOK_SECRET", "test")
-	os.Setenv("DISABLE_STRIPE_SIGNATURE_CHECK", "true")
 	r.ServeHTTP(w, req)
 
 	if w.Code != 200 {
@@ -58,7 +55,7 @@ func TestStripeWebhookHandler_CreatesSubscription(t *testing.T) {
 
 	// Vérifie la subscription
 	var found models.Subscription
-	err := db.GormDB.Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", subscriberID, creatorID, true).First(&found).Error
+	err := testDB.Where("subscriber_id = ? AND creator_id = ? AND is_active = ?", subscriberID, creatorID, true).First(&found).Error
 	if err != nil {
 		t.Fatalf("Subscription Stripe non trouvée ou inactive après webhook: %v", err)
 	}
@@ -12,6 +12,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
+	"backend/internal/auth"
+	"backend/internal/config"
 	"backend/internal/db"
 	"backend/internal/user"
 )
@@ -20,11 +22,15 @@ var testUser user.User
 
 func TestMain(m *testing.M) {
 	// Init DB
-	db.InitDB()
+	var err error
+	testDB, err = db.Open(config.FromEnv().Database)
+	if err != nil {
+		panic("Failed to open test database: " + err.Error())
+	}
 
-	// Nettoyer et remigrer la table
-	db.GormDB.Migrator().DropTable(&user.User{})
-	db.GormDB.AutoMigrate(&user.User{})
+	// Nettoyer et remigrer les tables
+	testDB.Migrator().DropTable(&auth.AuthToken{}, &user.User{})
+	testDB.AutoMigrate(&user.User{}, &auth.AuthToken{})
 
 	// Créer l'utilisateur de test
 	testUser = createTestUser()
@@ -44,14 +50,15 @@ func setupRouter() *gin.Engine {
 		c.Next()
 	})
 
-	r.GET("/api/profile", user.GetProfileHandler)
-	r.PUT("/api/profile", user.UpdateProfileHandler)
+	h := user.NewHandler(user.NewService(user.NewRepository(testDB)))
+	r.GET("/api/profile", h.GetProfile)
+	r.PUT("/api/profile", h.UpdateProfile)
 	return r
 }
 
 func createTestUser() user.User {
 	// Supprimer l'utilisateur existant s'il existe
-	db.GormDB.Unscoped().Where("id = ?", 1).Delete(&user.User{})
+	testDB.Unscoped().Where("id = ?", 1).Delete(&user.User{})
 
 	u := user.User{
 		ID:           1,
@@ -66,14 +73,14 @@ func createTestUser() user.User {
 	}
 
 	// Créer l'utilisateur avec un ID spécifique
-	result := db.GormDB.Create(&u)
+	result := testDB.Create(&u)
 	if result.Error != nil {
 		panic("Failed to create test user: " + result.Error.Error())
 	}
 
 	// Vérifier que l'utilisateur a été créé avec le bon ID
 	var createdUser user.User
-	if err := db.GormDB.First(&createdUser, 1).Error; err != nil {
+	if err := testDB.First(&createdUser, 1).Error; err != nil {
 		panic("Failed to verify test user creation: " + err.Error())
 	}
 
@@ -116,7 +123,7 @@ func TestUpdateProfileHandler(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var updatedUser user.User
-	err := db.GormDB.First(&updatedUser, testUser.ID).Error
+	err := testDB.First(&updatedUser, testUser.ID).Error
 	assert.NoError(t, err)
 
 	assert.Equal(t, updateInput.FullName, updatedUser.FullName)
@@ -0,0 +1,95 @@
+package unit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/antivirus"
+	"backend/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd écoute en TCP et répond comme clamd aux commandes zPING et zINSTREAM
+func fakeClamd(t *testing.T, maxStream int) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				if command == "zPING\x00" {
+					conn.Write([]byte("PONG\x00"))
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+						return
+					}
+					if data.Len() > maxStream {
+						conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+						return
+					}
+				}
+				if strings.Contains(data.String(), eicar) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return "tcp://" + ln.Addr().String()
+}
+
+func TestClamd_InstreamProtocol(t *testing.T) {
+	ctx := context.Background()
+	clamd, err := antivirus.NewClamd(config.AntivirusConfig{ClamdAddress: fakeClamd(t, 1<<20), Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	require.NoError(t, clamd.Ping(ctx))
+
+	// Fichier sain découpé en plusieurs blocs
+	verdict, err := clamd.Scan(ctx, bytes.NewReader(bytes.Repeat([]byte("cours "), 30000)))
+	require.NoError(t, err)
+	assert.False(t, verdict.Infected)
+
+	verdict, err = clamd.Scan(ctx, strings.NewReader("entête\n"+eicar))
+	require.NoError(t, err)
+	assert.True(t, verdict.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", verdict.Signature)
+
+	_, err = clamd.Scan(ctx, bytes.NewReader(make([]byte, 2<<20)))
+	assert.ErrorIs(t, err, antivirus.ErrTooLarge)
+
+	_, err = antivirus.NewClamd(config.AntivirusConfig{ClamdAddress: "clamd:3310"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"backend/internal/app"
+	"backend/internal/config"
+)
+
+// setupApp monte l'API complète sur une connexion jamais ouverte : seules les routes
+// qui ne touchent pas la base peuvent être appelées.
+func setupApp(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Defaults()
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.SessionSecret = cfg.Auth.JWTSecret
+	cfg.Storage.SigningSecret = cfg.Auth.JWTSecret
+	cfg.Storage.LocalDir = t.TempDir()
+	cfg.Jobs.Workers = 0
+
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DSN: cfg.Database.DSN()}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	a, err := app.New(cfg, gdb)
+	require.NoError(t, err)
+	t.Cleanup(a.Close)
+	return a.Router
+}
+
+func TestApp_PublicRoutes(t *testing.T) {
+	r := setupApp(t)
+
+	for _, path := range []string{"/", "/auth/providers"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestApp_ProtectedRoutesRequireToken(t *testing.T) {
+	r := setupApp(t)
+
+	for _, path := range []string{"/api/profile", "/api/posts", "/api/subscriptions"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+	}
+}
+
+func TestApp_MediaRequiresSignedURL(t *testing.T) {
+	r := setupApp(t)
+
+	for _, path := range []string{"/media/1", "/media/1?viewer=1&expires=9999999999&sig=faux", "/files/images/a.jpg", "/uploads/images/a.jpg"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+		assert.Contains(t, []int{http.StatusForbidden, http.StatusNotFound}, w.Code, path)
+	}
+}
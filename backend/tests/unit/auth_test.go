@@ -0,0 +1,139 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"backend/internal/auth"
+	"backend/internal/config"
+	"backend/internal/user"
+)
+
+func newAuthService(t *testing.T, secret string) *auth.Service {
+	cfg := config.Defaults()
+	cfg.Auth.JWTSecret = secret
+	cfg.Auth.SessionSecret = secret
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return auth.NewService(cfg, gdb, nil)
+}
+
+// Deux services (deux apps, ou des tests en parallèle) ne partagent ni clé ni connexion
+func TestAuthService_InstancesAreIsolated(t *testing.T) {
+	a := newAuthService(t, "0123456789abcdef0123456789abcdef")
+	b := newAuthService(t, "fedcba9876543210fedcba9876543210")
+
+	token, err := a.GenerateJWT(7, "session", "creator")
+	require.NoError(t, err)
+
+	claims, err := a.ParseJWT(token)
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.UserID)
+	assert.Equal(t, "creator", claims.Role)
+
+	_, err = b.ParseJWT(token)
+	assert.Error(t, err, "un token signé par une autre instance est refusé")
+}
+
+func TestAuthService_RefusesToSignWithoutSecret(t *testing.T) {
+	_, err := newAuthService(t, "").GenerateJWT(1, "session", "user")
+	assert.ErrorIs(t, err, auth.ErrJWTKeyNotConfigured)
+}
+
+// Vecteur de l'annexe B de la RFC 7636
+const (
+	rfc7636Verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfc7636Challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+// Le démarrage du flux OAuth refuse un challenge PKCE mal formé ou une redirect_uri hors liste blanche
+func TestBeginAuthHandler_ValidatesPKCEAndRedirectURI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Defaults()
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.SessionSecret = cfg.Auth.JWTSecret
+	cfg.Auth.OAuthRedirectURIs = []string{"http://localhost:3000/auth/callback", "thinkshare://oauth"}
+	cfg.Auth.OAuthProviders = []config.OAuthProvider{{Type: "github", ClientID: "id", ClientSecret: "secret"}}
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	s := auth.NewService(cfg, gdb, nil)
+
+	r := gin.New()
+	r.GET("/auth/:provider", s.BeginAuthHandler)
+
+	tests := []struct {
+		name        string
+		challenge   string
+		method      string
+		redirectURI string
+		want        int
+	}{
+		{"vecteur RFC 7636", rfc7636Challenge, "S256", "", http.StatusTemporaryRedirect},
+		{"redirect_uri de la liste", rfc7636Challenge, "S256", "thinkshare://oauth", http.StatusTemporaryRedirect},
+		{"méthode plain refusée", rfc7636Verifier, "plain", "", http.StatusBadRequest},
+		{"méthode absente", rfc7636Challenge, "", "", http.StatusBadRequest},
+		{"challenge absent", "", "S256", "", http.StatusBadRequest},
+		{"challenge avec padding", rfc7636Challenge + "=", "S256", "", http.StatusBadRequest},
+		{"challenge base64 standard", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw+cM", "S256", "", http.StatusBadRequest},
+		{"challenge trop court", rfc7636Challenge[:40], "S256", "", http.StatusBadRequest},
+		{"redirect_uri inconnue", rfc7636Challenge, "S256", "https://evil.example/cb", http.StatusBadRequest},
+		{"redirect_uri préfixe de la liste", rfc7636Challenge, "S256", "http://localhost:3000/auth/callback/x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"code_challenge": {tt.challenge}, "code_challenge_method": {tt.method}}
+			if tt.redirectURI != "" {
+				q.Set("redirect_uri", tt.redirectURI)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/github?"+q.Encode(), nil))
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
+
+// RequireRole laisse passer les rôles listés et l'admin, et répond 403 aux autres
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		role    string
+		allowed []string
+		want    int
+	}{
+		{"rôle listé", user.RoleCreator, []string{user.RoleCreator}, http.StatusOK},
+		{"un des rôles listés", user.RoleModerator, []string{user.RoleCreator, user.RoleModerator}, http.StatusOK},
+		{"admin toujours admis", user.RoleAdmin, []string{user.RoleModerator}, http.StatusOK},
+		{"admin sans rôle listé", user.RoleAdmin, nil, http.StatusOK},
+		{"utilisateur simple", user.RoleUser, []string{user.RoleCreator}, http.StatusForbidden},
+		{"modérateur sur une route créateur", user.RoleModerator, []string{user.RoleCreator}, http.StatusForbidden},
+		{"créateur sur une route admin", user.RoleCreator, []string{user.RoleAdmin}, http.StatusForbidden},
+		{"rôle absent", "", []string{user.RoleUser}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				if tt.role != "" {
+					c.Set("role", tt.role)
+				}
+			}, auth.RequireRole(tt.allowed...), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"backend/internal/config"
+)
+
+// setRequiredEnv définit le minimum nécessaire pour qu'une configuration soit valide
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("JWT_SECRET", "0123456789abcdef0123456789abcdef")
+	t.Setenv("PGHOST", "localhost")
+	t.Setenv("PGUSER", "thinkshare")
+	t.Setenv("PGDATABASE", "thinkshare")
+}
+
+func TestConfigLoad_MissingJWTSecretFailsFast(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("JWT_SECRET", "")
+
+	cfg, err := config.Load("")
+	assert.Nil(t, cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JWT_SECRET")
+}
+
+func TestConfigLoad_EnvOverridesYAML(t *testing.T) {
+	setRequiredEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := []byte(`
+server:
+  port: "9090"
+  frontend_url: "https://app.thinkshare.fr/"
+stripe:
+  success_url: "https://app.thinkshare.fr/paiement/ok"
+`)
+	require.NoError(t, os.WriteFile(path, yaml, 0600))
+	t.Setenv("PORT", "7070")
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "7070", cfg.Server.Port)                             // l'environnement prime
+	assert.Equal(t, "https://app.thinkshare.fr", cfg.Server.FrontendURL) // slash final retiré
+	assert.Equal(t, "https://app.thinkshare.fr/paiement/ok", cfg.Stripe.SuccessURL)
+	assert.Equal(t, []string{"https://app.thinkshare.fr/auth/callback"}, cfg.Auth.OAuthRedirectURIs)
+	assert.Equal(t, cfg.Auth.JWTSecret, cfg.Auth.SessionSecret)
+}
+
+func TestConfigLoad_ReleaseRejectsDisabledStripeSignature(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test")
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	t.Setenv("DISABLE_STRIPE_SIGNATURE_CHECK", "true")
+
+	_, err := config.Load("")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DISABLE_STRIPE_SIGNATURE_CHECK")
+}
+
+func TestConfigLoad_SMTPRequiresHost(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("MAIL_DRIVER", "smtp")
+
+	_, err := config.Load("")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SMTP_HOST")
+}
+
+func TestConfigLoad_MalformedValuesFailInsteadOfDefaulting(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("UPLOAD_EXPIRY", "24")
+	t.Setenv("JOB_WORKERS", "abc")
+	t.Setenv("S3_USE_SSL", "oui")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.local")
+
+	cfg, err := config.Load("")
+	assert.Nil(t, cfg)
+	require.Error(t, err)
+	for _, key := range []string{"UPLOAD_EXPIRY", "JOB_WORKERS", "S3_USE_SSL", "TRUSTED_PROXIES"} {
+		assert.Contains(t, err.Error(), key)
+	}
+}
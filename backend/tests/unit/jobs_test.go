@@ -0,0 +1,79 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/jobs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// --- File en mémoire ---
+
+type memoryJobStore struct {
+	succeeded []uint64
+	failed    map[uint64]error
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{failed: map[uint64]error{}}
+}
+
+func (s *memoryJobStore) Claim(ctx context.Context, workerID string, kinds []string, limit int) ([]jobs.Job, error) {
+	return nil, nil
+}
+
+func (s *memoryJobStore) MarkSucceeded(ctx context.Context, job *jobs.Job) error {
+	s.succeeded = append(s.succeeded, job.ID)
+	return nil
+}
+
+func (s *memoryJobStore) MarkFailed(ctx context.Context, job *jobs.Job, cause error) error {
+	s.failed[job.ID] = cause
+	return nil
+}
+
+func (s *memoryJobStore) RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newTestWorker(store jobs.Store) *jobs.Worker {
+	return jobs.NewWorker(store, config.JobsConfig{Workers: 1, PollInterval: time.Second, JobTimeout: time.Second})
+}
+
+// --- Tests ---
+
+func TestJobs_Backoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, jobs.Backoff(1))
+	assert.Equal(t, 20*time.Second, jobs.Backoff(2))
+	assert.Equal(t, 80*time.Second, jobs.Backoff(4))
+	assert.Equal(t, time.Hour, jobs.Backoff(50))
+}
+
+func TestJobs_WorkerExecute(t *testing.T) {
+	store := newMemoryJobStore()
+	worker := newTestWorker(store)
+	boom := errors.New("boom")
+	worker.Handle("ok", func(ctx context.Context, job *jobs.Job) error { return nil })
+	worker.Handle("fail", func(ctx context.Context, job *jobs.Job) error { return boom })
+	worker.Handle("fatal", func(ctx context.Context, job *jobs.Job) error { return jobs.Permanent(boom) })
+	worker.Handle("panic", func(ctx context.Context, job *jobs.Job) error { panic("oups") })
+
+	ctx := context.Background()
+	worker.Execute(ctx, &jobs.Job{ID: 1, Kind: "ok"})
+	worker.Execute(ctx, &jobs.Job{ID: 2, Kind: "fail"})
+	worker.Execute(ctx, &jobs.Job{ID: 3, Kind: "fatal"})
+	worker.Execute(ctx, &jobs.Job{ID: 4, Kind: "panic"})
+	worker.Execute(ctx, &jobs.Job{ID: 5, Kind: "inconnu"})
+
+	assert.Equal(t, []uint64{1}, store.succeeded)
+	assert.ErrorIs(t, store.failed[2], boom)
+	assert.False(t, jobs.IsPermanent(store.failed[2]), "une erreur ordinaire doit être réessayée")
+	assert.True(t, jobs.IsPermanent(store.failed[3]))
+	assert.ErrorContains(t, store.failed[4], "oups")
+	assert.True(t, jobs.IsPermanent(store.failed[5]), "un type sans handler part en dead-letter")
+}
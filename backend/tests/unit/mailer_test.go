@@ -0,0 +1,47 @@
+package unit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"backend/internal/mailer"
+)
+
+// Les accents du sujet sont encodés en mots MIME : un en-tête brut en UTF-8 est refusé ou mal affiché
+func TestLogMailer_EncodesSubject(t *testing.T) {
+	m := &mailer.LogMailer{Dir: t.TempDir()}
+	require.NoError(t, m.Send(mailer.Message{To: "a@test.com", Subject: "Vérifiez votre adresse", Body: "Bonjour"}))
+
+	files, err := filepath.Glob(filepath.Join(m.Dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	raw, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	assert.Contains(t, string(raw), "Subject: =?utf-8?q?V=C3=A9rifiez_votre_adresse?=\r\n")
+	headers := strings.SplitN(string(raw), "\r\n\r\n", 2)[0]
+	for _, r := range headers {
+		assert.Less(t, r, rune(128), "les en-têtes restent en ASCII")
+	}
+}
+
+// Seuls les MaxSent derniers emails restent en mémoire
+func TestLogMailer_CapsSentMessages(t *testing.T) {
+	m := &mailer.LogMailer{}
+	for i := 0; i < mailer.MaxSent+10; i++ {
+		require.NoError(t, m.Send(mailer.Message{To: fmt.Sprintf("u%d@test.com", i), Subject: "Test"}))
+	}
+
+	assert.Len(t, m.Sent, mailer.MaxSent)
+	_, ok := m.LastTo("u0@test.com")
+	assert.False(t, ok, "les plus anciens sont oubliés")
+	last, ok := m.LastTo(fmt.Sprintf("u%d@test.com", mailer.MaxSent+9))
+	assert.True(t, ok)
+	assert.Equal(t, "Test", last.Subject)
+}
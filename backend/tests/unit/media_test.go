@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/storage"
+	"backend/internal/upload"
+	"backend/internal/user"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postAccessStub : lecteurs autorisés par post (les posts absents n'existent pas)
+type postAccessStub map[uint][]uint
+
+func (p postAccessStub) CanViewPost(postID, viewerID uint) (bool, error) {
+	viewers, ok := p[postID]
+	if !ok {
+		return false, media.ErrPostNotFound
+	}
+	for _, id := range viewers {
+		if id == viewerID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type enqueuerStub struct {
+	kinds []string
+}
+
+func (e *enqueuerStub) Enqueue(ctx context.Context, kind string, payload interface{}, opts ...jobs.Option) (*jobs.Job, error) {
+	e.kinds = append(e.kinds, kind)
+	return &jobs.Job{ID: uint64(len(e.kinds)), Kind: kind, Status: jobs.StatusPending}, nil
+}
+
+func TestMediaHandler_OwnershipAndAccess(t *testing.T) {
+	// Média 1 : publié dans le post 10 (lisible par 2 et 3) ; média 2 : upload non rattaché. Tous deux à l'utilisateur 2.
+	repo := &memoryMediaRepository{media: map[uint]media.Media{
+		1: {ID: 1, PostID: 10, OwnerID: 2, MediaURL: "images/a.jpg", MediaType: "image"},
+		2: {ID: 2, OwnerID: 2, MediaURL: "images/b.jpg", MediaType: "image"},
+	}}
+	queue := &enqueuerStub{}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.GetHeader("X-User"))
+		c.Set("user_id", id)
+		c.Set("role", c.GetHeader("X-Role"))
+	})
+	h := media.NewHandler(media.NewService(repo, newLocalStorage(t)), postAccessStub{10: {2, 3}}, queue)
+	h.RegisterRoutes(api)
+
+	do := func(method, path string, userID int, role, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", strconv.Itoa(userID))
+		req.Header.Set("X-Role", role)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Lecture : via l'accès au post, l'upload non publié n'est visible que de son auteur
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/media/1", 3, user.RoleUser, ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/media/1", 4, user.RoleUser, ""))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/media/2", 3, user.RoleUser, ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/media/2", 2, user.RoleUser, ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/media/post/10", 4, user.RoleUser, ""))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/media/post/11", 3, user.RoleUser, ""))
+
+	// Modification : auteur du média ou admin uniquement
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/api/media/1/metadata", 3, user.RoleUser, `{"metadata":"{}"}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/media/1/metadata", 2, user.RoleUser, `{"metadata":"pas du json"}`))
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/media/1/metadata", 2, user.RoleUser, `{"metadata":"{\"alt\":\"Plage\"}"}`))
+	assert.Equal(t, `{"alt":"Plage"}`, repo.media[1].Metadata)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/api/media/1", 3, user.RoleUser, ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/media/2", 1, user.RoleAdmin, ""))
+	assert.NotContains(t, repo.media, uint(2))
+
+	// Nettoyage du stockage : réservé aux admins et planifié en arrière-plan
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/media/cleanup", 2, user.RoleUser, ""))
+	assert.Equal(t, http.StatusAccepted, do(http.MethodPost, "/api/media/cleanup", 1, user.RoleAdmin, ""))
+	assert.Equal(t, []string{media.CleanupJobKind}, queue.kinds)
+}
+
+func TestCleanupOrphanedMedia_KeepsResumableUploadChunks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs, err := storage.NewLocal(dir, "http://localhost:8080", []byte("test-secret"))
+	require.NoError(t, err)
+
+	// Fichiers de plus d'une heure : fragments d'uploads en cours (valables UPLOAD_EXPIRY), temporaire abandonné, orphelin
+	old := time.Now().Add(-2 * time.Hour)
+	keys := []string{upload.ChunkPrefix + "u1/0-a", "staging/u2/0-b", "staging/abandonne", "documents/ab/orphelin.pdf"}
+	for _, key := range keys {
+		_, err := blobs.Put(ctx, key, strings.NewReader("x"), 1, "")
+		require.NoError(t, err)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), old, old))
+	}
+
+	repo := &memoryMediaRepository{media: map[uint]media.Media{}}
+	deleted, err := media.NewService(repo, blobs).CleanupOrphanedMedia(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	for _, key := range keys[:2] {
+		_, err := blobs.Stat(ctx, key)
+		assert.NoError(t, err, key)
+	}
+}
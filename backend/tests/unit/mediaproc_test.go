@@ -0,0 +1,500 @@
+package unit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"backend/internal/antivirus"
+	"backend/internal/config"
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/mediafile"
+	"backend/internal/mediaproc"
+	"backend/internal/post"
+	"backend/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Repository en mémoire ---
+
+type memoryMediaRepository struct {
+	media map[uint]media.Media
+}
+
+func (r *memoryMediaRepository) Create(m *media.Media) error {
+	m.ID = uint(len(r.media) + 1)
+	r.media[m.ID] = *m
+	return nil
+}
+
+func (r *memoryMediaRepository) FindByID(id uint) (*media.Media, error) {
+	m, ok := r.media[id]
+	if !ok {
+		return nil, media.ErrMediaNotFound
+	}
+	return &m, nil
+}
+
+func (r *memoryMediaRepository) FindByPostID(postID uint) ([]media.Media, error) { return nil, nil }
+func (r *memoryMediaRepository) FindByMessageIDs(ids []uint) ([]media.Media, error) {
+	return nil, nil
+}
+func (r *memoryMediaRepository) FindAll() ([]media.Media, error) { return nil, nil }
+func (r *memoryMediaRepository) Delete(id uint) error            { delete(r.media, id); return nil }
+
+func (r *memoryMediaRepository) Update(m *media.Media) error {
+	r.media[m.ID] = *m
+	return nil
+}
+
+func (r *memoryMediaRepository) WithStorageKey(key string, fn func(refs int64) error) error {
+	var n int64
+	for _, m := range r.media {
+		if m.MediaURL == key {
+			n++
+		}
+	}
+	return fn(n)
+}
+
+func (r *memoryMediaRepository) FindByContentHash(hash string) ([]media.Media, error) {
+	var found []media.Media
+	for _, m := range r.media {
+		if m.ContentHash == hash {
+			found = append(found, m)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found, nil
+}
+
+// gpsLatitude : valeur repérable dans le fichier (48/1, 51/1, 30/1)
+var gpsLatitude = []byte{48, 0, 0, 0, 1, 0, 0, 0, 51, 0, 0, 0, 1, 0, 0, 0, 30, 0, 0, 0, 1, 0, 0, 0}
+
+// jpegWithExif encode une image en JPEG et y insère un segment EXIF (Orientation + GPSLatitude)
+func jpegWithExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 90}))
+
+	le := binary.LittleEndian
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	entry := func(tag, typ uint16, count, value uint32) {
+		tiff = le.AppendUint16(tiff, tag)
+		tiff = le.AppendUint16(tiff, typ)
+		tiff = le.AppendUint32(tiff, count)
+		tiff = le.AppendUint32(tiff, value)
+	}
+	// IFD0 (offset 8) : 2 entrées, puis le répertoire GPS (offset 38) et sa latitude (offset 56)
+	tiff = le.AppendUint16(tiff, 2)
+	entry(0x0112, 3, 1, uint32(orientation))
+	entry(0x8825, 4, 1, 38)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = le.AppendUint16(tiff, 1)
+	entry(0x0002, 5, 3, 56)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, gpsLatitude...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+// --- Tests ---
+
+func TestMediaProc_ImageVariantsOrientationAndGPS(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	repo := &memoryMediaRepository{media: map[uint]media.Media{}}
+
+	// Photo prise en portrait : stockée en 800x400, à tourner de 90° (Orientation 6)
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		img.Set(x, x%400, color.RGBA{R: 255, A: 255})
+	}
+	data := jpegWithExif(t, img, 6)
+	_, err := blobs.Put(ctx, "images/user_1_photo.jpg", bytes.NewReader(data), int64(len(data)), "image/jpeg")
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(&media.Media{MediaURL: "images/user_1_photo.jpg", MediaType: "image", FileSize: int64(len(data))}))
+	// Même fichier partagé par un second média (déduplication par contenu)
+	require.NoError(t, repo.Create(&media.Media{MediaURL: "images/user_1_photo.jpg", MediaType: "image", FileSize: int64(len(data))}))
+
+	processor := mediaproc.NewProcessor(repo, blobs, &localClaimer{blobs: blobs})
+	require.NoError(t, processor.Process(ctx, 1))
+
+	m := repo.media[1]
+	var info post.ImageInfo
+	require.NoError(t, json.Unmarshal([]byte(m.Metadata), &info))
+	assert.Equal(t, 400, info.Width)
+	assert.Equal(t, 800, info.Height)
+	assert.True(t, info.IsPortrait)
+
+	// L'original ne contient plus la position GPS
+	rc, err := blobs.Get(ctx, m.MediaURL)
+	require.NoError(t, err)
+	original, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Len(t, original, len(data))
+	assert.False(t, bytes.Contains(original, gpsLatitude))
+
+	// Rangé sous la clé de son nouveau contenu ; le fichier partagé n'est pas réécrit
+	sum := sha256.Sum256(original)
+	assert.Equal(t, fmt.Sprintf("%x", sum), m.ContentHash)
+	assert.Equal(t, mediafile.Key("image", m.ContentHash, "photo.jpg"), m.MediaURL)
+	assert.Equal(t, "images/user_1_photo.jpg", repo.media[2].MediaURL)
+	rc, err = blobs.Get(ctx, "images/user_1_photo.jpg")
+	require.NoError(t, err)
+	shared, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, data, shared)
+
+	// Miniature et fil redressés ; pas de « full » identique au « feed » pour une petite image
+	thumb := m.Variant(media.VariantThumbnail, "jpeg")
+	require.NotNil(t, thumb)
+	assert.Equal(t, [2]int{160, 320}, [2]int{thumb.Width, thumb.Height})
+	assert.Equal(t, thumb.Key, m.ThumbnailURL)
+	feed := m.Variant(media.VariantFeed, "jpeg")
+	require.NotNil(t, feed)
+	assert.Equal(t, [2]int{400, 800}, [2]int{feed.Width, feed.Height})
+	assert.Nil(t, m.Variant(media.VariantFull, "jpeg"))
+
+	rc, err = blobs.Get(ctx, feed.Key)
+	require.NoError(t, err)
+	defer rc.Close()
+	decoded, err := jpeg.Decode(rc)
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(400, 800), decoded.Bounds().Size())
+
+	// Média supprimé entre l'enqueue et le traitement : inutile de réessayer
+	assert.True(t, jobs.IsPermanent(processor.Process(ctx, 42)))
+}
+
+// fakeRunner remplace ffprobe / ffmpeg : réponse ffprobe fixe, fichiers de sortie factices
+type fakeRunner struct {
+	probe string
+	calls [][]string
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	r.calls = append(r.calls, append([]string{name}, args...))
+	if name == "ffprobe" {
+		return []byte(r.probe), nil
+	}
+	out := args[len(args)-1]
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return nil, err
+	}
+	content := "poster"
+	for i, arg := range args {
+		if arg == "-hls_segment_filename" {
+			segment := strings.Replace(args[i+1], "%03d", "000", 1)
+			if err := os.WriteFile(segment, []byte("ts"), 0o644); err != nil {
+				return nil, err
+			}
+			content = "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nsegment_000.ts\n#EXT-X-ENDLIST\n"
+		}
+	}
+	return nil, os.WriteFile(out, []byte(content), 0o644)
+}
+
+func TestMediaProc_VideoTranscodesToHLS(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	repo := &memoryMediaRepository{media: map[uint]media.Media{}}
+	_, err := blobs.Put(ctx, "videos/user_1_cours.mov", strings.NewReader("mov"), 3, "video/quicktime")
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(&media.Media{MediaURL: "videos/user_1_cours.mov", MediaType: "video", FileSize: 3, ProcessingStatus: media.ProcessingPending}))
+
+	runner := &fakeRunner{probe: `{
+		"streams": [
+			{"codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720, "avg_frame_rate": "30/1"},
+			{"codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"duration": "75.4", "bit_rate": "2500000"}
+	}`}
+	transcoder, err := mediaproc.NewTranscoder(runner, config.Defaults().Video)
+	require.NoError(t, err)
+	require.NoError(t, mediaproc.NewProcessor(repo, blobs, &localClaimer{blobs: blobs}, mediaproc.WithTranscoder(transcoder)).Process(ctx, 1))
+
+	m := repo.media[1]
+	assert.Equal(t, media.ProcessingReady, m.ProcessingStatus)
+	var info post.VideoInfo
+	require.NoError(t, json.Unmarshal([]byte(m.Metadata), &info))
+	assert.Equal(t, "h264", info.Codec)
+	assert.Equal(t, "00:01:15", info.Duration)
+	assert.Equal(t, [2]int{1280, 720}, [2]int{info.Width, info.Height})
+	assert.True(t, info.HasAudio)
+
+	// Source 720p : niveaux 720p, 480p et 360p (pas d'agrandissement en 1080p), puis le poster
+	require.Len(t, runner.calls, 5)
+	assert.Contains(t, strings.Join(runner.calls[1], " "), "scale=1280:720")
+	assert.Contains(t, strings.Join(runner.calls[3], " "), "scale=640:360")
+
+	hls := m.Variant(media.VariantHLS, "m3u8")
+	require.NotNil(t, hls)
+	assert.Equal(t, "hls/user_1_cours/master.m3u8", hls.Key)
+	assert.Equal(t, "hls/user_1_cours/poster.jpg", m.ThumbnailURL)
+	rc, err := blobs.Get(ctx, hls.Key)
+	require.NoError(t, err)
+	master, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Contains(t, string(master), "RESOLUTION=1280x720\n720p/index.m3u8")
+	assert.Equal(t, 2, countObjects(t, blobs, "hls/user_1_cours/480p/")) // index.m3u8 + segment
+}
+
+// officeFile construit une archive OOXML minimale à partir de ses parties
+func officeFile(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func processDocument(t *testing.T, key string, data []byte, opts ...mediaproc.Option) (media.Media, post.DocumentInfo, *storage.Local) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	repo := &memoryMediaRepository{media: map[uint]media.Media{}}
+	_, err := blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(&media.Media{MediaURL: key, MediaType: "document", FileSize: int64(len(data))}))
+	require.NoError(t, mediaproc.NewProcessor(repo, blobs, &localClaimer{blobs: blobs}, opts...).Process(ctx, 1))
+
+	m := repo.media[1]
+	var info post.DocumentInfo
+	require.NoError(t, json.Unmarshal([]byte(m.Metadata), &info))
+	return m, info, blobs
+}
+
+// minimalPDF produit un PDF d'une page (titre, auteur, une ligne de texte) avec sa table xref
+func minimalPDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Title (Cours de chimie) /Author (Marie Curie) >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// jpegBytes encode une image unie de la taille demandée
+func jpegBytes(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil))
+	return buf.Bytes()
+}
+
+// pdftoppmRunner simule pdftoppm : écrit un JPEG à l'emplacement demandé
+type pdftoppmRunner struct {
+	t     *testing.T
+	calls [][]string
+}
+
+func (r *pdftoppmRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	r.calls = append(r.calls, append([]string{name}, args...))
+	return nil, os.WriteFile(args[len(args)-1]+".jpg", jpegBytes(r.t, 612, 792), 0o644)
+}
+
+func TestMediaProc_DocumentExtraction(t *testing.T) {
+	t.Run("docx", func(t *testing.T) {
+		data := officeFile(t, map[string]string{
+			"word/document.xml": `<w:document xmlns:w="w"><w:body>` +
+				`<w:p><w:r><w:t>La photosynthèse</w:t></w:r></w:p>` +
+				`<w:p><w:r><w:t xml:space="preserve">convertit la </w:t></w:r><w:r><w:t>lumière.</w:t></w:r></w:p>` +
+				`</w:body></w:document>`,
+			"docProps/core.xml":       `<cp:coreProperties xmlns:cp="cp" xmlns:dc="dc"><dc:title>Biologie</dc:title><dc:creator>Mme Martin</dc:creator></cp:coreProperties>`,
+			"docProps/app.xml":        `<Properties><Pages>3</Pages></Properties>`,
+			"docProps/thumbnail.jpeg": string(jpegBytes(t, 200, 260)),
+		})
+		m, info, blobs := processDocument(t, "documents/user_1_cours.docx", data)
+
+		assert.Equal(t, "La photosynthèse\nconvertit la lumière.", m.ExtractedText)
+		assert.Equal(t, 3, info.PageCount)
+		assert.Equal(t, "Biologie", info.Title)
+		assert.Equal(t, "Mme Martin", info.Author)
+		assert.Equal(t, 5, info.WordCount)
+
+		preview := m.Variant(media.VariantPreview, "jpeg")
+		require.NotNil(t, preview)
+		assert.Equal(t, "variants/user_1_cours_preview.jpg", preview.Key)
+		assert.Equal(t, preview.Key, m.ThumbnailURL)
+		assert.Equal(t, 1, countObjects(t, blobs, "variants/"))
+	})
+
+	t.Run("pptx", func(t *testing.T) {
+		slide := func(text string) string {
+			return `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:sld>`
+		}
+		// slide10 doit venir après slide2 (ordre numérique)
+		m, info, _ := processDocument(t, "documents/user_1_slides.pptx", officeFile(t, map[string]string{
+			"ppt/slides/slide10.xml": slide("Fin"),
+			"ppt/slides/slide2.xml":  slide("Milieu"),
+			"ppt/slides/slide1.xml":  slide("Début"),
+		}))
+		assert.Equal(t, "Début\nMilieu\nFin", m.ExtractedText)
+		assert.Equal(t, 3, info.PageCount)
+		assert.Nil(t, m.Variant(media.VariantPreview, "jpeg"))
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		md := "# Révisions de maths\n\nVoir **le cours** sur [les fractions](https://exemple.fr).\n- point\x00 un\n"
+		m, info, _ := processDocument(t, "documents/user_1_notes.md", []byte(md))
+		assert.Equal(t, "Révisions de maths", info.Title)
+		assert.Equal(t, "Révisions de maths\n\nVoir le cours sur les fractions.\npoint un", m.ExtractedText)
+	})
+
+	t.Run("pdf", func(t *testing.T) {
+		runner := &pdftoppmRunner{t: t}
+		renderer, err := mediaproc.NewPDFRenderer(runner, "pdftoppm")
+		require.NoError(t, err)
+		m, info, _ := processDocument(t, "documents/user_1_chimie.pdf", minimalPDF("Les atomes"),
+			mediaproc.WithPDFRenderer(renderer))
+
+		assert.True(t, info.IsPDF)
+		assert.Equal(t, 1, info.PageCount)
+		assert.Equal(t, "Cours de chimie", info.Title)
+		assert.Equal(t, "Marie Curie", info.Author)
+		assert.Contains(t, m.ExtractedText, "Les atomes")
+
+		require.Len(t, runner.calls, 1)
+		preview := m.Variant(media.VariantPreview, "jpeg")
+		require.NotNil(t, preview)
+		assert.Equal(t, [2]int{612, 792}, [2]int{preview.Width, preview.Height}) // pdftoppm borne déjà à 1080
+	})
+
+	t.Run("fichier corrompu", func(t *testing.T) {
+		// Extraction impossible : la description de base est conservée, sans erreur
+		m, info, _ := processDocument(t, "documents/user_1_casse.docx", []byte("pas une archive"))
+		assert.Equal(t, ".docx", info.Format)
+		assert.Empty(t, m.ExtractedText)
+		assert.Equal(t, media.ProcessingReady, m.ProcessingStatus)
+	})
+}
+
+func TestMediaProc_InfectedUploadIsQuarantined(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	repo := &memoryMediaRepository{media: map[uint]media.Media{}}
+	for i, content := range []string{"notes de cours", "macro " + eicar} {
+		key := fmt.Sprintf("documents/user_1_doc%d.txt", i+1)
+		_, err := blobs.Put(ctx, key, strings.NewReader(content), int64(len(content)), "text/plain")
+		require.NoError(t, err)
+		require.NoError(t, repo.Create(&media.Media{MediaURL: key, MediaType: "document", FileSize: int64(len(content)), ScanStatus: media.ScanPending}))
+	}
+
+	scanner := &antivirus.Fake{Signatures: map[string]string{eicar: "Eicar-Test-Signature"}}
+	processor := mediaproc.NewProcessor(repo, blobs, &localClaimer{blobs: blobs}, mediaproc.WithScanner(scanner))
+	require.NoError(t, processor.Process(ctx, 1))
+	require.NoError(t, processor.Process(ctx, 2))
+
+	clean := repo.media[1]
+	assert.Equal(t, media.ScanClean, clean.ScanStatus)
+	assert.NotNil(t, clean.ScannedAt)
+	assert.True(t, clean.Servable())
+	assert.Equal(t, "notes de cours", clean.ExtractedText)
+
+	// Fichier infecté : déplacé en quarantaine, pas de traitement ni de diffusion
+	infected := repo.media[2]
+	assert.Equal(t, media.ScanInfected, infected.ScanStatus)
+	assert.Equal(t, "Eicar-Test-Signature", infected.ScanResult)
+	assert.Equal(t, media.ProcessingFailed, infected.ProcessingStatus)
+	assert.Equal(t, "quarantine/documents/user_1_doc2.txt", infected.MediaURL)
+	assert.False(t, infected.Servable())
+	assert.Empty(t, infected.Metadata)
+	_, err := blobs.Stat(ctx, "documents/user_1_doc2.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = blobs.Stat(ctx, infected.MediaURL)
+	assert.NoError(t, err)
+
+	// Antivirus injoignable : le job sera réessayé, le fichier reste invisible
+	repo.media[3] = media.Media{ID: 3, MediaURL: "documents/user_1_doc1.txt", MediaType: "document", ScanStatus: media.ScanPending}
+	scanner.Err = antivirus.ErrScanFailed
+	err = processor.Process(ctx, 3)
+	assert.ErrorIs(t, err, antivirus.ErrScanFailed)
+	assert.False(t, jobs.IsPermanent(err))
+	failed := repo.media[3]
+	assert.Equal(t, media.ScanError, failed.ScanStatus)
+	assert.False(t, failed.Servable())
+}
+
+func TestMediaProc_SharedFileReleasedWithLastReference(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	repo := &memoryMediaRepository{media: map[uint]media.Media{}}
+
+	// Même photo partagée par deux utilisateurs : un seul fichier, deux médias
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 640, 480)), nil))
+	hash := fmt.Sprintf("%x", sha256.Sum256(encoded.Bytes()))
+	key := mediafile.ContentKey("images", hash, ".jpg")
+	_, err := blobs.Put(ctx, key, bytes.NewReader(encoded.Bytes()), int64(encoded.Len()), "image/jpeg")
+	require.NoError(t, err)
+	for owner := uint(1); owner <= 2; owner++ {
+		require.NoError(t, repo.Create(&media.Media{OwnerID: owner, MediaURL: key, ContentHash: hash, MediaType: "image",
+			FileSize: int64(encoded.Len()), ScanStatus: media.ScanPending}))
+	}
+
+	scanner := &antivirus.Fake{}
+	processor := mediaproc.NewProcessor(repo, blobs, &localClaimer{blobs: blobs}, mediaproc.WithScanner(scanner))
+	require.NoError(t, processor.Process(ctx, 1))
+	require.NoError(t, processor.Process(ctx, 2))
+
+	// Le second média reprend l'analyse et les variantes du premier
+	assert.Equal(t, 1, scanner.Scanned)
+	first, second := repo.media[1], repo.media[2]
+	assert.Equal(t, media.ProcessingReady, second.ProcessingStatus)
+	assert.Equal(t, media.ScanClean, second.ScanStatus)
+	assert.Equal(t, first.Variants, second.Variants)
+	assert.Equal(t, first.Metadata, second.Metadata)
+	files := countObjects(t, blobs, "")
+
+	// Suppression du premier : le fichier reste, encore référencé
+	require.NoError(t, repo.Delete(1))
+	require.NoError(t, processor.Release(ctx, media.NewReleasePayload(&first)))
+	assert.Equal(t, files, countObjects(t, blobs, ""))
+
+	// Dernière référence : original et variantes sont effacés
+	require.NoError(t, repo.Delete(2))
+	require.NoError(t, processor.Release(ctx, media.NewReleasePayload(&second)))
+	assert.Equal(t, 0, countObjects(t, blobs, ""))
+}
@@ -0,0 +1,447 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/internal/media"
+	"backend/internal/mediafile"
+	"backend/internal/message"
+	"backend/internal/post"
+	"backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// messageServiceStub enregistre les curseurs reçus par l'historique et la recherche
+type messageServiceStub struct {
+	message.Service
+	page   message.PageQuery
+	search message.SearchQuery
+}
+
+func (s *messageServiceStub) GetConversation(user1ID, user2ID uint, page message.PageQuery) (*message.ConversationPage, error) {
+	s.page = page
+	return &message.ConversationPage{Messages: []*message.MessageDTO{{ID: 9}, {ID: 10}}, HasMore: true}, nil
+}
+
+func (s *messageServiceStub) Search(userID uint, query message.SearchQuery) (*message.SearchResult, error) {
+	s.search = query
+	return &message.SearchResult{Hits: []*message.SearchHit{{Message: &message.MessageDTO{ID: 4}, Snippet: "un <mark>théorème</mark>"}}}, nil
+}
+
+func TestMessageHandler_ConversationCursorAndSearch(t *testing.T) {
+	svc := &messageServiceStub{}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) { c.Set("user_id", 1) })
+	message.NewHandler(svc).RegisterRoutes(api)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// Historique : page d'un seul sens, réponse paginée
+	w := get("/api/messages/2?before=11&limit=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, message.PageQuery{Before: 11, Limit: 2}, svc.page)
+	var page message.ConversationPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Messages, 2)
+	assert.True(t, page.HasMore)
+
+	assert.Equal(t, http.StatusOK, get("/api/messages/2?after=10").Code)
+	assert.Equal(t, message.PageQuery{After: 10}, svc.page)
+	assert.Equal(t, http.StatusBadRequest, get("/api/messages/2?before=11&after=3").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/messages/2?before=-1").Code)
+
+	// Recherche : termes obligatoires, filtre de conversation et curseur transmis
+	w = get("/api/messages/search?q=th%C3%A9or%C3%A8me&with=2&before=50")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, message.SearchQuery{Query: "théorème", With: 2, Before: 50}, svc.search)
+	assert.Contains(t, w.Body.String(), `"snippet"`)
+	assert.Equal(t, http.StatusBadRequest, get("/api/messages/search?q=+a+").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/messages/search?q=abc&limit=x").Code)
+}
+
+// groupRepoStub : conversations, participants et invitations en mémoire
+type groupRepoStub struct {
+	message.Repository
+	convs        map[uint]*message.Conversation
+	participants []message.Participant
+	invites      map[uint]*message.Invite
+	nextID       uint
+}
+
+func newGroupRepoStub() *groupRepoStub {
+	return &groupRepoStub{convs: map[uint]*message.Conversation{}, invites: map[uint]*message.Invite{}}
+}
+
+func (r *groupRepoStub) id() uint { r.nextID++; return r.nextID }
+
+func (r *groupRepoStub) join(convID, userID uint, role message.ParticipantRole) {
+	r.participants = append(r.participants, message.Participant{ConversationID: convID, UserID: userID, Role: role})
+}
+
+func (r *groupRepoStub) CreateGroup(conv *message.Conversation, ownerID uint, inviteeIDs []uint) error {
+	conv.ID = r.id()
+	r.convs[conv.ID] = conv
+	r.join(conv.ID, ownerID, message.RoleOwner)
+	for _, id := range inviteeIDs {
+		_ = r.CreateInvite(&message.Invite{ConversationID: conv.ID, InviteeID: id, InviterID: ownerID})
+	}
+	return nil
+}
+
+func (r *groupRepoStub) GetConversationByID(id uint) (*message.Conversation, error) {
+	if conv, ok := r.convs[id]; ok {
+		return conv, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *groupRepoStub) GetParticipant(convID, userID uint) (*message.Participant, error) {
+	for i := range r.participants {
+		if p := &r.participants[i]; p.ConversationID == convID && p.UserID == userID {
+			return p, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *groupRepoStub) GetParticipants(convID uint) ([]message.Participant, error) {
+	var ps []message.Participant
+	for _, p := range r.participants {
+		if p.ConversationID == convID {
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
+
+func (r *groupRepoStub) CountMembers(convID uint) (int64, error) {
+	ps, _ := r.GetParticipants(convID)
+	return int64(len(ps) + len(r.invites)), nil
+}
+
+func (r *groupRepoStub) RemoveParticipant(convID, userID, successorID uint) error {
+	for i, p := range r.participants {
+		if p.ConversationID == convID && p.UserID == userID {
+			r.participants = append(r.participants[:i], r.participants[i+1:]...)
+			if successorID > 0 {
+				return r.SetRole(convID, successorID, message.RoleOwner)
+			}
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *groupRepoStub) SetRole(convID, userID uint, role message.ParticipantRole) error {
+	p, err := r.GetParticipant(convID, userID)
+	if err == nil {
+		p.Role = role
+	}
+	return err
+}
+
+func (r *groupRepoStub) CreateInvite(inv *message.Invite) error {
+	for _, existing := range r.invites {
+		if existing.ConversationID == inv.ConversationID && existing.InviteeID == inv.InviteeID {
+			return message.ErrAlreadyInvited
+		}
+	}
+	inv.ID = r.id()
+	r.invites[inv.ID] = inv
+	return nil
+}
+
+func (r *groupRepoStub) GetInvite(id uint) (*message.Invite, error) {
+	if inv, ok := r.invites[id]; ok {
+		return inv, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *groupRepoStub) AcceptInvite(inv *message.Invite) error {
+	delete(r.invites, inv.ID)
+	r.join(inv.ConversationID, inv.InviteeID, message.RoleMember)
+	return nil
+}
+
+// coursesStub : seuls les utilisateurs listés ont accès au cours
+type coursesStub map[uint]bool
+
+func (c coursesStub) CanViewPost(postID, viewerID uint) (bool, error) { return c[viewerID], nil }
+
+// notifierStub enregistre les événements publiés et leurs destinataires
+type notifierStub struct {
+	events []realtime.Event
+	to     [][]uint
+}
+
+func (n *notifierStub) Publish(ctx context.Context, to []uint, ev realtime.Event) error {
+	n.events = append(n.events, ev)
+	n.to = append(n.to, to)
+	return nil
+}
+
+func TestMessageService_GroupRolesInvitesAndCourseAccess(t *testing.T) {
+	// Base en DryRun : les infos utilisateur (username, avatar) sont vides mais les comptes « existent »
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	repo, notifier := newGroupRepoStub(), &notifierStub{}
+	courses := coursesStub{1: true, 2: true, 3: true}
+	svc := message.NewService(repo, gdb, notifier, courses, nil, nil)
+	postID := uint(7)
+
+	// Groupe d'étude : un invité sans accès au cours est refusé
+	_, err = svc.CreateGroup(1, message.CreateGroupInput{Title: "Révisions", PostID: &postID, InviteeIDs: []uint{2, 9}})
+	assert.ErrorIs(t, err, message.ErrCourseAccess)
+
+	group, err := svc.CreateGroup(1, message.CreateGroupInput{Title: " Révisions ", PostID: &postID, InviteeIDs: []uint{2, 3, 2, 1}})
+	require.NoError(t, err)
+	assert.Equal(t, "Révisions", group.Title)
+	assert.Equal(t, message.RoleOwner, group.MyRole)
+	require.Len(t, repo.invites, 2)
+	require.NotEmpty(t, notifier.events)
+	assert.Equal(t, realtime.TypeConversationInvite, notifier.events[0].Type)
+
+	// L'invitation ne vaut que pour son destinataire ; l'accès au cours est revérifié à l'acceptation
+	var invite2, invite3 uint
+	for id, inv := range repo.invites {
+		if inv.InviteeID == 2 {
+			invite2 = id
+		} else {
+			invite3 = id
+		}
+	}
+	_, err = svc.AcceptInvite(invite2, 3)
+	assert.ErrorIs(t, err, message.ErrInviteNotFound)
+	courses[3] = false
+	_, err = svc.AcceptInvite(invite3, 3)
+	assert.ErrorIs(t, err, message.ErrCourseAccess)
+	courses[3] = true
+	_, err = svc.AcceptInvite(invite3, 3)
+	require.NoError(t, err)
+	joined, err := svc.AcceptInvite(invite2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, message.RoleMember, joined.MyRole)
+	assert.Len(t, joined.Participants, 3)
+
+	// Un non-participant ne voit pas le groupe ; un membre n'administre pas
+	_, err = svc.GetMessages(group.ID, 4, message.PageQuery{})
+	assert.ErrorIs(t, err, message.ErrConversationNotFound)
+	assert.ErrorIs(t, svc.Invite(group.ID, 2, 4), message.ErrNotAllowed)
+	assert.ErrorIs(t, svc.Invite(group.ID, 1, 3), message.ErrAlreadyParticipant)
+	assert.ErrorIs(t, svc.Invite(group.ID, 1, 4), message.ErrCourseAccess)
+
+	// Seul le propriétaire nomme les admins ; un admin n'exclut pas un autre admin
+	assert.ErrorIs(t, svc.SetRole(group.ID, 2, 3, message.RoleAdmin), message.ErrNotAllowed)
+	require.NoError(t, svc.SetRole(group.ID, 1, 2, message.RoleAdmin))
+	require.NoError(t, svc.SetRole(group.ID, 1, 3, message.RoleAdmin))
+	assert.ErrorIs(t, svc.RemoveParticipant(group.ID, 2, 3), message.ErrNotAllowed)
+	assert.ErrorIs(t, svc.RemoveParticipant(group.ID, 2, 1), message.ErrInvalidParticipant)
+
+	// Le propriétaire qui part transmet le groupe à l'admin le plus ancien (3 a rejoint avant 2)
+	require.NoError(t, svc.Leave(group.ID, 1))
+	p, err := repo.GetParticipant(group.ID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, message.RoleOwner, p.Role)
+	require.NoError(t, svc.RemoveParticipant(group.ID, 3, 2))
+	_, err = repo.GetParticipant(group.ID, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.Equal(t, realtime.TypeConversationUpdated, notifier.events[len(notifier.events)-1].Type)
+}
+
+// directRepoStub : conversations privées et messages en mémoire
+type directRepoStub struct {
+	*groupRepoStub
+	messages []*message.Message
+}
+
+func (r *directRepoStub) FindDirect(user1ID, user2ID uint) (*message.Conversation, error) {
+	for _, conv := range r.convs {
+		if conv.Kind == message.KindDirect && r.isIn(conv.ID, user1ID) && r.isIn(conv.ID, user2ID) {
+			return conv, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *directRepoStub) isIn(convID, userID uint) bool {
+	_, err := r.GetParticipant(convID, userID)
+	return err == nil
+}
+
+func (r *directRepoStub) GetOrCreateDirect(senderID, receiverID uint, request message.RequestState) (*message.Conversation, error) {
+	if conv, err := r.FindDirect(senderID, receiverID); err == nil {
+		return conv, nil
+	}
+	conv := &message.Conversation{ID: r.id(), Kind: message.KindDirect, CreatedBy: senderID}
+	r.convs[conv.ID] = conv
+	r.join(conv.ID, senderID, message.RoleMember)
+	r.participants = append(r.participants, message.Participant{ConversationID: conv.ID, UserID: receiverID, Role: message.RoleMember, Request: request})
+	return conv, nil
+}
+
+func (r *directRepoStub) CreateMessage(msg *message.Message, inTx func(tx *gorm.DB) error) error {
+	msg.ID = r.id()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func (r *directRepoStub) SetRequest(convID, userID uint, request message.RequestState) error {
+	p, err := r.GetParticipant(convID, userID)
+	if err == nil {
+		p.Request = request
+	}
+	return err
+}
+
+// privacyStub : blocages (bloqueur → bloqué), réglages refusant certains expéditeurs et abonnements
+type privacyStub struct {
+	blocks  map[[2]uint]bool
+	refuses map[[2]uint]bool // destinataire → expéditeur refusé par son réglage
+	follows map[[2]uint]bool
+}
+
+func (p privacyStub) IsBlocked(blockerID, blockedID uint) (bool, error) {
+	return p.blocks[[2]uint{blockerID, blockedID}], nil
+}
+
+func (p privacyStub) AcceptsMessagesFrom(receiverID, senderID uint) (bool, error) {
+	return !p.refuses[[2]uint{receiverID, senderID}], nil
+}
+
+func (p privacyStub) Follows(followerID, creatorID uint) (bool, error) {
+	return p.follows[[2]uint{followerID, creatorID}], nil
+}
+
+func TestMessageService_DirectPrivacyBlocksAndRequests(t *testing.T) {
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	repo, notifier := &directRepoStub{groupRepoStub: newGroupRepoStub()}, &notifierStub{}
+	privacy := privacyStub{
+		blocks:  map[[2]uint]bool{{4, 1}: true, {1, 5}: true},
+		refuses: map[[2]uint]bool{{3, 1}: true, {6, 1}: true},
+		follows: map[[2]uint]bool{{7, 1}: true},
+	}
+	svc := message.NewService(repo, gdb, notifier, nil, nil, privacy)
+	send := func(from, to uint) (*message.MessageDTO, error) {
+		return svc.Send(from, message.CreateMessageInput{ReceiverID: to, Content: "Bonjour"})
+	}
+
+	// Premier contact d'un inconnu : demande de message, poussée à part au destinataire
+	dto, err := send(1, 2)
+	require.NoError(t, err)
+	p, err := repo.GetParticipant(dto.ConversationID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, message.RequestPending, p.Request)
+	assert.Equal(t, realtime.TypeMessageCreated, notifier.events[0].Type)
+	assert.Equal(t, []uint{1}, notifier.to[0])
+	assert.Equal(t, realtime.TypeMessageRequest, notifier.events[1].Type)
+	assert.Equal(t, []uint{2}, notifier.to[1])
+
+	// Répondre accepte la demande ; l'expéditeur n'est plus soumis au réglage du destinataire
+	_, err = send(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, message.RequestNone, p.Request)
+	assert.ErrorIs(t, svc.AcceptRequest(dto.ConversationID, 2), message.ErrRequestNotFound)
+
+	// Écrire par conversation_id applique les mêmes règles : bloqué, le message est retenu ; bloquant, il est refusé
+	byConversation := func(from, conversationID uint) (*message.MessageDTO, error) {
+		return svc.Send(from, message.CreateMessageInput{ConversationID: conversationID, Content: "Bonjour"})
+	}
+	privacy.blocks[[2]uint{2, 1}] = true
+	_, err = byConversation(1, dto.ConversationID)
+	require.NoError(t, err)
+	assert.True(t, repo.messages[len(repo.messages)-1].Withheld)
+	assert.Equal(t, []uint{1}, notifier.to[len(notifier.to)-1])
+	_, err = byConversation(2, dto.ConversationID)
+	assert.ErrorIs(t, err, message.ErrUserBlocked)
+	delete(privacy.blocks, [2]uint{2, 1})
+
+	// Suivre l'expéditeur évite la demande ; un réglage restrictif refuse le premier contact
+	dto, err = send(1, 7)
+	require.NoError(t, err)
+	p, err = repo.GetParticipant(dto.ConversationID, 7)
+	require.NoError(t, err)
+	assert.Equal(t, message.RequestNone, p.Request)
+	_, err = send(1, 3)
+	assert.ErrorIs(t, err, message.ErrRecipientUnavailable)
+	_, err = send(1, 5)
+	assert.ErrorIs(t, err, message.ErrUserBlocked)
+
+	// Bloqué par le destinataire : mêmes réponses qu'un autre expéditeur, message retenu et jamais remis
+	dto, err = send(1, 4)
+	require.NoError(t, err)
+	assert.NotZero(t, dto.ID)
+	assert.True(t, repo.messages[len(repo.messages)-1].Withheld)
+	assert.Equal(t, []uint{1}, notifier.to[len(notifier.to)-1])
+	privacy.refuses[[2]uint{4, 1}] = true
+	_, err = send(1, 4)
+	assert.ErrorIs(t, err, message.ErrRecipientUnavailable, "le réglage s'applique tant que la demande n'est pas acceptée")
+
+	// Demande refusée : l'expéditeur peut écrire sans le savoir, le destinataire n'est plus notifié
+	dto, err = send(8, 9)
+	require.NoError(t, err)
+	require.NoError(t, svc.DeclineRequest(dto.ConversationID, 9))
+	_, err = send(8, 9)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{8}, notifier.to[len(notifier.to)-1])
+	assert.ErrorIs(t, svc.DeclineRequest(dto.ConversationID, 8), message.ErrRequestNotFound)
+}
+
+// attachmentFiles construit les fichiers d'un formulaire multipart (nom → contenu)
+func attachmentFiles(t *testing.T, files map[string]string) []*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, err := w.CreateFormFile("attachments", name)
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	return form.File["attachments"]
+}
+
+func TestAttachments_StoreAppliesPostMediaChecks(t *testing.T) {
+	blobs := newLocalStorage(t)
+	medias := post.NewMessageAttachments(&memoryMediaRepository{media: map[uint]media.Media{}}, testMediaSigner)
+	attachments := message.NewAttachments(blobs, &localClaimer{blobs: blobs}, medias)
+	ctx := context.Background()
+
+	// Exécutable renommé, extension dangereuse, vidéo : refusés avant tout enregistrement
+	for name, content := range map[string]string{
+		"exercices.pdf":  "MZ\x90\x00 programme",
+		"corrige.pdf.sh": "#!/bin/sh",
+		"cours.mp4":      "video",
+	} {
+		_, err := attachments.Store(ctx, attachmentFiles(t, map[string]string{name: content}))
+		assert.ErrorIs(t, err, message.ErrInvalidAttachment, name)
+	}
+
+	stored, err := attachments.Store(ctx, attachmentFiles(t, map[string]string{"fiche de révision.pdf": "%PDF-1.4 fiche"}))
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, mediafile.Document, stored[0].MediaType)
+	assert.Equal(t, "fiche_de_r_vision.pdf", stored[0].FileName)
+	assert.True(t, strings.HasPrefix(stored[0].Key, "documents/"))
+}
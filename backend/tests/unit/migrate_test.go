@@ -0,0 +1,60 @@
+package unit
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"backend/internal/migrate"
+)
+
+func TestMigrateLoad_OrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_second.up.sql":   {Data: []byte("SELECT 2;")},
+		"0010_second.down.sql": {Data: []byte("SELECT -2;")},
+		"0002_first.up.sql":    {Data: []byte("SELECT 1;")},
+		"0002_first.down.sql":  {Data: []byte("SELECT -1;")},
+	}
+
+	migrations, err := migrate.Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, int64(2), migrations[0].Version)
+	assert.Equal(t, "first", migrations[0].Name)
+	assert.Equal(t, "SELECT -1;", migrations[0].Down)
+	assert.Equal(t, int64(10), migrations[1].Version)
+}
+
+func TestMigrateLoad_RejectsInvalidSets(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"down manquant": {
+			"0001_init.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"version en double": {
+			"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"0001_b.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"nom invalide": {
+			"init.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		_, err := migrate.Load(fsys)
+		assert.Error(t, err, name)
+	}
+}
+
+// Les migrations embarquées dans le binaire doivent toutes être valides
+func TestMigrateNew_EmbeddedMigrationsAreValid(t *testing.T) {
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	_, err = migrate.New(gdb)
+	assert.NoError(t, err)
+}
@@ -1,16 +1,41 @@
 package unit
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"backend/internal/media"
 	"backend/internal/post"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+var testMediaSigner = post.NewMediaURLSigner("http://localhost:8080", []byte("test-secret"), time.Hour)
+
+// messageParticipants : participants (message, utilisateur) des conversations, pour les pièces jointes
+type messageParticipants map[[2]uint]bool
+
+func (p messageParticipants) IsMessageParticipant(messageID, userID uint) (bool, error) {
+	return p[[2]uint{messageID, userID}], nil
+}
+
+func newPostService(t *testing.T, repo post.Repository) post.Service {
+	t.Helper()
+	return post.NewService(repo, testMediaSigner, messageParticipants{})
+}
+
 // --- Mock Repository ---
 
 type MockPostRepository struct {
@@ -45,6 +70,11 @@ func (m *MockPostRepository) Update(p *post.Post) error {
 	return args.Error(0)
 }
 
+func (m *MockPostRepository) UpdateWithMedia(p *post.Post, mediaIDs []uint) error {
+	args := m.Called(p, mediaIDs)
+	return args.Error(0)
+}
+
 func (m *MockPostRepository) Delete(id uint) error {
 	args := m.Called(id)
 	return args.Error(0)
@@ -80,11 +110,29 @@ func (m *MockPostRepository) GetByCreatorAfter(creatorID, afterID uint, limit in
 	return args.Get(0).([]*post.Post), args.Error(1)
 }
 
+func (m *MockPostRepository) CountActiveSubscriptions(subscriberID, creatorID uint) (int64, error) {
+	args := m.Called(subscriberID, creatorID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPostRepository) GetMediaByID(id uint) (*media.Media, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*media.Media), args.Error(1)
+}
+
+func (m *MockPostRepository) GetAttachableMedia(ownerID uint, ids []uint) ([]media.Media, error) {
+	args := m.Called(ownerID, ids)
+	return args.Get(0).([]media.Media), args.Error(1)
+}
+
 // --- Tests ---
 
 func TestCreatePost_Success(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	input := post.CreatePostInput{
 		Content:    "Test post",
@@ -117,7 +165,7 @@ func TestCreatePost_Success(t *testing.T) {
 
 func TestCreatePost_EmptyContent(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	input := post.CreatePostInput{
 		Content:    "",
@@ -134,7 +182,7 @@ func TestCreatePost_EmptyContent(t *testing.T) {
 
 func TestCreatePost_InvalidVisibility(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	input := post.CreatePostInput{
 		Content:    "Contenu",
@@ -150,7 +198,7 @@ func TestCreatePost_InvalidVisibility(t *testing.T) {
 
 func TestGetPostByID_Success(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	existing := &post.Post{
 		ID:         1,
@@ -179,7 +227,7 @@ func TestGetPostByID_Success(t *testing.T) {
 
 func TestGetPostByID_NotFound(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	mockRepo.On("GetByID", uint(404)).Return(nil, errors.New("post non trouvé"))
 
@@ -193,7 +241,7 @@ func TestGetPostByID_NotFound(t *testing.T) {
 
 func TestUpdatePost_Success(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	existing := &post.Post{
 		ID:         1,
@@ -224,9 +272,48 @@ func TestUpdatePost_Success(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUpdatePost_ReordersAndAddsMedia(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	// Le post contient les images 1, 2 et 3 : la 2 est retirée, l'upload 7 ajouté en tête
+	existing := &post.Post{ID: 1, CreatorID: 2, Content: "Galerie", Media: []media.Media{
+		{ID: 1, PostID: 1, MediaType: post.ImageType},
+		{ID: 2, PostID: 1, MediaType: post.ImageType},
+		{ID: 3, PostID: 1, MediaType: post.ImageType},
+	}}
+	mockRepo.On("GetByID", uint(1)).Return(existing, nil)
+	mockRepo.On("GetAttachableMedia", uint(2), []uint{7}).Return([]media.Media{{ID: 7, MediaType: post.ImageType}}, nil)
+	mockRepo.On("UpdateWithMedia", existing, []uint{7, 3, 1}).Return(nil)
+	mockRepo.On("GetPostsWithStats", mock.Anything, mock.Anything).Return([]*post.PostDTO{{ID: 1, CreatorID: 2}}, nil)
+	mockRepo.On("GetCreatorInfo", uint(2)).Return(&post.CreatorInfo{ID: 2, Username: "auteur"}, nil)
+
+	mediaIDs := []uint{7, 3, 1, 3}
+	_, err := service.UpdatePost(1, 2, post.UpdatePostInput{MediaIDs: &mediaIDs})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestUpdatePost_MediaFollowsMixRules(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	existing := &post.Post{ID: 1, CreatorID: 2, Content: "Vidéo", Media: []media.Media{{ID: 1, PostID: 1, MediaType: post.VideoType}}}
+	mockRepo.On("GetByID", uint(1)).Return(existing, nil)
+	mockRepo.On("GetAttachableMedia", uint(2), []uint{8}).Return([]media.Media{{ID: 8, MediaType: post.VideoType}}, nil)
+
+	mediaIDs := []uint{1, 8}
+	_, err := service.UpdatePost(1, 2, post.UpdatePostInput{MediaIDs: &mediaIDs})
+
+	assert.ErrorIs(t, err, post.ErrInvalidMedia)
+	mockRepo.AssertNotCalled(t, "UpdateWithMedia", mock.Anything, mock.Anything)
+}
+
 func TestUpdatePost_Unauthorized(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	postToEdit := &post.Post{
 		ID:        1,
@@ -249,7 +336,7 @@ func TestUpdatePost_Unauthorized(t *testing.T) {
 
 func TestDeletePost_Success(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	postToDelete := &post.Post{ID: 1, CreatorID: 2}
 
@@ -264,7 +351,7 @@ func TestDeletePost_Success(t *testing.T) {
 
 func TestDeletePost_Unauthorized(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	postToDelete := &post.Post{ID: 1, CreatorID: 2}
 
@@ -279,7 +366,7 @@ func TestDeletePost_Unauthorized(t *testing.T) {
 
 func TestGetPostsByCreatorAfter_Success(t *testing.T) {
 	mockRepo := new(MockPostRepository)
-	service := post.NewService(mockRepo)
+	service := newPostService(t, mockRepo)
 
 	posts := []*post.Post{
 		{ID: 31, CreatorID: 2, Content: "post 1", Visibility: post.Public},
@@ -296,3 +383,225 @@ func TestGetPostsByCreatorAfter_Success(t *testing.T) {
 	assert.Len(t, result, 2)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestGetPostByID_LockedPostHidesMedia(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	existing := &post.Post{ID: 1, CreatorID: 2, Content: "Payant", IsPaidOnly: true}
+	mockRepo.On("GetByID", uint(1)).Return(existing, nil)
+	mockRepo.On("GetPostsWithStats", []*post.Post{existing}, uint(7)).Return([]*post.PostDTO{{
+		ID: 1, CreatorID: 2, Content: "Payant", IsPaidOnly: true,
+		Media: []post.MediaDTO{{ID: 10, Key: "images/a.jpg"}, {ID: 11, Key: "images/b.jpg"}},
+	}}, nil)
+	mockRepo.On("CountActiveSubscriptions", uint(7), uint(2)).Return(int64(0), nil)
+	mockRepo.On("GetCreatorInfo", uint(2)).Return(&post.CreatorInfo{ID: 2}, nil)
+
+	dto, err := service.GetPostByID(1, 7)
+
+	assert.NoError(t, err)
+	assert.False(t, dto.HasAccess)
+	assert.Empty(t, dto.Media)
+	assert.Equal(t, 2, dto.LockedMediaCount)
+}
+
+func TestGetPostByID_SignsMediaForViewer(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	existing := &post.Post{ID: 1, CreatorID: 2, Content: "Public"}
+	mockRepo.On("GetByID", uint(1)).Return(existing, nil)
+	mockRepo.On("GetPostsWithStats", []*post.Post{existing}, uint(7)).Return([]*post.PostDTO{{
+		ID: 1, CreatorID: 2, Content: "Public",
+		Media: []post.MediaDTO{post.NewMediaDTO(&media.Media{
+			ID: 10, MediaURL: "images/a.jpg", MediaType: "image",
+			Variants: []media.Variant{{Name: media.VariantFeed, Format: "webp", Key: "variants/a_feed.webp", Width: 1080, Height: 720}},
+		})},
+	}}, nil)
+	mockRepo.On("GetCreatorInfo", uint(2)).Return(&post.CreatorInfo{ID: 2}, nil)
+
+	dto, err := service.GetPostByID(1, 7)
+	require.NoError(t, err)
+	require.Len(t, dto.Media, 1)
+	require.Len(t, dto.Media[0].Variants, 1)
+
+	variant, err := url.Parse(dto.Media[0].Variants[0].URL)
+	require.NoError(t, err)
+	assert.Equal(t, "/media/10", variant.Path)
+	assert.Equal(t, "feed", variant.Query().Get("variant"))
+	assert.Equal(t, "webp", variant.Query().Get("format"))
+
+	u, err := url.Parse(dto.Media[0].URL)
+	require.NoError(t, err)
+	assert.Equal(t, "/media/10", u.Path)
+	q := u.Query()
+
+	viewer, err := testMediaSigner.Verify(10, q.Get("viewer"), q.Get("expires"), q.Get("sig"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), viewer)
+
+	// Une URL émise pour un lecteur ne vaut ni pour un autre lecteur ni pour un autre média
+	_, err = testMediaSigner.Verify(10, "8", q.Get("expires"), q.Get("sig"))
+	assert.ErrorIs(t, err, post.ErrInvalidMediaURL)
+	_, err = testMediaSigner.Verify(11, q.Get("viewer"), q.Get("expires"), q.Get("sig"))
+	assert.ErrorIs(t, err, post.ErrInvalidMediaURL)
+}
+
+func TestGetMediaForViewer_RechecksAccess(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	mockRepo.On("GetMediaByID", uint(10)).Return(&media.Media{ID: 10, PostID: 1, MediaURL: "images/a.jpg"}, nil)
+	mockRepo.On("GetByID", uint(1)).Return(&post.Post{ID: 1, CreatorID: 2, IsPaidOnly: true}, nil)
+	mockRepo.On("CountActiveSubscriptions", uint(7), uint(2)).Return(int64(0), nil)
+	mockRepo.On("CountActiveSubscriptions", uint(8), uint(2)).Return(int64(1), nil)
+
+	_, err := service.GetMediaForViewer(10, 7)
+	assert.ErrorIs(t, err, post.ErrMediaForbidden)
+
+	m, err := service.GetMediaForViewer(10, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, "images/a.jpg", m.MediaURL)
+}
+
+func TestGetMediaForViewer_BlockedUntilScanned(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	pending := &media.Media{ID: 10, PostID: 1, MediaURL: "images/a.jpg", MediaType: "image", ScanStatus: media.ScanPending}
+	mockRepo.On("GetMediaByID", uint(10)).Return(pending, nil)
+	existing := &post.Post{ID: 1, CreatorID: 2}
+	mockRepo.On("GetByID", uint(1)).Return(existing, nil)
+	mockRepo.On("GetPostsWithStats", []*post.Post{existing}, uint(7)).Return([]*post.PostDTO{{
+		ID: 1, CreatorID: 2, Media: []post.MediaDTO{post.NewMediaDTO(pending)},
+	}}, nil)
+	mockRepo.On("GetCreatorInfo", uint(2)).Return(&post.CreatorInfo{ID: 2}, nil)
+
+	// Le média est listé, sans URL, tant que l'antivirus ne l'a pas validé
+	dto, err := service.GetPostByID(1, 7)
+	require.NoError(t, err)
+	require.Len(t, dto.Media, 1)
+	assert.Empty(t, dto.Media[0].URL)
+	assert.Equal(t, media.ScanPending, dto.Media[0].Scan)
+
+	_, err = service.GetMediaForViewer(10, 7)
+	assert.ErrorIs(t, err, post.ErrMediaBlocked)
+}
+
+func TestServeMedia_HLSPlaylistIsSignedPerFile(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	_, err := blobs.Put(ctx, "hls/v/720p/index.m3u8", strings.NewReader("#EXTM3U\n#EXTINF:6.0,\nsegment_000.ts\n"), -1, "")
+	require.NoError(t, err)
+
+	mockRepo := new(MockPostRepository)
+	mockRepo.On("GetMediaByID", uint(10)).Return(&media.Media{ID: 10, PostID: 1, MediaURL: "videos/v.mp4", MediaType: "video",
+		Variants: []media.Variant{{Name: media.VariantHLS, Format: "m3u8", Key: "hls/v/master.m3u8"}}}, nil)
+	mockRepo.On("GetByID", uint(1)).Return(&post.Post{ID: 1, CreatorID: 2}, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	post.NewHandler(newPostService(t, mockRepo), blobs, testMediaSigner, &localClaimer{blobs: blobs}).RegisterMediaRoutes(r)
+
+	// Playlist de niveau : chaque segment reçoit sa propre URL signée
+	playlistURL, err := url.Parse(testMediaSigner.HLSURL(10, 7, "720p/index.m3u8"))
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, playlistURL.RequestURI(), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.apple.mpegurl", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	segment, err := url.Parse(lines[2])
+	require.NoError(t, err)
+	assert.Equal(t, "720p/segment_000.ts", segment.Query().Get("file"))
+	_, err = testMediaSigner.Verify(10, segment.Query().Get("viewer"), segment.Query().Get("expires"), segment.Query().Get("sig"))
+	assert.NoError(t, err)
+
+	// Le segment redirige vers le stockage ; impossible de sortir du dossier de la vidéo
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, segment.RequestURI(), nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	q := playlistURL.Query()
+	q.Set("file", "../../images/a.jpg")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/media/10?"+q.Encode(), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreatePost_UploadedMediaMustBeAttachable(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	// Le média 6 appartient à un autre utilisateur ou est déjà rattaché : seul le 5 est retourné
+	mockRepo.On("GetAttachableMedia", uint(1), []uint{5, 6}).Return([]media.Media{{ID: 5, MediaType: post.VideoType}}, nil)
+
+	_, err := service.CreatePost(1, post.CreatePostInput{Content: "Vidéo", Visibility: post.Public, MediaIDs: []uint{5, 6, 5}})
+
+	assert.ErrorIs(t, err, post.ErrInvalidMedia)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestCreatePost_UploadedMediaFollowsMixRules(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := newPostService(t, mockRepo)
+
+	mockRepo.On("GetAttachableMedia", uint(1), []uint{5}).Return([]media.Media{{ID: 5, MediaType: post.VideoType}}, nil)
+
+	_, err := service.CreatePost(1, post.CreatePostInput{
+		Content:    "Mélange",
+		Visibility: post.Public,
+		Media:      []media.Media{{MediaType: post.ImageType}},
+		MediaIDs:   []uint{5},
+	})
+
+	assert.ErrorIs(t, err, post.ErrInvalidMedia)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestGetMediaForViewer_MessageAttachmentParticipantsOnly(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	service := post.NewService(mockRepo, testMediaSigner, messageParticipants{{5, 8}: true})
+
+	mockRepo.On("GetMediaByID", uint(10)).Return(&media.Media{ID: 10, MessageID: 5, MediaURL: "documents/a.pdf", ScanStatus: media.ScanClean}, nil)
+
+	_, err := service.GetMediaForViewer(10, 7)
+	assert.ErrorIs(t, err, post.ErrMediaForbidden)
+
+	m, err := service.GetMediaForViewer(10, 8)
+	require.NoError(t, err)
+	assert.Equal(t, "documents/a.pdf", m.MediaURL)
+	mockRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+}
+
+func TestCreatePostHandler_AbandonsStoredFilesOnFailure(t *testing.T) {
+	blobs := newLocalStorage(t)
+	claims := &localClaimer{blobs: blobs}
+	mockRepo := new(MockPostRepository)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("content", " "))
+	require.NoError(t, w.WriteField("visibility", "public"))
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="images"; filename="schema.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := w.CreatePart(header)
+	require.NoError(t, err)
+	_, err = part.Write([]byte("\x89PNG\r\n\x1a\n schéma"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/posts", func(c *gin.Context) { c.Set("user_id", 1) }, post.NewHandler(newPostService(t, mockRepo), blobs, testMediaSigner, claims).CreatePost)
+	req := httptest.NewRequest(http.MethodPost, "/posts", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	// Contenu vide : le post est refusé après le dépôt de l'image, dont la réservation est abandonnée
+	assert.NotEqual(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, []uint{1}, claims.abandoned)
+	mockRepo.AssertNotCalled(t, "Create")
+}
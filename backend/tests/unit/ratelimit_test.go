@@ -0,0 +1,192 @@
+package unit
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"backend/internal/ratelimit"
+)
+
+var testLoginPolicy = ratelimit.BackoffPolicy{
+	Name:             "login",
+	FreeAttempts:     2,
+	BaseDelay:        time.Minute,
+	MaxDelay:         10 * time.Minute,
+	LockoutThreshold: 5,
+	LockoutDuration:  time.Hour,
+	FailureWindow:    time.Hour,
+}
+
+// setupLoginRouter simule /login : "good" comme mot de passe réussit, tout le reste échoue (401)
+func setupLoginRouter(limiter *ratelimit.Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/login", limiter.Backoff(testLoginPolicy, ratelimit.ByIP, ratelimit.ByEmail), func(c *gin.Context) {
+		var input struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		_ = c.ShouldBindJSON(&input)
+		if input.Password != "good" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "email ou mot de passe invalide"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"email": input.Email})
+	})
+	return r
+}
+
+func doLogin(r *gin.Engine, ip, email, password string) *httptest.ResponseRecorder {
+	body := []byte(`{"email":"` + email + `","password":"` + password + `"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBackoff_FreeAttemptsThenDelay(t *testing.T) {
+	r := setupLoginRouter(ratelimit.New(ratelimit.NewMemoryStore()))
+
+	assert.Equal(t, http.StatusUnauthorized, doLogin(r, "10.0.0.1", "a@example.com", "bad").Code)
+	assert.Equal(t, http.StatusUnauthorized, doLogin(r, "10.0.0.1", "a@example.com", "bad").Code)
+	// 3e échec : au-delà des essais libres, la clé est bloquée
+	assert.Equal(t, http.StatusUnauthorized, doLogin(r, "10.0.0.1", "a@example.com", "bad").Code)
+
+	w := doLogin(r, "10.0.0.1", "a@example.com", "good")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	// Le handler n'est pas appelé : même un bon mot de passe est refusé
+	assert.Contains(t, w.Body.String(), "trop de tentatives")
+}
+
+func TestBackoff_EmailKeyAppliesAcrossIPs(t *testing.T) {
+	r := setupLoginRouter(ratelimit.New(ratelimit.NewMemoryStore()))
+
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		assert.Equal(t, http.StatusUnauthorized, doLogin(r, ip, "victim@example.com", "bad").Code, "tentative %d", i)
+	}
+	// Nouvelle IP, même compte : bloqué par la clé email
+	assert.Equal(t, http.StatusTooManyRequests, doLogin(r, "10.0.0.4", "Victim@Example.com", "bad").Code)
+	// Autre compte depuis une nouvelle IP : non concerné
+	assert.Equal(t, http.StatusOK, doLogin(r, "10.0.0.4", "other@example.com", "good").Code)
+}
+
+func TestBackoff_SuccessResetsEmailButNotIP(t *testing.T) {
+	r := setupLoginRouter(ratelimit.New(ratelimit.NewMemoryStore()))
+
+	// 2 échecs sur deux comptes différents depuis la même IP (essais libres)
+	doLogin(r, "10.0.0.9", "a@example.com", "bad")
+	doLogin(r, "10.0.0.9", "b@example.com", "bad")
+	// Un succès ne remet pas le compteur IP à zéro...
+	assert.Equal(t, http.StatusOK, doLogin(r, "10.0.0.9", "c@example.com", "good").Code)
+	// ...donc le 3e échec depuis cette IP déclenche le délai
+	assert.Equal(t, http.StatusUnauthorized, doLogin(r, "10.0.0.9", "d@example.com", "bad").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doLogin(r, "10.0.0.9", "e@example.com", "good").Code)
+}
+
+func TestBackoff_CustomFailureStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := testLoginPolicy
+	policy.FailureStatus = http.StatusBadRequest
+	limiter := ratelimit.New(ratelimit.NewMemoryStore())
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 7); c.Next() })
+	r.POST("/auth/2fa/disable", limiter.Backoff(policy, ratelimit.ByUser), func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code de vérification invalide"})
+	})
+
+	disable := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/auth/2fa/disable", nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	// Les mauvais codes (400) sont des échecs : au-delà des essais libres, le compte est bloqué
+	assert.Equal(t, http.StatusBadRequest, disable())
+	assert.Equal(t, http.StatusBadRequest, disable())
+	assert.Equal(t, http.StatusBadRequest, disable())
+	assert.Equal(t, http.StatusTooManyRequests, disable())
+}
+
+func TestBackoffDelay_ExponentialAndCapped(t *testing.T) {
+	assert.Equal(t, time.Duration(0), ratelimit.BackoffDelay(testLoginPolicy, 2))
+	assert.Equal(t, time.Minute, ratelimit.BackoffDelay(testLoginPolicy, 3))
+	assert.Equal(t, 2*time.Minute, ratelimit.BackoffDelay(testLoginPolicy, 4))
+	assert.Equal(t, 4*time.Minute, ratelimit.BackoffDelay(testLoginPolicy, 5))
+	assert.Equal(t, 10*time.Minute, ratelimit.BackoffDelay(testLoginPolicy, 8))
+}
+
+func TestThrottle_LimitPerWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore())
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 7); c.Next() })
+	r.POST("/messages", limiter.Throttle(ratelimit.Policy{Name: "messages", Limit: 3, Window: time.Minute}, ratelimit.ByUser), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/messages", nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/messages", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestThrottle_ByIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(trustedProxies []string) *gin.Engine {
+		r := gin.New()
+		assert.NoError(t, r.SetTrustedProxies(trustedProxies)) // Comme app.New (TRUSTED_PROXIES)
+		limiter := ratelimit.New(ratelimit.NewMemoryStore())
+		r.POST("/register", limiter.Throttle(ratelimit.Policy{Name: "register", Limit: 1, Window: time.Minute}, ratelimit.ByIP), func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		})
+		return r
+	}
+	register := func(r *gin.Engine, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/register", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Sans proxy de confiance, changer X-Forwarded-For ne donne pas de nouvelle clé
+	r := newRouter(nil)
+	assert.Equal(t, http.StatusCreated, register(r, "203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, register(r, "203.0.113.2"))
+
+	// Derrière un proxy déclaré, l'IP transmise par le proxy est la clé
+	r = newRouter([]string{"10.0.0.0/8"})
+	assert.Equal(t, http.StatusCreated, register(r, "203.0.113.1"))
+	assert.Equal(t, http.StatusCreated, register(r, "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, register(r, "203.0.113.2"))
+}
+
+func TestMemoryStore_LockExpires(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	ctx := t.Context()
+
+	assert.NoError(t, store.Lock(ctx, "k", 20*time.Millisecond))
+	remaining, _ := store.LockedFor(ctx, "k")
+	assert.Greater(t, remaining, time.Duration(0))
+
+	time.Sleep(30 * time.Millisecond)
+	remaining, _ = store.LockedFor(ctx, "k")
+	assert.Equal(t, time.Duration(0), remaining)
+}
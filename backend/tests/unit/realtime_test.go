@@ -0,0 +1,114 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type wsEvent struct {
+	Type string          `json:"type"`
+	From uint            `json:"from"`
+	Data json.RawMessage `json:"data"`
+}
+
+// readEvent lit le prochain événement (échec du test s'il n'arrive pas à temps)
+func readEvent(t *testing.T, conn *websocket.Conn) wsEvent {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var ev wsEvent
+	require.NoError(t, conn.ReadJSON(&ev))
+	return ev
+}
+
+func TestRealtime_EventsPresenceAndTyping(t *testing.T) {
+	// Les utilisateurs 1 et 2 ont déjà échangé des messages
+	contacts := map[uint][]uint{1: {2}, 2: {1}}
+	hub := realtime.NewHub(realtime.NewLocal(), func(userID uint) ([]uint, error) { return contacts[userID], nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	time.Sleep(30 * time.Millisecond) // abonnement du hub au PubSub
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.GetHeader("X-User"))
+		c.Set("user_id", id)
+		c.Set("session_id", "session")
+	})
+	realtime.NewHandler(hub, func(string) bool { return true }).RegisterRoutes(api)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	dial := func(userID int) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/realtime"
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User": {strconv.Itoa(userID)}})
+		require.NoError(t, err)
+		return conn
+	}
+
+	// Une requête HTTP classique est refusée
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/realtime", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	bob := dial(2)
+	defer bob.Close()
+	alice := dial(1)
+	defer alice.Close()
+
+	// Alice reçoit l'état de ses contacts déjà connectés, Bob est prévenu de son arrivée
+	ev := readEvent(t, alice)
+	assert.Equal(t, realtime.TypePresence, ev.Type)
+	assert.Equal(t, uint(2), ev.From)
+	assert.JSONEq(t, `{"online":true}`, string(ev.Data))
+	ev = readEvent(t, bob)
+	assert.Equal(t, realtime.TypePresence, ev.Type)
+	assert.Equal(t, uint(1), ev.From)
+	assert.True(t, hub.Online(1))
+
+	// Indicateur de saisie relayé au destinataire, répétition ignorée
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "typing", "to": 2}))
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "typing", "to": 2}))
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "typing", "to": 2, "active": false}))
+	ev = readEvent(t, bob)
+	assert.Equal(t, realtime.TypeTyping, ev.Type)
+	assert.JSONEq(t, `{"active":true}`, string(ev.Data))
+	ev = readEvent(t, bob)
+	assert.JSONEq(t, `{"active":false}`, string(ev.Data))
+
+	// Message invalide : erreur renvoyée à l'émetteur seulement
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "unknown"}))
+	assert.Equal(t, realtime.TypeError, readEvent(t, alice).Type)
+
+	// Événement de messagerie poussé aux deux participants
+	msg, err := realtime.NewEvent(realtime.TypeMessageCreated, 1, map[string]interface{}{"id": 7, "content": "Salut"})
+	require.NoError(t, err)
+	require.NoError(t, hub.Publish(ctx, []uint{1, 2}, msg))
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		ev = readEvent(t, conn)
+		assert.Equal(t, realtime.TypeMessageCreated, ev.Type)
+		assert.JSONEq(t, `{"id":7,"content":"Salut"}`, string(ev.Data))
+	}
+
+	// Déconnexion d'Alice : Bob la voit hors ligne
+	alice.Close()
+	ev = readEvent(t, bob)
+	assert.Equal(t, realtime.TypePresence, ev.Type)
+	assert.JSONEq(t, `{"online":false}`, string(ev.Data))
+	assert.False(t, hub.Online(1))
+}
@@ -0,0 +1,115 @@
+package unit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLocalStorage(t *testing.T) *storage.Local {
+	blobs, err := storage.NewLocal(t.TempDir(), "http://localhost:8080", []byte("test-secret"))
+	require.NoError(t, err)
+	return blobs
+}
+
+// localClaimer : media.Claimer sans base (dépôt immédiat), qui retient les réservations abandonnées
+type localClaimer struct {
+	blobs     storage.Blob
+	next      uint
+	abandoned []uint
+}
+
+func (c *localClaimer) Promote(ctx context.Context, tmpKey, key string) (uint, error) {
+	if err := storage.Promote(ctx, c.blobs, tmpKey, key); err != nil {
+		return 0, err
+	}
+	c.next++
+	return c.next, nil
+}
+
+func (c *localClaimer) Done(claimIDs ...uint) {}
+
+func (c *localClaimer) Abandon(claimIDs ...uint) { c.abandoned = append(c.abandoned, claimIDs...) }
+
+func TestLocalStorage_PutGetStatDelete(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+
+	n, err := blobs.Put(ctx, "images/a.txt", strings.NewReader("bonjour"), 7, "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+
+	info, err := blobs.Stat(ctx, "images/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), info.Size)
+
+	r, err := blobs.Get(ctx, "images/a.txt")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "bonjour", string(data))
+
+	var keys []string
+	require.NoError(t, blobs.List(ctx, "images/", func(o storage.ObjectInfo) error {
+		keys = append(keys, o.Key)
+		return nil
+	}))
+	assert.Equal(t, []string{"images/a.txt"}, keys)
+
+	require.NoError(t, blobs.Delete(ctx, "images/a.txt"))
+	require.NoError(t, blobs.Delete(ctx, "images/a.txt"))
+	_, err = blobs.Stat(ctx, "images/a.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestLocalStorage_RejectsInvalidKeys(t *testing.T) {
+	blobs := newLocalStorage(t)
+	for _, key := range []string{"", "/etc/passwd", "../secret", "images/../../x", "a//b"} {
+		_, err := blobs.Put(context.Background(), key, strings.NewReader("x"), 1, "")
+		assert.ErrorIs(t, err, storage.ErrInvalidKey, key)
+	}
+}
+
+func TestLocalStorage_SignedURL(t *testing.T) {
+	ctx := context.Background()
+	blobs := newLocalStorage(t)
+	_, err := blobs.Put(ctx, "documents/cours.txt", strings.NewReader("contenu"), -1, "")
+	require.NoError(t, err)
+
+	signed, err := blobs.SignedURL(ctx, "documents/cours.txt", time.Minute)
+	require.NoError(t, err)
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/files/documents/cours.txt", u.Path)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		blobs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := serve(u.RequestURI())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "contenu", w.Body.String())
+
+	// Signature pour une autre clé
+	w = serve(strings.Replace(u.RequestURI(), "cours.txt", "autre.txt", 1))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Lien expiré
+	expired, err := blobs.SignedURL(ctx, "documents/cours.txt", -time.Minute)
+	require.NoError(t, err)
+	u, _ = url.Parse(expired)
+	w = serve(u.RequestURI())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
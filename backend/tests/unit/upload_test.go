@@ -0,0 +1,271 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"backend/internal/media"
+	"backend/internal/storage"
+	"backend/internal/upload"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Repository en mémoire ---
+
+type memoryUploadRepository struct {
+	uploads map[string]upload.Upload
+	chunks  map[string][]upload.Chunk
+	media   map[uint]media.Media
+	nextID  uint
+}
+
+func newMemoryUploadRepository() *memoryUploadRepository {
+	return &memoryUploadRepository{
+		uploads: map[string]upload.Upload{},
+		chunks:  map[string][]upload.Chunk{},
+		media:   map[uint]media.Media{},
+	}
+}
+
+func (r *memoryUploadRepository) Create(u *upload.Upload) error {
+	r.uploads[u.ID] = *u
+	return nil
+}
+
+func (r *memoryUploadRepository) GetByID(id string) (*upload.Upload, error) {
+	u, ok := r.uploads[id]
+	if !ok {
+		return nil, upload.ErrUploadNotFound
+	}
+	return &u, nil
+}
+
+func (r *memoryUploadRepository) AppendChunk(u *upload.Upload, chunk *upload.Chunk) error {
+	stored := r.uploads[u.ID]
+	if stored.Received != chunk.Position {
+		return upload.ErrOffsetConflict
+	}
+	stored.Received += chunk.Size
+	r.uploads[u.ID] = stored
+	r.chunks[u.ID] = append(r.chunks[u.ID], *chunk)
+	u.Received = stored.Received
+	return nil
+}
+
+func (r *memoryUploadRepository) ListChunks(uploadID string) ([]upload.Chunk, error) {
+	return r.chunks[uploadID], nil
+}
+
+func (r *memoryUploadRepository) Complete(u *upload.Upload, m *media.Media, expiresAt time.Time) error {
+	r.nextID++
+	m.ID = r.nextID
+	r.media[m.ID] = *m
+	u.Status = upload.StatusCompleted
+	u.MediaID = &m.ID
+	u.ExpiresAt = expiresAt
+	r.uploads[u.ID] = *u
+	delete(r.chunks, u.ID)
+	return nil
+}
+
+func (r *memoryUploadRepository) Delete(id string) error {
+	delete(r.uploads, id)
+	delete(r.chunks, id)
+	return nil
+}
+
+func (r *memoryUploadRepository) ListExpired(now time.Time, limit int) ([]upload.Upload, error) {
+	var expired []upload.Upload
+	for _, u := range r.uploads {
+		if u.ExpiresAt.Before(now) && len(expired) < limit {
+			expired = append(expired, u)
+		}
+	}
+	return expired, nil
+}
+
+func (r *memoryUploadRepository) DeleteUnattachedMedia(mediaID uint) error {
+	if m, ok := r.media[mediaID]; ok && m.PostID == 0 {
+		delete(r.media, mediaID)
+	}
+	return nil
+}
+
+func setupUploads(t *testing.T, expiry time.Duration) (upload.Service, *memoryUploadRepository, *storage.Local) {
+	repo := newMemoryUploadRepository()
+	blobs := newLocalStorage(t)
+	return upload.NewService(repo, blobs, &localClaimer{blobs: blobs}, expiry), repo, blobs
+}
+
+func countObjects(t *testing.T, blobs storage.Blob, prefix string) int {
+	n := 0
+	require.NoError(t, blobs.List(context.Background(), prefix, func(storage.ObjectInfo) error {
+		n++
+		return nil
+	}))
+	return n
+}
+
+// --- Tests ---
+
+func TestUpload_ResumableFlow(t *testing.T) {
+	ctx := context.Background()
+	service, repo, blobs := setupUploads(t, time.Hour)
+	// En-tête MP4 (boîte ftyp) : le contenu assemblé est contrôlé comme un envoi direct
+	data := append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), bytes.Repeat([]byte("0123456789"), 100)...)[:1000]
+	sum := sha256.Sum256(data)
+
+	dto, err := service.Init(1, upload.InitInput{FileName: "cours.mp4", Size: int64(len(data))})
+	require.NoError(t, err)
+	assert.Equal(t, "video", dto.MediaType)
+
+	offset, err := service.AppendChunk(ctx, 1, dto.ID, 0, bytes.NewReader(data[:400]), 400)
+	require.NoError(t, err)
+	assert.Equal(t, int64(400), offset)
+
+	// Reprise avec un mauvais offset : le serveur indique où reprendre
+	offset, err = service.AppendChunk(ctx, 1, dto.ID, 0, bytes.NewReader(data[:400]), 400)
+	assert.ErrorIs(t, err, upload.ErrOffsetConflict)
+	assert.Equal(t, int64(400), offset)
+
+	// Un autre utilisateur ne voit pas l'upload
+	_, err = service.Get(2, dto.ID)
+	assert.ErrorIs(t, err, upload.ErrUploadNotFound)
+
+	_, err = service.Complete(ctx, 1, dto.ID, upload.CompleteInput{Checksum: hex.EncodeToString(sum[:])})
+	assert.ErrorIs(t, err, upload.ErrUploadIncomplete)
+
+	_, err = service.AppendChunk(ctx, 1, dto.ID, 400, bytes.NewReader(data[400:]), int64(len(data)-400))
+	require.NoError(t, err)
+
+	done, err := service.Complete(ctx, 1, dto.ID, upload.CompleteInput{Checksum: hex.EncodeToString(sum[:])})
+	require.NoError(t, err)
+	require.NotNil(t, done.MediaID)
+
+	m := repo.media[*done.MediaID]
+	assert.Equal(t, uint(1), m.OwnerID)
+	assert.Equal(t, int64(len(data)), m.FileSize)
+	rc, err := blobs.Get(ctx, m.MediaURL)
+	require.NoError(t, err)
+	assembled, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, data, assembled)
+	assert.Equal(t, 0, countObjects(t, blobs, "staging/"))
+	assert.Equal(t, 0, countObjects(t, blobs, upload.ChunkPrefix))
+
+	// Complétion idempotente
+	again, err := service.Complete(ctx, 1, dto.ID, upload.CompleteInput{})
+	require.NoError(t, err)
+	assert.Equal(t, *done.MediaID, *again.MediaID)
+}
+
+func TestUpload_ChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	service, repo, blobs := setupUploads(t, time.Hour)
+
+	dto, err := service.Init(1, upload.InitInput{FileName: "notes.pdf", Size: 5})
+	require.NoError(t, err)
+	_, err = service.AppendChunk(ctx, 1, dto.ID, 0, bytes.NewReader([]byte("hello")), 5)
+	require.NoError(t, err)
+
+	_, err = service.Complete(ctx, 1, dto.ID, upload.CompleteInput{})
+	assert.ErrorIs(t, err, upload.ErrChecksumRequired)
+
+	wrong := sha256.Sum256([]byte("autre chose"))
+	_, err = service.Complete(ctx, 1, dto.ID, upload.CompleteInput{Checksum: hex.EncodeToString(wrong[:])})
+	assert.ErrorIs(t, err, upload.ErrChecksumMismatch)
+	assert.Empty(t, repo.media)
+	assert.Equal(t, 0, countObjects(t, blobs, "documents/"))
+}
+
+func TestUpload_SameContentIsStoredOnce(t *testing.T) {
+	ctx := context.Background()
+	service, repo, blobs := setupUploads(t, time.Hour)
+	data := []byte("%PDF-1.4 polycopié de cours")
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	var keys []string
+	for userID := uint(1); userID <= 2; userID++ {
+		dto, err := service.Init(userID, upload.InitInput{FileName: "cours.pdf", Size: int64(len(data)), Checksum: checksum})
+		require.NoError(t, err)
+		_, err = service.AppendChunk(ctx, userID, dto.ID, 0, bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		done, err := service.Complete(ctx, userID, dto.ID, upload.CompleteInput{})
+		require.NoError(t, err)
+		m := repo.media[*done.MediaID]
+		assert.Equal(t, checksum, m.ContentHash)
+		keys = append(keys, m.MediaURL)
+	}
+
+	assert.Equal(t, "documents/"+checksum[:2]+"/"+checksum+".pdf", keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, 1, countObjects(t, blobs, "documents/"))
+	assert.Equal(t, 0, countObjects(t, blobs, "staging/"))
+}
+
+func TestUpload_RejectsInvalidFiles(t *testing.T) {
+	service, _, _ := setupUploads(t, time.Hour)
+
+	_, err := service.Init(1, upload.InitInput{FileName: "script.exe", Size: 10})
+	assert.ErrorIs(t, err, upload.ErrInvalidUploadSpec)
+
+	_, err = service.Init(1, upload.InitInput{FileName: "film.mp4", Size: 3 << 30})
+	assert.ErrorIs(t, err, upload.ErrInvalidUploadSpec)
+
+	// Mêmes limites que l'envoi direct : 10 MB par image, 10 MB par PDF, 20 MB par document
+	_, err = service.Init(1, upload.InitInput{FileName: "photo.png", Size: 11 << 20})
+	assert.ErrorIs(t, err, upload.ErrInvalidUploadSpec)
+	_, err = service.Init(1, upload.InitInput{FileName: "cours.pdf", Size: 11 << 20})
+	assert.ErrorIs(t, err, upload.ErrInvalidUploadSpec)
+	_, err = service.Init(1, upload.InitInput{FileName: "cours.docx", Size: 15 << 20})
+	assert.NoError(t, err)
+}
+
+func TestUpload_RejectsDisguisedContent(t *testing.T) {
+	ctx := context.Background()
+	service, repo, blobs := setupUploads(t, time.Hour)
+	// Exécutable Windows renommé en PDF
+	data := append([]byte("MZ\x90\x00"), make([]byte, 60)...)
+	sum := sha256.Sum256(data)
+
+	dto, err := service.Init(1, upload.InitInput{FileName: "cours.pdf", Size: int64(len(data))})
+	require.NoError(t, err)
+	_, err = service.AppendChunk(ctx, 1, dto.ID, 0, bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	_, err = service.Complete(ctx, 1, dto.ID, upload.CompleteInput{Checksum: hex.EncodeToString(sum[:])})
+	assert.ErrorIs(t, err, upload.ErrInvalidUploadSpec)
+	assert.Empty(t, repo.media)
+	assert.Equal(t, 0, countObjects(t, blobs, "documents/"))
+}
+
+func TestUpload_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	service, repo, blobs := setupUploads(t, -time.Minute)
+
+	dto, err := service.Init(1, upload.InitInput{FileName: "photo.png", Size: 10})
+	require.NoError(t, err)
+
+	// Upload expiré : plus de fragment accepté
+	_, err = service.AppendChunk(ctx, 1, dto.ID, 0, bytes.NewReader(make([]byte, 10)), 10)
+	assert.ErrorIs(t, err, upload.ErrUploadExpired)
+
+	// Fragment déjà stocké avant expiration
+	_, err = blobs.Put(ctx, upload.ChunkPrefix+dto.ID+"/0", bytes.NewReader(make([]byte, 4)), 4, "")
+	require.NoError(t, err)
+	repo.chunks[dto.ID] = []upload.Chunk{{UploadID: dto.ID, Position: 0, Size: 4, StorageKey: upload.ChunkPrefix + dto.ID + "/0"}}
+
+	n, err := service.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, repo.uploads)
+	assert.Equal(t, 0, countObjects(t, blobs, upload.ChunkPrefix))
+}